@@ -7,37 +7,40 @@ package main
 import (
 	"bufio"
 	"fmt"
-	"io"
 	"os"
 	"strconv"
 	"strings"
 
 	"github.com/kolkov/uawk"
-)
-
-// version is set by GoReleaser at build time via -ldflags.
-// For development builds, it will be "dev".
-var (
-	version = "dev"
-	commit  = "none"
-	date    = "unknown"
+	"github.com/kolkov/uawk/internal/lexer"
 )
 
 const (
-	shortUsage = "usage: uawk [-F fs] [-v var=value] [-f progfile | 'prog'] [file ...]"
+	shortUsage = "usage: uawk [-0] [-t] [-F fs] [-v var=value] [-f progfile | 'prog'] [file ...]"
 	longUsage  = `Standard AWK arguments:
   -F separator      field separator (default " ")
-  -f progfile       load AWK source from progfile (multiple allowed)
+  -f progfile       load AWK source from progfile (multiple allowed,
+                    joined in order, e.g. -f lib.awk -f main.awk)
   -v var=value      variable assignment (multiple allowed)
 
 Additional uawk features:
+  -0                NUL-delimited records: set RS and ORS to "\0"
+                    (an explicit -v RS=... or -v ORS=... takes precedence)
   -c                use Unicode chars for index, length, match, substr
-  -H                parse header row in CSV input mode
+  -H                take the first row of each input as column names in
+                    CSV or TSV input mode, for @"name" field access
+  -t, --tab         tab-separated fields: set FS and OFS to "\t"
+                    (an explicit -F or -v OFS=... takes precedence)
+  --trim            strip leading and trailing whitespace from each field
+  --count           instead of running a program, print the number of
+                    records, fields and characters in the input, like wc
+                    (uses FS and RS, so -F and -v RS=... apply)
   -i mode           input mode: csv, tsv
   -o mode           output mode: csv, tsv
 
 Performance options:
-  --posix           use POSIX leftmost-longest regex matching (default)
+  --posix           POSIX AWK: no extension functions such as hash or now,
+                    and POSIX leftmost-longest regex matching (the default)
   --no-posix        use faster leftmost-first regex matching (Perl-like)
   -j N              use N parallel workers (default: 1 = sequential)
                     parallel execution is automatic for suitable programs
@@ -47,11 +50,17 @@ Debugging arguments:
   -da               print bytecode assembly to stderr and exit
   -dt               print type information to stderr and exit
   -dp               print parallel safety analysis to stderr and exit
+  --lint            warn on stderr about likely mistakes, then run
 
 Other:
   -h, --help        show this help message
   -version          show uawk version and exit
 `
+
+	// countProgram is run by --count. Each record also counts the
+	// terminator that ended it, as wc counts the newline ending each line.
+	countProgram = `{ records++; fields += NF; chars += length($0) + length(RT) }
+END { print records + 0, fields + 0, chars + 0 }`
 )
 
 //nolint:gocyclo,funlen // CLI argument parsing is inherently complex
@@ -62,15 +71,22 @@ func main() {
 	var progFiles []string
 	var vars []string
 	fieldSep := " "
+	fieldSepSet := false
+	tabFields := false
+	trimFields := false
+	countMode := false
 	inputMode := ""
 	outputMode := ""
 	header := false
+	nulRecords := false
 	useChars := false
 	debug := false
 	debugAsm := false
 	debugTypes := false
 	debugParallel := false
+	lint := false
 	var posixRegex *bool // nil = default (true), explicit true/false from flags
+	posix := false       // --posix: compile without extension functions
 	parallelWorkers := 1 // Default: sequential execution
 
 	var i int
@@ -92,6 +108,7 @@ func main() {
 			}
 			i++
 			fieldSep = os.Args[i]
+			fieldSepSet = true
 		case "-f":
 			if i+1 >= len(os.Args) {
 				errorExitf("flag needs an argument: -f")
@@ -116,6 +133,14 @@ func main() {
 			}
 			i++
 			outputMode = os.Args[i]
+		case "-0":
+			nulRecords = true
+		case "-t", "--tab":
+			tabFields = true
+		case "--trim":
+			trimFields = true
+		case "--count":
+			countMode = true
 		case "-c":
 			useChars = true
 		case "-d":
@@ -126,6 +151,8 @@ func main() {
 			debugTypes = true
 		case "-dp":
 			debugParallel = true
+		case "--lint":
+			lint = true
 		case "-j":
 			if i+1 >= len(os.Args) {
 				errorExitf("flag needs an argument: -j")
@@ -141,23 +168,28 @@ func main() {
 		case "--posix":
 			t := true
 			posixRegex = &t
+			posix = true
 		case "--no-posix":
 			f := false
 			posixRegex = &f
+			posix = false
 		case "-h", "--help":
+			version, _, _ := uawk.BuildInfo()
 			fmt.Printf("uawk %s - Ultra AWK Interpreter\n\n%s\n\n%s", version, shortUsage, longUsage)
 			os.Exit(0)
 		case "-version", "--version":
+			version, commit, date := uawk.BuildInfo()
 			fmt.Printf("uawk version %s\n", version)
 			fmt.Printf("  commit: %s\n", commit)
 			fmt.Printf("  built:  %s\n", date)
-			fmt.Println("  regex:  coregex")
+			fmt.Printf("  regex:  %s\n", uawk.RegexEngine())
 			os.Exit(0)
 		default:
 			// Handle flags with no space: -F:, -ffile, -vvar=val, -j4, etc.
 			switch {
 			case strings.HasPrefix(arg, "-F"):
 				fieldSep = arg[2:]
+				fieldSepSet = true
 			case strings.HasPrefix(arg, "-f"):
 				progFiles = append(progFiles, arg[2:])
 			case strings.HasPrefix(arg, "-i"):
@@ -185,8 +217,16 @@ func main() {
 	var program string
 	var inputFiles []string
 
-	if len(progFiles) > 0 {
-		// Read program from files
+	if countMode {
+		if len(progFiles) > 0 {
+			errorExitf("--count cannot be used with -f")
+		}
+		program = countProgram
+		inputFiles = args
+	} else if len(progFiles) > 0 {
+		// Read program from files, in command-line order. Each file is
+		// ended with a newline, so a library whose last line lacks one
+		// (or is a comment) can't run into the next file's first rule.
 		var sb strings.Builder
 		for _, f := range progFiles {
 			content, err := os.ReadFile(f)
@@ -207,11 +247,18 @@ func main() {
 	}
 
 	// Compile program
-	prog, err := uawk.Compile(program)
+	prog, err := uawk.CompileWithConfig(program, &uawk.Config{POSIX: posix})
 	if err != nil {
 		errorExit(err)
 	}
 
+	if lint {
+		warnings, _ := uawk.Lint(program)
+		for _, w := range warnings {
+			fmt.Fprintf(os.Stderr, "uawk: %s\n", w)
+		}
+	}
+
 	// Debug output modes
 	if debug {
 		// TODO: Print AST when available
@@ -244,7 +291,6 @@ func main() {
 
 	// Build configuration with buffered output for performance
 	stdout := bufio.NewWriter(os.Stdout)
-	defer stdout.Flush()
 
 	config := &uawk.Config{
 		FS:         fieldSep,
@@ -252,9 +298,26 @@ func main() {
 		Stderr:     os.Stderr,
 		POSIXRegex: posixRegex,
 		Parallel:   parallelWorkers,
+		Chars:      useChars,
+		TrimFields: trimFields,
+		InputMode:  inputMode,
+		Header:     header,
+		OutputMode: outputMode,
+	}
+	if nulRecords {
+		config.RS = "\x00"
+		config.ORS = "\x00"
+	}
+	if tabFields {
+		if !fieldSepSet {
+			config.FS = "\t"
+		}
+		config.OFS = "\t"
 	}
 
-	// Parse variable assignments
+	// Parse variable assignments (values get string escape processing,
+	// so -v RS='\0' yields a NUL record separator). They are applied after
+	// RS and ORS, so an explicit -v RS=... overrides -0.
 	if len(vars) > 0 {
 		config.Variables = make(map[string]string)
 		for _, v := range vars {
@@ -262,38 +325,18 @@ func main() {
 			if len(parts) != 2 {
 				errorExitf("invalid variable assignment: %s (expected var=value)", v)
 			}
-			config.Variables[parts[0]] = parts[1]
+			config.Variables[parts[0]] = lexer.Unescape(parts[1])
 		}
 	}
 
-	// Set ARGV
+	// Set ARGV; input files are opened by the VM as it walks ARGV,
+	// falling back to stdin when there are no file operands
 	config.Args = append([]string{"uawk"}, inputFiles...)
 
-	// Determine input source
-	var input io.Reader
-	if len(inputFiles) == 0 {
-		// Read from stdin
-		input = os.Stdin
-	} else {
-		// Concatenate all input files
-		readers := make([]io.Reader, 0, len(inputFiles))
-		for _, f := range inputFiles {
-			if f == "-" {
-				readers = append(readers, os.Stdin)
-			} else {
-				file, err := os.Open(f)
-				if err != nil {
-					errorExitf("cannot open file %s: %v", f, err)
-				}
-				defer file.Close()
-				readers = append(readers, file)
-			}
-		}
-		input = io.MultiReader(readers...)
-	}
-
 	// Execute program
-	_, err = prog.Run(input, config)
+	_, err = prog.Run(os.Stdin, config)
+	// Flush before any os.Exit below, which skips deferred calls
+	stdout.Flush()
 	if err != nil {
 		// Check if it's a normal exit with non-zero code
 		if code, ok := uawk.IsExitError(err); ok {
@@ -301,12 +344,6 @@ func main() {
 		}
 		errorExit(err)
 	}
-
-	// Suppress unused variable warnings (future features)
-	_ = inputMode
-	_ = outputMode
-	_ = header
-	_ = useChars
 }
 
 // errorExitf prints formatted error message and exits with code 1
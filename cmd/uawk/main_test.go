@@ -0,0 +1,347 @@
+package main
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestMain re-executes the test binary as the uawk command when
+// UAWK_TEST_MAIN is set, so tests can drive the real CLI.
+func TestMain(m *testing.M) {
+	if os.Getenv("UAWK_TEST_MAIN") == "1" {
+		main()
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// runCLI runs uawk with args and stdin, returning its standard output.
+func runCLI(t *testing.T, stdin string, args ...string) string {
+	t.Helper()
+	cmd := exec.Command(os.Args[0], args...)
+	cmd.Env = append(os.Environ(), "UAWK_TEST_MAIN=1")
+	cmd.Stdin = strings.NewReader(stdin)
+	var stderr strings.Builder
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		t.Fatalf("uawk %q: %v\n%s", args, err, stderr.String())
+	}
+	return string(out)
+}
+
+func TestPosixFlag(t *testing.T) {
+	prog := `function hash(a, s) { return "user " a } BEGIN { print hash("md5", "") }`
+	got := runCLI(t, "", "--posix", prog)
+	if want := "user md5\n"; got != want {
+		t.Errorf("output = %q, want %q", got, want)
+	}
+
+	cmd := exec.Command(os.Args[0], "--posix", `BEGIN { print hash("sha256", "abc") }`)
+	cmd.Env = append(os.Environ(), "UAWK_TEST_MAIN=1")
+	out, err := cmd.CombinedOutput()
+	if err == nil || !strings.Contains(string(out), `undefined function "hash"`) {
+		t.Errorf("uawk --posix calling hash: %v, output %q, want an undefined function error", err, out)
+	}
+}
+
+func TestTrimFlag(t *testing.T) {
+	got := runCLI(t, "  a , b  ,c\n", "--trim", "-F,", `{ print "[" $1 "][" $2 "][" $3 "]" }`)
+	if want := "[a][b][c]\n"; got != want {
+		t.Errorf("output = %q, want %q", got, want)
+	}
+}
+
+func TestSystemOutputOrder(t *testing.T) {
+	got := runCLI(t, "1\n2\n", `{ print "a" $1; system("echo b" $1); print "c" $1 }`)
+	if want := "a1\nb1\nc1\na2\nb2\nc2\n"; got != want {
+		t.Errorf("output = %q, want %q", got, want)
+	}
+}
+
+// TestFflushStreamsOutput checks that fflush() pushes output out while
+// uawk is still waiting for more input, as when piping into tail -f.
+func TestFflushStreamsOutput(t *testing.T) {
+	for _, prog := range []string{
+		`{ print "got " $0; fflush() }`,
+		`{ print "got " $0; fflush("/dev/stdout") }`,
+	} {
+		t.Run(prog, func(t *testing.T) {
+			cmd := exec.Command(os.Args[0], prog)
+			cmd.Env = append(os.Environ(), "UAWK_TEST_MAIN=1")
+			stdin, err := cmd.StdinPipe()
+			if err != nil {
+				t.Fatal(err)
+			}
+			stdout, err := cmd.StdoutPipe()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := cmd.Start(); err != nil {
+				t.Fatal(err)
+			}
+			defer cmd.Wait()
+			defer stdin.Close()
+
+			if _, err := io.WriteString(stdin, "one\n"); err != nil {
+				t.Fatal(err)
+			}
+			line := make(chan string, 1)
+			go func() {
+				s, _ := bufio.NewReader(stdout).ReadString('\n')
+				line <- s
+			}()
+			select {
+			case got := <-line:
+				if got != "got one\n" {
+					t.Errorf("output = %q, want %q", got, "got one\n")
+				}
+			case <-time.After(5 * time.Second):
+				cmd.Process.Kill()
+				t.Fatal("no output before end of input")
+			}
+		})
+	}
+}
+
+func TestInputModeFlag(t *testing.T) {
+	in := "name,\"a,b\",\"line1\nline2\"\n"
+	for _, args := range [][]string{{"-i", "csv"}, {"-icsv"}} {
+		got := runCLI(t, in, append(args, `{ print NF; print $3 }`)...)
+		if want := "3\nline1\nline2\n"; got != want {
+			t.Errorf("uawk %q: output = %q, want %q", args, got, want)
+		}
+	}
+}
+
+func TestOutputModeFlag(t *testing.T) {
+	got := runCLI(t, "", "-o", "csv", `BEGIN { print "a,b", "c" }`)
+	if want := "\"a,b\",c\n"; got != want {
+		t.Errorf("output = %q, want %q", got, want)
+	}
+}
+
+func TestHeaderFlag(t *testing.T) {
+	dir := t.TempDir()
+	first := filepath.Join(dir, "first.csv")
+	second := filepath.Join(dir, "second.csv")
+	if err := os.WriteFile(first, []byte("id,value\n7,42\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(second, []byte("value,id\n5,8\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	// Each file has its own header row
+	got := runCLI(t, "", "-i", "csv", "-H", `{ print NR, @"id", @"value" }`, first, second)
+	if want := "1 7 42\n2 8 5\n"; got != want {
+		t.Errorf("output = %q, want %q", got, want)
+	}
+}
+
+func TestCountFlag(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "in.txt")
+	if err := os.WriteFile(file, []byte("one two\nthree\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		args  []string
+		input string
+		want  string
+	}{
+		{"stdin", []string{"--count"}, "a b\nc d e\n", "2 5 10\n"},
+		{"empty", []string{"--count"}, "", "0 0 0\n"},
+		{"custom FS", []string{"--count", "-F,"}, "a,b\nc d,e\n", "2 4 10\n"},
+		{"custom RS", []string{"--count", "-v", "RS=;"}, "a b;c", "2 3 5\n"},
+		{"multi-char RS", []string{"--count", "-v", "RS=;;"}, "a;;b;;", "2 2 6\n"},
+		{"no final newline", []string{"--count"}, "a b\nc", "2 3 5\n"},
+		{"files", []string{"--count", file, file}, "", "4 6 28\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := runCLI(t, tt.input, tt.args...); got != tt.want {
+				t.Errorf("output = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNulFlag(t *testing.T) {
+	tests := []struct {
+		name  string
+		args  []string
+		input string
+		want  string
+	}{
+		{
+			name:  "nul in and out",
+			args:  []string{"-0", `{ print NR ":" $0 }`},
+			input: "a b\x00c\nd\x00",
+			want:  "1:a b\x002:c\nd\x00",
+		},
+		{
+			name:  "explicit RS wins",
+			args:  []string{"-0", "-v", "RS=,", `{ print $0 }`},
+			input: "x,y",
+			want:  "x\x00y\x00",
+		},
+		{
+			name:  "explicit ORS wins",
+			args:  []string{"-0", "-v", "ORS=|", `{ print $0 }`},
+			input: "x\x00y\x00",
+			want:  "x|y|",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := runCLI(t, tt.input, tt.args...); got != tt.want {
+				t.Errorf("output = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTabFlag(t *testing.T) {
+	tests := []struct {
+		name  string
+		args  []string
+		input string
+		want  string
+	}{
+		{
+			name:  "split and join",
+			args:  []string{"-t", `{ print $2, $1; print NF }`},
+			input: "a b\tc d\n",
+			want:  "c d\ta b\n2\n",
+		},
+		{
+			name:  "long form",
+			args:  []string{"--tab", `{ $1 = $1; print }`},
+			input: "x\t\ty\n",
+			want:  "x\t\ty\n",
+		},
+		{
+			name:  "explicit FS wins",
+			args:  []string{"-F,", "-t", `{ print $1, $2 }`},
+			input: "a,b\tc\n",
+			want:  "a\tb\tc\n",
+		},
+		{
+			name:  "explicit OFS wins",
+			args:  []string{"-t", "-v", "OFS=|", `{ print $1, $2 }`},
+			input: "a\tb\n",
+			want:  "a|b\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := runCLI(t, tt.input, tt.args...); got != tt.want {
+				t.Errorf("output = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestProgFiles(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	// No trailing newlines: files must not run together
+	lib := write("lib.awk", "function double(x) { return x * 2 }")
+	lib2 := write("lib2.awk", "function inc(x) {\n\treturn x + 1\n} # trailing comment")
+	main := write("main.awk", "{ print double($1), inc($1) }")
+	begin := write("begin.awk", "BEGIN { printf \"start \" }")
+
+	tests := []struct {
+		name string
+		args []string
+		want string
+	}{
+		{"library then rules", []string{"-f", lib, "-f", lib2, "-f", main}, "6 4\n"},
+		{"rules then library", []string{"-f", main, "-f", lib2, "-f", lib}, "6 4\n"},
+		{"attached flag", []string{"-f" + lib, "-f" + lib2, "-f" + main}, "6 4\n"},
+		{"rules in order", []string{"-f", begin, "-f", lib, "-f", lib2, "-f", main}, "start 6 4\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := runCLI(t, "3\n", tt.args...); got != tt.want {
+				t.Errorf("output = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestInputFiles(t *testing.T) {
+	dir := t.TempDir()
+	one, two := filepath.Join(dir, "one"), filepath.Join(dir, "two")
+	if err := os.WriteFile(one, []byte("a\nb\nc\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(two, []byte("d\ne\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	got := runCLI(t, "in\n", `{ print FILENAME, FNR, NR }`, one, "-", two)
+	want := one + " 1 1\n" + one + " 2 2\n" + one + " 3 3\n- 1 4\n" + two + " 1 5\n" + two + " 2 6\n"
+	if got != want {
+		t.Errorf("output = %q, want %q", got, want)
+	}
+
+	got = runCLI(t, "", `FNR == 2 { nextfile } { print FILENAME, FNR, NR }`, one, two)
+	want = one + " 1 1\n" + two + " 1 3\n"
+	if got != want {
+		t.Errorf("nextfile output = %q, want %q", got, want)
+	}
+}
+
+func TestVersionFlag(t *testing.T) {
+	got := runCLI(t, "", "--version")
+	for _, want := range []string{"uawk version dev\n", "  commit: none\n", "  regex:  coregex"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("--version output %q missing %q", got, want)
+		}
+	}
+}
+
+func TestExitFlushesOutput(t *testing.T) {
+	cmd := exec.Command(os.Args[0], `BEGIN { print "before exit"; exit 3 }`)
+	cmd.Env = append(os.Environ(), "UAWK_TEST_MAIN=1")
+	out, err := cmd.Output()
+	exitErr, ok := err.(*exec.ExitError)
+	if !ok || exitErr.ExitCode() != 3 {
+		t.Fatalf("uawk error = %v, want exit status 3", err)
+	}
+	if string(out) != "before exit\n" {
+		t.Errorf("output = %q, want %q", out, "before exit\n")
+	}
+}
+
+func TestBareExitInEndKeepsStatus(t *testing.T) {
+	cmd := exec.Command(os.Args[0], `NR == 1 { exit 3 } END { print "cleanup"; exit }`)
+	cmd.Env = append(os.Environ(), "UAWK_TEST_MAIN=1")
+	cmd.Stdin = strings.NewReader("a\nb\n")
+	out, err := cmd.Output()
+	exitErr, ok := err.(*exec.ExitError)
+	if !ok || exitErr.ExitCode() != 3 {
+		t.Fatalf("uawk error = %v, want exit status 3", err)
+	}
+	if string(out) != "cleanup\n" {
+		t.Errorf("output = %q, want %q", out, "cleanup\n")
+	}
+}
@@ -1,6 +1,11 @@
 package uawk
 
-import "io"
+import (
+	"io"
+	"maps"
+	"slices"
+	"time"
+)
 
 // Config holds configuration options for AWK execution.
 type Config struct {
@@ -27,18 +32,43 @@ type Config struct {
 	// Example: map[string]string{"threshold": "100", "prefix": "LOG:"}
 	Variables map[string]string
 
-	// Output is the writer for print/printf statements.
+	// Arrays contains pre-defined global arrays, such as lookup tables,
+	// keyed by array name and then by subscript. They are filled before
+	// BEGIN runs, with numeric-string values like input fields. Names the
+	// program doesn't use as arrays are ignored. Programs given arrays run
+	// sequentially, ignoring Parallel.
+	// Example: map[string]map[string]string{"limit": {"alice": "10", "bob": "3"}}
+	Arrays map[string]map[string]string
+
+	// Output is the writer for print/printf statements, including
+	// print > "/dev/stdout".
 	// If nil, output is captured and returned from Run.
 	Output io.Writer
 
-	// Stderr is the writer for error output.
+	// Stderr is the writer for error output, including
+	// print > "/dev/stderr".
 	// If nil, errors are discarded.
 	Stderr io.Writer
 
+	// Environ, if non-nil, replaces the process environment as the
+	// contents of ENVIRON; os.Environ() is then never read. It does not
+	// change the environment of commands run by system() or pipes.
+	Environ map[string]string
+
 	// Args contains command-line arguments (ARGV).
-	// Args[0] is typically the program name.
+	// Args[0] is typically the program name. As in AWK, the remaining
+	// entries are input files read in order (var=value entries are
+	// assignments and "-" is the input reader); the input reader is used
+	// only when there are no file operands. The program may change which
+	// files are read by modifying ARGV and ARGC in BEGIN.
 	Args []string
 
+	// Inputs are named input streams, read in order as if they were files:
+	// FILENAME is set to each Name and FNR restarts for each stream.
+	// They are read before the input passed to Run, and only when Args
+	// contains no file operands.
+	Inputs []NamedReader
+
 	// POSIXRegex enables POSIX leftmost-longest regex matching.
 	// When true (default), uses AWK/POSIX ERE semantics (slower but compliant).
 	// When false, uses leftmost-first matching (faster, Perl-like).
@@ -54,6 +84,147 @@ type Config struct {
 	// ChunkSize is the approximate size in bytes of each input chunk
 	// when parallel execution is enabled. Default: 4MB (4 * 1024 * 1024).
 	ChunkSize int
+
+	// PreserveDelimiters keeps the input's own delimiters on output.
+	// When a field is modified, $0 is rebuilt with the separators that
+	// surrounded the fields in the input (OFS is only used for new fields),
+	// and printing the record to standard output ends it with its original
+	// terminator instead of ORS; other output still ends with ORS.
+	// Useful for edit-in-place scripts that should only change what they touch.
+	PreserveDelimiters bool
+
+	// Now returns the current time for time builtins such as now(), systime()
+	// and strftime(), and for the default seeds of rand() and srand().
+	// If nil, time.Now is used. Set it to a fixed clock for reproducible output.
+	Now func() time.Time
+
+	// MaxOutputFiles limits how many files opened by print > or >> stay
+	// open at once (default: 512). Past the limit the least recently used
+	// file is closed and reopened for append when written again, so programs
+	// such as print > ("out" NR) don't run out of file descriptors.
+	// A negative value removes the limit.
+	MaxOutputFiles int
+
+	// MaxSlurpSize limits the size in bytes of a file read by slurp()
+	// (default: 64 MiB). Larger files yield "" and set ERRNO.
+	// A negative value removes the limit.
+	MaxSlurpSize int64
+
+	// Chars makes length, index, match (RSTART and RLENGTH) and substr
+	// count characters (UTF-8 runes) instead of bytes, and printf's %c
+	// write a character rather than a byte, as the -c flag does.
+	Chars bool
+
+	// SubsepSafe escapes SUBSEP inside the parts of multi-dimensional array
+	// keys, so arr[$1, $2] stays distinct for every pair of values even
+	// when the data contains SUBSEP ("\034" by default). Keys without SUBSEP
+	// or "\035" in their parts are unchanged; others start with "\035", and
+	// split(key, parts, SUBSEP) recovers their original parts.
+	SubsepSafe bool
+
+	// ThousandsSep, if set, groups the digits of integer-valued numbers
+	// output by print in threes, e.g. "1,234,567" with ",", for
+	// report-style output. Other numbers and strings are unchanged. It is
+	// also the separator used by printf's ' flag ("%'d"), which otherwise
+	// has no effect, as in the C locale.
+	ThousandsSep string
+
+	// TrimFields strips leading and trailing ASCII whitespace from each
+	// field after splitting, as the --trim flag does, for padded columns
+	// such as "a ,  b". $0 keeps its padding unless a field is assigned,
+	// which rebuilds it from the trimmed fields.
+	TrimFields bool
+
+	// SqueezeDelimiters, with a single-character FS other than " ", treats
+	// a run of the separator as one, the way the default FS treats runs
+	// of blanks: FS=":" splits "a::b" into 2 fields, not 3, and separators
+	// at the start or end of the record are ignored. It is meant for messy
+	// data with repeated separators; split() is not affected.
+	SqueezeDelimiters bool
+
+	// EagerFields splits each record into fields as soon as it is read,
+	// instead of on the first access to a field or NF. Output is the same
+	// either way; it is meant for debugging field handling and for
+	// profiling the cost of splitting on its own.
+	EagerFields bool
+
+	// InputMode selects how input is split into records and fields: ""
+	// uses RS and FS, "csv" reads RFC 4180 CSV, where quoted fields may
+	// hold commas, doubled quotes ("") and newlines, and "tsv" reads
+	// tab-separated fields with \t, \n, \r and \\ escapes. In both modes
+	// a $0 rebuilt after a field assignment joins its fields with commas or
+	// tabs rather than OFS, quoting or escaping them, so it splits back
+	// into the same fields.
+	InputMode string
+
+	// Header, with an InputMode, takes the first record of each input as
+	// a header row of column names instead of a record (it does not count
+	// in NR or FNR), so that @"name" is the field under column name. A
+	// name missing from the header is a runtime error.
+	Header bool
+
+	// OutputMode makes print write CSV ("csv") or TSV ("tsv") records:
+	// arguments are joined with commas or tabs instead of OFS, a CSV field
+	// holding a comma, a quote or a line break is quoted with inner quotes
+	// doubled, and TSV fields are escaped as in InputMode. Records still
+	// end with ORS, and print with no arguments writes $0 unchanged.
+	OutputMode string
+
+	// ProfileFile, if set, names a file to which Run writes the program
+	// source annotated with how many times the statements and patterns on
+	// each line were executed, like gawk --profile. Profiling recompiles
+	// the program with counting instructions, so it runs slower, and
+	// always runs sequentially.
+	ProfileFile string
+
+	// RandSeed, if non-nil, is the initial seed of rand(), making its
+	// sequence reproducible without srand(). Otherwise rand() is seeded
+	// from Now when first used, so creating a VM doesn't read the clock.
+	RandSeed *int64
+
+	// StrictArity controls calls passing a user-defined function more
+	// arguments than it declares.
+	// When true (default), such a call is a compile error, as in gawk.
+	// When false, the extra arguments are evaluated and then ignored.
+	// It applies where the program is compiled: by Run, RunContext, Exec
+	// and CompileWithConfig. Compile always rejects such calls, and
+	// Program.Run ignores it.
+	StrictArity *bool
+
+	// POSIX compiles the program as POSIX AWK, without the extension
+	// builtins: names such as hash, now or gensub are plain names, and
+	// calling one calls a user-defined function. Like StrictArity, it
+	// applies where the program is compiled.
+	POSIX bool
+}
+
+// NamedReader is an input stream with the name FILENAME reports while
+// it is being read.
+type NamedReader struct {
+	Name string
+	R    io.Reader
+}
+
+// strictArity reports whether config, which may be nil, rejects extra
+// function arguments.
+func (c *Config) strictArity() bool {
+	return c == nil || c.StrictArity == nil || *c.StrictArity
+}
+
+// compileOptions are the settings of a Config that apply when a program
+// is compiled.
+type compileOptions struct {
+	strictArity bool // Config.StrictArity
+	posix       bool // Config.POSIX
+}
+
+// compileOptions returns the compile-time settings of config, which may
+// be nil.
+func (c *Config) compileOptions() compileOptions {
+	return compileOptions{
+		strictArity: c.strictArity(),
+		posix:       c != nil && c.POSIX,
+	}
 }
 
 // applyDefaults fills in default values for unset Config fields.
@@ -71,3 +242,32 @@ func (c *Config) applyDefaults() {
 		c.ORS = "\n"
 	}
 }
+
+// clone returns a copy of c that shares none of its maps, slices or
+// pointers, other than the Output and Stderr writers and Inputs readers.
+func (c *Config) clone() Config {
+	cc := *c
+	cc.Variables = maps.Clone(c.Variables)
+	cc.Environ = maps.Clone(c.Environ)
+	if c.Arrays != nil {
+		cc.Arrays = make(map[string]map[string]string, len(c.Arrays))
+		for name, arr := range c.Arrays {
+			cc.Arrays[name] = maps.Clone(arr)
+		}
+	}
+	cc.Args = slices.Clone(c.Args)
+	cc.Inputs = slices.Clone(c.Inputs)
+	cc.POSIXRegex = clonePtr(c.POSIXRegex)
+	cc.RandSeed = clonePtr(c.RandSeed)
+	cc.StrictArity = clonePtr(c.StrictArity)
+	return cc
+}
+
+// clonePtr returns a pointer to a copy of *p, or nil if p is nil.
+func clonePtr[T any](p *T) *T {
+	if p == nil {
+		return nil
+	}
+	v := *p
+	return &v
+}
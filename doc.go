@@ -41,12 +41,24 @@
 //   - Field and record separators (FS, RS, OFS, ORS)
 //   - Pre-defined variables
 //   - Custom I/O writers
+//   - Input files (ARGV) and named input streams ([NamedReader])
+//
+// # Regular Expressions
+//
+// A regex literal such as /\./ reaches the regex engine as written. A string
+// used as a dynamic regex, as in $0 ~ "\\.", is unescaped twice: the string
+// literal's escapes are processed first, then the result is compiled as a
+// regex. "\\." therefore becomes \. and matches a literal dot, while "\."
+// becomes . (an unknown string escape keeps only the character) and matches
+// any character. Escapes known to both levels, like \t or \x41, work either
+// way.
 //
 // # Error Handling
 //
 // Errors are returned as specific types for detailed handling:
 //   - [ParseError]: syntax errors in AWK source
 //   - [CompileError]: semantic errors during compilation
+//   - [RegexError]: invalid patterns passed to [CompileRegex]
 //   - [RuntimeError]: errors during execution
 //
 // # Thread Safety
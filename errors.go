@@ -24,6 +24,29 @@ func (e *CompileError) Error() string {
 	return fmt.Sprintf("compile error: %s", e.Message)
 }
 
+// RegexError represents an invalid regular expression.
+type RegexError struct {
+	Pattern  string // Offending pattern
+	Position int    // 0-based byte offset of the problem in Pattern
+	Message  string // Error description
+}
+
+func (e *RegexError) Error() string {
+	return fmt.Sprintf("%s at position %d", e.Message, e.Position)
+}
+
+// Warning is a lint finding: valid AWK that is probably a mistake.
+// Warnings never prevent a program from compiling or running.
+type Warning struct {
+	Line    int    // 1-based line number
+	Column  int    // 1-based column number
+	Message string // Warning description
+}
+
+func (w *Warning) String() string {
+	return fmt.Sprintf("warning at %d:%d: %s", w.Line, w.Column, w.Message)
+}
+
 // RuntimeError represents an error during AWK execution.
 type RuntimeError struct {
 	Message string // Error description
@@ -37,6 +37,7 @@ func TestNodeInterface(t *testing.T) {
 
 		// Calls
 		{"CallExpr", &ast.CallExpr{}},
+		{"IndirectCallExpr", &ast.IndirectCallExpr{}},
 		{"BuiltinExpr", &ast.BuiltinExpr{}},
 		{"GetlineExpr", &ast.GetlineExpr{}},
 
@@ -225,6 +226,22 @@ func TestPrinter(t *testing.T) {
 			},
 			expect: "$1",
 		},
+		{
+			name: "FieldExpr named",
+			node: &ast.FieldExpr{
+				Index: &ast.StrLit{Value: "id"},
+				Named: true,
+			},
+			expect: `@"id"`,
+		},
+		{
+			name: "FieldExpr named expression",
+			node: &ast.FieldExpr{
+				Index: &ast.Ident{Name: "col"},
+				Named: true,
+			},
+			expect: "@(col)",
+		},
 		{
 			name: "BinaryExpr add",
 			node: &ast.BinaryExpr{
@@ -263,6 +280,23 @@ func TestPrinter(t *testing.T) {
 			},
 			expect: "my_func(a, b)",
 		},
+		{
+			name: "IndirectCallExpr",
+			node: &ast.IndirectCallExpr{
+				Func: &ast.Ident{Name: "fn"},
+				Args: []ast.Expr{&ast.NumLit{Value: 4}},
+			},
+			expect: "@fn(4)",
+		},
+		{
+			name: "GetlineExpr coprocess",
+			node: &ast.GetlineExpr{
+				Command:   &ast.Ident{Name: "cmd"},
+				Coprocess: true,
+				Target:    &ast.Ident{Name: "line"},
+			},
+			expect: "cmd |& getline line",
+		},
 		{
 			name: "InExpr",
 			node: &ast.InExpr{
@@ -490,6 +524,8 @@ func (v *testVisitor) VisitReturnStmt(*ast.ReturnStmt) int     { return 0 }
 func (v *testVisitor) VisitExitStmt(*ast.ExitStmt) int         { return 0 }
 func (v *testVisitor) VisitDeleteStmt(*ast.DeleteStmt) int     { return 0 }
 
+func (v *testVisitor) VisitIndirectCallExpr(*ast.IndirectCallExpr) int { return 0 }
+
 // TestAccept verifies the Accept generic function works.
 func TestAccept(t *testing.T) {
 	visitor := &testVisitor{}
@@ -41,10 +41,11 @@ type Ident struct {
 }
 
 // FieldExpr represents a field reference.
-// Examples: $0, $1, $NF, $(i+1)
+// Examples: $0, $1, $NF, $(i+1), @"name"
 type FieldExpr struct {
 	BaseExpr
 	Index Expr // Field index expression (nil means $0)
+	Named bool // Index is a header column name (@"name")
 }
 
 // IndexExpr represents an array subscript expression.
@@ -122,6 +123,15 @@ type CallExpr struct {
 	Args []Expr // Arguments (may be empty)
 }
 
+// IndirectCallExpr represents an indirect function call (gawk extension).
+// The callee is the value of a variable naming a user-defined or built-in function.
+// Example: @fn(a, b)
+type IndirectCallExpr struct {
+	BaseExpr
+	Func *Ident // Variable holding the function name
+	Args []Expr // Arguments (may be empty)
+}
+
 // BuiltinExpr represents a built-in function call.
 // Examples: length($0), substr(s, 1, 5), split(s, arr, ":")
 type BuiltinExpr struct {
@@ -143,6 +153,9 @@ type GetlineExpr struct {
 	Target  Expr // Variable to read into (nil means $0)
 	File    Expr // File to read from (nil means stdin/current input)
 	Command Expr // Command to pipe from (nil if not piped)
+
+	// Coprocess is true for "cmd |& getline", reading from a two-way pipe.
+	Coprocess bool
 }
 
 // -----------------------------------------------------------------------------
@@ -193,6 +206,7 @@ var (
 	_ Expr = (*ConcatExpr)(nil)
 	_ Expr = (*GroupExpr)(nil)
 	_ Expr = (*CallExpr)(nil)
+	_ Expr = (*IndirectCallExpr)(nil)
 	_ Expr = (*BuiltinExpr)(nil)
 	_ Expr = (*GetlineExpr)(nil)
 	_ Expr = (*InExpr)(nil)
@@ -13,7 +13,7 @@
 //	│   ├── NumLit, StrLit, RegexLit - literals
 //	│   ├── Ident, FieldExpr, IndexExpr - references
 //	│   ├── BinaryExpr, UnaryExpr, TernaryExpr - operations
-//	│   ├── CallExpr, BuiltinExpr, GetlineExpr - calls
+//	│   ├── CallExpr, IndirectCallExpr, BuiltinExpr, GetlineExpr - calls
 //	│   └── InExpr, MatchExpr, ConcatExpr, AssignExpr - special
 //	├── Stmt (interface) - statements that perform actions
 //	│   ├── ExprStmt, PrintStmt, IfStmt - basic
@@ -144,6 +144,17 @@ func (p *Printer) printExpr(e Expr) {
 		p.printf("%s", n.Name)
 
 	case *FieldExpr:
+		if n.Named {
+			if _, ok := n.Index.(*StrLit); ok {
+				p.printf("@")
+				p.printExpr(n.Index)
+			} else {
+				p.printf("@(")
+				p.printExpr(n.Index)
+				p.printf(")")
+			}
+			break
+		}
 		p.printf("$")
 		if n.Index != nil {
 			needParen := needsParens(n.Index)
@@ -205,6 +216,11 @@ func (p *Printer) printExpr(e Expr) {
 		p.printArgs(n.Args)
 		p.printf(")")
 
+	case *IndirectCallExpr:
+		p.printf("@%s(", n.Func.Name)
+		p.printArgs(n.Args)
+		p.printf(")")
+
 	case *BuiltinExpr:
 		p.printf("%s(", builtinName(n.Func))
 		p.printArgs(n.Args)
@@ -213,7 +229,11 @@ func (p *Printer) printExpr(e Expr) {
 	case *GetlineExpr:
 		if n.Command != nil {
 			p.printExpr(n.Command)
-			p.printf(" | ")
+			if n.Coprocess {
+				p.printf(" |& ")
+			} else {
+				p.printf(" | ")
+			}
 		}
 		p.printf("getline")
 		if n.Target != nil {
@@ -504,6 +524,8 @@ func tokenString(t token.Token) string {
 		return ">>"
 	case token.PIPE:
 		return "|"
+	case token.PIPE_BOTH:
+		return "|&"
 	case token.CONCAT:
 		return " " // Space for concatenation
 	default:
@@ -547,36 +569,78 @@ func assignOpString(op token.Token) string {
 
 func builtinName(t token.Token) string {
 	switch t {
+	case token.F_AND:
+		return "and"
+	case token.F_ASORT:
+		return "asort"
+	case token.F_ASORTI:
+		return "asorti"
 	case token.F_ATAN2:
 		return "atan2"
 	case token.F_CLOSE:
 		return "close"
+	case token.F_COMPL:
+		return "compl"
+	case token.F_COPY:
+		return "copy"
 	case token.F_COS:
 		return "cos"
 	case token.F_EXP:
 		return "exp"
+	case token.F_EXTEND:
+		return "extend"
 	case token.F_FFLUSH:
 		return "fflush"
+	case token.F_B64DEC:
+		return "b64dec"
+	case token.F_B64ENC:
+		return "b64enc"
+	case token.F_GENSUB:
+		return "gensub"
 	case token.F_GSUB:
 		return "gsub"
+	case token.F_HASH:
+		return "hash"
 	case token.F_INDEX:
 		return "index"
 	case token.F_INT:
 		return "int"
+	case token.F_ISARRAY:
+		return "isarray"
 	case token.F_LENGTH:
 		return "length"
 	case token.F_LOG:
 		return "log"
+	case token.F_LSHIFT:
+		return "lshift"
 	case token.F_MATCH:
 		return "match"
+	case token.F_MKTIME:
+		return "mktime"
+	case token.F_NOW:
+		return "now"
+	case token.F_OR:
+		return "or"
 	case token.F_RAND:
 		return "rand"
+	case token.F_RSHIFT:
+		return "rshift"
+	case token.F_SLURP:
+		return "slurp"
+	case token.F_SPIT:
+		return "spit"
 	case token.F_SIN:
 		return "sin"
 	case token.F_SPLIT:
 		return "split"
 	case token.F_SPRINTF:
 		return "sprintf"
+	case token.F_STREAMNR:
+		return "streamnr"
+	case token.F_STRFTIME:
+		return "strftime"
+	case token.F_STRTONUM:
+		return "strtonum"
 	case token.F_SQRT:
 		return "sqrt"
 	case token.F_SRAND:
@@ -587,10 +651,22 @@ func builtinName(t token.Token) string {
 		return "substr"
 	case token.F_SYSTEM:
 		return "system"
+	case token.F_SYSTIME:
+		return "systime"
+	case token.F_TIMEFMT:
+		return "timefmt"
 	case token.F_TOLOWER:
 		return "tolower"
 	case token.F_TOUPPER:
 		return "toupper"
+	case token.F_TYPEOF:
+		return "typeof"
+	case token.F_URLDEC:
+		return "urldec"
+	case token.F_URLENC:
+		return "urlenc"
+	case token.F_XOR:
+		return "xor"
 	default:
 		return "unknown"
 	}
@@ -43,6 +43,7 @@ type Visitor[T any] interface {
 
 	// Expressions - Calls
 	VisitCallExpr(*CallExpr) T
+	VisitIndirectCallExpr(*IndirectCallExpr) T
 	VisitBuiltinExpr(*BuiltinExpr) T
 	VisitGetlineExpr(*GetlineExpr) T
 
@@ -158,6 +159,12 @@ func Walk(node Node, fn func(Node) bool) {
 			Walk(arg, fn)
 		}
 
+	case *IndirectCallExpr:
+		Walk(n.Func, fn)
+		for _, arg := range n.Args {
+			Walk(arg, fn)
+		}
+
 	case *BuiltinExpr:
 		for _, arg := range n.Args {
 			Walk(arg, fn)
@@ -325,6 +332,12 @@ func inspect(node, parent Node, fn func(node, parent Node) bool) {
 			inspect(arg, n, fn)
 		}
 
+	case *IndirectCallExpr:
+		inspect(n.Func, n, fn)
+		for _, arg := range n.Args {
+			inspect(arg, n, fn)
+		}
+
 	case *BuiltinExpr:
 		for _, arg := range n.Args {
 			inspect(arg, n, fn)
@@ -454,6 +467,8 @@ func Accept[T any](node Node, v Visitor[T]) T {
 
 	case *CallExpr:
 		return v.VisitCallExpr(n)
+	case *IndirectCallExpr:
+		return v.VisitIndirectCallExpr(n)
 	case *BuiltinExpr:
 		return v.VisitBuiltinExpr(n)
 	case *GetlineExpr:
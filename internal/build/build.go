@@ -0,0 +1,70 @@
+// Package build holds version information shared by the uawk library and
+// command. The variables are set by GoReleaser at build time via -ldflags:
+//
+//	-X github.com/kolkov/uawk/internal/build.Version=...
+//
+// Without them, Version falls back to the uawk module version recorded in
+// the binary's build information, as for programs importing the library
+// or a go install of the command. Otherwise they keep their defaults.
+package build
+
+import (
+	"regexp"
+	"runtime/debug"
+	"strings"
+)
+
+var (
+	Version = "dev"     // Release version, e.g. "0.3.0"
+	Commit  = "none"    // Git commit the binary was built from
+	Date    = "unknown" // Commit date
+)
+
+const (
+	modulePath  = "github.com/kolkov/uawk" // Module path of uawk itself
+	coregexPath = "github.com/coregx/coregex"
+)
+
+// pseudoVersion matches the timestamp and commit of a Go pseudo-version,
+// as in v0.0.0-20260102150405-abcdef123456.
+var pseudoVersion = regexp.MustCompile(`\d{14}-[0-9a-f]{12}`)
+
+func init() {
+	if Version != "dev" {
+		return
+	}
+	// Pseudo-versions and "(devel)" don't name a release
+	if v := moduleVersion(modulePath); strings.HasPrefix(v, "v") && !pseudoVersion.MatchString(v) {
+		Version = strings.TrimPrefix(v, "v")
+	}
+}
+
+// RegexEngine describes the regex engine linked into the binary, including
+// its module version when build information is available.
+func RegexEngine() string {
+	if v := moduleVersion(coregexPath); v != "" {
+		return "coregex " + v
+	}
+	return "coregex"
+}
+
+// moduleVersion returns the version of the module at path recorded in the
+// binary's build information, or "" if it isn't recorded.
+func moduleVersion(path string) string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return ""
+	}
+	if info.Main.Path == path {
+		return info.Main.Version
+	}
+	for _, dep := range info.Deps {
+		if dep.Path == path {
+			if dep.Replace != nil {
+				dep = dep.Replace
+			}
+			return dep.Version
+		}
+	}
+	return ""
+}
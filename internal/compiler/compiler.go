@@ -8,6 +8,7 @@ import (
 	"github.com/kolkov/uawk/internal/ast"
 	"github.com/kolkov/uawk/internal/semantic"
 	"github.com/kolkov/uawk/internal/token"
+	"github.com/kolkov/uawk/internal/types"
 )
 
 // CompileError represents a compilation error.
@@ -20,7 +21,18 @@ func (e *CompileError) Error() string {
 }
 
 // Compile transforms a resolved AST into bytecode.
-func Compile(prog *ast.Program, resolved *semantic.ResolveResult) (compiledProg *Program, err error) {
+func Compile(prog *ast.Program, resolved *semantic.ResolveResult) (*Program, error) {
+	return compile(prog, resolved, false)
+}
+
+// CompileProfiled is like Compile, but starts the code of each statement
+// and pattern with a Line opcode, so the VM can count how often each
+// source line runs. Profiled code is slower and is not optimized as well.
+func CompileProfiled(prog *ast.Program, resolved *semantic.ResolveResult) (*Program, error) {
+	return compile(prog, resolved, true)
+}
+
+func compile(prog *ast.Program, resolved *semantic.ResolveResult, profile bool) (compiledProg *Program, err error) {
 	defer func() {
 		if r := recover(); r != nil {
 			if ce, ok := r.(*CompileError); ok {
@@ -31,7 +43,7 @@ func Compile(prog *ast.Program, resolved *semantic.ResolveResult) (compiledProg
 		}
 	}()
 
-	p := &Program{}
+	p := &Program{Profile: profile}
 
 	// Initialize constant indexes for deduplication.
 	indexes := &constantIndexes{
@@ -98,15 +110,18 @@ func Compile(prog *ast.Program, resolved *semantic.ResolveResult) (compiledProg
 			if comma, ok := rule.Pattern.(*ast.CommaExpr); ok {
 				// Range pattern: /start/, /end/
 				c := newCompiler(resolved, p, indexes, "", typeInfo)
+				c.line(comma.Left.Pos())
 				c.compileExpr(comma.Left)
 				pattern = append(pattern, c.finish())
 
 				c = newCompiler(resolved, p, indexes, "", typeInfo)
+				c.line(comma.Right.Pos())
 				c.compileExpr(comma.Right)
 				pattern = append(pattern, c.finish())
 			} else {
 				// Single pattern
 				c := newCompiler(resolved, p, indexes, "", typeInfo)
+				c.line(rule.Pattern.Pos())
 				c.compileExpr(rule.Pattern)
 				pattern = [][]Opcode{c.finish()}
 			}
@@ -204,6 +219,13 @@ func (c *compiler) add(ops ...Opcode) {
 	c.code = append(c.code, ops...)
 }
 
+// line marks the start of a statement or pattern at pos when profiling.
+func (c *compiler) line(pos token.Position) {
+	if c.program.Profile {
+		c.add(Line, opcodeInt(pos.Line))
+	}
+}
+
 // finish returns the compiled code block.
 func (c *compiler) finish() []Opcode {
 	return c.code
@@ -259,6 +281,12 @@ func (c *compiler) lookupScalar(name string) (Scope, int) {
 	if sym.Type == semantic.TypeArray {
 		panic(&CompileError{Message: fmt.Sprintf("expected scalar, got array: %s", name)})
 	}
+	if kind == semantic.SymbolSpecial && name == "RT" {
+		c.program.UsesRT = true
+	}
+	if kind == semantic.SymbolSpecial && name == "ARGC" {
+		c.program.UsesArgs = true
+	}
 	return kindToScope(kind), sym.Index
 }
 
@@ -271,6 +299,9 @@ func (c *compiler) lookupArray(name string) (Scope, int) {
 	if sym.Type != semantic.TypeArray {
 		panic(&CompileError{Message: fmt.Sprintf("expected array, got scalar: %s", name)})
 	}
+	if kind == semantic.SymbolSpecial && name == "ARGV" {
+		c.program.UsesArgs = true
+	}
 	return kindToScope(kind), sym.Index
 }
 
@@ -348,6 +379,9 @@ func (c *compiler) compileStmt(stmt ast.Stmt) {
 	if stmt == nil {
 		return
 	}
+	if _, ok := stmt.(*ast.BlockStmt); !ok {
+		c.line(stmt.Pos())
+	}
 
 	switch s := stmt.(type) {
 	case *ast.ExprStmt:
@@ -478,7 +512,7 @@ func (c *compiler) compileIncr(expr *ast.UnaryExpr) {
 			c.add(IncrSpecial, amount, opcodeInt(idx))
 		}
 	case *ast.FieldExpr:
-		c.compileExpr(target.Index)
+		c.compileFieldIndex(target)
 		c.add(IncrField, amount)
 	case *ast.IndexExpr:
 		c.compileIndex(target.Index)
@@ -513,10 +547,31 @@ func (c *compiler) compilePrintStmt(s *ast.PrintStmt) {
 	if s.Printf {
 		c.add(Printf, opcodeInt(len(s.Args)), Opcode(redirect))
 	} else {
-		c.add(Print, opcodeInt(len(s.Args)), Opcode(redirect))
+		record := Opcode(0)
+		if len(s.Args) == 0 || len(s.Args) == 1 && isRecordField(s.Args[0]) {
+			record = 1
+		}
+		c.add(Print, opcodeInt(len(s.Args)), Opcode(redirect), record)
 	}
 }
 
+// isRecordField reports whether e is literally $0.
+func isRecordField(e ast.Expr) bool {
+	f, ok := e.(*ast.FieldExpr)
+	if !ok || f.Named {
+		return false
+	}
+	if f.Index == nil {
+		return true
+	}
+	index := f.Index
+	for g, ok := index.(*ast.GroupExpr); ok; g, ok = index.(*ast.GroupExpr) {
+		index = g.Expr
+	}
+	num, ok := index.(*ast.NumLit)
+	return ok && num.Value == 0
+}
+
 // tokenToRedirect converts a token to a Redirect.
 func tokenToRedirect(tok token.Token) Redirect {
 	switch tok {
@@ -526,6 +581,8 @@ func tokenToRedirect(tok token.Token) Redirect {
 		return RedirectAppend
 	case token.PIPE:
 		return RedirectPipe
+	case token.PIPE_BOTH:
+		return RedirectCoprocess
 	case token.LESS:
 		return RedirectInput
 	default:
@@ -748,13 +805,13 @@ func (c *compiler) compileExpr(expr ast.Expr) {
 
 	case *ast.FieldExpr:
 		// Optimize constant field index
-		if num, ok := e.Index.(*ast.NumLit); ok {
+		if num, ok := e.Index.(*ast.NumLit); ok && !e.Named {
 			if num.Value == float64(int(num.Value)) {
 				c.add(FieldInt, opcodeInt(int(num.Value)))
 				return
 			}
 		}
-		c.compileExpr(e.Index)
+		c.compileFieldIndex(e)
 		c.add(Field)
 
 	case *ast.IndexExpr:
@@ -814,6 +871,9 @@ func (c *compiler) compileExpr(expr ast.Expr) {
 	case *ast.CallExpr:
 		c.compileCallExpr(e)
 
+	case *ast.IndirectCallExpr:
+		c.compileIndirectCallExpr(e)
+
 	case *ast.BuiltinExpr:
 		c.compileBuiltinExpr(e)
 
@@ -1042,6 +1102,12 @@ func (c *compiler) compileCallExpr(e *ast.CallExpr) {
 	numScalarArgs := 0
 
 	for i, arg := range e.Args {
+		if compiledFunc != nil && i >= len(compiledFunc.Params) {
+			// Extra argument, accepted by semantic.Options.ExtraArgs:
+			// evaluated for its side effects only
+			c.compileExtraArg(arg)
+			continue
+		}
 		if compiledFunc != nil && i < len(compiledFunc.Arrays) && compiledFunc.Arrays[i] {
 			// Array argument
 			if ident, ok := arg.(*ast.Ident); ok {
@@ -1064,6 +1130,29 @@ func (c *compiler) compileCallExpr(e *ast.CallExpr) {
 	c.add(arrayOpcodes...)
 }
 
+// compileExtraArg compiles an argument passed beyond a function's
+// parameters, dropping its value. An array name has nothing to evaluate.
+func (c *compiler) compileExtraArg(arg ast.Expr) {
+	if ident, ok := arg.(*ast.Ident); ok {
+		if sym, _, ok := c.resolved.LookupVar(c.funcName, ident.Name); ok && sym.Type == semantic.TypeArray {
+			return
+		}
+	}
+	c.compileExpr(arg)
+	c.add(Drop)
+}
+
+// compileIndirectCallExpr compiles an indirect function call (@f(args)).
+// The function name and arguments are pushed and resolved by the VM at runtime,
+// so only scalar arguments are supported.
+func (c *compiler) compileIndirectCallExpr(e *ast.IndirectCallExpr) {
+	c.compileExpr(e.Func)
+	for _, arg := range e.Args {
+		c.compileExpr(arg)
+	}
+	c.add(CallIndirect, opcodeInt(len(e.Args)))
+}
+
 // compileBuiltinExpr compiles a built-in function call.
 func (c *compiler) compileBuiltinExpr(e *ast.BuiltinExpr) {
 	// Special cases that need array or lvalue handling
@@ -1086,6 +1175,50 @@ func (c *compiler) compileBuiltinExpr(e *ast.BuiltinExpr) {
 		}
 		return
 
+	case token.F_COPY:
+		src, srcOK := e.Args[0].(*ast.Ident)
+		dst, dstOK := e.Args[1].(*ast.Ident)
+		if srcOK && dstOK {
+			srcScope, srcIdx := c.lookupArray(src.Name)
+			dstScope, dstIdx := c.lookupArray(dst.Name)
+			c.add(CallCopy, Opcode(srcScope), opcodeInt(srcIdx), Opcode(dstScope), opcodeInt(dstIdx))
+		}
+		return
+
+	case token.F_EXTEND:
+		dst, dstOK := e.Args[0].(*ast.Ident)
+		src, srcOK := e.Args[1].(*ast.Ident)
+		if dstOK && srcOK {
+			dstScope, dstIdx := c.lookupArray(dst.Name)
+			srcScope, srcIdx := c.lookupArray(src.Name)
+			c.add(CallExtend, Opcode(dstScope), opcodeInt(dstIdx), Opcode(srcScope), opcodeInt(srcIdx))
+		}
+		return
+
+	case token.F_ASORT, token.F_ASORTI:
+		// Without dst, src is sorted in place; an empty how is the default
+		// order
+		src, srcOK := e.Args[0].(*ast.Ident)
+		dst, dstOK := src, srcOK
+		if len(e.Args) > 1 {
+			dst, dstOK = e.Args[1].(*ast.Ident)
+		}
+		if srcOK && dstOK {
+			if len(e.Args) > 2 {
+				c.compileExpr(e.Args[2])
+			} else {
+				c.add(Str, opcodeInt(c.strIndex("")))
+			}
+			op := CallAsort
+			if e.Func == token.F_ASORTI {
+				op = CallAsorti
+			}
+			srcScope, srcIdx := c.lookupArray(src.Name)
+			dstScope, dstIdx := c.lookupArray(dst.Name)
+			c.add(op, Opcode(srcScope), opcodeInt(srcIdx), Opcode(dstScope), opcodeInt(dstIdx))
+		}
+		return
+
 	case token.F_SUB, token.F_GSUB:
 		op := BuiltinSub
 		if e.Func == token.F_GSUB {
@@ -1148,6 +1281,32 @@ func (c *compiler) compileBuiltinExpr(e *ast.BuiltinExpr) {
 		}
 		return
 
+	case token.F_TYPEOF, token.F_ISARRAY:
+		// Whether a name is an array is known here; values are inspected
+		// at run time
+		if ident, ok := e.Args[0].(*ast.Ident); ok {
+			sym, _, ok := c.resolved.LookupVar(c.funcName, ident.Name)
+			switch {
+			case ok && sym.Type == semantic.TypeArray && e.Func == token.F_TYPEOF:
+				c.add(Str, opcodeInt(c.strIndex("array")))
+				return
+			case ok && sym.Type == semantic.TypeArray:
+				c.add(Num, opcodeInt(c.numIndex(1)))
+				return
+			case ok && sym.Untyped && e.Func == token.F_TYPEOF:
+				c.compileExpr(ident)
+				c.add(CallBuiltin, Opcode(BuiltinTypeofUntyped))
+				return
+			}
+		}
+		c.compileExpr(e.Args[0])
+		if e.Func == token.F_TYPEOF {
+			c.add(CallBuiltin, Opcode(BuiltinTypeof))
+		} else {
+			c.add(CallBuiltin, Opcode(BuiltinIsarray))
+		}
+		return
+
 	case token.F_SPRINTF:
 		for _, arg := range e.Args {
 			c.compileExpr(arg)
@@ -1155,6 +1314,39 @@ func (c *compiler) compileBuiltinExpr(e *ast.BuiltinExpr) {
 		c.add(CallSprintf, opcodeInt(len(e.Args)))
 		return
 
+	case token.F_AND, token.F_OR, token.F_XOR:
+		// Variadic: fold the arguments pairwise, left to right
+		op := BuiltinAnd
+		if e.Func == token.F_OR {
+			op = BuiltinOr
+		} else if e.Func == token.F_XOR {
+			op = BuiltinXor
+		}
+		c.compileExpr(e.Args[0])
+		for _, arg := range e.Args[1:] {
+			c.compileExpr(arg)
+			c.add(CallBuiltin, Opcode(op))
+		}
+		return
+
+	case token.F_GENSUB:
+		// gensub(pattern, repl, how [, target]) - pattern pushed as a
+		// string; the target defaults to $0 and is not assigned
+		if regex, ok := e.Args[0].(*ast.RegexLit); ok {
+			c.add(Str, opcodeInt(c.strIndex(regex.Pattern)))
+		} else {
+			c.compileExpr(e.Args[0])
+		}
+		c.compileExpr(e.Args[1])
+		c.compileExpr(e.Args[2])
+		if len(e.Args) > 3 {
+			c.compileExpr(e.Args[3])
+		} else {
+			c.add(FieldInt, 0)
+		}
+		c.add(CallBuiltin, Opcode(BuiltinGensub))
+		return
+
 	case token.F_MATCH:
 		// match(str, pattern) - pattern must be pushed as string, not executed
 		c.compileExpr(e.Args[0]) // str
@@ -1176,8 +1368,14 @@ func (c *compiler) compileBuiltinExpr(e *ast.BuiltinExpr) {
 	switch e.Func {
 	case token.F_ATAN2:
 		op = BuiltinAtan2
+	case token.F_COMPL:
+		op = BuiltinCompl
 	case token.F_CLOSE:
-		op = BuiltinClose
+		if len(e.Args) > 1 {
+			op = BuiltinCloseHow
+		} else {
+			op = BuiltinClose
+		}
 	case token.F_COS:
 		op = BuiltinCos
 	case token.F_EXP:
@@ -1188,18 +1386,63 @@ func (c *compiler) compileBuiltinExpr(e *ast.BuiltinExpr) {
 		} else {
 			op = BuiltinFflushAll
 		}
+	case token.F_B64DEC:
+		op = BuiltinB64Dec
+	case token.F_B64ENC:
+		op = BuiltinB64Enc
+	case token.F_HASH:
+		op = BuiltinHash
 	case token.F_INDEX:
 		op = BuiltinIndex
 	case token.F_INT:
 		op = BuiltinInt
 	case token.F_LOG:
 		op = BuiltinLog
+	case token.F_LSHIFT:
+		op = BuiltinLshift
+	case token.F_MKTIME:
+		if len(e.Args) > 1 {
+			op = BuiltinMktimeUTC
+		} else {
+			op = BuiltinMktime
+		}
+	case token.F_NOW:
+		if len(e.Args) > 0 {
+			op = BuiltinNowFormat
+		} else {
+			op = BuiltinNow
+		}
 	case token.F_RAND:
 		op = BuiltinRand
+	case token.F_RSHIFT:
+		op = BuiltinRshift
 	case token.F_SIN:
 		op = BuiltinSin
+	case token.F_SLURP:
+		op = BuiltinSlurp
+	case token.F_SPIT:
+		if len(e.Args) > 2 {
+			op = BuiltinSpitAppend
+		} else {
+			op = BuiltinSpit
+		}
 	case token.F_SQRT:
 		op = BuiltinSqrt
+	case token.F_STREAMNR:
+		op = BuiltinStreamNR
+	case token.F_STRFTIME:
+		switch len(e.Args) {
+		case 0:
+			op = BuiltinStrftime
+		case 1:
+			op = BuiltinStrftimeFormat
+		case 2:
+			op = BuiltinStrftimeTime
+		default:
+			op = BuiltinStrftimeUTC
+		}
+	case token.F_STRTONUM:
+		op = BuiltinStrtonum
 	case token.F_SRAND:
 		if len(e.Args) > 0 {
 			op = BuiltinSrandSeed
@@ -1214,10 +1457,22 @@ func (c *compiler) compileBuiltinExpr(e *ast.BuiltinExpr) {
 		}
 	case token.F_SYSTEM:
 		op = BuiltinSystem
+	case token.F_SYSTIME:
+		op = BuiltinSystime
+	case token.F_TIMEFMT:
+		if len(e.Args) > 2 {
+			op = BuiltinTimefmtUTC
+		} else {
+			op = BuiltinTimefmt
+		}
 	case token.F_TOLOWER:
 		op = BuiltinTolower
 	case token.F_TOUPPER:
 		op = BuiltinToupper
+	case token.F_URLDEC:
+		op = BuiltinURLDec
+	case token.F_URLENC:
+		op = BuiltinURLEnc
 	default:
 		panic(&CompileError{Message: fmt.Sprintf("unknown builtin: %v", e.Func)})
 	}
@@ -1231,6 +1486,9 @@ func (c *compiler) compileGetlineExpr(e *ast.GetlineExpr) {
 	if e.Command != nil {
 		c.compileExpr(e.Command)
 		redirect = RedirectPipe
+		if e.Coprocess {
+			redirect = RedirectCoprocess
+		}
 	} else if e.File != nil {
 		c.compileExpr(e.File)
 		redirect = RedirectInput
@@ -1242,7 +1500,7 @@ func (c *compiler) compileGetlineExpr(e *ast.GetlineExpr) {
 		scope, idx := c.lookupScalar(target.Name)
 		c.add(GetlineVar, Opcode(redirect), Opcode(scope), opcodeInt(idx))
 	case *ast.FieldExpr:
-		c.compileExpr(target.Index)
+		c.compileFieldIndex(target)
 		c.add(GetlineField, Opcode(redirect))
 	case *ast.IndexExpr:
 		c.compileIndex(target.Index)
@@ -1255,11 +1513,20 @@ func (c *compiler) compileGetlineExpr(e *ast.GetlineExpr) {
 	}
 }
 
+// compileFieldIndex compiles the index of a field reference. A named
+// field's index is a column name, looked up in the header row.
+func (c *compiler) compileFieldIndex(e *ast.FieldExpr) {
+	c.compileExpr(e.Index)
+	if e.Named {
+		c.add(FieldIndex)
+	}
+}
+
 // compileIndex compiles array index expressions.
 func (c *compiler) compileIndex(indexes []ast.Expr) {
 	for _, idx := range indexes {
 		// Optimize integer constants to string form
-		if num, ok := idx.(*ast.NumLit); ok && num.Value == float64(int64(num.Value)) {
+		if num, ok := idx.(*ast.NumLit); ok && types.IsInt(num.Value) {
 			s := strconv.FormatInt(int64(num.Value), 10)
 			c.add(Str, opcodeInt(c.strIndex(s)))
 			continue
@@ -1292,7 +1559,7 @@ func (c *compiler) compileAssign(target ast.Expr, op token.Token) {
 			c.add(StoreSpecial, opcodeInt(idx))
 		}
 	case *ast.FieldExpr:
-		c.compileExpr(t.Index)
+		c.compileFieldIndex(t)
 		c.add(StoreField)
 	case *ast.IndexExpr:
 		c.compileIndex(t.Index)
@@ -1339,7 +1606,7 @@ func (c *compiler) compileAugAssign(target ast.Expr, op token.Token) {
 			c.add(AugSpecial, Opcode(augOp), opcodeInt(idx))
 		}
 	case *ast.FieldExpr:
-		c.compileExpr(t.Index)
+		c.compileFieldIndex(t)
 		c.add(AugField, Opcode(augOp))
 	case *ast.IndexExpr:
 		c.compileIndex(t.Index)
@@ -1360,7 +1627,7 @@ func (c *compiler) compileDupeIndexLValue(expr ast.Expr) {
 	case *ast.Ident:
 		c.compileExpr(expr)
 	case *ast.FieldExpr:
-		c.compileExpr(e.Index)
+		c.compileFieldIndex(e)
 		c.add(Dupe)
 		c.add(Field)
 	case *ast.IndexExpr:
@@ -1407,7 +1674,7 @@ func (c *compiler) compileAugAssignExpr(target ast.Expr, op token.Token, rhs ast
 
 	case *ast.FieldExpr:
 		// Field: compile index, dupe for later, get field, compute, dupe result, rote, store
-		c.compileExpr(t.Index)
+		c.compileFieldIndex(t)
 		c.add(Dupe)
 		c.add(Field)
 		c.compileExpr(rhs)
@@ -411,6 +411,9 @@ func TestCompileBuiltins(t *testing.T) {
 		{"substr 3 arg", `BEGIN { print substr("hello", 2, 3) }`},
 		{"index", `BEGIN { print index("hello", "l") }`},
 		{"split", `BEGIN { split("a:b:c", arr, ":") }`},
+		{"copy", `BEGIN { a[1] = 1; copy(a, b) }`},
+		{"extend", `BEGIN { b[1] = 1; extend(a, b) }`},
+		{"asort", `BEGIN { a[1] = 2; asort(a); asorti(a, b, "@ind_str_desc") }`},
 		{"sprintf", `BEGIN { print sprintf("%d", 42) }`},
 		{"tolower", `BEGIN { print tolower("HELLO") }`},
 		{"toupper", `BEGIN { print toupper("hello") }`},
@@ -573,13 +576,75 @@ func TestDisassemble(t *testing.T) {
 	}
 }
 
+func TestDisassembleGolden(t *testing.T) {
+	const src = `BEGIN { n = split("a b c", parts) }
+$1 > 1 { count[$2]++ }
+END { for (i = 1; i <= n; i++) if (parts[i] in count) print parts[i], count[parts[i]] }`
+	const want = `=== BEGIN ===
+    Str "a b c"
+    CallSplit parts
+    StoreGlobal n
+
+=== Action 0 ===
+  Pattern[0]:
+      FieldInt $1
+      Num 1
+      Greater
+  Body:
+      FieldInt $2
+      IncrArrayGlobal ++ count
+
+=== END ===
+    Num 1
+    StoreGlobal i
+    LoadGlobal i
+    LoadGlobal n
+    JumpGreater -> L3
+  L1:
+    LoadGlobal i
+    ArrayGetGlobal parts
+    ArrayInGlobal count
+    JumpFalse -> L2
+    LoadGlobal i
+    ArrayGetGlobal parts
+    LoadGlobal i
+    ArrayGetGlobal parts
+    ArrayGetGlobal count
+    Print args=2 redirect=none
+  L2:
+    IncrGlobal ++ i
+    LoadGlobal i
+    LoadGlobal n
+    JumpLessEq -> L1
+  L3:
+`
+	disasm := compileSource(t, src).Disassemble()
+	_, code, _ := strings.Cut(disasm, "=== BEGIN ===")
+	if got := "=== BEGIN ===" + code; strings.TrimSpace(got) != strings.TrimSpace(want) {
+		t.Errorf("disassembly:\n%s\nwant:\n%s", got, want)
+	}
+
+	// New constants and variables elsewhere leave the END block as it was
+	other := compileSource(t, `function f(s) { return s s }
+BEGIN { x = 2.5; y = f("z"); while (x < 9) x++ }
+`+src).Disassemble()
+	endBlock := func(s string) string {
+		_, end, _ := strings.Cut(s, "=== END ===")
+		end, _, _ = strings.Cut(end, "=== Function")
+		return strings.TrimSpace(end)
+	}
+	if endBlock(other) != endBlock(disasm) {
+		t.Errorf("END block changed by unrelated code:\n%s\nwant:\n%s", endBlock(other), endBlock(disasm))
+	}
+}
+
 func TestOpcodeString(t *testing.T) {
 	// Verify all opcodes have valid String() representations
 	opcodes := []Opcode{
 		Nop, Num, Str, Dupe, Drop, Swap, Rote,
 		LoadGlobal, LoadLocal, LoadSpecial,
 		StoreGlobal, StoreLocal, StoreSpecial,
-		Field, FieldInt, StoreField,
+		Field, FieldInt, StoreField, FieldIndex,
 		ArrayGet, ArraySet, ArrayDelete, ArrayClear, ArrayIn,
 		Add, Subtract, Multiply, Divide, Power, Modulo,
 		Equal, NotEqual, Less, LessEqual, Greater, GreaterEqual,
@@ -589,7 +654,7 @@ func TestOpcodeString(t *testing.T) {
 		Next, Nextfile, Exit, ExitCode,
 		CallBuiltin, CallUser, Return, ReturnNull,
 		Print, Printf, Getline,
-		Halt,
+		Line, Halt,
 	}
 
 	for _, op := range opcodes {
@@ -850,3 +915,45 @@ func TestTypedOpcodeStrings(t *testing.T) {
 		}
 	}
 }
+
+func TestCompileProfiled(t *testing.T) {
+	source := "$1 {\n\tx = 1\n\tif (x) {\n\t\ty = 2\n\t}\n}"
+	prog, err := parser.Parse(source)
+	if err != nil {
+		t.Fatalf("parse error: %v", err)
+	}
+	resolved, err := semantic.Resolve(prog)
+	if err != nil {
+		t.Fatalf("resolve error: %v", err)
+	}
+	compiled, err := CompileProfiled(prog, resolved)
+	if err != nil {
+		t.Fatalf("compile error: %v", err)
+	}
+	if !compiled.Profile {
+		t.Error("Profile = false, want true")
+	}
+
+	lines := func(code []Opcode) []int {
+		var got []int
+		for i := 0; i < len(code); i += instructionLength(code, i) {
+			if code[i] == Line {
+				got = append(got, int(code[i+1]))
+			}
+		}
+		return got
+	}
+	action := compiled.Actions[0]
+	if got := lines(action.Pattern[0]); len(got) != 1 || got[0] != 1 {
+		t.Errorf("pattern lines = %v, want [1]", got)
+	}
+	if got := lines(action.Body); len(got) != 3 || got[0] != 2 || got[1] != 3 || got[2] != 4 {
+		t.Errorf("body lines = %v, want [2 3 4]", got)
+	}
+
+	// Plain compilation emits no Line opcodes
+	plain := compileSource(t, source)
+	if got := lines(plain.Actions[0].Body); len(got) != 0 {
+		t.Errorf("unprofiled body lines = %v, want none", got)
+	}
+}
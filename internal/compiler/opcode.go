@@ -34,6 +34,7 @@ const (
 	Field      // Get field $N (N on stack): Field
 	FieldInt   // Get field $N (constant): FieldInt index
 	StoreField // Set field $N (value and N on stack): StoreField
+	FieldIndex // Replace a header column name with its field number: FieldIndex
 
 	// Array access
 	ArrayGet    // Get array element: ArrayGet scope index (key on stack)
@@ -124,21 +125,26 @@ const (
 	BreakForIn // Break from for-in loop
 
 	// Function calls
-	CallBuiltin // Call builtin: CallBuiltin builtinOp
-	CallUser    // Call user function: CallUser funcIndex numArrayArgs [scope index]...
-	CallNative  // Call native function: CallNative funcIndex numArgs
-	Return      // Return with value (value on stack)
-	ReturnNull  // Return without value (return "")
-	Nulls       // Push N null values: Nulls count
+	CallBuiltin  // Call builtin: CallBuiltin builtinOp
+	CallUser     // Call user function: CallUser funcIndex numArrayArgs [scope index]...
+	CallNative   // Call native function: CallNative funcIndex numArgs
+	CallIndirect // Call function by name: CallIndirect numArgs (name and args on stack)
+	Return       // Return with value (value on stack)
+	ReturnNull   // Return without value (return "")
+	Nulls        // Push N null values: Nulls count
 
 	// Special builtins (need special handling)
 	CallSplit    // split(s, a): CallSplit scope index (string on stack)
 	CallSplitSep // split(s, a, sep): CallSplitSep scope index (string and sep on stack)
 	CallSprintf  // sprintf(fmt, ...): CallSprintf numArgs
 	CallLength   // length(array): CallLength scope index
+	CallCopy     // copy(src, dst): CallCopy srcScope srcIndex dstScope dstIndex
+	CallExtend   // extend(dst, src): CallExtend dstScope dstIndex srcScope srcIndex
+	CallAsort    // asort(src, dst, how): CallAsort srcScope srcIndex dstScope dstIndex (how on stack)
+	CallAsorti   // asorti(src, dst, how): CallAsorti srcScope srcIndex dstScope dstIndex (how on stack)
 
 	// I/O operations
-	Print  // print: Print numArgs redirect
+	Print  // print: Print numArgs redirect record (1 if printing the record, as print or print $0)
 	Printf // printf: Printf numArgs redirect
 
 	// Getline operations
@@ -147,6 +153,9 @@ const (
 	GetlineField // getline field: GetlineField redirect (field index on stack)
 	GetlineArray // getline arr[k]: GetlineArray redirect scope index (key on stack)
 
+	// Profiling (only emitted by CompileProfiled)
+	Line // Count a statement or pattern starting on a source line: Line line
+
 	// Halt marks end of execution
 	Halt
 )
@@ -186,6 +195,8 @@ func (op Opcode) String() string {
 		return "FieldInt"
 	case StoreField:
 		return "StoreField"
+	case FieldIndex:
+		return "FieldIndex"
 	case ArrayGet:
 		return "ArrayGet"
 	case ArraySet:
@@ -308,6 +319,8 @@ func (op Opcode) String() string {
 		return "CallUser"
 	case CallNative:
 		return "CallNative"
+	case CallIndirect:
+		return "CallIndirect"
 	case Return:
 		return "Return"
 	case ReturnNull:
@@ -322,6 +335,14 @@ func (op Opcode) String() string {
 		return "CallSprintf"
 	case CallLength:
 		return "CallLength"
+	case CallCopy:
+		return "CallCopy"
+	case CallExtend:
+		return "CallExtend"
+	case CallAsort:
+		return "CallAsort"
+	case CallAsorti:
+		return "CallAsorti"
 	case Print:
 		return "Print"
 	case Printf:
@@ -334,6 +355,8 @@ func (op Opcode) String() string {
 		return "GetlineField"
 	case GetlineArray:
 		return "GetlineArray"
+	case Line:
+		return "Line"
 	case Halt:
 		return "Halt"
 	// Fused opcodes (peephole optimization)
@@ -431,39 +454,81 @@ func (op AugOp) String() string {
 type BuiltinOp Opcode
 
 const (
-	BuiltinAtan2 BuiltinOp = iota
+	BuiltinAnd BuiltinOp = iota
+	BuiltinAtan2
+	BuiltinB64Dec
+	BuiltinB64Enc
 	BuiltinClose
+	BuiltinCloseHow
+	BuiltinCompl
 	BuiltinCos
 	BuiltinExp
 	BuiltinFflush
 	BuiltinFflushAll
+	BuiltinGensub
 	BuiltinGsub
+	BuiltinHash
 	BuiltinIndex
 	BuiltinInt
+	BuiltinIsarray
 	BuiltinLength
 	BuiltinLengthArg
 	BuiltinLog
+	BuiltinLshift
 	BuiltinMatch
+	BuiltinMktime
+	BuiltinMktimeUTC
+	BuiltinNow
+	BuiltinNowFormat
+	BuiltinOr
 	BuiltinRand
+	BuiltinRshift
 	BuiltinSin
+	BuiltinSlurp
+	BuiltinSpit
+	BuiltinSpitAppend
 	BuiltinSqrt
 	BuiltinSrand
 	BuiltinSrandSeed
+	BuiltinStreamNR
+	BuiltinStrftime
+	BuiltinStrftimeFormat
+	BuiltinStrftimeTime
+	BuiltinStrftimeUTC
+	BuiltinStrtonum
 	BuiltinSub
 	BuiltinSubstr
 	BuiltinSubstrLen
 	BuiltinSystem
+	BuiltinSystime
+	BuiltinTimefmt
+	BuiltinTimefmtUTC
 	BuiltinTolower
 	BuiltinToupper
+	BuiltinTypeof
+	BuiltinTypeofUntyped
+	BuiltinURLDec
+	BuiltinURLEnc
+	BuiltinXor
 )
 
 // String returns a human-readable name for the builtin operation.
 func (op BuiltinOp) String() string {
 	switch op {
+	case BuiltinAnd:
+		return "and"
 	case BuiltinAtan2:
 		return "atan2"
+	case BuiltinB64Dec:
+		return "b64dec"
+	case BuiltinB64Enc:
+		return "b64enc"
 	case BuiltinClose:
 		return "close"
+	case BuiltinCloseHow:
+		return "close2"
+	case BuiltinCompl:
+		return "compl"
 	case BuiltinCos:
 		return "cos"
 	case BuiltinExp:
@@ -472,30 +537,68 @@ func (op BuiltinOp) String() string {
 		return "fflush"
 	case BuiltinFflushAll:
 		return "fflush()"
+	case BuiltinGensub:
+		return "gensub"
 	case BuiltinGsub:
 		return "gsub"
+	case BuiltinHash:
+		return "hash"
 	case BuiltinIndex:
 		return "index"
 	case BuiltinInt:
 		return "int"
+	case BuiltinIsarray:
+		return "isarray"
 	case BuiltinLength:
 		return "length()"
 	case BuiltinLengthArg:
 		return "length"
 	case BuiltinLog:
 		return "log"
+	case BuiltinLshift:
+		return "lshift"
 	case BuiltinMatch:
 		return "match"
+	case BuiltinMktime:
+		return "mktime"
+	case BuiltinMktimeUTC:
+		return "mktime2"
+	case BuiltinNow:
+		return "now()"
+	case BuiltinNowFormat:
+		return "now"
+	case BuiltinOr:
+		return "or"
 	case BuiltinRand:
 		return "rand"
+	case BuiltinRshift:
+		return "rshift"
 	case BuiltinSin:
 		return "sin"
+	case BuiltinSlurp:
+		return "slurp"
+	case BuiltinSpit:
+		return "spit"
+	case BuiltinSpitAppend:
+		return "spit3"
 	case BuiltinSqrt:
 		return "sqrt"
 	case BuiltinSrand:
 		return "srand()"
 	case BuiltinSrandSeed:
 		return "srand"
+	case BuiltinStreamNR:
+		return "streamnr"
+	case BuiltinStrftime:
+		return "strftime()"
+	case BuiltinStrftimeFormat:
+		return "strftime"
+	case BuiltinStrftimeTime:
+		return "strftime2"
+	case BuiltinStrftimeUTC:
+		return "strftime3"
+	case BuiltinStrtonum:
+		return "strtonum"
 	case BuiltinSub:
 		return "sub"
 	case BuiltinSubstr:
@@ -504,10 +607,26 @@ func (op BuiltinOp) String() string {
 		return "substr3"
 	case BuiltinSystem:
 		return "system"
+	case BuiltinSystime:
+		return "systime"
+	case BuiltinTimefmt:
+		return "timefmt"
+	case BuiltinTimefmtUTC:
+		return "timefmt3"
 	case BuiltinTolower:
 		return "tolower"
 	case BuiltinToupper:
 		return "toupper"
+	case BuiltinTypeof:
+		return "typeof"
+	case BuiltinTypeofUntyped:
+		return "typeof2"
+	case BuiltinURLDec:
+		return "urldec"
+	case BuiltinURLEnc:
+		return "urlenc"
+	case BuiltinXor:
+		return "xor"
 	default:
 		return fmt.Sprintf("BuiltinOp(%d)", op)
 	}
@@ -540,11 +659,12 @@ func (s Scope) String() string {
 type Redirect int32
 
 const (
-	RedirectNone   Redirect = iota // No redirection
-	RedirectWrite                  // > file
-	RedirectAppend                 // >> file
-	RedirectPipe                   // | command
-	RedirectInput                  // < file (for getline)
+	RedirectNone      Redirect = iota // No redirection
+	RedirectWrite                     // > file
+	RedirectAppend                    // >> file
+	RedirectPipe                      // | command
+	RedirectInput                     // < file (for getline)
+	RedirectCoprocess                 // |& command (two-way pipe)
 )
 
 // String returns a human-readable name for the redirect type.
@@ -560,6 +680,8 @@ func (r Redirect) String() string {
 		return "|"
 	case RedirectInput:
 		return "<"
+	case RedirectCoprocess:
+		return "|&"
 	default:
 		return fmt.Sprintf("Redirect(%d)", r)
 	}
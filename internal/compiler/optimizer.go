@@ -412,12 +412,12 @@ func instructionLength(code []Opcode, i int) int {
 		LoadSpecial, StoreSpecial, FieldInt,
 		Jump, JumpTrue, JumpFalse, JumpEqual, JumpNotEq,
 		JumpLess, JumpLessEq, JumpGreater, JumpGrEq,
-		CallBuiltin, Nulls, IndexMulti, ConcatMulti,
-		ArrayGetGlobal, ArraySetGlobal, ArrayDeleteGlobal, ArrayInGlobal:
+		CallBuiltin, CallIndirect, Nulls, IndexMulti, ConcatMulti,
+		ArrayGetGlobal, ArraySetGlobal, ArrayDeleteGlobal, ArrayInGlobal, Line:
 		return 2
 
 	case IncrGlobal, IncrLocal, IncrSpecial, AugGlobal, AugLocal, AugSpecial,
-		CallNative, Print, Printf, Getline, GetlineField,
+		CallNative, Printf, Getline, GetlineField,
 		IncrArrayGlobal, AugArrayGlobal:
 		return 3
 
@@ -425,9 +425,12 @@ func instructionLength(code []Opcode, i int) int {
 		CallLength, CallSprintf:
 		return 3
 
-	case IncrArray, AugArray:
+	case IncrArray, AugArray, Print:
 		return 4
 
+	case CallCopy, CallExtend, CallAsort, CallAsorti:
+		return 5
+
 	case GetlineVar, GetlineArray:
 		return 4
 
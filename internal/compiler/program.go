@@ -2,7 +2,10 @@ package compiler
 
 import (
 	"fmt"
+	"sort"
 	"strings"
+
+	"github.com/kolkov/uawk/internal/semantic"
 )
 
 // Program represents a compiled AWK program ready for VM execution.
@@ -31,6 +34,18 @@ type Program struct {
 	// Counts for VM allocation
 	NumScalars int // Number of global scalar variables
 	NumArrays  int // Number of global array variables
+
+	// Profile is set when the program was compiled by CompileProfiled, so
+	// each statement and pattern starts with a Line opcode.
+	Profile bool
+
+	// UsesRT is set when the program refers to RT, so the VM must record
+	// the terminator of each input record.
+	UsesRT bool
+
+	// UsesArgs is set when the program refers to ARGV or ARGC, and so may
+	// change which files are read.
+	UsesArgs bool
 }
 
 // Action represents a compiled pattern-action rule.
@@ -141,13 +156,20 @@ func (p *Program) Disassemble() string {
 	return sb.String()
 }
 
-// disassembleCode outputs bytecode with proper formatting.
+// disassembleCode outputs bytecode with proper formatting. Instructions
+// carry no addresses and operands show values and names rather than pool
+// indexes, so the output only changes where the code does: jump targets
+// are labelled L1, L2, ... in address order.
 //
 //nolint:funlen // switch-case disassembler cannot be split without losing readability
 func (p *Program) disassembleCode(sb *strings.Builder, code []Opcode, indent string) {
+	labels := jumpLabels(code)
 	for i := 0; i < len(code); i++ {
+		if label, ok := labels[i]; ok {
+			fmt.Fprintf(sb, "%s%s:\n", indent, label)
+		}
 		op := code[i]
-		fmt.Fprintf(sb, "%s%04d: %s", indent, i, op.String())
+		fmt.Fprintf(sb, "%s  %s", indent, op.String())
 
 		// Handle opcodes with arguments
 		switch op {
@@ -156,7 +178,7 @@ func (p *Program) disassembleCode(sb *strings.Builder, code []Opcode, indent str
 				i++
 				idx := int(code[i])
 				if idx < len(p.Nums) {
-					fmt.Fprintf(sb, " [%d] = %v", idx, p.Nums[idx])
+					fmt.Fprintf(sb, " %v", p.Nums[idx])
 				} else {
 					fmt.Fprintf(sb, " [%d]", idx)
 				}
@@ -166,7 +188,7 @@ func (p *Program) disassembleCode(sb *strings.Builder, code []Opcode, indent str
 				i++
 				idx := int(code[i])
 				if idx < len(p.Strs) {
-					fmt.Fprintf(sb, " [%d] = %q", idx, p.Strs[idx])
+					fmt.Fprintf(sb, " %q", p.Strs[idx])
 				} else {
 					fmt.Fprintf(sb, " [%d]", idx)
 				}
@@ -176,59 +198,46 @@ func (p *Program) disassembleCode(sb *strings.Builder, code []Opcode, indent str
 				i++
 				idx := int(code[i])
 				if idx < len(p.Regexes) {
-					fmt.Fprintf(sb, " [%d] = /%s/", idx, p.Regexes[idx])
+					fmt.Fprintf(sb, " /%s/", p.Regexes[idx])
 				} else {
 					fmt.Fprintf(sb, " [%d]", idx)
 				}
 			}
-		case LoadGlobal, StoreGlobal:
+		case LoadGlobal, StoreGlobal, LoadLocal, StoreLocal, LoadSpecial, StoreSpecial:
 			if i+1 < len(code) {
 				i++
-				idx := int(code[i])
-				if idx < len(p.ScalarNames) && p.ScalarNames[idx] != "" {
-					fmt.Fprintf(sb, " %s [%d]", p.ScalarNames[idx], idx)
-				} else {
-					fmt.Fprintf(sb, " [%d]", idx)
-				}
+				fmt.Fprintf(sb, " %s", p.scalarName(opScope(op), code[i]))
 			}
-		case LoadLocal, StoreLocal, LoadSpecial, StoreSpecial:
+		case FieldInt:
 			if i+1 < len(code) {
 				i++
-				fmt.Fprintf(sb, " [%d]", code[i])
+				fmt.Fprintf(sb, " $%d", code[i])
 			}
-		case FieldInt:
+		case Line:
 			if i+1 < len(code) {
 				i++
-				fmt.Fprintf(sb, " $%d", code[i])
+				fmt.Fprintf(sb, " %d", code[i])
 			}
 		case ArrayGet, ArraySet, ArrayDelete, ArrayIn:
 			if i+2 < len(code) {
-				i++
-				scope := Scope(code[i])
-				i++
-				idx := code[i]
-				fmt.Fprintf(sb, " %s [%d]", scope, idx)
+				fmt.Fprintf(sb, " %s", p.arrayName(Scope(code[i+1]), code[i+2]))
+				i += 2
 			}
 		case ArrayGetGlobal, ArraySetGlobal, ArrayDeleteGlobal, ArrayInGlobal:
 			if i+1 < len(code) {
 				i++
-				idx := code[i]
-				if int(idx) < len(p.ArrayNames) && p.ArrayNames[idx] != "" {
-					fmt.Fprintf(sb, " %s [%d]", p.ArrayNames[idx], idx)
-				} else {
-					fmt.Fprintf(sb, " Global[%d]", idx)
-				}
+				fmt.Fprintf(sb, " %s", p.arrayName(ScopeGlobal, code[i]))
 			}
 		case IncrGlobal, IncrLocal, IncrSpecial:
 			if i+2 < len(code) {
 				i++
 				amount := code[i]
 				i++
-				idx := code[i]
+				name := p.scalarName(opScope(op), code[i])
 				if amount > 0 {
-					fmt.Fprintf(sb, " ++ [%d]", idx)
+					fmt.Fprintf(sb, " ++ %s", name)
 				} else {
-					fmt.Fprintf(sb, " -- [%d]", idx)
+					fmt.Fprintf(sb, " -- %s", name)
 				}
 			}
 		case IncrField:
@@ -245,14 +254,12 @@ func (p *Program) disassembleCode(sb *strings.Builder, code []Opcode, indent str
 			if i+3 < len(code) {
 				i++
 				amount := code[i]
-				i++
-				scope := Scope(code[i])
-				i++
-				idx := code[i]
+				name := p.arrayName(Scope(code[i+1]), code[i+2])
+				i += 2
 				if amount > 0 {
-					fmt.Fprintf(sb, " ++ %s[%d]", scope, idx)
+					fmt.Fprintf(sb, " ++ %s", name)
 				} else {
-					fmt.Fprintf(sb, " -- %s[%d]", scope, idx)
+					fmt.Fprintf(sb, " -- %s", name)
 				}
 			}
 		case IncrArrayGlobal:
@@ -260,13 +267,7 @@ func (p *Program) disassembleCode(sb *strings.Builder, code []Opcode, indent str
 				i++
 				amount := code[i]
 				i++
-				idx := code[i]
-				var name string
-				if int(idx) < len(p.ArrayNames) && p.ArrayNames[idx] != "" {
-					name = p.ArrayNames[idx]
-				} else {
-					name = fmt.Sprintf("Global[%d]", idx)
-				}
+				name := p.arrayName(ScopeGlobal, code[i])
 				if amount > 0 {
 					fmt.Fprintf(sb, " ++ %s", name)
 				} else {
@@ -278,8 +279,7 @@ func (p *Program) disassembleCode(sb *strings.Builder, code []Opcode, indent str
 				i++
 				augOp := AugOp(code[i])
 				i++
-				idx := code[i]
-				fmt.Fprintf(sb, " %s [%d]", augOp, idx)
+				fmt.Fprintf(sb, " %s %s", augOp, p.scalarName(opScope(op), code[i]))
 			}
 		case AugField:
 			if i+1 < len(code) {
@@ -291,47 +291,31 @@ func (p *Program) disassembleCode(sb *strings.Builder, code []Opcode, indent str
 			if i+3 < len(code) {
 				i++
 				augOp := AugOp(code[i])
-				i++
-				scope := Scope(code[i])
-				i++
-				idx := code[i]
-				fmt.Fprintf(sb, " %s %s[%d]", augOp, scope, idx)
+				fmt.Fprintf(sb, " %s %s", augOp, p.arrayName(Scope(code[i+1]), code[i+2]))
+				i += 2
 			}
 		case AugArrayGlobal:
 			if i+2 < len(code) {
 				i++
 				augOp := AugOp(code[i])
 				i++
-				idx := code[i]
-				var name string
-				if int(idx) < len(p.ArrayNames) && p.ArrayNames[idx] != "" {
-					name = p.ArrayNames[idx]
-				} else {
-					name = fmt.Sprintf("Global[%d]", idx)
-				}
-				fmt.Fprintf(sb, " %s %s", augOp, name)
+				fmt.Fprintf(sb, " %s %s", augOp, p.arrayName(ScopeGlobal, code[i]))
 			}
 		case Jump, JumpTrue, JumpFalse, JumpEqual, JumpNotEq,
-			JumpLess, JumpLessEq, JumpGreater, JumpGrEq:
+			JumpLess, JumpLessEq, JumpGreater, JumpGrEq,
+			JumpLessNum, JumpLessEqNum, JumpGreaterNum, JumpGreaterEqNum,
+			JumpEqualNum, JumpNotEqualNum:
 			if i+1 < len(code) {
+				target, _ := jumpTarget(code, i)
 				i++
-				offset := int(code[i])
-				target := i + offset
-				fmt.Fprintf(sb, " %+d -> %04d", offset, target)
+				fmt.Fprintf(sb, " -> %s", labels[target])
 			}
 		case ForIn:
 			if i+5 < len(code) {
-				i++
-				varScope := Scope(code[i])
-				i++
-				varIdx := code[i]
-				i++
-				arrScope := Scope(code[i])
-				i++
-				arrIdx := code[i]
-				i++
-				offset := int(code[i])
-				fmt.Fprintf(sb, " var=%s[%d] arr=%s[%d] end=%+d", varScope, varIdx, arrScope, arrIdx, offset)
+				end, _ := jumpTarget(code, i)
+				fmt.Fprintf(sb, " var=%s arr=%s end=%s", p.scalarName(Scope(code[i+1]), code[i+2]),
+					p.arrayName(Scope(code[i+3]), code[i+4]), labels[end])
+				i += 5
 			}
 		case CallBuiltin:
 			if i+1 < len(code) {
@@ -345,7 +329,11 @@ func (p *Program) disassembleCode(sb *strings.Builder, code []Opcode, indent str
 				funcIdx := code[i]
 				i++
 				numArrays := int(code[i])
-				fmt.Fprintf(sb, " func[%d] arrays=%d", funcIdx, numArrays)
+				if int(funcIdx) < len(p.Functions) {
+					fmt.Fprintf(sb, " %s arrays=%d", p.Functions[funcIdx].Name, numArrays)
+				} else {
+					fmt.Fprintf(sb, " func[%d] arrays=%d", funcIdx, numArrays)
+				}
 				// Skip array scope/index pairs
 				for j := 0; j < numArrays*2 && i+1 < len(code); j++ {
 					i++
@@ -359,6 +347,11 @@ func (p *Program) disassembleCode(sb *strings.Builder, code []Opcode, indent str
 				numArgs := code[i]
 				fmt.Fprintf(sb, " native[%d] args=%d", funcIdx, numArgs)
 			}
+		case CallIndirect:
+			if i+1 < len(code) {
+				i++
+				fmt.Fprintf(sb, " args=%d", code[i])
+			}
 		case Nulls, IndexMulti, ConcatMulti:
 			if i+1 < len(code) {
 				i++
@@ -366,11 +359,18 @@ func (p *Program) disassembleCode(sb *strings.Builder, code []Opcode, indent str
 			}
 		case CallSplit, CallSplitSep, CallLength:
 			if i+2 < len(code) {
-				i++
-				scope := Scope(code[i])
-				i++
-				idx := code[i]
-				fmt.Fprintf(sb, " %s [%d]", scope, idx)
+				fmt.Fprintf(sb, " %s", p.arrayName(Scope(code[i+1]), code[i+2]))
+				i += 2
+			}
+		case CallCopy, CallAsort, CallAsorti:
+			if i+4 < len(code) {
+				fmt.Fprintf(sb, " %s -> %s", p.arrayName(Scope(code[i+1]), code[i+2]), p.arrayName(Scope(code[i+3]), code[i+4]))
+				i += 4
+			}
+		case CallExtend:
+			if i+4 < len(code) {
+				fmt.Fprintf(sb, " %s <- %s", p.arrayName(Scope(code[i+1]), code[i+2]), p.arrayName(Scope(code[i+3]), code[i+4]))
+				i += 4
 			}
 		case CallSprintf, Print, Printf:
 			if i+2 < len(code) {
@@ -379,6 +379,12 @@ func (p *Program) disassembleCode(sb *strings.Builder, code []Opcode, indent str
 				i++
 				redirect := Redirect(code[i])
 				fmt.Fprintf(sb, " args=%d redirect=%s", numArgs, redirect)
+				if code[i-2] == Print && i+1 < len(code) {
+					i++
+					if code[i] != 0 {
+						sb.WriteString(" record")
+					}
+				}
 			}
 		case Getline, GetlineField:
 			if i+1 < len(code) {
@@ -388,34 +394,23 @@ func (p *Program) disassembleCode(sb *strings.Builder, code []Opcode, indent str
 			}
 		case GetlineVar:
 			if i+3 < len(code) {
-				i++
-				redirect := Redirect(code[i])
-				i++
-				scope := Scope(code[i])
-				i++
-				idx := code[i]
-				fmt.Fprintf(sb, " redirect=%s %s[%d]", redirect, scope, idx)
+				fmt.Fprintf(sb, " redirect=%s %s", Redirect(code[i+1]), p.scalarName(Scope(code[i+2]), code[i+3]))
+				i += 3
 			}
 		case GetlineArray:
 			if i+3 < len(code) {
-				i++
-				redirect := Redirect(code[i])
-				i++
-				scope := Scope(code[i])
-				i++
-				idx := code[i]
-				fmt.Fprintf(sb, " redirect=%s %s[%d]", redirect, scope, idx)
+				fmt.Fprintf(sb, " redirect=%s %s", Redirect(code[i+1]), p.arrayName(Scope(code[i+2]), code[i+3]))
+				i += 3
 			}
 		// Fused opcodes (peephole optimization)
 		case JumpGlobalLessNum, JumpGlobalGrEqNum:
 			if i+3 < len(code) {
+				target, _ := jumpTarget(code, i)
 				i++
 				globalIdx := code[i]
 				i++
 				numIdx := code[i]
 				i++
-				offset := int(code[i])
-				target := i + offset
 				var cmp string
 				if op == JumpGlobalLessNum {
 					cmp = "<"
@@ -423,9 +418,9 @@ func (p *Program) disassembleCode(sb *strings.Builder, code []Opcode, indent str
 					cmp = ">="
 				}
 				if int(globalIdx) < len(p.ScalarNames) && p.ScalarNames[globalIdx] != "" {
-					fmt.Fprintf(sb, " %s %s %v -> %04d", p.ScalarNames[globalIdx], cmp, p.Nums[numIdx], target)
+					fmt.Fprintf(sb, " %s %s %v -> %s", p.ScalarNames[globalIdx], cmp, p.Nums[numIdx], labels[target])
 				} else {
-					fmt.Fprintf(sb, " global[%d] %s num[%d] -> %04d", globalIdx, cmp, numIdx, target)
+					fmt.Fprintf(sb, " global[%d] %s %v -> %s", globalIdx, cmp, p.Nums[numIdx], labels[target])
 				}
 			}
 		case FieldIntGreaterNum, FieldIntLessNum, FieldIntEqualNum:
@@ -465,4 +460,78 @@ func (p *Program) disassembleCode(sb *strings.Builder, code []Opcode, indent str
 
 		sb.WriteString("\n")
 	}
+	if label, ok := labels[len(code)]; ok {
+		fmt.Fprintf(sb, "%s%s:\n", indent, label)
+	}
+}
+
+// scalarName returns the name of scalar idx in scope, or scope[idx] for
+// locals and unnamed globals.
+func (p *Program) scalarName(scope Scope, idx Opcode) string {
+	return varName(scope, idx, p.ScalarNames)
+}
+
+// arrayName returns the name of array idx in scope, or scope[idx] for
+// locals and unnamed globals.
+func (p *Program) arrayName(scope Scope, idx Opcode) string {
+	return varName(scope, idx, p.ArrayNames)
+}
+
+func varName(scope Scope, idx Opcode, globals []string) string {
+	switch {
+	case scope == ScopeGlobal && int(idx) < len(globals) && globals[idx] != "":
+		return globals[idx]
+	case scope == ScopeSpecial && semantic.SpecialVarName(int(idx)) != "":
+		return semantic.SpecialVarName(int(idx))
+	}
+	return fmt.Sprintf("%s[%d]", scope, idx)
+}
+
+// opScope returns the scope of the scalar a load, store, increment or
+// augmented assignment opcode refers to.
+func opScope(op Opcode) Scope {
+	switch op {
+	case LoadLocal, StoreLocal, IncrLocal, AugLocal:
+		return ScopeLocal
+	case LoadSpecial, StoreSpecial, IncrSpecial, AugSpecial:
+		return ScopeSpecial
+	}
+	return ScopeGlobal
+}
+
+// jumpLabels names the targets of the jumps in code L1, L2, ... in
+// address order.
+func jumpLabels(code []Opcode) map[int]string {
+	var targets []int
+	for i := 0; i < len(code); i += instructionLength(code, i) {
+		if target, ok := jumpTarget(code, i); ok {
+			targets = append(targets, target)
+		}
+	}
+	sort.Ints(targets)
+	labels := make(map[int]string, len(targets))
+	for _, target := range targets {
+		if _, ok := labels[target]; !ok {
+			labels[target] = fmt.Sprintf("L%d", len(labels)+1)
+		}
+	}
+	return labels
+}
+
+// jumpTarget returns the address the instruction at i jumps to, if it is
+// a jump. The offset is its last operand, relative to the next instruction.
+func jumpTarget(code []Opcode, i int) (int, bool) {
+	switch code[i] {
+	case Jump, JumpTrue, JumpFalse, JumpEqual, JumpNotEq,
+		JumpLess, JumpLessEq, JumpGreater, JumpGrEq,
+		JumpLessNum, JumpLessEqNum, JumpGreaterNum, JumpGreaterEqNum,
+		JumpEqualNum, JumpNotEqualNum,
+		JumpGlobalLessNum, JumpGlobalGrEqNum, ForIn:
+		next := i + instructionLength(code, i)
+		if next > len(code) {
+			return 0, false
+		}
+		return next + int(code[next-1]), true
+	}
+	return 0, false
 }
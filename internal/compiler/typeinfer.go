@@ -458,6 +458,14 @@ func (ti *typeInferrer) inferExpr(expr ast.Expr) InferredType {
 		}
 		t = TypeUnknown
 
+	case *ast.IndirectCallExpr:
+		// Callee is only known at runtime
+		ti.inferExpr(e.Func)
+		for _, arg := range e.Args {
+			ti.inferExpr(arg)
+		}
+		t = TypeUnknown
+
 	case *ast.BuiltinExpr:
 		t = ti.inferBuiltinExpr(e)
 
@@ -595,11 +603,17 @@ func (ti *typeInferrer) inferBuiltinExpr(e *ast.BuiltinExpr) InferredType {
 	case token.F_ATAN2, token.F_COS, token.F_EXP, token.F_INT, token.F_LOG,
 		token.F_RAND, token.F_SIN, token.F_SQRT, token.F_SRAND,
 		token.F_INDEX, token.F_LENGTH, token.F_MATCH, token.F_SPLIT,
-		token.F_SUB, token.F_GSUB, token.F_SYSTEM:
+		token.F_SUB, token.F_GSUB, token.F_SYSTEM, token.F_COPY,
+		token.F_EXTEND, token.F_SPIT, token.F_STREAMNR, token.F_STRTONUM,
+		token.F_SYSTIME, token.F_MKTIME, token.F_AND, token.F_OR, token.F_XOR,
+		token.F_COMPL, token.F_LSHIFT, token.F_RSHIFT, token.F_ISARRAY,
+		token.F_ASORT, token.F_ASORTI:
 		return TypeInferNum
 
 	// String return type
-	case token.F_SPRINTF, token.F_SUBSTR, token.F_TOLOWER, token.F_TOUPPER:
+	case token.F_SPRINTF, token.F_SUBSTR, token.F_TOLOWER, token.F_TOUPPER, token.F_GENSUB,
+		token.F_NOW, token.F_SLURP, token.F_HASH, token.F_B64ENC, token.F_B64DEC,
+		token.F_URLENC, token.F_URLDEC, token.F_TIMEFMT, token.F_STRFTIME, token.F_TYPEOF:
 		return TypeInferStr
 
 	// Unknown/varies
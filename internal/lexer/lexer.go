@@ -2,7 +2,7 @@
 package lexer
 
 import (
-	"unicode/utf8"
+	"strings"
 
 	"github.com/kolkov/uawk/internal/token"
 )
@@ -193,6 +193,10 @@ func (l *Lexer) scan() Token {
 			l.next()
 			return Token{Type: token.OR, Pos: pos, Value: "||"}
 		}
+		if l.ch == '&' {
+			l.next()
+			return Token{Type: token.PIPE_BOTH, Pos: pos, Value: "|&"}
+		}
 		return Token{Type: token.PIPE, Pos: pos, Value: "|"}
 
 	case '~':
@@ -262,6 +266,18 @@ func (l *Lexer) ScanRegex() Token {
 	return Token{Type: token.ILLEGAL, Pos: pos, Value: "expected regex"}
 }
 
+// RescanRegex scans a regex starting at the / of tok, a DIV or DIV_ASSIGN
+// token just returned by Scan. The parser calls it when a / that followed
+// a token such as } or ) turns out to start a regex, not a division.
+func (l *Lexer) RescanRegex(tok Token) Token {
+	l.offset = tok.Pos.Offset
+	l.nextPos = tok.Pos
+	l.next()
+	regex := l.scanRegex(tok.Pos)
+	l.lastTok = regex.Type
+	return regex
+}
+
 func (l *Lexer) scanRegex(pos token.Position) Token {
 	l.next()              // consume opening /
 	start := l.pos.Offset // Position of first regex character
@@ -343,6 +359,9 @@ func (l *Lexer) scanString(pos token.Position) Token {
 				sb = append(sb, 'x')
 				continue
 			default:
+				// Unknown escape: keep the character, drop the backslash
+				// (as gawk does). A string used as a dynamic regex therefore
+				// needs "\\." to reach the regex engine as \.
 				sb = append(sb, l.ch)
 			}
 			l.next()
@@ -360,6 +379,64 @@ func (l *Lexer) scanString(pos token.Position) Token {
 	return Token{Type: token.STRING, Pos: pos, Value: string(sb)}
 }
 
+// Unescape processes AWK string escape sequences in s, as in a string
+// literal. Used for command-line assignments like -v RS='\0'.
+// Unknown escapes keep the escaped character; a trailing backslash is kept.
+func Unescape(s string) string {
+	if strings.IndexByte(s, '\\') < 0 {
+		return s
+	}
+	sb := make([]byte, 0, len(s))
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c != '\\' || i+1 >= len(s) {
+			sb = append(sb, c)
+			continue
+		}
+		i++
+		switch c = s[i]; c {
+		case 'n':
+			sb = append(sb, '\n')
+		case 't':
+			sb = append(sb, '\t')
+		case 'r':
+			sb = append(sb, '\r')
+		case 'b':
+			sb = append(sb, '\b')
+		case 'f':
+			sb = append(sb, '\f')
+		case 'a':
+			sb = append(sb, '\a')
+		case 'v':
+			sb = append(sb, '\v')
+		case '0', '1', '2', '3', '4', '5', '6', '7':
+			// Octal escape
+			n := int(c - '0')
+			for j := 0; j < 2 && i+1 < len(s) && s[i+1] >= '0' && s[i+1] <= '7'; j++ {
+				i++
+				n = n*8 + int(s[i]-'0')
+			}
+			sb = append(sb, byte(n))
+		case 'x':
+			// Hex escape
+			if i+1 < len(s) && isHexDigit(s[i+1]) {
+				i++
+				n := hexValue(s[i])
+				if i+1 < len(s) && isHexDigit(s[i+1]) {
+					i++
+					n = n*16 + hexValue(s[i])
+				}
+				sb = append(sb, byte(n))
+				continue
+			}
+			sb = append(sb, 'x')
+		default:
+			sb = append(sb, c)
+		}
+	}
+	return string(sb)
+}
+
 func (l *Lexer) scanNumber(pos token.Position) Token {
 	start := pos.Offset // Use position offset to include first character
 
@@ -489,20 +566,9 @@ func (l *Lexer) next() {
 
 	l.pos = l.nextPos
 
-	// Handle UTF-8
-	if l.src[l.offset] >= utf8.RuneSelf {
-		r, size := utf8.DecodeRune(l.src[l.offset:])
-		l.offset += size
-		l.nextPos.Column += size
-		l.nextPos.Offset = l.offset
-		if r == '\n' {
-			l.nextPos.Line++
-			l.nextPos.Column = 1
-		}
-		l.ch = byte(r) // Note: multi-byte runes become single byte (simplified)
-		return
-	}
-
+	// The source is scanned byte by byte. Bytes of multi-byte UTF-8
+	// sequences are all >= 0x80, so they never look like AWK syntax and
+	// reach string and regex literals unchanged.
 	l.ch = l.src[l.offset]
 	l.offset++
 	l.nextPos.Column++
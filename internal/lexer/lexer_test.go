@@ -39,6 +39,7 @@ func TestScanBasicTokens(t *testing.T) {
 		{"&&", []token.Token{token.AND, token.EOF}},
 		{"||", []token.Token{token.OR, token.EOF}},
 		{"|", []token.Token{token.PIPE, token.EOF}},
+		{"|&", []token.Token{token.PIPE_BOTH, token.EOF}},
 		{"(", []token.Token{token.LPAREN, token.EOF}},
 		{")", []token.Token{token.RPAREN, token.EOF}},
 		{"{", []token.Token{token.LBRACE, token.EOF}},
@@ -135,7 +136,7 @@ func TestScanBuiltins(t *testing.T) {
 
 	for name, expected := range builtins {
 		t.Run(name, func(t *testing.T) {
-			l := NewFromString(name)
+			l := NewFromString(name + "(")
 			tok := l.Scan()
 			if tok.Type != expected {
 				t.Errorf("expected %v for %q, got %v", expected, name, tok.Type)
@@ -147,6 +148,55 @@ func TestScanBuiltins(t *testing.T) {
 	}
 }
 
+func TestScanExtensionNames(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected token.Token
+	}{
+		{"copy(", token.NAME},
+		{"hash(", token.NAME},
+		{"copy", token.NAME},
+		{"copy (", token.NAME},
+		{"copy[", token.NAME},
+		{"extend", token.NAME},
+		{"now", token.NAME},
+		{"slurp", token.NAME},
+		{"spit", token.NAME},
+		{"streamnr", token.NAME},
+		{"hash", token.NAME},
+		{"b64enc", token.NAME},
+		{"b64dec", token.NAME},
+		{"urlenc", token.NAME},
+		{"urldec", token.NAME},
+		{"timefmt", token.NAME},
+		{"strtonum", token.NAME},
+		{"gensub", token.NAME},
+		{"strftime", token.NAME},
+		{"systime", token.NAME},
+		{"mktime", token.NAME},
+		{"and", token.NAME},
+		{"or", token.NAME},
+		{"xor", token.NAME},
+		{"compl", token.NAME},
+		{"lshift", token.NAME},
+		{"rshift", token.NAME},
+		{"typeof", token.NAME},
+		{"isarray", token.NAME},
+		{"asort", token.NAME},
+		{"asorti", token.NAME},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			l := NewFromString(tt.input)
+			tok := l.Scan()
+			if tok.Type != tt.expected {
+				t.Errorf("expected %v, got %v", tt.expected, tok.Type)
+			}
+		})
+	}
+}
+
 func TestScanIdentifiers(t *testing.T) {
 	tests := []struct {
 		input    string
@@ -224,6 +274,11 @@ func TestScanStrings(t *testing.T) {
 		{`"octal\101"`, "octalA"},     // \101 = 'A'
 		{`"hex\x41test"`, "hexAtest"}, // \x41 = 'A'
 		{`'single quotes'`, "single quotes"},
+		{`"héllo wörld"`, "héllo wörld"}, // UTF-8 kept byte for byte
+		{`"日本"`, "日本"},
+		{`"\\."`, `\.`}, // Escaped backslash survives for the regex level
+		{`"\."`, "."},   // Unknown escape: backslash dropped
+		{`"a\/b"`, "a/b"},
 	}
 
 	for _, tt := range tests {
@@ -248,6 +303,28 @@ func TestScanUnterminatedString(t *testing.T) {
 	}
 }
 
+func TestUnescape(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`plain`, "plain"},
+		{`\0`, "\x00"},
+		{`a\tb\nc`, "a\tb\nc"},
+		{`\\`, "\\"},
+		{`\101\x41`, "AA"},
+		{`\q`, "q"},
+		{`\xg`, "xg"},
+		{`end\`, "end\\"},
+	}
+
+	for _, tt := range tests {
+		if got := Unescape(tt.input); got != tt.expected {
+			t.Errorf("Unescape(%q) = %q, want %q", tt.input, got, tt.expected)
+		}
+	}
+}
+
 func TestScanRegex(t *testing.T) {
 	tests := []struct {
 		input    string
@@ -258,6 +335,7 @@ func TestScanRegex(t *testing.T) {
 		{"~ /foo/", []token.Token{token.MATCH, token.REGEX}, "foo"},
 		{"!~ /bar/", []token.Token{token.NOT_MATCH, token.REGEX}, "bar"},
 		{"if /test/", []token.Token{token.IF, token.REGEX}, "test"},
+		{"~ /wö+/", []token.Token{token.MATCH, token.REGEX}, "wö+"},
 		// Division context - not regex
 		{"x / y", []token.Token{token.NAME, token.DIV, token.NAME}, ""},
 	}
@@ -463,6 +541,25 @@ func TestScanScanRegexMethod(t *testing.T) {
 	}
 }
 
+func TestRescanRegex(t *testing.T) {
+	for _, input := range []string{"} /a b/ x", "} /=c/ x"} {
+		l := NewFromString(input)
+		l.Scan() // }
+		div := l.Scan()
+		if div.Type != token.DIV && div.Type != token.DIV_ASSIGN {
+			t.Fatalf("%q: expected DIV or DIV_ASSIGN after }, got %v", input, div.Type)
+		}
+		tok := l.RescanRegex(div)
+		want := input[3 : len(input)-3]
+		if tok.Type != token.REGEX || tok.Value != want || tok.Pos != div.Pos {
+			t.Errorf("%q: RescanRegex() = %v %q at %v, want REGEX %q at %v", input, tok.Type, tok.Value, tok.Pos, want, div.Pos)
+		}
+		if next := l.Scan(); next.Type != token.NAME || next.Value != "x" {
+			t.Errorf("%q: token after regex = %v %q, want NAME x", input, next.Type, next.Value)
+		}
+	}
+}
+
 func TestScanUnterminatedRegex(t *testing.T) {
 	l := NewFromString("~ /unterminated")
 	l.Scan() // ~
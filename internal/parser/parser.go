@@ -75,6 +75,8 @@ func tokenName(t token.Token) string {
 		return ">>"
 	case token.PIPE:
 		return "|"
+	case token.PIPE_BOTH:
+		return "|&"
 	case token.LPAREN:
 		return "("
 	case token.RPAREN:
@@ -156,9 +158,11 @@ type Parser struct {
 	errors  ErrorList    // Accumulated errors
 
 	// Parsing state
-	inAction  bool   // true if parsing pattern-action (not BEGIN/END)
-	funcName  string // current function name, empty if not in function
-	loopDepth int    // nesting depth of loops (for break/continue validation)
+	posix     bool            // extension names are never builtins (Options.POSIX)
+	funcs     map[string]bool // names of the functions the program defines
+	inAction  bool            // true if parsing pattern-action (not BEGIN/END)
+	funcName  string          // current function name, empty if not in function
+	loopDepth int             // nesting depth of loops (for break/continue validation)
 }
 
 // Parse parses an AWK program from source code.
@@ -169,8 +173,23 @@ func Parse(src string) (*ast.Program, error) {
 
 // ParseBytes parses an AWK program from byte slice.
 func ParseBytes(src []byte) (*ast.Program, error) {
+	return ParseWithOptions(src, Options{})
+}
+
+// Options adjusts parsing.
+type Options struct {
+	// POSIX parses the program as POSIX AWK: the names of extension
+	// builtins such as hash or now are plain names, so calling one calls
+	// a user-defined function.
+	POSIX bool
+}
+
+// ParseWithOptions is like ParseBytes but with the given options.
+func ParseWithOptions(src []byte, opts Options) (*ast.Program, error) {
 	p := &Parser{
 		lexer: lexer.New(src),
+		posix: opts.POSIX,
+		funcs: funcNames(src),
 	}
 	p.next() // Initialize first token
 
@@ -464,10 +483,15 @@ func (p *Parser) parseBlock() *ast.BlockStmt {
 			p.next()
 			continue
 		}
+		offset := p.tok.Pos.Offset
 		stmt := p.parseStmt()
 		if stmt != nil {
 			stmts = append(stmts, stmt)
 		}
+		if p.tok.Pos.Offset == offset && len(p.errors) > 0 {
+			// Skip the token the error stopped at, so parsing ends
+			p.next()
+		}
 	}
 
 	endPos := p.tok.Pos
@@ -813,7 +837,7 @@ func (p *Parser) parsePrintStmt() *ast.PrintStmt {
 	// Parse redirect
 	redirect := token.ILLEGAL
 	var dest ast.Expr
-	if p.match(token.GREATER, token.APPEND, token.PIPE) {
+	if p.match(token.GREATER, token.APPEND, token.PIPE, token.PIPE_BOTH) {
 		redirect = p.tok.Type
 		p.next()
 		dest = p.parseExpr()
@@ -846,25 +870,29 @@ func (p *Parser) parsePrintExpr() ast.Expr {
 	return p.parseAssign(p.parsePrintCond)
 }
 
-// parseGetline handles the special "expr | getline [var]" case.
+// parseGetline handles the special "expr | getline [var]" and
+// "expr |& getline [var]" cases.
 func (p *Parser) parseGetline() ast.Expr {
 	expr := p.parseCond()
 
-	// Check for: expr | getline [var]
-	if p.tok.Type == token.PIPE {
+	// Check for: expr | getline [var] or expr |& getline [var]
+	if p.tok.Type == token.PIPE || p.tok.Type == token.PIPE_BOTH {
+		coprocess := p.tok.Type == token.PIPE_BOTH
+		op := p.tok.Value
 		p.next()
 		if p.tok.Type == token.GETLINE {
 			p.next()
 			target := p.parseOptionalLValue()
 			return &ast.GetlineExpr{
-				BaseExpr: ast.MakeBaseExpr(expr.Pos(), p.tok.Pos),
-				Command:  expr,
-				Target:   target,
+				BaseExpr:  ast.MakeBaseExpr(expr.Pos(), p.tok.Pos),
+				Command:   expr,
+				Coprocess: coprocess,
+				Target:    target,
 			}
 		}
 		// Not getline, continue as binary OR... but PIPE is not OR
 		// This is an error case
-		p.errorf("expected getline after |")
+		p.errorf("expected getline after %s", op)
 	}
 
 	return expr
@@ -903,7 +931,7 @@ func (p *Parser) parseAssign(higher func() ast.Expr) ast.Expr {
 					}
 				}
 			}
-			p.errorf("left side of assignment must be a variable, field, or array element")
+			p.error(errorf(startPos, "left side of assignment must be a variable, field, or array element"))
 			return expr
 		}
 		return p.makeAssign(expr, op, right)
@@ -1097,6 +1125,22 @@ func (p *Parser) parseConcat() ast.Expr {
 	return expr
 }
 
+// parseFieldPostfix parses an optional post-increment or post-decrement
+// of the field expression expr.
+func (p *Parser) parseFieldPostfix(startPos token.Position, expr *ast.FieldExpr) ast.Expr {
+	if p.match(token.INCR, token.DECR) {
+		op := p.tok.Type
+		p.next()
+		return &ast.UnaryExpr{
+			BaseExpr: ast.MakeBaseExpr(startPos, p.tok.Pos),
+			Op:       op,
+			Expr:     expr,
+			Post:     true,
+		}
+	}
+	return expr
+}
+
 // canStartPrimary returns true if current token can start a primary expression.
 func (p *Parser) canStartPrimary() bool {
 	switch p.tok.Type {
@@ -1193,8 +1237,9 @@ func (p *Parser) parsePrimary() ast.Expr {
 		}
 
 	case token.DIV, token.DIV_ASSIGN:
-		// Regex in expression position
-		tok := p.lexer.ScanRegex()
+		// Regex in expression position, lexed as division after a token
+		// such as } or ) where / usually divides
+		tok := p.lexer.RescanRegex(p.tok)
 		if tok.Type == token.ILLEGAL {
 			p.errorf("%s", tok.Value)
 			return nil
@@ -1212,26 +1257,40 @@ func (p *Parser) parsePrimary() ast.Expr {
 		if index == nil {
 			return nil
 		}
-		expr := &ast.FieldExpr{
+		return p.parseFieldPostfix(startPos, &ast.FieldExpr{
 			BaseExpr: ast.MakeBaseExpr(startPos, index.End()),
 			Index:    index,
-		}
-		// Field expressions can have post-increment
-		if p.match(token.INCR, token.DECR) {
-			op := p.tok.Type
-			p.next()
-			return &ast.UnaryExpr{
-				BaseExpr: ast.MakeBaseExpr(startPos, p.tok.Pos),
-				Op:       op,
-				Expr:     expr,
-				Post:     true,
-			}
-		}
-		return expr
+		})
 
 	case token.AT:
 		p.next()
-		return p.parsePrimary() // Named field - simplified
+		if p.tok.Type == token.STRING || p.tok.Type == token.LPAREN {
+			// Named field: @"name" is the field under the header column name
+			index := p.parsePrimary()
+			if index == nil {
+				return nil
+			}
+			return p.parseFieldPostfix(startPos, &ast.FieldExpr{
+				BaseExpr: ast.MakeBaseExpr(startPos, index.End()),
+				Index:    index,
+				Named:    true,
+			})
+		}
+		// Indirect call: @name(args) calls the function named by name's value
+		name, namePos := p.expectName()
+		if name == "" {
+			return nil
+		}
+		if p.tok.Type != token.LPAREN || p.lexer.HadSpace() {
+			p.errorf("expected function call after @, not %s", p.tokenDesc())
+			return nil
+		}
+		call := p.parseUserCall(name, namePos)
+		return &ast.IndirectCallExpr{
+			BaseExpr: ast.MakeBaseExpr(startPos, call.End()),
+			Func:     &ast.Ident{BaseExpr: ast.MakeBaseExpr(namePos, namePos), Name: name},
+			Args:     call.Args,
+		}
 
 	case token.NOT:
 		p.next()
@@ -1293,6 +1352,9 @@ func (p *Parser) parsePrimary() ast.Expr {
 
 		// Function call: name(args) - no space between name and (
 		if p.tok.Type == token.LPAREN && !p.lexer.HadSpace() {
+			if fn := p.extension(name); fn != token.ILLEGAL {
+				return p.parseBuiltinArgs(fn, namePos)
+			}
 			return p.parseUserCall(name, namePos)
 		}
 
@@ -1440,12 +1502,28 @@ func (p *Parser) parseUserCall(name string, namePos token.Position) *ast.CallExp
 	}
 }
 
+// extension returns the extension builtin that a call to name calls, or
+// ILLEGAL if name is not one, the program defines a function of that name,
+// which takes priority, or the program is parsed as POSIX AWK.
+func (p *Parser) extension(name string) token.Token {
+	fn := token.LookupBuiltin(name)
+	if !fn.IsExtension() || p.funcs[name] || p.posix {
+		return token.ILLEGAL
+	}
+	return fn
+}
+
 // parseBuiltinCall parses a built-in function call.
 func (p *Parser) parseBuiltinCall() ast.Expr {
 	startPos := p.tok.Pos
 	fn := p.tok.Type
 	p.next()
+	return p.parseBuiltinArgs(fn, startPos)
+}
 
+// parseBuiltinArgs parses the arguments of a call to builtin fn, whose
+// name is at startPos and has been consumed.
+func (p *Parser) parseBuiltinArgs(fn token.Token, startPos token.Position) ast.Expr {
 	switch fn {
 	case token.F_LENGTH:
 		// length can be called without parens
@@ -1463,7 +1541,7 @@ func (p *Parser) parseBuiltinCall() ast.Expr {
 			Args:     args,
 		}
 
-	case token.F_RAND:
+	case token.F_RAND, token.F_SYSTIME:
 		p.expect(token.LPAREN)
 		p.expect(token.RPAREN)
 		return &ast.BuiltinExpr{
@@ -1472,7 +1550,7 @@ func (p *Parser) parseBuiltinCall() ast.Expr {
 			Args:     nil,
 		}
 
-	case token.F_SRAND, token.F_FFLUSH:
+	case token.F_SRAND, token.F_FFLUSH, token.F_NOW:
 		p.expect(token.LPAREN)
 		var args []ast.Expr
 		if p.tok.Type != token.RPAREN {
@@ -1486,7 +1564,9 @@ func (p *Parser) parseBuiltinCall() ast.Expr {
 		}
 
 	case token.F_COS, token.F_SIN, token.F_EXP, token.F_LOG, token.F_SQRT,
-		token.F_INT, token.F_TOLOWER, token.F_TOUPPER, token.F_SYSTEM, token.F_CLOSE:
+		token.F_INT, token.F_TOLOWER, token.F_TOUPPER, token.F_SYSTEM, token.F_SLURP,
+		token.F_STREAMNR, token.F_B64ENC, token.F_B64DEC, token.F_URLENC, token.F_URLDEC,
+		token.F_STRTONUM, token.F_COMPL, token.F_TYPEOF, token.F_ISARRAY:
 		// 1-argument functions
 		p.expect(token.LPAREN)
 		arg := p.parseExpr()
@@ -1497,7 +1577,23 @@ func (p *Parser) parseBuiltinCall() ast.Expr {
 			Args:     []ast.Expr{arg},
 		}
 
-	case token.F_ATAN2, token.F_INDEX:
+	case token.F_CLOSE, token.F_MKTIME:
+		// close(name [, how]), where how is "to" or "from" for
+		// coprocesses, and mktime(spec [, utc])
+		p.expect(token.LPAREN)
+		args := []ast.Expr{p.parseExpr()}
+		if p.tok.Type == token.COMMA {
+			p.commaNewlines()
+			args = append(args, p.parseExpr())
+		}
+		p.expect(token.RPAREN)
+		return &ast.BuiltinExpr{
+			BaseExpr: ast.MakeBaseExpr(startPos, p.tok.Pos),
+			Func:     fn,
+			Args:     args,
+		}
+
+	case token.F_ATAN2, token.F_INDEX, token.F_HASH, token.F_LSHIFT, token.F_RSHIFT:
 		// 2-argument functions
 		p.expect(token.LPAREN)
 		arg1 := p.parseExpr()
@@ -1510,7 +1606,9 @@ func (p *Parser) parseBuiltinCall() ast.Expr {
 			Args:     []ast.Expr{arg1, arg2},
 		}
 
-	case token.F_SUBSTR:
+	case token.F_SUBSTR, token.F_SPIT, token.F_TIMEFMT:
+		// substr(s, start [, len]), spit(file, content [, append]) and
+		// timefmt(ts, layout [, utc])
 		p.expect(token.LPAREN)
 		str := p.parseExpr()
 		p.commaNewlines()
@@ -1527,7 +1625,27 @@ func (p *Parser) parseBuiltinCall() ast.Expr {
 			Args:     args,
 		}
 
-	case token.F_SPRINTF:
+	case token.F_STRFTIME:
+		// strftime([format [, timestamp [, utc]]]); the checker limits
+		// the count
+		p.expect(token.LPAREN)
+		var args []ast.Expr
+		if p.tok.Type != token.RPAREN {
+			args = append(args, p.parseExpr())
+			for p.tok.Type == token.COMMA {
+				p.commaNewlines()
+				args = append(args, p.parseExpr())
+			}
+		}
+		p.expect(token.RPAREN)
+		return &ast.BuiltinExpr{
+			BaseExpr: ast.MakeBaseExpr(startPos, p.tok.Pos),
+			Func:     fn,
+			Args:     args,
+		}
+
+	case token.F_SPRINTF, token.F_AND, token.F_OR, token.F_XOR:
+		// sprintf(format, ...) and the variadic and(), or() and xor()
 		p.expect(token.LPAREN)
 		args := []ast.Expr{p.parseExpr()}
 		for p.tok.Type == token.COMMA {
@@ -1561,6 +1679,43 @@ func (p *Parser) parseBuiltinCall() ast.Expr {
 			Args:     args,
 		}
 
+	case token.F_COPY, token.F_EXTEND:
+		// copy(src, dst) and extend(dst, src) - both arguments are array names
+		p.expect(token.LPAREN)
+		firstName, firstPos := p.expectName()
+		first := &ast.Ident{BaseExpr: ast.MakeBaseExpr(firstPos, p.tok.Pos), Name: firstName}
+		p.commaNewlines()
+		secondName, secondPos := p.expectName()
+		second := &ast.Ident{BaseExpr: ast.MakeBaseExpr(secondPos, p.tok.Pos), Name: secondName}
+		p.expect(token.RPAREN)
+		return &ast.BuiltinExpr{
+			BaseExpr: ast.MakeBaseExpr(startPos, p.tok.Pos),
+			Func:     fn,
+			Args:     []ast.Expr{first, second},
+		}
+
+	case token.F_ASORT, token.F_ASORTI:
+		// asort(src [, dst [, how]]) and asorti(src [, dst [, how]]) -
+		// src and dst are array names
+		p.expect(token.LPAREN)
+		srcName, srcPos := p.expectName()
+		args := []ast.Expr{&ast.Ident{BaseExpr: ast.MakeBaseExpr(srcPos, p.tok.Pos), Name: srcName}}
+		if p.tok.Type == token.COMMA {
+			p.commaNewlines()
+			dstName, dstPos := p.expectName()
+			args = append(args, &ast.Ident{BaseExpr: ast.MakeBaseExpr(dstPos, p.tok.Pos), Name: dstName})
+			if p.tok.Type == token.COMMA {
+				p.commaNewlines()
+				args = append(args, p.parseExpr())
+			}
+		}
+		p.expect(token.RPAREN)
+		return &ast.BuiltinExpr{
+			BaseExpr: ast.MakeBaseExpr(startPos, p.tok.Pos),
+			Func:     fn,
+			Args:     args,
+		}
+
 	case token.F_SUB, token.F_GSUB:
 		p.expect(token.LPAREN)
 		regex := p.parseRegexOrExpr(p.parseExpr)
@@ -1582,6 +1737,25 @@ func (p *Parser) parseBuiltinCall() ast.Expr {
 			Args:     args,
 		}
 
+	case token.F_GENSUB:
+		// gensub(regex, repl, how [, target]) - the target is not assigned
+		p.expect(token.LPAREN)
+		args := []ast.Expr{p.parseRegexOrExpr(p.parseExpr)}
+		p.commaNewlines()
+		args = append(args, p.parseExpr())
+		p.commaNewlines()
+		args = append(args, p.parseExpr())
+		if p.tok.Type == token.COMMA {
+			p.commaNewlines()
+			args = append(args, p.parseExpr())
+		}
+		p.expect(token.RPAREN)
+		return &ast.BuiltinExpr{
+			BaseExpr: ast.MakeBaseExpr(startPos, p.tok.Pos),
+			Func:     fn,
+			Args:     args,
+		}
+
 	case token.F_MATCH:
 		p.expect(token.LPAREN)
 		str := p.parseExpr()
@@ -1604,7 +1778,7 @@ func (p *Parser) parseBuiltinCall() ast.Expr {
 func (p *Parser) parseRegexOrExpr(fallback func() ast.Expr) ast.Expr {
 	if p.match(token.DIV, token.DIV_ASSIGN) {
 		startPos := p.tok.Pos
-		tok := p.lexer.ScanRegex()
+		tok := p.lexer.RescanRegex(p.tok)
 		if tok.Type == token.ILLEGAL {
 			p.errorf("%s", tok.Value)
 			return nil
@@ -1623,6 +1797,25 @@ func (p *Parser) parseRegexOrExpr(fallback func() ast.Expr) ast.Expr {
 // Helper functions
 // -----------------------------------------------------------------------------
 
+// funcNames returns the names of the functions src defines, so that a call
+// before the definition resolves to it rather than to an extension builtin.
+func funcNames(src []byte) map[string]bool {
+	names := make(map[string]bool)
+	l := lexer.New(src)
+	for tok := l.Scan(); tok.Type != token.EOF; tok = l.Scan() {
+		if tok.Type != token.FUNCTION {
+			continue
+		}
+		if tok = l.Scan(); tok.Type == token.EOF {
+			break
+		}
+		if tok.Type == token.NAME {
+			names[tok.Value] = true
+		}
+	}
+	return names
+}
+
 // parseBinaryLeft parses left-associative binary operators.
 func (p *Parser) parseBinaryLeft(higher func() ast.Expr, allowNewline bool, ops ...token.Token) ast.Expr {
 	expr := higher()
@@ -1656,7 +1849,7 @@ func (p *Parser) parseExprList(parse func() ast.Expr) []ast.Expr {
 	first := true
 
 	for !p.match(token.NEWLINE, token.SEMICOLON, token.RBRACE, token.RBRACKET,
-		token.RPAREN, token.GREATER, token.PIPE, token.APPEND, token.EOF) {
+		token.RPAREN, token.GREATER, token.PIPE, token.PIPE_BOTH, token.APPEND, token.EOF) {
 		if !first {
 			p.commaNewlines()
 		}
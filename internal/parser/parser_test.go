@@ -1,6 +1,7 @@
 package parser_test
 
 import (
+	"strings"
 	"testing"
 
 	"github.com/kolkov/uawk/internal/ast"
@@ -423,6 +424,34 @@ func TestParseExpr(t *testing.T) {
 				return ok && b.Func == token.F_SPLIT && len(b.Args) == 3
 			},
 		},
+		{
+			name: "indirect call",
+			src:  "@f(x, 1)",
+			check: func(e ast.Expr) bool {
+				c, ok := e.(*ast.IndirectCallExpr)
+				return ok && c.Func.Name == "f" && len(c.Args) == 2
+			},
+		},
+		{
+			name: "named field",
+			src:  `@"value"`,
+			check: func(e ast.Expr) bool {
+				f, ok := e.(*ast.FieldExpr)
+				return ok && f.Named
+			},
+		},
+		{
+			name: "named field expression post-increment",
+			src:  `@("na" "me")++`,
+			check: func(e ast.Expr) bool {
+				u, ok := e.(*ast.UnaryExpr)
+				if !ok || !u.Post {
+					return false
+				}
+				f, ok := u.Expr.(*ast.FieldExpr)
+				return ok && f.Named
+			},
+		},
 		{
 			name: "getline",
 			src:  "getline",
@@ -439,6 +468,14 @@ func TestParseExpr(t *testing.T) {
 				return ok && g.Target != nil
 			},
 		},
+		{
+			name: "coprocess getline",
+			src:  `"cmd" |& getline x`,
+			check: func(e ast.Expr) bool {
+				g, ok := e.(*ast.GetlineExpr)
+				return ok && g.Coprocess && g.Command != nil && g.Target != nil
+			},
+		},
 		{
 			name: "grouped expression",
 			src:  "(a + b)",
@@ -756,6 +793,11 @@ func TestParseErrors(t *testing.T) {
 		{"return outside function", "BEGIN { return 1 }"},
 		{"next in BEGIN", "BEGIN { next }"},
 		{"duplicate param", "function f(a, a) { }"},
+		{"at without call", "BEGIN { x = 1; print @x }"},
+		{"at with index", "BEGIN { print @a[1] }"},
+		{"at with number", "BEGIN { print @1 }"},
+		{"at with space before paren", "BEGIN { print @f (1) }"},
+		{"lone slash", "{ if (1) / }"},
 	}
 
 	for _, tt := range tests {
@@ -783,6 +825,118 @@ func TestParseErrorPosition(t *testing.T) {
 	}
 }
 
+// TestAssignTargetError tests that assigning to something other than a
+// variable, field or array element is reported at the assignment target.
+func TestAssignTargetError(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want string
+	}{
+		{"ternary", "BEGIN { (c ? a : b) = 1 }", "1:9"},
+		{"call", "BEGIN {\n  x = 1; rand() = 1\n}", "2:10"},
+		{"constant", "BEGIN { 3 += x }", "1:9"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parser.Parse(tt.src)
+			if err == nil {
+				t.Fatalf("Parse(%q) expected error, got none", tt.src)
+			}
+			msg := err.Error()
+			if !strings.Contains(msg, "left side of assignment must be a variable, field, or array element") {
+				t.Errorf("error = %q, want left side of assignment message", msg)
+			}
+			if !strings.Contains(msg, tt.want) {
+				t.Errorf("error = %q, want position %s", msg, tt.want)
+			}
+		})
+	}
+}
+
+// TestRegexContext tests that / starts a regex, not a division, wherever
+// an operand is expected, including after } and ) where it usually divides.
+func TestRegexContext(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want string // printed statement or pattern
+	}{
+		{"subscript", `{ a[/re/] }`, "a[/re/]"},
+		{"print", `{ print /re/ }`, "print /re/"},
+		{"comma", `{ print 1, /re/ }`, "print 1, /re/"},
+		{"call argument", `{ f(1, /re/) }`, "f(1, /re/)"},
+		{"return", `function f() { return /re/ }`, "return /re/"},
+		{"paren", `{ x = (/re/) }`, "x = (/re/)"},
+		{"ternary", `{ x = c ? /re/ : /re2/ }`, "x = c ? /re/ : /re2/"},
+		{"not", `{ x = !/re/ }`, "x = !/re/"},
+		{"and", `{ x = 1 && /re/ }`, "x = 1 && /re/"},
+		{"if body", `{ if (x) /re/ }`, "if (x) /re/"},
+		{"while body", `{ while (x) /re/ }`, "while (x) /re/"},
+		{"after BEGIN block", `BEGIN { } /re/`, "/re/"},
+		{"after rule", `{ x } /re/ { y }`, "/re/"},
+		{"starting with =", `BEGIN { } /=/`, "/=/"},
+		{"division", `{ x = 4 /2/ 1 }`, "x = (4 / 2) / 1"},
+		{"division after ]", `{ x = a[1] /2/ 1 }`, "x = (a[1] / 2) / 1"},
+		{"division after )", `{ x = (4) /2/ 1 }`, "x = ((4) / 2) / 1"},
+		{"division in pattern", `$1 /2/ 1`, "($1 / 2) / 1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			prog, err := parser.Parse(tt.src)
+			if err != nil {
+				t.Fatalf("Parse(%q) error = %v", tt.src, err)
+			}
+			var sb strings.Builder
+			if err := ast.NewPrinter(&sb).Print(prog); err != nil {
+				t.Fatal(err)
+			}
+			if !strings.Contains(sb.String(), tt.want) {
+				t.Errorf("Parse(%q) printed %q, want it to contain %q", tt.src, sb.String(), tt.want)
+			}
+		})
+	}
+}
+
+// TestBareLength tests that length without parentheses is length($0)
+// followed by whatever operator comes next, in every expression context.
+func TestBareLength(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want string
+	}{
+		{"print", `{ print length }`, "print length()"},
+		{"assign", `{ x = length }`, "x = length()"},
+		{"pattern", `length > 5`, "length() > 5"},
+		{"subscript", `{ a[length] }`, "a[length()]"},
+		{"plus", `{ x = length + 1 }`, "x = length() + 1"},
+		{"divide", `{ x = length/2 }`, "x = length() / 2"},
+		{"mixed", `{ x = length * 2 - length }`, "x = (length() * 2) - length()"},
+		{"concat", `{ x = length "x" }`, `x = length() "x"`},
+		{"negate", `{ x = -length }`, "x = -length()"},
+		{"ternary", `{ x = length ? 1 : 2 }`, "x = length() ? 1 : 2"},
+		{"argument", `{ f(length, 1) }`, "f(length(), 1)"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			prog, err := parser.Parse(tt.src)
+			if err != nil {
+				t.Fatalf("Parse(%q) error = %v", tt.src, err)
+			}
+			var sb strings.Builder
+			if err := ast.NewPrinter(&sb).Print(prog); err != nil {
+				t.Fatal(err)
+			}
+			if !strings.Contains(sb.String(), tt.want) {
+				t.Errorf("Parse(%q) printed %q, want it to contain %q", tt.src, sb.String(), tt.want)
+			}
+		})
+	}
+}
+
 // TestConcatenation tests implicit concatenation parsing.
 func TestConcatenation(t *testing.T) {
 	tests := []struct {
@@ -823,6 +977,41 @@ func TestBuiltinFunctions(t *testing.T) {
 		"index(s, t)",
 		"split(s, a)",
 		`split(s, a, ":")`,
+		"copy(a, b)",
+		"extend(a, b)",
+		"asort(a)",
+		"asorti(a, b)",
+		`asort(a, b, "@val_num_desc")`,
+		"now()",
+		`now("YYYY")`,
+		`slurp("f")`,
+		`spit("f", s)`,
+		`spit("f", s, 1)`,
+		`streamnr("f")`,
+		`hash("sha256", $0)`,
+		`b64enc($1)`,
+		`b64dec($1)`,
+		`urlenc($1)`,
+		`urldec($1)`,
+		`strtonum($1)`,
+		`gensub(/(a)(b)/, "\\2\\1", "g")`,
+		`gensub("x", "y", 2, s)`,
+		`timefmt($1, "2006-01-02")`,
+		`timefmt($1, "15:04", 1)`,
+		"systime()",
+		"and(a, b)",
+		"or(a, b, c)",
+		"xor(1, 2)",
+		"compl(x)",
+		"lshift(x, 4)",
+		"typeof(x)",
+		"isarray(x)",
+		"rshift(x, 4)",
+		`mktime("2024 01 02 03 04 05")`,
+		`mktime(s, 1)`,
+		"strftime()",
+		`strftime("%Y")`,
+		`strftime("%F %T", t, 1)`,
 		"sprintf(\"%d\", x)",
 		"sub(/re/, r)",
 		"sub(/re/, r, s)",
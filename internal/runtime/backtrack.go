@@ -0,0 +1,1068 @@
+package runtime
+
+import (
+	"fmt"
+	"regexp/syntax"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// errInvalidBackref is reported for back-references to groups that do not exist.
+const errInvalidBackref syntax.ErrorCode = "invalid back reference"
+
+// needsBacktrack reports whether pattern uses constructs that coregex cannot
+// handle and that require the backtracking matcher: back-references (\1-\9)
+// and lookahead assertions ((?=re), (?!re)).
+// Escapes inside bracket expressions are ignored.
+func needsBacktrack(pattern string) bool {
+	inClass := false
+	for i := 0; i < len(pattern); i++ {
+		c := pattern[i]
+		switch {
+		case c == '\\':
+			if !inClass && i+1 < len(pattern) && pattern[i+1] >= '1' && pattern[i+1] <= '9' {
+				return true
+			}
+			i++
+		case c == '(' && !inClass:
+			if strings.HasPrefix(pattern[i+1:], "?=") || strings.HasPrefix(pattern[i+1:], "?!") {
+				return true
+			}
+		case c == '[' && !inClass:
+			inClass = true
+			// A ']' right after '[' or '[^' is a literal member
+			if i+1 < len(pattern) && pattern[i+1] == '^' {
+				i++
+			}
+			if i+1 < len(pattern) && pattern[i+1] == ']' {
+				i++
+			}
+		case c == '[' && inClass && i+1 < len(pattern) && pattern[i+1] == ':':
+			// Skip POSIX class like [:alpha:]
+			if end := strings.Index(pattern[i+2:], ":]"); end >= 0 {
+				i += end + 3
+			}
+		case c == ']' && inClass:
+			inClass = false
+		}
+	}
+	return false
+}
+
+// btKind identifies a backtracking node type.
+type btKind uint8
+
+const (
+	btEmpty     btKind = iota // Matches the empty string
+	btLiteral                 // Single rune
+	btAny                     // Any rune, including newline
+	btClass                   // Rune ranges
+	btBeginText               // ^ or \A
+	btEndText                 // $ or \z
+	btWordB                   // \b
+	btNoWordB                 // \B
+	btConcat                  // Sequence of subs
+	btAlternate               // Alternation of subs
+	btRepeat                  // Repetition of subs[0]
+	btCapture                 // Capturing group around subs[0]
+	btBackref                 // Back-reference to group n
+	btLookahead               // Zero-width assertion on subs[0]
+)
+
+// btNode is a node of the backtracking matcher's pattern tree.
+type btNode struct {
+	kind   btKind
+	r      rune   // btLiteral
+	ranges []rune // btClass: pairs of lo, hi
+	subs   []*btNode
+	min    int  // btRepeat
+	max    int  // btRepeat: -1 means unbounded
+	greedy bool // btRepeat
+	negate bool // btLookahead: (?!re) rather than (?=re)
+	n      int  // btCapture, btBackref: group number
+}
+
+// backtracker is a leftmost-first backtracking regex matcher.
+// It supports the constructs coregex cannot express (back-references and
+// lookahead) and is only used in non-POSIX mode, where Perl-like semantics apply.
+// The pattern tree is compiled into a program that runs on an explicit
+// backtrack stack. Matching is exponential in the worst case, so it is
+// never used for patterns the linear engine can handle, and a search
+// that exceeds its budget panics with a [BacktrackLimitError].
+type backtracker struct {
+	pattern string     // Pattern as written by the user, for errors
+	prog    []btInst   // Main program
+	subs    [][]btInst // Lookahead sub-programs
+	size    int        // Instructions in prog and subs
+	nregs   int        // Registers, including submatch positions
+	ngroups int
+}
+
+// compileBacktrack parses pattern into a backtracking matcher.
+// Errors use regexp/syntax error codes for consistency with coregex.
+func compileBacktrack(pattern string) (*backtracker, error) {
+	p := &btParser{src: pattern}
+	node, err := p.parseAlternate()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.src) {
+		// Only an unmatched ')' stops the top-level parse early
+		return nil, &syntax.Error{Code: syntax.ErrUnexpectedParen, Expr: pattern}
+	}
+	for _, n := range p.backrefs {
+		if n > p.ngroups {
+			return nil, &syntax.Error{Code: errInvalidBackref, Expr: `\` + strconv.Itoa(n)}
+		}
+	}
+	prog, subs, nregs, err := compileProgram(node, p.ngroups)
+	if err != nil {
+		return nil, err
+	}
+	size := len(prog)
+	for _, sub := range subs {
+		size += len(sub)
+	}
+	return &backtracker{prog: prog, subs: subs, size: size, nregs: nregs, ngroups: p.ngroups}, nil
+}
+
+// =============================================================================
+// Parser
+// =============================================================================
+
+// btParser is a recursive-descent parser for the backtracking matcher.
+type btParser struct {
+	src      string
+	pos      int
+	ngroups  int
+	backrefs []int
+}
+
+func (p *btParser) parseAlternate() (*btNode, error) {
+	var alts []*btNode
+	for {
+		n, err := p.parseConcat()
+		if err != nil {
+			return nil, err
+		}
+		alts = append(alts, n)
+		if p.pos >= len(p.src) || p.src[p.pos] != '|' {
+			break
+		}
+		p.pos++
+	}
+	if len(alts) == 1 {
+		return alts[0], nil
+	}
+	return &btNode{kind: btAlternate, subs: alts}, nil
+}
+
+func (p *btParser) parseConcat() (*btNode, error) {
+	var items []*btNode
+	for p.pos < len(p.src) {
+		c := p.src[p.pos]
+		if c == '|' || c == ')' {
+			break
+		}
+		atom, err := p.parseAtom()
+		if err != nil {
+			return nil, err
+		}
+		if atom == nil {
+			continue // Flag group such as (?s)
+		}
+		atom, err = p.parseRepeat(atom)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, atom)
+	}
+	switch len(items) {
+	case 0:
+		return &btNode{kind: btEmpty}, nil
+	case 1:
+		return items[0], nil
+	}
+	return &btNode{kind: btConcat, subs: items}, nil
+}
+
+// parseRepeat applies a quantifier following atom, if any.
+func (p *btParser) parseRepeat(atom *btNode) (*btNode, error) {
+	if p.pos >= len(p.src) {
+		return atom, nil
+	}
+	start := p.pos
+	var min, max int
+	switch p.src[p.pos] {
+	case '*':
+		min, max = 0, -1
+		p.pos++
+	case '+':
+		min, max = 1, -1
+		p.pos++
+	case '?':
+		min, max = 0, 1
+		p.pos++
+	case '{':
+		lo, hi, size, ok := parseRepeatBraces(p.src[p.pos:])
+		if !ok {
+			return atom, nil // Literal '{'
+		}
+		if (hi >= 0 && hi < lo) || lo > 1000 || hi > 1000 {
+			return nil, &syntax.Error{Code: syntax.ErrInvalidRepeatSize, Expr: p.src[start : start+size]}
+		}
+		min, max = lo, hi
+		p.pos += size
+	default:
+		return atom, nil
+	}
+
+	greedy := true
+	if p.pos < len(p.src) && p.src[p.pos] == '?' {
+		greedy = false
+		p.pos++
+	}
+
+	// Nested quantifiers like a** are rejected, as in regexp/syntax
+	if p.pos < len(p.src) {
+		switch p.src[p.pos] {
+		case '*', '+', '?':
+			return nil, &syntax.Error{Code: syntax.ErrInvalidRepeatOp, Expr: p.src[start : p.pos+1]}
+		case '{':
+			if _, _, size, ok := parseRepeatBraces(p.src[p.pos:]); ok {
+				return nil, &syntax.Error{Code: syntax.ErrInvalidRepeatOp, Expr: p.src[start : p.pos+size]}
+			}
+		}
+	}
+
+	return &btNode{kind: btRepeat, subs: []*btNode{atom}, min: min, max: max, greedy: greedy}, nil
+}
+
+// parseRepeatBraces parses {n}, {n,} or {n,m} at the start of s.
+// Returns hi=-1 for an open upper bound and ok=false if s is not a repeat.
+func parseRepeatBraces(s string) (lo, hi, size int, ok bool) {
+	end := strings.IndexByte(s, '}')
+	if end < 2 {
+		return 0, 0, 0, false
+	}
+	body := s[1:end]
+	loStr, hiStr, hasComma := strings.Cut(body, ",")
+	lo, err := strconv.Atoi(loStr)
+	if err != nil || !isDigits(loStr) {
+		return 0, 0, 0, false
+	}
+	switch {
+	case !hasComma:
+		hi = lo
+	case hiStr == "":
+		hi = -1
+	default:
+		if !isDigits(hiStr) {
+			return 0, 0, 0, false
+		}
+		hi, _ = strconv.Atoi(hiStr)
+	}
+	return lo, hi, end + 1, true
+}
+
+func isDigits(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// parseAtom parses a single atom. Returns nil for flag-only groups like (?s).
+func (p *btParser) parseAtom() (*btNode, error) {
+	c := p.src[p.pos]
+	switch c {
+	case '(':
+		return p.parseGroup()
+	case '[':
+		return p.parseClass()
+	case '\\':
+		return p.parseEscape()
+	case '.':
+		p.pos++
+		return &btNode{kind: btAny}, nil
+	case '^':
+		p.pos++
+		return &btNode{kind: btBeginText}, nil
+	case '$':
+		p.pos++
+		return &btNode{kind: btEndText}, nil
+	case '*', '+', '?':
+		return nil, &syntax.Error{Code: syntax.ErrMissingRepeatArgument, Expr: p.src[p.pos : p.pos+1]}
+	case '{':
+		if _, _, size, ok := parseRepeatBraces(p.src[p.pos:]); ok {
+			return nil, &syntax.Error{Code: syntax.ErrMissingRepeatArgument, Expr: p.src[p.pos : p.pos+size]}
+		}
+	}
+	r, size := utf8.DecodeRuneInString(p.src[p.pos:])
+	p.pos += size
+	return &btNode{kind: btLiteral, r: r}, nil
+}
+
+// parseGroup parses (re), (?:re), lookaheads (?=re) / (?!re) and flag
+// groups like (?s).
+func (p *btParser) parseGroup() (*btNode, error) {
+	start := p.pos
+	p.pos++ // '('
+
+	if strings.HasPrefix(p.src[p.pos:], "?=") || strings.HasPrefix(p.src[p.pos:], "?!") {
+		negate := p.src[p.pos+1] == '!'
+		p.pos += 2
+		sub, err := p.parseAlternate()
+		if err != nil {
+			return nil, err
+		}
+		if p.pos >= len(p.src) || p.src[p.pos] != ')' {
+			return nil, &syntax.Error{Code: syntax.ErrMissingParen, Expr: p.src[start:]}
+		}
+		p.pos++
+		return &btNode{kind: btLookahead, subs: []*btNode{sub}, negate: negate}, nil
+	}
+
+	capture := true
+	if strings.HasPrefix(p.src[p.pos:], "?") {
+		end := strings.IndexAny(p.src[p.pos:], ":)")
+		if end < 0 {
+			return nil, &syntax.Error{Code: syntax.ErrMissingParen, Expr: p.src[start:]}
+		}
+		flags := p.src[p.pos+1 : p.pos+end]
+		// Dot always matches newline here (AWK semantics), so only s is accepted
+		if strings.Trim(flags, "s") != "" {
+			return nil, &syntax.Error{Code: syntax.ErrInvalidPerlOp, Expr: p.src[start : p.pos+end+1]}
+		}
+		if p.src[p.pos+end] == ')' {
+			p.pos += end + 1
+			return nil, nil
+		}
+		p.pos += end + 1
+		capture = false
+	}
+
+	var n int
+	if capture {
+		p.ngroups++
+		n = p.ngroups
+	}
+	sub, err := p.parseAlternate()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos >= len(p.src) || p.src[p.pos] != ')' {
+		return nil, &syntax.Error{Code: syntax.ErrMissingParen, Expr: p.src[start:]}
+	}
+	p.pos++
+	if !capture {
+		return sub, nil
+	}
+	return &btNode{kind: btCapture, subs: []*btNode{sub}, n: n}, nil
+}
+
+// parseClass parses a bracket expression, delegating the class
+// semantics (ranges, negation, POSIX classes) to regexp/syntax.
+func (p *btParser) parseClass() (*btNode, error) {
+	start := p.pos
+	i := p.pos + 1
+	if i < len(p.src) && p.src[i] == '^' {
+		i++
+	}
+	if i < len(p.src) && p.src[i] == ']' {
+		i++
+	}
+	for i < len(p.src) && p.src[i] != ']' {
+		switch {
+		case p.src[i] == '\\':
+			i += 2
+		case p.src[i] == '[' && i+1 < len(p.src) && p.src[i+1] == ':':
+			if end := strings.Index(p.src[i+2:], ":]"); end >= 0 {
+				i += end + 4
+			} else {
+				i++
+			}
+		default:
+			i++
+		}
+	}
+	if i >= len(p.src) {
+		return nil, &syntax.Error{Code: syntax.ErrMissingBracket, Expr: p.src[start:]}
+	}
+	p.pos = i + 1
+	return classNode(p.src[start:p.pos])
+}
+
+// parseEscape parses a backslash escape.
+func (p *btParser) parseEscape() (*btNode, error) {
+	start := p.pos
+	if p.pos+1 >= len(p.src) {
+		return nil, &syntax.Error{Code: syntax.ErrTrailingBackslash, Expr: ""}
+	}
+	c := p.src[p.pos+1]
+	switch {
+	case c >= '1' && c <= '9':
+		p.pos += 2
+		n := int(c - '0')
+		p.backrefs = append(p.backrefs, n)
+		return &btNode{kind: btBackref, n: n}, nil
+	case c == 'A':
+		p.pos += 2
+		return &btNode{kind: btBeginText}, nil
+	case c == 'z':
+		p.pos += 2
+		return &btNode{kind: btEndText}, nil
+	case c == 'b':
+		p.pos += 2
+		return &btNode{kind: btWordB}, nil
+	case c == 'B':
+		p.pos += 2
+		return &btNode{kind: btNoWordB}, nil
+	}
+
+	// Determine escape length, then let regexp/syntax interpret it
+	end := p.pos + 2
+	switch c {
+	case 'x', 'p', 'P':
+		if end < len(p.src) && p.src[end] == '{' {
+			if close := strings.IndexByte(p.src[end:], '}'); close >= 0 {
+				end += close + 1
+			}
+		} else if c == 'x' {
+			end = min(end+2, len(p.src))
+		} else {
+			end = min(end+1, len(p.src))
+		}
+	case '0':
+		for end < len(p.src) && end < p.pos+4 && p.src[end] >= '0' && p.src[end] <= '7' {
+			end++
+		}
+	default:
+		if c >= utf8.RuneSelf {
+			_, size := utf8.DecodeRuneInString(p.src[p.pos+1:])
+			end = p.pos + 1 + size
+		}
+	}
+	p.pos = end
+	return classNode(p.src[start:end])
+}
+
+// classNode converts a class or escape into a node using regexp/syntax.
+func classNode(expr string) (*btNode, error) {
+	re, err := syntax.Parse(expr, syntax.Perl|syntax.DotNL)
+	if err != nil {
+		return nil, err
+	}
+	switch re.Op {
+	case syntax.OpLiteral:
+		if len(re.Rune) == 1 {
+			return &btNode{kind: btLiteral, r: re.Rune[0]}, nil
+		}
+	case syntax.OpCharClass:
+		return &btNode{kind: btClass, ranges: re.Rune}, nil
+	case syntax.OpAnyChar:
+		return &btNode{kind: btAny}, nil
+	case syntax.OpAnyCharNotNL:
+		return &btNode{kind: btClass, ranges: []rune{0, '\n' - 1, '\n' + 1, utf8.MaxRune}}, nil
+	}
+	return nil, &syntax.Error{Code: syntax.ErrInvalidEscape, Expr: expr}
+}
+
+// =============================================================================
+// Program
+// =============================================================================
+
+// btOp identifies a backtracking instruction.
+type btOp uint8
+
+const (
+	opRune      btOp = iota // Match rune r
+	opAny                   // Match any rune, including newline
+	opClass                 // Match a rune in ranges
+	opBeginText             // Assert start of text
+	opEndText               // Assert end of text
+	opWordB                 // Assert \b
+	opNoWordB               // Assert \B
+	opBackref               // Match the text of group n
+	opSplit                 // Continue at x; on backtrack, at y
+	opJmp                   // Continue at x
+	opMark                  // Set register n to the current position
+	opCheck                 // Fail if register n equals the current position
+	opCapture               // Set group n to register x .. current position
+	opLookahead             // Run sub-program x as a zero-width assertion
+	opMatch                 // Report success
+)
+
+// btInst is a single instruction of a backtracking program.
+type btInst struct {
+	op     btOp
+	negate bool   // opLookahead: (?!re) rather than (?=re)
+	r      rune   // opRune
+	ranges []rune // opClass: pairs of lo, hi
+	n      int    // opBackref, opCapture: group; opMark, opCheck: register
+	x, y   int    // opSplit, opJmp: targets; opCapture: register; opLookahead: sub-program
+}
+
+// Budget of a single search. The step limit grows with program and input
+// size, so linear-time matches of long records always fit and only
+// catastrophic backtracking hits it. The stack limit bounds memory use.
+const (
+	btMaxInsts     = 1 << 16 // Instructions after expanding counted repeats
+	btBaseSteps    = 1 << 20
+	btStepsPerByte = 4 // Per instruction and input byte
+	btMaxStack     = 1 << 23
+)
+
+// BacktrackLimitError reports a search that exceeded the backtracking
+// budget. The matcher panics with it, since the Regex methods have no error
+// result; the VM recovers it and ends the program with a runtime error.
+type BacktrackLimitError struct {
+	Pattern string
+}
+
+func (e *BacktrackLimitError) Error() string {
+	return fmt.Sprintf("regex /%s/: backtracking limit exceeded", e.Pattern)
+}
+
+// btCompiler translates a pattern tree into backtracking programs.
+type btCompiler struct {
+	prog  []btInst   // Program being generated
+	subs  [][]btInst // Lookahead sub-programs
+	size  int        // Instructions generated so far, including finished sub-programs
+	nregs int        // Registers allocated so far
+}
+
+// compileProgram generates the main program and lookahead sub-programs
+// for node. Registers 0 .. 2*ngroups+1 hold the submatch positions;
+// the rest hold group starts and loop positions.
+func compileProgram(node *btNode, ngroups int) (prog []btInst, subs [][]btInst, nregs int, err error) {
+	c := &btCompiler{nregs: 2 * (ngroups + 1)}
+	c.gen(node)
+	c.emit(btInst{op: opMatch})
+	if c.size > btMaxInsts {
+		return nil, nil, 0, &syntax.Error{Code: syntax.ErrLarge, Expr: ""}
+	}
+	return c.prog, c.subs, c.nregs, nil
+}
+
+func (c *btCompiler) emit(inst btInst) int {
+	c.prog = append(c.prog, inst)
+	c.size++
+	return len(c.prog) - 1
+}
+
+func (c *btCompiler) reg() int {
+	c.nregs++
+	return c.nregs - 1
+}
+
+// split emits a branch that prefers the next instruction if greedy and
+// the patched target otherwise. Returns the instruction index for patching.
+func (c *btCompiler) split(greedy bool) int {
+	next := len(c.prog) + 1
+	if greedy {
+		return c.emit(btInst{op: opSplit, x: next})
+	}
+	return c.emit(btInst{op: opSplit, y: next})
+}
+
+// patch sets the non-preferred (or, for lazy loops, preferred) target of split.
+func (c *btCompiler) patch(split int, greedy bool, target int) {
+	if greedy {
+		c.prog[split].y = target
+	} else {
+		c.prog[split].x = target
+	}
+}
+
+//nolint:gocyclo // Code generation is inherently a large switch
+func (c *btCompiler) gen(n *btNode) {
+	if c.size > btMaxInsts {
+		return // Reported by compileProgram
+	}
+	switch n.kind {
+	case btEmpty:
+	case btLiteral:
+		c.emit(btInst{op: opRune, r: n.r})
+	case btAny:
+		c.emit(btInst{op: opAny})
+	case btClass:
+		c.emit(btInst{op: opClass, ranges: n.ranges})
+	case btBeginText:
+		c.emit(btInst{op: opBeginText})
+	case btEndText:
+		c.emit(btInst{op: opEndText})
+	case btWordB:
+		c.emit(btInst{op: opWordB})
+	case btNoWordB:
+		c.emit(btInst{op: opNoWordB})
+	case btBackref:
+		c.emit(btInst{op: opBackref, n: n.n})
+	case btConcat:
+		for _, sub := range n.subs {
+			c.gen(sub)
+		}
+	case btAlternate:
+		var jumps []int
+		for i, sub := range n.subs {
+			if i == len(n.subs)-1 {
+				c.gen(sub)
+				break
+			}
+			split := c.split(true)
+			c.gen(sub)
+			jumps = append(jumps, c.emit(btInst{op: opJmp}))
+			c.patch(split, true, len(c.prog))
+		}
+		for _, j := range jumps {
+			c.prog[j].x = len(c.prog)
+		}
+	case btCapture:
+		start := c.reg()
+		c.emit(btInst{op: opMark, n: start})
+		c.gen(n.subs[0])
+		c.emit(btInst{op: opCapture, n: n.n, x: start})
+	case btRepeat:
+		c.genRepeat(n)
+	case btLookahead:
+		outer := c.prog
+		c.prog = nil
+		c.gen(n.subs[0])
+		c.emit(btInst{op: opMatch})
+		c.subs = append(c.subs, c.prog)
+		c.prog = outer
+		c.emit(btInst{op: opLookahead, negate: n.negate, x: len(c.subs) - 1})
+	}
+}
+
+// genRepeat expands a repeat into min copies of its body followed by
+// either a loop or max-min nested optional copies. Iterations beyond
+// min that consume nothing fail, so empty loops terminate.
+func (c *btCompiler) genRepeat(n *btNode) {
+	sub := n.subs[0]
+	for range n.min {
+		c.gen(sub)
+	}
+	guard := canBeEmpty(sub)
+	body := func() {
+		if !guard {
+			c.gen(sub)
+			return
+		}
+		r := c.reg()
+		c.emit(btInst{op: opMark, n: r})
+		c.gen(sub)
+		c.emit(btInst{op: opCheck, n: r})
+	}
+
+	if n.max < 0 {
+		loop := c.split(n.greedy)
+		body()
+		c.emit(btInst{op: opJmp, x: loop})
+		c.patch(loop, n.greedy, len(c.prog))
+		return
+	}
+	var skips []int
+	for range n.max - n.min {
+		skips = append(skips, c.split(n.greedy))
+		body()
+	}
+	for _, s := range skips {
+		c.patch(s, n.greedy, len(c.prog))
+	}
+}
+
+// canBeEmpty reports whether n may match without consuming input.
+func canBeEmpty(n *btNode) bool {
+	switch n.kind {
+	case btLiteral, btAny, btClass:
+		return false
+	case btConcat:
+		for _, sub := range n.subs {
+			if !canBeEmpty(sub) {
+				return false
+			}
+		}
+		return true
+	case btAlternate:
+		for _, sub := range n.subs {
+			if canBeEmpty(sub) {
+				return true
+			}
+		}
+		return false
+	case btRepeat:
+		return n.min == 0 || canBeEmpty(n.subs[0])
+	case btCapture:
+		return canBeEmpty(n.subs[0])
+	}
+	return true
+}
+
+// =============================================================================
+// Matcher
+// =============================================================================
+
+// btEntry is a backtrack stack entry: either a branch to resume at pc
+// and pos, or (with pc < 0) a register to restore to val.
+type btEntry struct {
+	pc  int32
+	reg int32
+	val int
+}
+
+// btMachine holds the state of a single search.
+type btMachine struct {
+	b     *backtracker
+	input string
+	regs  []int // Submatch positions first: regs[2*n], regs[2*n+1]
+	stack []btEntry
+	steps int
+	limit int
+}
+
+// findAt returns the submatch positions of the leftmost match starting
+// at or after pos, or nil if there is none.
+func (b *backtracker) findAt(s string, pos int) []int {
+	m := &btMachine{
+		b:     b,
+		input: s,
+		regs:  make([]int, b.nregs),
+		limit: btBaseSteps + btStepsPerByte*b.size*len(s),
+	}
+	for start := pos; start <= len(s); {
+		for i := range m.regs {
+			m.regs[i] = -1
+		}
+		if end, ok := m.run(b.prog, start); ok {
+			caps := m.regs[:2*(b.ngroups+1)]
+			caps[0], caps[1] = start, end
+			return caps
+		}
+		// A pattern starting with ^ cannot match further on
+		if b.prog[0].op == opBeginText || start == len(s) {
+			break
+		}
+		_, size := utf8.DecodeRuneInString(s[start:])
+		start += size
+	}
+	return nil
+}
+
+// run executes prog at pos and returns the end position of the first
+// match in priority order. Entries it pushes are popped before it returns,
+// so a lookahead is atomic: once it succeeds, it is not retried.
+//
+//nolint:gocyclo // Matcher dispatch is inherently a large switch
+func (m *btMachine) run(prog []btInst, pos int) (int, bool) {
+	s := m.input
+	base := len(m.stack)
+	pc := 0
+	for {
+		m.steps++
+		if m.steps > m.limit {
+			panic(&BacktrackLimitError{Pattern: m.b.pattern})
+		}
+		inst := &prog[pc]
+		ok := true
+		switch inst.op {
+		case opRune:
+			ok = false
+			if pos < len(s) {
+				r, size := utf8.DecodeRuneInString(s[pos:])
+				if r == inst.r {
+					pos += size
+					ok = true
+				}
+			}
+		case opAny:
+			ok = pos < len(s)
+			if ok {
+				_, size := utf8.DecodeRuneInString(s[pos:])
+				pos += size
+			}
+		case opClass:
+			ok = false
+			if pos < len(s) {
+				r, size := utf8.DecodeRuneInString(s[pos:])
+				if inRanges(inst.ranges, r) {
+					pos += size
+					ok = true
+				}
+			}
+		case opBeginText:
+			ok = pos == 0
+		case opEndText:
+			ok = pos == len(s)
+		case opWordB:
+			ok = m.atWordBoundary(pos)
+		case opNoWordB:
+			ok = !m.atWordBoundary(pos)
+		case opBackref:
+			start, end := m.regs[2*inst.n], m.regs[2*inst.n+1]
+			// Unset group never matches (Perl semantics)
+			ok = start >= 0 && strings.HasPrefix(s[pos:], s[start:end])
+			if ok {
+				pos += end - start
+			}
+		case opSplit:
+			m.push(btEntry{pc: int32(inst.y), val: pos})
+			pc = inst.x
+			continue
+		case opJmp:
+			pc = inst.x
+			continue
+		case opMark:
+			m.set(inst.n, pos)
+		case opCheck:
+			ok = m.regs[inst.n] != pos
+		case opCapture:
+			m.set(2*inst.n, m.regs[inst.x])
+			m.set(2*inst.n+1, pos)
+		case opLookahead:
+			ok = m.lookahead(inst, pos)
+		case opMatch:
+			m.stack = m.stack[:base]
+			return pos, true
+		}
+		if ok {
+			pc++
+			continue
+		}
+
+		// Backtrack to the most recent branch, undoing register changes
+		for {
+			if len(m.stack) == base {
+				return 0, false
+			}
+			e := m.stack[len(m.stack)-1]
+			m.stack = m.stack[:len(m.stack)-1]
+			if e.pc >= 0 {
+				pc, pos = int(e.pc), e.val
+				break
+			}
+			m.regs[e.reg] = e.val
+		}
+	}
+}
+
+// lookahead runs the assertion inst at pos. Groups captured by a positive
+// lookahead are kept until the enclosing match backtracks past it;
+// groups captured by a negative lookahead are discarded.
+func (m *btMachine) lookahead(inst *btInst, pos int) bool {
+	saved := append([]int(nil), m.regs...)
+	_, matched := m.run(m.b.subs[inst.x], pos)
+	if matched == inst.negate {
+		copy(m.regs, saved)
+		return false
+	}
+	for i, v := range saved {
+		if m.regs[i] != v {
+			m.push(btEntry{pc: -1, reg: int32(i), val: v})
+		}
+	}
+	return true
+}
+
+// set changes register r, recording its old value for backtracking.
+func (m *btMachine) set(r, val int) {
+	if m.regs[r] != val {
+		m.push(btEntry{pc: -1, reg: int32(r), val: m.regs[r]})
+		m.regs[r] = val
+	}
+}
+
+func (m *btMachine) push(e btEntry) {
+	if len(m.stack) >= btMaxStack {
+		panic(&BacktrackLimitError{Pattern: m.b.pattern})
+	}
+	m.stack = append(m.stack, e)
+}
+
+// atWordBoundary reports whether pos is between an ASCII word character
+// and a non-word character (or text edge), as \b in regexp/syntax.
+func (m *btMachine) atWordBoundary(pos int) bool {
+	before := pos > 0 && isWordByte(m.input[pos-1])
+	after := pos < len(m.input) && isWordByte(m.input[pos])
+	return before != after
+}
+
+func isWordByte(c byte) bool {
+	return c == '_' || (c >= '0' && c <= '9') || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func inRanges(ranges []rune, r rune) bool {
+	for i := 0; i+1 < len(ranges); i += 2 {
+		if r < ranges[i] {
+			return false // Ranges are sorted
+		}
+		if r <= ranges[i+1] {
+			return true
+		}
+	}
+	return false
+}
+
+// =============================================================================
+// Regex-compatible operations
+// =============================================================================
+
+// MatchString reports whether s contains any match.
+func (b *backtracker) MatchString(s string) bool {
+	return b.findAt(s, 0) != nil
+}
+
+// FindStringIndex returns the start and end of the first match, or nil.
+func (b *backtracker) FindStringIndex(s string) []int {
+	loc := b.findAt(s, 0)
+	if loc == nil {
+		return nil
+	}
+	return []int{loc[0], loc[1]}
+}
+
+// FindStringSubmatchIndex returns the positions of the first match
+// and its groups, or nil.
+func (b *backtracker) FindStringSubmatchIndex(s string) []int {
+	return b.findAt(s, 0)
+}
+
+// FindAllStringSubmatchIndex returns up to n matches (all if n < 0).
+// Like regexp, an empty match directly after a previous match is skipped.
+func (b *backtracker) FindAllStringSubmatchIndex(s string, n int) [][]int {
+	var result [][]int
+	prevEnd := -1
+	for pos := 0; pos <= len(s) && (n < 0 || len(result) < n); {
+		loc := b.findAt(s, pos)
+		if loc == nil {
+			break
+		}
+		if loc[1] == loc[0] && loc[0] == prevEnd {
+			// Empty match abutting the previous one: retry one rune later
+			if loc[0] >= len(s) {
+				break
+			}
+			_, size := utf8.DecodeRuneInString(s[loc[0]:])
+			pos = loc[0] + size
+			continue
+		}
+		result = append(result, append([]int(nil), loc...))
+		prevEnd = loc[1]
+		if loc[1] > loc[0] {
+			pos = loc[1]
+		} else {
+			if loc[1] >= len(s) {
+				break
+			}
+			_, size := utf8.DecodeRuneInString(s[loc[1]:])
+			pos = loc[1] + size
+		}
+	}
+	return result
+}
+
+// FindAllStringIndex returns up to n match positions (all if n < 0).
+func (b *backtracker) FindAllStringIndex(s string, n int) [][]int {
+	all := b.FindAllStringSubmatchIndex(s, n)
+	for i, loc := range all {
+		all[i] = loc[:2]
+	}
+	return all
+}
+
+// ReplaceAllStringFunc replaces all matches with the result of f.
+func (b *backtracker) ReplaceAllStringFunc(s string, f func(string) string) string {
+	var sb strings.Builder
+	last := 0
+	for _, loc := range b.FindAllStringIndex(s, -1) {
+		sb.WriteString(s[last:loc[0]])
+		sb.WriteString(f(s[loc[0]:loc[1]]))
+		last = loc[1]
+	}
+	sb.WriteString(s[last:])
+	return sb.String()
+}
+
+// ReplaceAllString replaces all matches with repl, expanding $n group
+// references like regexp.Regexp.ReplaceAllString.
+func (b *backtracker) ReplaceAllString(s, repl string) string {
+	var sb strings.Builder
+	last := 0
+	for _, loc := range b.FindAllStringSubmatchIndex(s, -1) {
+		sb.WriteString(s[last:loc[0]])
+		expandGroups(&sb, repl, s, loc)
+		last = loc[1]
+	}
+	sb.WriteString(s[last:])
+	return sb.String()
+}
+
+// expandGroups writes template to sb, replacing $n and ${n} with groups from loc.
+func expandGroups(sb *strings.Builder, template, s string, loc []int) {
+	for i := 0; i < len(template); i++ {
+		c := template[i]
+		if c != '$' || i+1 >= len(template) {
+			sb.WriteByte(c)
+			continue
+		}
+		if template[i+1] == '$' {
+			sb.WriteByte('$')
+			i++
+			continue
+		}
+		j := i + 1
+		braced := template[j] == '{'
+		if braced {
+			j++
+		}
+		k := j
+		for k < len(template) && template[k] >= '0' && template[k] <= '9' {
+			k++
+		}
+		if k == j || (braced && (k >= len(template) || template[k] != '}')) {
+			sb.WriteByte(c)
+			continue
+		}
+		n, _ := strconv.Atoi(template[j:k])
+		if 2*n+1 < len(loc) && loc[2*n] >= 0 {
+			sb.WriteString(s[loc[2*n]:loc[2*n+1]])
+		}
+		if braced {
+			k++
+		}
+		i = k - 1
+	}
+}
+
+// Split slices s into substrings separated by matches, like regexp.Split.
+func (b *backtracker) Split(s string, n int) []string {
+	if n == 0 {
+		return nil
+	}
+	if s == "" {
+		return []string{""}
+	}
+	matches := b.FindAllStringIndex(s, n)
+	parts := make([]string, 0, len(matches)+1)
+	beg, end := 0, 0
+	for _, match := range matches {
+		if n > 0 && len(parts) == n-1 {
+			break
+		}
+		end = match[0]
+		if match[1] != 0 {
+			parts = append(parts, s[beg:end])
+		}
+		beg = match[1]
+	}
+	if end != len(s) {
+		parts = append(parts, s[beg:])
+	}
+	return parts
+}
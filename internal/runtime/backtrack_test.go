@@ -0,0 +1,243 @@
+package runtime
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestBackrefNonPOSIX(t *testing.T) {
+	tests := []struct {
+		pattern string
+		input   string
+		want    []int
+	}{
+		{`(.)\1`, "aabb", []int{0, 2}},
+		{`(.)\1`, "abcc", []int{2, 4}},
+		{`(.)\1`, "abcd", nil},
+		{`(a|b)\1`, "abba", []int{1, 3}},
+		{`^(\w+) \1$`, "hey hey", []int{0, 7}},
+		{`^(\w+) \1$`, "hey you", nil},
+		{`(a)(b)\2\1`, "xabbay", []int{1, 5}},
+		{`([0-9]+)-\1`, "12-12", []int{0, 5}},
+		{`(x)?y\1`, "y", nil}, // Unset group never matches
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.pattern+"_"+tt.input, func(t *testing.T) {
+			re, err := CompileWithConfig(tt.pattern, FastConfig())
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got := re.FindStringIndex(tt.input); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("FindStringIndex(%q) = %v, want %v", tt.input, got, tt.want)
+			}
+			if got := re.MatchString(tt.input); got != (tt.want != nil) {
+				t.Errorf("MatchString(%q) = %v, want %v", tt.input, got, tt.want != nil)
+			}
+		})
+	}
+}
+
+func TestBackrefPOSIXRejected(t *testing.T) {
+	if _, err := Compile(`(.)\1`); err == nil {
+		t.Error("expected POSIX mode to reject back-reference")
+	}
+}
+
+func TestBackrefErrors(t *testing.T) {
+	patterns := []string{
+		`(.)\2`,
+		`(.\1`,
+		`a)\1`,
+		`*\1`,
+		`(.)\1**`,
+		`(.)\1{3,1}`,
+	}
+	for _, pattern := range patterns {
+		t.Run(pattern, func(t *testing.T) {
+			if _, err := CompileWithConfig(pattern, FastConfig()); err == nil {
+				t.Errorf("expected error for pattern %q", pattern)
+			}
+		})
+	}
+}
+
+func TestBackrefOperations(t *testing.T) {
+	re, err := CompileWithConfig(`(.)\1`, FastConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := re.FindAllStringIndex("aabbcd", -1), [][]int{{0, 2}, {2, 4}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("FindAllStringIndex = %v, want %v", got, want)
+	}
+	if got, want := re.ReplaceAllString("aabbcd", "<$1>"), "<a><b>cd"; got != want {
+		t.Errorf("ReplaceAllString = %q, want %q", got, want)
+	}
+	if got, want := re.ReplaceAllStringFunc("xaay", func(string) string { return "-" }), "x-y"; got != want {
+		t.Errorf("ReplaceAllStringFunc = %q, want %q", got, want)
+	}
+	if got, want := re.Split("1aa2bb3", -1), []string{"1", "2", "3"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Split = %q, want %q", got, want)
+	}
+}
+
+func TestBacktrackQuantifiers(t *testing.T) {
+	tests := []struct {
+		pattern string
+		input   string
+		want    []int
+	}{
+		{`(a*)b\1`, "aabaa", []int{0, 5}},
+		{`(a+?)\1`, "aaaa", []int{0, 2}},
+		{`(ab){2}\1`, "ababab", []int{0, 6}},
+		{`(.)\1{2,}`, "xyyyy", []int{1, 5}},
+		{`(.)x?\1`, "axa", []int{0, 3}},
+		{`\b(\w)\w*\1\b`, "abc aba", []int{4, 7}},
+		{`(é)\1`, "café éé", []int{6, 10}},
+		{`(.)\1.`, "a\na\n\nx", []int{3, 6}},
+		{`(a|ab)*c\1`, "ababcab", []int{0, 7}},
+		{`(?:(a)|b)*\1`, "aba", []int{0, 3}},
+		{`(a{0,3}?)b\1`, "aaabaa", []int{1, 6}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.pattern+"_"+tt.input, func(t *testing.T) {
+			re, err := CompileWithConfig(tt.pattern, FastConfig())
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got := re.FindStringIndex(tt.input); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("FindStringIndex(%q) = %v, want %v", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLookaheadNonPOSIX(t *testing.T) {
+	tests := []struct {
+		pattern string
+		input   string
+		want    []int
+	}{
+		{`foo(?=bar)`, "foobaz foobar", []int{7, 10}},
+		{`foo(?!bar)`, "foobar foobaz", []int{7, 10}},
+		{`\d+(?=%)`, "10 of 25%", []int{6, 8}},
+		{`\b(?!un)\w+`, "undo redo", []int{5, 9}},
+		{`^(?=.*[0-9])(?=.*[a-z]).+$`, "abc123", []int{0, 6}},
+		{`^(?=.*[0-9])(?=.*[a-z]).+$`, "abcdef", nil},
+		{`(?=(a+))a*b\1`, "baaabac", []int{3, 6}},
+		{`a(?!b)`, "ab", nil},
+		{`x(?=)`, "x", []int{0, 1}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.pattern+"_"+tt.input, func(t *testing.T) {
+			re, err := CompileWithConfig(tt.pattern, FastConfig())
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got := re.FindStringIndex(tt.input); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("FindStringIndex(%q) = %v, want %v", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLookaheadPOSIXRejected(t *testing.T) {
+	for _, pattern := range []string{`a(?=b)`, `a(?!b)`} {
+		if _, err := Compile(pattern); err == nil {
+			t.Errorf("expected POSIX mode to reject lookahead %q", pattern)
+		}
+	}
+	if _, err := CompileWithConfig(`a(?=b`, FastConfig()); err == nil {
+		t.Error("expected error for unclosed lookahead")
+	}
+}
+
+func TestBacktrackLongInput(t *testing.T) {
+	long := strings.Repeat("a", 3<<20)
+	tests := []struct {
+		pattern string
+		input   string
+		want    []int
+	}{
+		{`^(a)\1.*z`, long, nil},
+		{`^(a)\1.*a$`, long, []int{0, len(long)}},
+		{`^(a+)\1$`, long, []int{0, len(long)}},
+		{`(?=a*b)a`, long + "b", []int{0, 1}},
+		{`(b)\1`, long + "bb", []int{len(long), len(long) + 2}},
+	}
+
+	for _, tt := range tests {
+		re, err := CompileWithConfig(tt.pattern, FastConfig())
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", tt.pattern, err)
+		}
+		if got := re.FindStringIndex(tt.input); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: FindStringIndex = %v, want %v", tt.pattern, got, tt.want)
+		}
+	}
+}
+
+func TestBacktrackLimit(t *testing.T) {
+	tests := []struct {
+		pattern string
+		input   string
+	}{
+		{`(a|a)*\1b`, strings.Repeat("a", 40)},
+		{`((a*)*)*\1b`, strings.Repeat("a", 40)},
+		{`(a)\1.*z`, strings.Repeat("a", 20000)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.pattern, func(t *testing.T) {
+			re, err := CompileWithConfig(tt.pattern, FastConfig())
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			defer func() {
+				limitErr, ok := recover().(*BacktrackLimitError)
+				if !ok {
+					t.Fatal("expected BacktrackLimitError panic")
+				}
+				if want := "regex /" + tt.pattern + "/: backtracking limit exceeded"; limitErr.Error() != want {
+					t.Errorf("Error() = %q, want %q", limitErr.Error(), want)
+				}
+			}()
+			re.MatchString(tt.input)
+		})
+	}
+}
+
+func TestBacktrackTooLarge(t *testing.T) {
+	if _, err := CompileWithConfig(`((a{1000}){1000})\1`, FastConfig()); err == nil {
+		t.Error("expected error for oversized pattern")
+	}
+}
+
+func TestNeedsBacktrack(t *testing.T) {
+	tests := []struct {
+		pattern string
+		want    bool
+	}{
+		{`(.)\1`, true},
+		{`a\9`, true},
+		{`\\1`, false},
+		{`[\1]`, false},
+		{`[]\1]`, false},
+		{`[[:alpha:]]\1`, true},
+		{`\0`, false},
+		{`a(?=b)`, true},
+		{`a(?!b)`, true},
+		{`[(?=]`, false},
+		{`(?:a)`, false},
+		{`hello`, false},
+	}
+	for _, tt := range tests {
+		if got := needsBacktrack(tt.pattern); got != tt.want {
+			t.Errorf("needsBacktrack(%q) = %v, want %v", tt.pattern, got, tt.want)
+		}
+	}
+}
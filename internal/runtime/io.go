@@ -2,21 +2,65 @@ package runtime
 
 import (
 	"bufio"
+	"bytes"
+	"container/list"
+	"context"
+	"errors"
+	"fmt"
 	"io"
+	"maps"
 	"os"
 	"os/exec"
+	goruntime "runtime"
+	"slices"
 	"sync"
+	"time"
 )
 
+// DefaultMaxOutputFiles is the default limit on output files held open at
+// once. It stays well below the common 1024 file descriptor limit.
+const DefaultMaxOutputFiles = 512
+
+// DefaultMaxSlurpSize is the default limit on the size of a file read
+// whole by Slurp, so a stray huge file cannot exhaust memory.
+const DefaultMaxSlurpSize = 64 << 20
+
+// MaxRecordSize is the largest record NewScanner accepts. bufio.Scanner's
+// own limit of 64 KiB is too small for long lines, or for reading a whole
+// input as a single record with an RS that never matches.
+const MaxRecordSize = 1 << 30
+
+// NewScanner returns a scanner for r that accepts records of up to
+// MaxRecordSize bytes.
+func NewScanner(r io.Reader) *bufio.Scanner {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, MaxRecordSize)
+	return scanner
+}
+
 // IOManager manages file and pipe I/O for AWK operations.
 // It handles file caching (files stay open until explicitly closed)
 // and provides thread-safe access to I/O resources.
+//
+// At most maxOutFiles output files are kept open. When a program writes
+// to more, the least recently used file is closed; it is reopened in
+// append mode if written again, so its contents are unaffected.
 type IOManager struct {
 	mu sync.Mutex
 
 	// Output files (> and >>)
 	outFiles map[string]*OutputFile
 
+	// Output files in use order, most recently used at the front
+	outLRU      *list.List
+	maxOutFiles int
+
+	// Output files closed to stay under maxOutFiles, to be reopened for append
+	evicted map[string]bool
+
+	// Largest file Slurp reads, or 0 for no limit
+	maxSlurp int64
+
 	// Input files (<)
 	inFiles map[string]*InputFile
 
@@ -25,12 +69,85 @@ type IOManager struct {
 
 	// Input pipes (cmd |)
 	inPipes map[string]*InputPipe
+
+	// Coprocesses (|& cmd and cmd |& getline)
+	coprocs map[string]*Coprocess
+
+	// Process streams behind /dev/stdout and /dev/stderr
+	stdout processStream
+	stderr processStream
+
+	// Standard input for getline < "/dev/stdin" or "-", scanned lazily
+	stdin        io.Reader
+	stdinScanner *bufio.Scanner
+
+	// Context for commands: cancelling it kills them and unblocks reads
+	// and writes on their pipes
+	ctx context.Context
 }
 
 // OutputFile wraps an os.File for output operations.
 type OutputFile struct {
 	file   *os.File
 	writer *bufio.Writer
+	elem   *list.Element // position in IOManager.outLRU
+}
+
+// processStream is stdout or stderr as the program writes to it. Commands
+// started by output pipes run alongside the program and write to the same
+// stream, so once one may be writing, the program's writes and flushes
+// take mu as well; until then they go straight through.
+type processStream struct {
+	w      io.Writer
+	mu     sync.Mutex
+	shared bool // Set and read only by the program's goroutine
+}
+
+// Write implements io.Writer for the program's own output.
+func (s *processStream) Write(b []byte) (int, error) {
+	if !s.shared {
+		return s.w.Write(b)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.w.Write(b)
+}
+
+// Flush flushes the underlying writer if it is buffered.
+func (s *processStream) Flush() error {
+	f, ok := s.w.(interface{ Flush() error })
+	if !ok {
+		return nil
+	}
+	if !s.shared {
+		return f.Flush()
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return f.Flush()
+}
+
+// forCommand returns the writer to give a command as its stdout or
+// stderr. A file is passed on as it is, so the command writes to it
+// directly; any other writer is copied to by a goroutine, which takes mu.
+func (s *processStream) forCommand() io.Writer {
+	if f, ok := s.w.(*os.File); ok {
+		return f
+	}
+	s.shared = true
+	return commandOutput{s}
+}
+
+// commandOutput is a process stream as a command writes to it.
+type commandOutput struct {
+	s *processStream
+}
+
+// Write implements io.Writer.
+func (c commandOutput) Write(b []byte) (int, error) {
+	c.s.mu.Lock()
+	defer c.s.mu.Unlock()
+	return c.s.w.Write(b)
 }
 
 // InputFile wraps an os.File for input operations.
@@ -44,6 +161,7 @@ type OutputPipe struct {
 	cmd    *exec.Cmd
 	stdin  io.WriteCloser
 	writer *bufio.Writer
+	stop   func() bool // unregisters the close on cancellation
 }
 
 // InputPipe wraps an exec.Cmd for pipe input.
@@ -51,29 +169,211 @@ type InputPipe struct {
 	cmd     *exec.Cmd
 	stdout  io.ReadCloser
 	scanner *bufio.Scanner
+	stop    func() bool
+}
+
+// Coprocess wraps an exec.Cmd with both stdin and stdout piped,
+// for gawk-style two-way I/O.
+//
+// The child's stdout is drained into memory by a goroutine, so a child
+// that produces output faster than the program reads it never blocks
+// on a full pipe. Without this, a program writing many requests before
+// reading any responses would deadlock: the child stalls writing output,
+// stops reading its input, and our next write blocks forever.
+type Coprocess struct {
+	cmd      *exec.Cmd
+	stdin    io.WriteCloser
+	writer   *bufio.Writer
+	stdout   io.ReadCloser
+	scanner  *bufio.Scanner
+	toClosed bool // stdin closed by close(cmd, "to")
+	stop     func() bool
+}
+
+// drainBuffer continuously reads from a source into an unbounded buffer
+// and serves reads from that buffer, blocking only when it is empty.
+type drainBuffer struct {
+	mu   sync.Mutex
+	cond *sync.Cond
+	buf  bytes.Buffer
+	err  error // read error from source, io.EOF at end
+}
+
+// newDrainBuffer starts draining r in a background goroutine.
+func newDrainBuffer(r io.Reader) *drainBuffer {
+	d := &drainBuffer{}
+	d.cond = sync.NewCond(&d.mu)
+	go d.drain(r)
+	return d
+}
+
+func (d *drainBuffer) drain(r io.Reader) {
+	chunk := make([]byte, 32*1024)
+	for {
+		n, err := r.Read(chunk)
+		d.mu.Lock()
+		d.buf.Write(chunk[:n])
+		if err != nil {
+			d.err = err
+		}
+		d.cond.Broadcast()
+		d.mu.Unlock()
+		if err != nil {
+			return
+		}
+	}
+}
+
+// Read implements io.Reader, waiting until data or the source's error arrives.
+func (d *drainBuffer) Read(p []byte) (int, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for d.buf.Len() == 0 && d.err == nil {
+		d.cond.Wait()
+	}
+	if d.buf.Len() > 0 {
+		return d.buf.Read(p)
+	}
+	return 0, d.err
 }
 
 // NewIOManager creates a new I/O manager.
 func NewIOManager() *IOManager {
 	return &IOManager{
-		outFiles: make(map[string]*OutputFile),
-		inFiles:  make(map[string]*InputFile),
-		outPipes: make(map[string]*OutputPipe),
-		inPipes:  make(map[string]*InputPipe),
+		outFiles:    make(map[string]*OutputFile),
+		outLRU:      list.New(),
+		maxOutFiles: DefaultMaxOutputFiles,
+		evicted:     make(map[string]bool),
+		maxSlurp:    DefaultMaxSlurpSize,
+		inFiles:     make(map[string]*InputFile),
+		outPipes:    make(map[string]*OutputPipe),
+		inPipes:     make(map[string]*InputPipe),
+		coprocs:     make(map[string]*Coprocess),
+		stdout:      processStream{w: os.Stdout},
+		stderr:      processStream{w: os.Stderr},
+		stdin:       os.Stdin,
+		ctx:         context.Background(),
+	}
+}
+
+// SetContext sets the context for commands started from now on. When it is
+// cancelled, running commands are killed and their pipes closed, so a
+// blocked getline or print returns instead of waiting for the command.
+func (m *IOManager) SetContext(ctx context.Context) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.ctx = ctx
+}
+
+// command returns a shell command for cmdStr, killed when m.ctx is done.
+// As POSIX requires for pipes and system(), it is run by sh whatever
+// SHELL is set to; on Windows it is run by cmd.
+func (m *IOManager) command(cmdStr string) *exec.Cmd {
+	if goruntime.GOOS == "windows" {
+		return exec.CommandContext(m.ctx, "cmd", "/c", cmdStr)
+	}
+	return exec.CommandContext(m.ctx, "sh", "-c", cmdStr)
+}
+
+// closeOnCancel closes pipes when m.ctx is done. Killing the shell alone
+// is not enough: a command it started may still hold the other end open.
+// The returned function unregisters the closing.
+func (m *IOManager) closeOnCancel(pipes ...io.Closer) func() bool {
+	return context.AfterFunc(m.ctx, func() {
+		for _, p := range pipes {
+			p.Close()
+		}
+	})
+}
+
+// SetStdin sets the reader used for getline < "/dev/stdin" or "-".
+func (m *IOManager) SetStdin(r io.Reader) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.stdin = r
+	m.stdinScanner = nil
+}
+
+// isStdin reports whether name is one of the special input names
+// "/dev/stdin", "/dev/fd/0" or "-".
+func isStdin(name string) bool {
+	return name == "/dev/stdin" || name == "/dev/fd/0" || name == "-"
+}
+
+// SetStdout sets the writer used for output to "/dev/stdout".
+func (m *IOManager) SetStdout(w io.Writer) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.stdout.w = w
+	m.stdout.shared = false
+}
+
+// Stdout returns the writer for the program's output to "/dev/stdout",
+// which commands started by output pipes may be writing to as well.
+func (m *IOManager) Stdout() io.Writer {
+	return &m.stdout
+}
+
+// SetStderr sets the writer used for output to "/dev/stderr".
+func (m *IOManager) SetStderr(w io.Writer) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.stderr.w = w
+	m.stderr.shared = false
+}
+
+// stdStream returns the process stream for the special output names
+// "/dev/stdout", "/dev/stderr", "/dev/fd/1" and "/dev/fd/2", or nil.
+// Caller must hold m.mu.
+func (m *IOManager) stdStream(name string) io.Writer {
+	switch name {
+	case "/dev/stdout", "/dev/fd/1":
+		return &m.stdout
+	case "/dev/stderr", "/dev/fd/2":
+		return &m.stderr
 	}
+	return nil
+}
+
+// SetMaxOutputFiles sets how many output files may be open at once.
+// A value of 0 or less removes the limit.
+func (m *IOManager) SetMaxOutputFiles(n int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.maxOutFiles = n
 }
 
 // GetOutputFile returns an output file for writing, creating it if needed.
-// If append is true, opens in append mode.
-func (m *IOManager) GetOutputFile(name string, append bool) (*bufio.Writer, error) {
+// If append is true, opens in append mode. The special names "/dev/stdout"
+// and "/dev/stderr" (and "/dev/fd/1", "/dev/fd/2") return the configured
+// process streams unbuffered, so their output stays in order with print
+// output that is not redirected; no file is opened for them.
+func (m *IOManager) GetOutputFile(name string, append bool) (io.Writer, error) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
+	if w := m.stdStream(name); w != nil {
+		return w, nil
+	}
+
 	// Check if already open
 	if of, ok := m.outFiles[name]; ok {
+		m.outLRU.MoveToFront(of.elem)
 		return of.writer, nil
 	}
 
+	// A file closed to free a descriptor continues where it left off
+	if m.evicted[name] {
+		append = true
+	}
+
+	// Make room under the open file limit
+	if m.maxOutFiles > 0 {
+		for len(m.outFiles) >= m.maxOutFiles {
+			m.evictOldest()
+		}
+	}
+
 	// Open file
 	var flag int
 	if append {
@@ -91,16 +391,121 @@ func (m *IOManager) GetOutputFile(name string, append bool) (*bufio.Writer, erro
 		file:   file,
 		writer: bufio.NewWriter(file),
 	}
+	of.elem = m.outLRU.PushFront(name)
 	m.outFiles[name] = of
+	delete(m.evicted, name)
 
 	return of.writer, nil
 }
 
+// evictOldest closes the least recently used output file and remembers
+// it so a later write reopens it for append. Caller must hold m.mu.
+func (m *IOManager) evictOldest() {
+	elem := m.outLRU.Back()
+	name := elem.Value.(string)
+	of := m.outFiles[name]
+	of.writer.Flush()
+	of.file.Close()
+	m.outLRU.Remove(elem)
+	delete(m.outFiles, name)
+	m.evicted[name] = true
+}
+
+// SetMaxSlurpSize sets the largest file Slurp reads.
+// A value of 0 or less removes the limit.
+func (m *IOManager) SetMaxSlurpSize(n int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.maxSlurp = max(n, 0)
+}
+
+// Slurp returns the whole contents of the named file. Output the program
+// has written to the file but not yet flushed is flushed first. Files
+// larger than the slurp limit are not read.
+func (m *IOManager) Slurp(name string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if of, ok := m.outFiles[name]; ok {
+		of.writer.Flush()
+	}
+
+	f, err := os.Open(name)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	r := io.Reader(f)
+	if m.maxSlurp > 0 {
+		r = io.LimitReader(f, m.maxSlurp+1)
+	}
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return "", err
+	}
+	if m.maxSlurp > 0 && int64(len(data)) > m.maxSlurp {
+		return "", fmt.Errorf("%s: file larger than %d bytes", name, m.maxSlurp)
+	}
+	return string(data), nil
+}
+
+// Spit writes content to the named file, truncating it first unless
+// append is set, and returns the number of bytes written. If the program
+// has the file open for output, it is flushed and closed first, as by
+// close(name), so buffered output can't later overwrite the content.
+func (m *IOManager) Spit(name, content string, append bool) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if w := m.stdStream(name); w != nil {
+		return io.WriteString(w, content)
+	}
+
+	if of, ok := m.outFiles[name]; ok {
+		of.writer.Flush()
+		of.file.Close()
+		m.outLRU.Remove(of.elem)
+		delete(m.outFiles, name)
+	}
+	delete(m.evicted, name)
+
+	flags := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	if append {
+		flags = os.O_WRONLY | os.O_CREATE | os.O_APPEND
+	}
+	f, err := os.OpenFile(name, flags, 0644)
+	if err != nil {
+		return 0, err
+	}
+	n, err := io.WriteString(f, content)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
 // GetInputFile returns an input file for reading, opening it if needed.
+// The special names "/dev/stdin", "/dev/fd/0" and "-" read the configured
+// standard input instead of opening a file, so they work on platforms
+// without those devices.
 func (m *IOManager) GetInputFile(name string) (*bufio.Scanner, error) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
+	if isStdin(name) {
+		if m.stdin == nil {
+			return nil, errors.New("no standard input")
+		}
+		if m.stdinScanner == nil {
+			m.stdinScanner = NewScanner(m.stdin)
+		}
+		return m.stdinScanner, nil
+	}
+
 	// Check if already open
 	if inf, ok := m.inFiles[name]; ok {
 		return inf.scanner, nil
@@ -114,7 +519,7 @@ func (m *IOManager) GetInputFile(name string) (*bufio.Scanner, error) {
 
 	inf := &InputFile{
 		file:    file,
-		scanner: bufio.NewScanner(file),
+		scanner: NewScanner(file),
 	}
 	m.inFiles[name] = inf
 
@@ -122,6 +527,8 @@ func (m *IOManager) GetInputFile(name string) (*bufio.Scanner, error) {
 }
 
 // GetOutputPipe returns an output pipe, creating the command if needed.
+// One command runs per command string until it is closed. What it writes
+// goes to stdout and stderr as it is written.
 func (m *IOManager) GetOutputPipe(cmdStr string) (*bufio.Writer, error) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
@@ -132,11 +539,15 @@ func (m *IOManager) GetOutputPipe(cmdStr string) (*bufio.Writer, error) {
 	}
 
 	// Start command
-	cmd := exec.Command(getShell(), getShellArg(), cmdStr)
+	cmd := m.command(cmdStr)
 	stdin, err := cmd.StdinPipe()
 	if err != nil {
 		return nil, err
 	}
+	cmd.Stdout = m.stdout.forCommand()
+	cmd.Stderr = m.stderr.forCommand()
+	// Don't wait long for output from commands the shell leaves running
+	cmd.WaitDelay = time.Second
 
 	if err := cmd.Start(); err != nil {
 		stdin.Close()
@@ -147,6 +558,7 @@ func (m *IOManager) GetOutputPipe(cmdStr string) (*bufio.Writer, error) {
 		cmd:    cmd,
 		stdin:  stdin,
 		writer: bufio.NewWriter(stdin),
+		stop:   m.closeOnCancel(stdin),
 	}
 	m.outPipes[cmdStr] = op
 
@@ -164,7 +576,7 @@ func (m *IOManager) GetInputPipe(cmdStr string) (*bufio.Scanner, error) {
 	}
 
 	// Start command
-	cmd := exec.Command(getShell(), getShellArg(), cmdStr)
+	cmd := m.command(cmdStr)
 	stdout, err := cmd.StdoutPipe()
 	if err != nil {
 		return nil, err
@@ -178,15 +590,131 @@ func (m *IOManager) GetInputPipe(cmdStr string) (*bufio.Scanner, error) {
 	ip := &InputPipe{
 		cmd:     cmd,
 		stdout:  stdout,
-		scanner: bufio.NewScanner(stdout),
+		scanner: NewScanner(stdout),
+		stop:    m.closeOnCancel(stdout),
 	}
 	m.inPipes[cmdStr] = ip
 
 	return ip.scanner, nil
 }
 
-// Close closes a file or pipe by name.
-// Returns 0 on success, -1 on error or if not found.
+// GetCoprocessWriter returns the writer feeding a coprocess's stdin,
+// starting the command if needed.
+func (m *IOManager) GetCoprocessWriter(cmdStr string) (*bufio.Writer, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	cp, err := m.coprocess(cmdStr)
+	if err != nil {
+		return nil, err
+	}
+	return cp.writer, nil
+}
+
+// GetCoprocessReader returns a scanner over a coprocess's stdout, starting
+// the command if needed. Pending output to the coprocess is flushed first
+// so it can see the request it is expected to answer.
+func (m *IOManager) GetCoprocessReader(cmdStr string) (*bufio.Scanner, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	cp, err := m.coprocess(cmdStr)
+	if err != nil {
+		return nil, err
+	}
+	if !cp.toClosed {
+		cp.writer.Flush()
+	}
+	return cp.scanner, nil
+}
+
+// coprocess returns the running coprocess for cmdStr, starting it if needed.
+// Caller must hold m.mu.
+func (m *IOManager) coprocess(cmdStr string) (*Coprocess, error) {
+	if cp, ok := m.coprocs[cmdStr]; ok {
+		return cp, nil
+	}
+
+	cmd := m.command(cmdStr)
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		stdin.Close()
+		return nil, err
+	}
+
+	if err := cmd.Start(); err != nil {
+		stdin.Close()
+		stdout.Close()
+		return nil, err
+	}
+
+	cp := &Coprocess{
+		cmd:     cmd,
+		stdin:   stdin,
+		writer:  bufio.NewWriter(stdin),
+		stdout:  stdout,
+		scanner: NewScanner(newDrainBuffer(stdout)),
+		stop:    m.closeOnCancel(stdin, stdout),
+	}
+	m.coprocs[cmdStr] = cp
+
+	return cp, nil
+}
+
+// closeCoprocess flushes and closes both ends of a coprocess and waits
+// for it to exit. Caller must hold m.mu.
+func (m *IOManager) closeCoprocess(name string, cp *Coprocess) error {
+	cp.stop()
+	if !cp.toClosed {
+		cp.writer.Flush()
+		cp.stdin.Close()
+	}
+	// Close our read end first so a child blocked writing output exits
+	cp.stdout.Close()
+	err := cp.cmd.Wait()
+	delete(m.coprocs, name)
+	return err
+}
+
+// CloseHalf closes one direction of a coprocess, as close(cmd, how) does.
+// "to" flushes and closes the coprocess's stdin, so it sees end of input
+// while its output can still be read; "from" closes the coprocess entirely
+// and returns its exit status. Returns 0 on success, -1 on error or if
+// name is not a coprocess.
+func (m *IOManager) CloseHalf(name, how string) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	cp, ok := m.coprocs[name]
+	if !ok {
+		return -1
+	}
+
+	switch how {
+	case "to":
+		if cp.toClosed {
+			return -1
+		}
+		cp.toClosed = true
+		flushErr := cp.writer.Flush()
+		if err := cp.stdin.Close(); err != nil || flushErr != nil {
+			return -1
+		}
+		return 0
+	case "from":
+		return exitStatus(m.closeCoprocess(name, cp))
+	default:
+		return -1
+	}
+}
+
+// Close closes a file or pipe by name, so the next use of the name opens
+// it afresh. Returns 0 on success, -1 on error or if not found; closing a
+// command returns its exit status.
 func (m *IOManager) Close(name string) int {
 	m.mu.Lock()
 	defer m.mu.Unlock()
@@ -195,12 +723,26 @@ func (m *IOManager) Close(name string) int {
 	if of, ok := m.outFiles[name]; ok {
 		of.writer.Flush()
 		err := of.file.Close()
+		m.outLRU.Remove(of.elem)
 		delete(m.outFiles, name)
 		if err != nil {
 			return -1
 		}
 		return 0
 	}
+	if m.evicted[name] {
+		// Already flushed and closed; forget it so ">" truncates again
+		delete(m.evicted, name)
+		return 0
+	}
+
+	// Process streams are never closed, only flushed
+	if w := m.stdStream(name); w != nil {
+		return flushWriter(w)
+	}
+	if isStdin(name) && m.stdinScanner != nil {
+		return 0
+	}
 
 	// Try input files
 	if inf, ok := m.inFiles[name]; ok {
@@ -214,47 +756,102 @@ func (m *IOManager) Close(name string) int {
 
 	// Try output pipes
 	if op, ok := m.outPipes[name]; ok {
+		op.stop()
 		op.writer.Flush()
 		op.stdin.Close()
 		err := op.cmd.Wait()
 		delete(m.outPipes, name)
-		if err != nil {
-			return -1
-		}
-		return 0
+		return exitStatus(err)
 	}
 
 	// Try input pipes
 	if ip, ok := m.inPipes[name]; ok {
+		ip.stop()
 		ip.stdout.Close()
 		err := ip.cmd.Wait()
 		delete(m.inPipes, name)
-		if err != nil {
-			return -1
-		}
-		return 0
+		return exitStatus(err)
+	}
+
+	// Try coprocesses
+	if cp, ok := m.coprocs[name]; ok {
+		return exitStatus(m.closeCoprocess(name, cp))
 	}
 
 	return -1 // Not found
 }
 
+// System runs cmdStr with sh (cmd on Windows) for the system() builtin and
+// returns its exit status, or 127 if the shell could not be started.
+// All output is flushed first so the command's output lands after
+// everything printed before it; the command writes straight to the
+// configured stdout and stderr.
+func (m *IOManager) System(cmdStr string) int {
+	m.Flush("")
+	m.mu.Lock()
+	stdout, stderr := m.stdout.forCommand(), m.stderr.forCommand()
+	c := m.command(cmdStr)
+	m.mu.Unlock()
+
+	c.Stdout = stdout
+	c.Stderr = stderr
+	// Don't wait long for output from commands the shell leaves running,
+	// as when cancellation kills the shell but not its children
+	c.WaitDelay = time.Second
+
+	if err := c.Start(); err != nil {
+		return 127
+	}
+	return exitStatus(c.Wait())
+}
+
+// exitStatus converts the result of waiting for a command into the value
+// close() and system() return: the command's exit status, or -1 if it
+// did not exit normally or could not be waited for.
+func exitStatus(err error) int {
+	if err == nil {
+		return 0
+	}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.ExitCode()
+	}
+	return -1
+}
+
 // Flush flushes a specific file or all files.
-// If name is empty, flushes all output files.
+// If name is empty, flushes stdout, stderr and all output files, pipes
+// and coprocesses.
 // Returns 0 on success, -1 on error.
 func (m *IOManager) Flush(name string) int {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
 	if name == "" {
-		// Flush all
+		// Flush all, carrying on past errors so one bad stream
+		// doesn't hold back the others
+		result := 0
+		fail := func(err error) {
+			if err != nil {
+				result = -1
+			}
+		}
 		for _, of := range m.outFiles {
-			of.writer.Flush()
+			fail(of.writer.Flush())
 			of.file.Sync()
 		}
 		for _, op := range m.outPipes {
-			op.writer.Flush()
+			fail(op.writer.Flush())
 		}
-		return 0
+		for _, cp := range m.coprocs {
+			if !cp.toClosed {
+				fail(cp.writer.Flush())
+			}
+		}
+		if flushWriter(&m.stdout) != 0 || flushWriter(&m.stderr) != 0 {
+			result = -1
+		}
+		return result
 	}
 
 	// Flush specific file
@@ -267,6 +864,12 @@ func (m *IOManager) Flush(name string) int {
 		}
 		return 0
 	}
+	if m.evicted[name] {
+		return 0 // Flushed when it was closed
+	}
+	if w := m.stdStream(name); w != nil {
+		return flushWriter(w)
+	}
 
 	// Flush specific pipe
 	if op, ok := m.outPipes[name]; ok {
@@ -276,57 +879,68 @@ func (m *IOManager) Flush(name string) int {
 		return 0
 	}
 
+	// Flush specific coprocess
+	if cp, ok := m.coprocs[name]; ok && !cp.toClosed {
+		if err := cp.writer.Flush(); err != nil {
+			return -1
+		}
+		return 0
+	}
+
 	return -1 // Not found
 }
 
-// CloseAll closes all files and pipes.
+// CloseAll flushes and closes all files and pipes, waiting for commands to
+// exit. Output is closed before input, and each kind in name order, so the
+// order is deterministic: output files, output pipes, coprocesses, input
+// files, then input pipes.
 func (m *IOManager) CloseAll() {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
-	for _, of := range m.outFiles {
+	for _, name := range slices.Sorted(maps.Keys(m.outFiles)) {
+		of := m.outFiles[name]
 		of.writer.Flush()
 		of.file.Close()
 	}
 	m.outFiles = make(map[string]*OutputFile)
+	m.outLRU.Init()
+	m.evicted = make(map[string]bool)
 
-	for _, inf := range m.inFiles {
-		inf.file.Close()
-	}
-	m.inFiles = make(map[string]*InputFile)
-
-	for _, op := range m.outPipes {
+	for _, name := range slices.Sorted(maps.Keys(m.outPipes)) {
+		op := m.outPipes[name]
+		op.stop()
 		op.writer.Flush()
 		op.stdin.Close()
 		op.cmd.Wait()
 	}
 	m.outPipes = make(map[string]*OutputPipe)
 
-	for _, ip := range m.inPipes {
-		ip.stdout.Close()
-		ip.cmd.Wait()
+	for _, name := range slices.Sorted(maps.Keys(m.coprocs)) {
+		m.closeCoprocess(name, m.coprocs[name])
 	}
-	m.inPipes = make(map[string]*InputPipe)
-}
 
-// getShell returns the shell to use for command execution.
-func getShell() string {
-	if shell := os.Getenv("SHELL"); shell != "" {
-		return shell
+	for _, name := range slices.Sorted(maps.Keys(m.inFiles)) {
+		m.inFiles[name].file.Close()
 	}
-	// Windows
-	if comspec := os.Getenv("COMSPEC"); comspec != "" {
-		return comspec
+	m.inFiles = make(map[string]*InputFile)
+
+	for _, name := range slices.Sorted(maps.Keys(m.inPipes)) {
+		ip := m.inPipes[name]
+		ip.stop()
+		ip.stdout.Close()
+		ip.cmd.Wait()
 	}
-	return "sh"
+	m.inPipes = make(map[string]*InputPipe)
 }
 
-// getShellArg returns the argument to pass to the shell for command execution.
-func getShellArg() string {
-	shell := getShell()
-	// Windows cmd.exe uses /c
-	if shell == os.Getenv("COMSPEC") || shell == "cmd.exe" || shell == "cmd" {
-		return "/c"
+// flushWriter flushes w if it buffers output.
+// Returns 0 on success, -1 on error.
+func flushWriter(w io.Writer) int {
+	if f, ok := w.(interface{ Flush() error }); ok {
+		if err := f.Flush(); err != nil {
+			return -1
+		}
 	}
-	return "-c"
+	return 0
 }
@@ -1,10 +1,14 @@
 package runtime
 
 import (
+	"bufio"
+	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 )
 
 func TestIOManagerOutputFile(t *testing.T) {
@@ -20,11 +24,11 @@ func TestIOManagerOutputFile(t *testing.T) {
 		t.Fatalf("GetOutputFile failed: %v", err)
 	}
 
-	_, err = w.WriteString("hello\n")
+	_, err = io.WriteString(w, "hello\n")
 	if err != nil {
 		t.Fatalf("WriteString failed: %v", err)
 	}
-	w.Flush()
+	m.Flush(testFile)
 
 	// Verify content
 	content, err := os.ReadFile(testFile)
@@ -55,11 +59,11 @@ func TestIOManagerOutputFileAppend(t *testing.T) {
 		t.Fatalf("GetOutputFile (append) failed: %v", err)
 	}
 
-	_, err = w.WriteString("second\n")
+	_, err = io.WriteString(w, "second\n")
 	if err != nil {
 		t.Fatalf("WriteString failed: %v", err)
 	}
-	w.Flush()
+	m.Flush(testFile)
 
 	// Verify content
 	content, err := os.ReadFile(testFile)
@@ -129,6 +133,38 @@ func TestIOManagerClose(t *testing.T) {
 	}
 }
 
+func TestIOManagerClosePipeStatus(t *testing.T) {
+	m := NewIOManager()
+	defer m.CloseAll()
+
+	if _, err := m.GetOutputPipe("cat >/dev/null; exit 3"); err != nil {
+		t.Skipf("Pipe test skipped (shell not available): %v", err)
+	}
+	if got := m.Close("cat >/dev/null; exit 3"); got != 3 {
+		t.Errorf("Close(output pipe) = %d, want 3", got)
+	}
+
+	scanner, err := m.GetInputPipe("echo x; exit 5")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for scanner.Scan() {
+	}
+	if got := m.Close("echo x; exit 5"); got != 5 {
+		t.Errorf("Close(input pipe) = %d, want 5", got)
+	}
+
+	if _, err := m.GetInputPipe("true"); err != nil {
+		t.Fatal(err)
+	}
+	if got := m.Close("true"); got != 0 {
+		t.Errorf("Close(successful pipe) = %d, want 0", got)
+	}
+	if got := m.Close("true"); got != -1 {
+		t.Errorf("second Close = %d, want -1", got)
+	}
+}
+
 func TestIOManagerFlush(t *testing.T) {
 	tmpDir := t.TempDir()
 	testFile := filepath.Join(tmpDir, "flush.txt")
@@ -142,7 +178,7 @@ func TestIOManagerFlush(t *testing.T) {
 		t.Fatalf("GetOutputFile failed: %v", err)
 	}
 
-	_, err = w.WriteString("buffered")
+	_, err = io.WriteString(w, "buffered")
 	if err != nil {
 		t.Fatalf("WriteString failed: %v", err)
 	}
@@ -176,7 +212,7 @@ func TestIOManagerFlushAll(t *testing.T) {
 		if err != nil {
 			t.Fatalf("GetOutputFile failed: %v", err)
 		}
-		w.WriteString("content")
+		io.WriteString(w, "content")
 	}
 
 	// Flush all
@@ -186,6 +222,28 @@ func TestIOManagerFlushAll(t *testing.T) {
 	}
 }
 
+func TestIOManagerFlushStdStreams(t *testing.T) {
+	m := NewIOManager()
+	defer m.CloseAll()
+
+	var stdout, stderr strings.Builder
+	bufOut, bufErr := bufio.NewWriter(&stdout), bufio.NewWriter(&stderr)
+	m.SetStdout(bufOut)
+	m.SetStderr(bufErr)
+	io.WriteString(bufOut, "out")
+	io.WriteString(bufErr, "err")
+
+	if result := m.Flush(""); result != 0 {
+		t.Errorf("Flush all returned %d, expected 0", result)
+	}
+	if stdout.String() != "out" || stderr.String() != "err" {
+		t.Errorf("stdout = %q, stderr = %q after Flush all", stdout.String(), stderr.String())
+	}
+	if result := m.Flush("never-opened"); result != -1 {
+		t.Errorf("Flush of unknown name returned %d, expected -1", result)
+	}
+}
+
 func TestIOManagerFileCaching(t *testing.T) {
 	tmpDir := t.TempDir()
 	testFile := filepath.Join(tmpDir, "cache.txt")
@@ -235,6 +293,40 @@ func TestIOManagerInputPipe(t *testing.T) {
 	}
 }
 
+// chanWriter sends each write to a channel.
+type chanWriter chan string
+
+func (c chanWriter) Write(b []byte) (int, error) {
+	c <- string(b)
+	return len(b), nil
+}
+
+// TestIOManagerOutputPipeStreams checks that what an output pipe command
+// writes reaches stdout while it runs, rather than being held until the
+// pipe is flushed or closed.
+func TestIOManagerOutputPipeStreams(t *testing.T) {
+	out := make(chanWriter, 10)
+	m := NewIOManager()
+	defer m.CloseAll()
+	m.SetStdout(out)
+
+	cmd := "echo streamed; cat >/dev/null"
+	if _, err := m.GetOutputPipe(cmd); err != nil {
+		t.Skipf("Pipe test skipped (shell not available): %v", err)
+	}
+	select {
+	case got := <-out:
+		if got != "streamed\n" {
+			t.Errorf("stdout got %q, want %q", got, "streamed\n")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("command output did not reach stdout before close")
+	}
+	if result := m.Close(cmd); result != 0 {
+		t.Errorf("Close(%q) returned %d, expected 0", cmd, result)
+	}
+}
+
 func TestIOManagerOutputPipe(t *testing.T) {
 	tmpDir := t.TempDir()
 	testFile := filepath.Join(tmpDir, "pipe_out.txt")
@@ -276,6 +368,175 @@ func TestIOManagerOutputPipe(t *testing.T) {
 	}
 }
 
+func TestIOManagerCoprocess(t *testing.T) {
+	m := NewIOManager()
+	defer m.CloseAll()
+
+	cmd := "tr a-z A-Z"
+	w, err := m.GetCoprocessWriter(cmd)
+	if err != nil {
+		t.Skipf("Coprocess test skipped (shell not available): %v", err)
+	}
+	w.WriteString("hello\nworld\n")
+
+	// tr only answers once its input ends
+	if result := m.CloseHalf(cmd, "to"); result != 0 {
+		t.Fatalf("CloseHalf(to) returned %d, expected 0", result)
+	}
+
+	scanner, err := m.GetCoprocessReader(cmd)
+	if err != nil {
+		t.Fatalf("GetCoprocessReader failed: %v", err)
+	}
+	var got []string
+	for scanner.Scan() {
+		got = append(got, scanner.Text())
+	}
+	if strings.Join(got, ",") != "HELLO,WORLD" {
+		t.Errorf("Expected HELLO,WORLD, got %q", got)
+	}
+
+	if result := m.Close(cmd); result != 0 {
+		t.Errorf("Close returned %d, expected 0", result)
+	}
+	if result := m.CloseHalf(cmd, "from"); result != -1 {
+		t.Errorf("CloseHalf on closed coprocess returned %d, expected -1", result)
+	}
+}
+
+func TestIOManagerMaxOutputFiles(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	m := NewIOManager()
+	defer m.CloseAll()
+	m.SetMaxOutputFiles(3)
+
+	// Round-robin over more files than the limit, so every write after
+	// the first pass reopens a file that was closed to make room
+	const numFiles, rounds = 10, 4
+	for r := 0; r < rounds; r++ {
+		for i := 0; i < numFiles; i++ {
+			name := filepath.Join(tmpDir, fmt.Sprintf("out%d.txt", i))
+			w, err := m.GetOutputFile(name, false)
+			if err != nil {
+				t.Fatalf("GetOutputFile failed: %v", err)
+			}
+			fmt.Fprintf(w, "file %d round %d\n", i, r)
+			if len(m.outFiles) > 3 {
+				t.Fatalf("%d output files open, limit is 3", len(m.outFiles))
+			}
+		}
+	}
+	m.CloseAll()
+
+	for i := 0; i < numFiles; i++ {
+		content, err := os.ReadFile(filepath.Join(tmpDir, fmt.Sprintf("out%d.txt", i)))
+		if err != nil {
+			t.Fatalf("ReadFile failed: %v", err)
+		}
+		var want strings.Builder
+		for r := 0; r < rounds; r++ {
+			fmt.Fprintf(&want, "file %d round %d\n", i, r)
+		}
+		if string(content) != want.String() {
+			t.Errorf("out%d.txt = %q, want %q", i, content, want.String())
+		}
+	}
+}
+
+func TestIOManagerCloseEvicted(t *testing.T) {
+	tmpDir := t.TempDir()
+	first := filepath.Join(tmpDir, "first.txt")
+	second := filepath.Join(tmpDir, "second.txt")
+
+	m := NewIOManager()
+	defer m.CloseAll()
+	m.SetMaxOutputFiles(1)
+
+	w, _ := m.GetOutputFile(first, false)
+	io.WriteString(w, "old\n")
+	m.GetOutputFile(second, false) // evicts first
+
+	// Closing an evicted file succeeds, and a later ">" truncates again
+	if result := m.Close(first); result != 0 {
+		t.Errorf("Close evicted returned %d, expected 0", result)
+	}
+	w, _ = m.GetOutputFile(first, false)
+	io.WriteString(w, "new\n")
+	m.Close(first)
+
+	content, err := os.ReadFile(first)
+	if err != nil {
+		t.Fatalf("ReadFile failed: %v", err)
+	}
+	if string(content) != "new\n" {
+		t.Errorf("Expected 'new\\n', got %q", string(content))
+	}
+}
+
+func TestIOManagerStdStreams(t *testing.T) {
+	var stdout, stderr strings.Builder
+	m := NewIOManager()
+	defer m.CloseAll()
+	m.SetStdout(&stdout)
+	m.SetStderr(&stderr)
+
+	for _, tt := range []struct {
+		name string
+		want *strings.Builder
+	}{
+		{"/dev/stdout", &stdout},
+		{"/dev/fd/1", &stdout},
+		{"/dev/stderr", &stderr},
+		{"/dev/fd/2", &stderr},
+	} {
+		w, err := m.GetOutputFile(tt.name, false)
+		if err != nil {
+			t.Fatalf("GetOutputFile(%q) failed: %v", tt.name, err)
+		}
+		fmt.Fprintln(w, tt.name)
+		if !strings.Contains(tt.want.String(), tt.name+"\n") {
+			t.Errorf("GetOutputFile(%q) did not write to the process stream", tt.name)
+		}
+		if result := m.Close(tt.name); result != 0 {
+			t.Errorf("Close(%q) returned %d, expected 0", tt.name, result)
+		}
+	}
+	if len(m.outFiles) != 0 {
+		t.Errorf("Expected no files opened, got %d", len(m.outFiles))
+	}
+}
+
+func TestIOManagerStdin(t *testing.T) {
+	m := NewIOManager()
+	defer m.CloseAll()
+	m.SetStdin(strings.NewReader("first\nsecond\nthird\n"))
+
+	// All stdin names share one scanner
+	var got []string
+	for _, name := range []string{"/dev/stdin", "-", "/dev/fd/0"} {
+		scanner, err := m.GetInputFile(name)
+		if err != nil {
+			t.Fatalf("GetInputFile(%q) failed: %v", name, err)
+		}
+		if !scanner.Scan() {
+			t.Fatalf("Expected to read line from %q", name)
+		}
+		got = append(got, scanner.Text())
+	}
+	if strings.Join(got, ",") != "first,second,third" {
+		t.Errorf("Expected first,second,third, got %q", got)
+	}
+	if len(m.inFiles) != 0 {
+		t.Errorf("Expected no files opened, got %d", len(m.inFiles))
+	}
+
+	m.SetStdin(nil)
+	if _, err := m.GetInputFile("/dev/stdin"); err == nil {
+		t.Error("Expected error without standard input")
+	}
+}
+
 func TestIOManagerErrorHandling(t *testing.T) {
 	m := NewIOManager()
 	defer m.CloseAll()
@@ -310,9 +571,9 @@ func BenchmarkIOManagerWrite(b *testing.B) {
 
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
-		w.WriteString("benchmark line\n")
+		io.WriteString(w, "benchmark line\n")
 	}
-	w.Flush()
+	m.Flush(testFile)
 }
 
 func BenchmarkIOManagerCacheHit(b *testing.B) {
@@ -330,3 +591,87 @@ func BenchmarkIOManagerCacheHit(b *testing.B) {
 		m.GetOutputFile(testFile, false)
 	}
 }
+
+func TestIOManagerSlurp(t *testing.T) {
+	tmpDir := t.TempDir()
+	name := filepath.Join(tmpDir, "in.txt")
+	if err := os.WriteFile(name, []byte("line 1\nline 2\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	m := NewIOManager()
+	defer m.CloseAll()
+
+	if got, err := m.Slurp(name); err != nil || got != "line 1\nline 2\n" {
+		t.Errorf("Slurp() = %q, %v", got, err)
+	}
+	if got, err := m.Slurp(filepath.Join(tmpDir, "missing")); err == nil || got != "" {
+		t.Errorf("Slurp(missing) = %q, %v, want error", got, err)
+	}
+
+	// Unflushed output to the same file is visible
+	out := filepath.Join(tmpDir, "out.txt")
+	w, err := m.GetOutputFile(out, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	io.WriteString(w, "pending\n")
+	if got, err := m.Slurp(out); err != nil || got != "pending\n" {
+		t.Errorf("Slurp(out) = %q, %v", got, err)
+	}
+
+	// Size limit
+	m.SetMaxSlurpSize(10)
+	if got, err := m.Slurp(name); err == nil || got != "" {
+		t.Errorf("Slurp() over limit = %q, %v, want error", got, err)
+	}
+	m.SetMaxSlurpSize(14)
+	if got, err := m.Slurp(name); err != nil || got != "line 1\nline 2\n" {
+		t.Errorf("Slurp() at limit = %q, %v", got, err)
+	}
+}
+
+func TestIOManagerSpit(t *testing.T) {
+	tmpDir := t.TempDir()
+	name := filepath.Join(tmpDir, "out.txt")
+
+	m := NewIOManager()
+	defer m.CloseAll()
+
+	if n, err := m.Spit(name, "first\n", false); err != nil || n != 6 {
+		t.Fatalf("Spit() = %d, %v", n, err)
+	}
+	if n, err := m.Spit(name, "second\n", true); err != nil || n != 7 {
+		t.Fatalf("Spit(append) = %d, %v", n, err)
+	}
+	if got, _ := os.ReadFile(name); string(got) != "first\nsecond\n" {
+		t.Errorf("after append: %q", got)
+	}
+	if _, err := m.Spit(name, "third\n", false); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := os.ReadFile(name); string(got) != "third\n" {
+		t.Errorf("after truncate: %q", got)
+	}
+
+	// A file open for output is flushed and closed first
+	w, err := m.GetOutputFile(name, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	io.WriteString(w, "printed\n")
+	if _, err := m.Spit(name, "spat\n", true); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := m.outFiles[name]; ok {
+		t.Error("output file still open after Spit")
+	}
+	m.CloseAll()
+	if got, _ := os.ReadFile(name); string(got) != "printed\nspat\n" {
+		t.Errorf("after print and spit: %q", got)
+	}
+
+	if _, err := m.Spit(filepath.Join(tmpDir, "missing", "x"), "x", false); err == nil {
+		t.Error("expected error for missing directory")
+	}
+}
@@ -283,6 +283,12 @@ func extractRequiredLiterals(p string) []string {
 				}
 				current.Reset()
 				i += 2
+				// Braced escape arguments (\x{41}, \p{Greek}) are not literals
+				if i < len(p) && p[i] == '{' {
+					if end := strings.IndexByte(p[i:], '}'); end >= 0 {
+						i += end + 1
+					}
+				}
 				continue
 			}
 			// Trailing backslash - skip
@@ -115,6 +115,15 @@ func TestExtractLiterals(t *testing.T) {
 			pattern: ".*authentication_failed.*",
 			wantReq: []string{"authentication_failed"},
 		},
+		{
+			name:    "braced hex escape is not a literal",
+			pattern: `.*\x{4e16}.*`,
+		},
+		{
+			name:    "literal after braced escape",
+			pattern: `\x{e9}.*error`,
+			wantReq: []string{"error"},
+		},
 	}
 
 	for _, tt := range tests {
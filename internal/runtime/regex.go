@@ -2,7 +2,13 @@
 package runtime
 
 import (
+	"errors"
+	"fmt"
+	"regexp/syntax"
+	"strconv"
+	"strings"
 	"sync"
+	"unicode/utf8"
 
 	"github.com/coregx/coregex"
 )
@@ -40,7 +46,11 @@ type Regex struct {
 	charClass *CharClassSearcher // Fast path for simple patterns like \d+, \s+, \w+
 	composite *CompositeSearcher // Fast path for composite patterns like [a-zA-Z]+[0-9]+
 	literals  *LiteralInfo       // Fast rejection for patterns with literal substrings
+	bt        *backtracker       // Backtracking matcher for back-references and lookahead (non-POSIX only)
 	posix     bool               // POSIX leftmost-longest matching enabled
+
+	resumeOnce sync.Once
+	resume     resumeInfo // For SearchResume, computed on first use
 }
 
 // Compile creates a new Regex from pattern with default POSIX config.
@@ -54,10 +64,28 @@ func Compile(pattern string) (*Regex, error) {
 // CompileWithConfig creates a new Regex with specified configuration.
 // AWK semantics: dot matches any character including newlines.
 // When config.POSIX is true, uses leftmost-longest matching (slower but POSIX compliant).
-// When config.POSIX is false, uses leftmost-first matching (faster, Perl-like).
+// When config.POSIX is false, uses leftmost-first matching (faster, Perl-like)
+// and additionally accepts back-references (\1-\9) and lookahead
+// ((?=re), (?!re)) via a backtracking matcher.
 func CompileWithConfig(pattern string, config RegexConfig) (*Regex, error) {
+	src := normalizeEscapes(pattern)
+
+	// Back-references and lookahead are not part of POSIX ERE and cannot be
+	// matched by the linear engine, so they are only available in non-POSIX mode.
+	if !config.POSIX && needsBacktrack(src) {
+		bt, err := compileBacktrack(src)
+		if err != nil {
+			return nil, newRegexError(pattern, err, func(p string) error {
+				_, err := compileBacktrack(normalizeEscapes(p))
+				return err
+			})
+		}
+		bt.pattern = pattern
+		return &Regex{pattern: pattern, bt: bt}, nil
+	}
+
 	// Prepend dotallPrefix for AWK dotall semantics: . matches \n
-	awkPattern := dotallPrefix + pattern
+	awkPattern := dotallPrefix + src
 
 	// Try fast path for simple character class patterns
 	charClass := analyzeCharClass(awkPattern)
@@ -77,7 +105,10 @@ func CompileWithConfig(pattern string, config RegexConfig) (*Regex, error) {
 	// Still compile the full regex as fallback and for complex operations
 	re, err := coregex.Compile(awkPattern)
 	if err != nil {
-		return nil, err
+		return nil, newRegexError(pattern, err, func(p string) error {
+			_, err := coregex.Compile(dotallPrefix + normalizeEscapes(p))
+			return err
+		})
 	}
 
 	// POSIX mode: use leftmost-longest matching (AWK/ERE semantics)
@@ -96,6 +127,154 @@ func CompileWithConfig(pattern string, config RegexConfig) (*Regex, error) {
 	}, nil
 }
 
+// RegexError describes an invalid pattern and where the problem was found.
+type RegexError struct {
+	Pattern string // Pattern as written by the user
+	Pos     int    // 0-based byte offset of the problem in Pattern
+	Msg     string // Error description, e.g. "missing ]"
+}
+
+func (e *RegexError) Error() string {
+	return fmt.Sprintf("%s at position %d", e.Msg, e.Pos)
+}
+
+// newRegexError converts a regexp/syntax error into a RegexError whose
+// position refers to pattern (without the internal dotall prefix).
+// compile is the compiler that failed, used to locate the error.
+func newRegexError(pattern string, err error, compile func(string) error) error {
+	var se *syntax.Error
+	if !errors.As(err, &se) {
+		return &RegexError{Pattern: pattern, Pos: 0, Msg: err.Error()}
+	}
+
+	e := &RegexError{Pattern: pattern}
+	switch se.Code {
+	case syntax.ErrMissingBracket:
+		e.Msg, e.Pos = "missing ]", len(pattern)
+	case syntax.ErrMissingParen:
+		e.Msg, e.Pos = "missing )", len(pattern)
+	case syntax.ErrUnexpectedParen:
+		e.Msg, e.Pos = "unexpected )", unmatchedParen(pattern)
+	case syntax.ErrTrailingBackslash:
+		e.Msg, e.Pos = "trailing backslash", max(len(pattern)-1, 0)
+	default:
+		e.Msg = fmt.Sprintf("%s `%s`", se.Code, se.Expr)
+		e.Pos = errorPos(pattern, se, compile)
+	}
+	return e
+}
+
+// errorPos returns the offset in pattern of the text se reports. The same
+// text may appear earlier without error (e.g. "**" inside a bracket
+// expression), so it is the first occurrence where compiling pattern up to
+// the end of that text fails with the same error.
+func errorPos(pattern string, se *syntax.Error, compile func(string) error) int {
+	first := strings.Index(pattern, se.Expr)
+	if first < 0 || se.Expr == "" {
+		return 0
+	}
+	for i := first; i >= 0; {
+		var pe *syntax.Error
+		err := compile(pattern[:i+len(se.Expr)])
+		if errors.As(err, &pe) && pe.Code == se.Code && pe.Expr == se.Expr {
+			return i
+		}
+		next := strings.Index(pattern[i+1:], se.Expr)
+		if next < 0 {
+			break
+		}
+		i += 1 + next
+	}
+	return first
+}
+
+// normalizeEscapes rewrites the numeric escapes AWK allows in regexes into
+// the \x{...} form understood by both regex engines: \NNN and \0NN octal,
+// \xH and \xHH hex, and \uH... (up to 8 hex digits) Unicode code points.
+// A lone \1-\9 is left alone so it can still act as a back-reference.
+func normalizeEscapes(pattern string) string {
+	if !strings.Contains(pattern, "\\") {
+		return pattern
+	}
+	var b strings.Builder
+	for i := 0; i < len(pattern); i++ {
+		c := pattern[i]
+		if c != '\\' || i+1 >= len(pattern) {
+			b.WriteByte(c)
+			continue
+		}
+		next := pattern[i+1]
+		switch {
+		case isOctal(next) && (next == '0' || countDigits(pattern[i+1:], 3, isOctal) == 3):
+			n := countDigits(pattern[i+1:], 3, isOctal)
+			v, _ := strconv.ParseUint(pattern[i+1:i+1+n], 8, 32)
+			fmt.Fprintf(&b, "\\x{%x}", v)
+			i += n
+		case next == 'x' && countDigits(pattern[i+2:], 2, isHex) > 0:
+			n := countDigits(pattern[i+2:], 2, isHex)
+			fmt.Fprintf(&b, "\\x{%s}", pattern[i+2:i+2+n])
+			i += 1 + n
+		case next == 'u' && countDigits(pattern[i+2:], 8, isHex) > 0:
+			n := countDigits(pattern[i+2:], 8, isHex)
+			fmt.Fprintf(&b, "\\x{%s}", pattern[i+2:i+2+n])
+			i += 1 + n
+		default:
+			// Any other escape, including \\, is copied through untouched
+			b.WriteByte(c)
+			b.WriteByte(next)
+			i++
+		}
+	}
+	return b.String()
+}
+
+// countDigits returns how many leading bytes of s, up to limit, satisfy digit.
+func countDigits(s string, limit int, digit func(byte) bool) int {
+	n := 0
+	for n < len(s) && n < limit && digit(s[n]) {
+		n++
+	}
+	return n
+}
+
+func isOctal(c byte) bool { return c >= '0' && c <= '7' }
+
+func isHex(c byte) bool {
+	return c >= '0' && c <= '9' || c >= 'a' && c <= 'f' || c >= 'A' && c <= 'F'
+}
+
+// unmatchedParen returns the offset of the first ')' without a matching '('.
+func unmatchedParen(pattern string) int {
+	depth := 0
+	inClass := false
+	for i := 0; i < len(pattern); i++ {
+		switch c := pattern[i]; {
+		case c == '\\':
+			i++
+		case inClass:
+			if c == ']' {
+				inClass = false
+			}
+		case c == '[':
+			inClass = true
+			if i+1 < len(pattern) && pattern[i+1] == '^' {
+				i++
+			}
+			if i+1 < len(pattern) && pattern[i+1] == ']' {
+				i++
+			}
+		case c == '(':
+			depth++
+		case c == ')':
+			if depth == 0 {
+				return i
+			}
+			depth--
+		}
+	}
+	return len(pattern)
+}
+
 // MustCompile creates a Regex, panicking on error.
 func MustCompile(pattern string) *Regex {
 	re, err := Compile(pattern)
@@ -120,6 +299,10 @@ func (r *Regex) IsPOSIX() bool {
 // Uses composite fast path for patterns like [a-zA-Z]+[0-9]+.
 // Uses literal prefiltering for patterns with literal substrings.
 func (r *Regex) MatchString(s string) bool {
+	if r.bt != nil {
+		return r.bt.MatchString(s)
+	}
+
 	// Fast path 1: CharClass (14-22x speedup for \d+, \s+, \w+, etc.)
 	if r.charClass != nil {
 		return r.charClass.MatchString(s)
@@ -145,6 +328,10 @@ func (r *Regex) MatchString(s string) bool {
 // Uses composite fast path for patterns like [a-zA-Z]+[0-9]+.
 // Uses literal prefiltering for patterns with literal substrings.
 func (r *Regex) FindStringIndex(s string) []int {
+	if r.bt != nil {
+		return r.bt.FindStringIndex(s)
+	}
+
 	// Fast path 1: CharClass
 	if r.charClass != nil {
 		return r.charClass.FindStringIndex(s)
@@ -166,24 +353,218 @@ func (r *Regex) FindStringIndex(s string) []int {
 
 // FindAllStringIndex returns all non-overlapping matches.
 func (r *Regex) FindAllStringIndex(s string, n int) [][]int {
+	if r.bt != nil {
+		return r.bt.FindAllStringIndex(s, n)
+	}
 	return r.re.FindAllStringIndex(s, n)
 }
 
+// FindAllStringSubmatchIndex returns up to n matches (all if n < 0), each
+// with the positions of its groups as in regexp.
+func (r *Regex) FindAllStringSubmatchIndex(s string, n int) [][]int {
+	if r.bt != nil {
+		return r.bt.FindAllStringSubmatchIndex(s, n)
+	}
+	return r.re.FindAllStringSubmatchIndex(s, n)
+}
+
 // ReplaceAllString replaces all matches with repl.
 func (r *Regex) ReplaceAllString(s, repl string) string {
+	if r.bt != nil {
+		return r.bt.ReplaceAllString(s, repl)
+	}
 	return r.re.ReplaceAllString(s, repl)
 }
 
 // ReplaceAllStringFunc replaces all matches using the function.
 func (r *Regex) ReplaceAllStringFunc(s string, f func(string) string) string {
+	if r.bt != nil {
+		return r.bt.ReplaceAllStringFunc(s, f)
+	}
 	return r.re.ReplaceAllStringFunc(s, f)
 }
 
 // Split slices s into substrings separated by matches.
 func (r *Regex) Split(s string, n int) []string {
+	if r.bt != nil {
+		return r.bt.Split(s, n)
+	}
 	return r.re.Split(s, n)
 }
 
+// SearchResume returns the offset in s from which a search must start
+// again once more text is appended to s, given that searching s[from:]
+// found no non-empty match ending before len(s). Earlier offsets can be
+// skipped: a match starting there would have ended within s, or can't
+// start with the byte there. It returns from if the pattern gives no such
+// guarantee, as with back-references or assertions that look at the text
+// before the match, like ^ or \b.
+func (r *Regex) SearchResume(s []byte, from int) int {
+	r.resumeOnce.Do(func() {
+		r.resume = newResumeInfo(r.pattern)
+	})
+	info := &r.resume
+	if !info.ok {
+		return from
+	}
+	p := from
+	if info.maxLen >= 0 {
+		p = max(p, len(s)-info.maxLen)
+	}
+	for p < len(s) && !info.first[s[p]] {
+		p++
+	}
+	return p
+}
+
+// resumeInfo describes the matches of a pattern for SearchResume.
+type resumeInfo struct {
+	ok     bool      // Searches may resume after the start of the text
+	maxLen int       // Longest match in bytes, or -1 if unbounded
+	first  [256]bool // Bytes a non-empty match can start with
+}
+
+// newResumeInfo analyzes pattern for SearchResume.
+func newResumeInfo(pattern string) resumeInfo {
+	var info resumeInfo
+	re, err := syntax.Parse(dotallPrefix+normalizeEscapes(pattern), syntax.Perl)
+	if err != nil || lookBehind(re) {
+		// Back-references, lookahead and other extensions don't parse
+		return info
+	}
+	re = re.Simplify()
+	info.ok = true
+	info.maxLen = maxMatchLen(re)
+	firstBytes(re, &info.first)
+	return info
+}
+
+// lookBehind reports whether re has assertions depending on the text
+// before the position they are tested at.
+func lookBehind(re *syntax.Regexp) bool {
+	switch re.Op {
+	case syntax.OpBeginLine, syntax.OpBeginText, syntax.OpWordBoundary, syntax.OpNoWordBoundary:
+		return true
+	}
+	for _, sub := range re.Sub {
+		if lookBehind(sub) {
+			return true
+		}
+	}
+	return false
+}
+
+// maxMatchLen returns the length in bytes of the longest text re matches,
+// or -1 if there is no limit.
+func maxMatchLen(re *syntax.Regexp) int {
+	switch re.Op {
+	case syntax.OpLiteral:
+		if re.Flags&syntax.FoldCase != 0 {
+			// Case variants may be longer, like K (KELVIN SIGN) for k
+			return len(re.Rune) * utf8.UTFMax
+		}
+		n := 0
+		for _, r := range re.Rune {
+			n += utf8.RuneLen(r)
+		}
+		return n
+	case syntax.OpCharClass, syntax.OpAnyChar, syntax.OpAnyCharNotNL:
+		return utf8.UTFMax
+	case syntax.OpCapture, syntax.OpQuest:
+		return maxMatchLen(re.Sub[0])
+	case syntax.OpStar, syntax.OpPlus, syntax.OpRepeat:
+		n := maxMatchLen(re.Sub[0])
+		switch {
+		case n == 0:
+			return 0
+		case n < 0 || re.Op != syntax.OpRepeat || re.Max < 0:
+			return -1
+		}
+		return n * re.Max
+	case syntax.OpConcat, syntax.OpAlternate:
+		total := 0
+		for _, sub := range re.Sub {
+			n := maxMatchLen(sub)
+			if n < 0 {
+				return -1
+			}
+			if re.Op == syntax.OpConcat {
+				total += n
+			} else {
+				total = max(total, n)
+			}
+		}
+		return total
+	}
+	return 0 // Empty matches and assertions
+}
+
+// firstBytes adds the bytes a non-empty match of re can start with to set.
+// It reports whether re can match the empty string, in which case the
+// bytes following re may start the match too.
+func firstBytes(re *syntax.Regexp, set *[256]bool) (empty bool) {
+	switch re.Op {
+	case syntax.OpLiteral:
+		if len(re.Rune) == 0 {
+			return true
+		}
+		if re.Flags&syntax.FoldCase != 0 || re.Rune[0] >= utf8.RuneSelf {
+			// Case variants may start with other bytes; allow them all
+			for b := range set {
+				set[b] = true
+			}
+			return false
+		}
+		set[re.Rune[0]] = true
+		return false
+	case syntax.OpCharClass:
+		for i := 0; i+1 < len(re.Rune); i += 2 {
+			lo, hi := re.Rune[i], re.Rune[i+1]
+			for c := lo; c <= hi && c < utf8.RuneSelf; c++ {
+				set[c] = true
+			}
+			if hi >= utf8.RuneSelf {
+				// Any multi-byte or invalid (U+FFFD) lead byte
+				for b := utf8.RuneSelf; b < len(set); b++ {
+					set[b] = true
+				}
+			}
+		}
+		return false
+	case syntax.OpAnyChar, syntax.OpAnyCharNotNL:
+		for b := range set {
+			if re.Op == syntax.OpAnyChar || b != '\n' {
+				set[b] = true
+			}
+		}
+		return false
+	case syntax.OpCapture, syntax.OpPlus:
+		return firstBytes(re.Sub[0], set)
+	case syntax.OpStar, syntax.OpQuest:
+		firstBytes(re.Sub[0], set)
+		return true
+	case syntax.OpRepeat:
+		return firstBytes(re.Sub[0], set) || re.Min == 0
+	case syntax.OpConcat:
+		for _, sub := range re.Sub {
+			if !firstBytes(sub, set) {
+				return false
+			}
+		}
+		return true
+	case syntax.OpAlternate:
+		for _, sub := range re.Sub {
+			if firstBytes(sub, set) {
+				empty = true
+			}
+		}
+		return empty
+	case syntax.OpNoMatch:
+		return false
+	}
+	return true // Empty matches and assertions
+}
+
 // RegexCache provides thread-safe compiled regex caching with FIFO eviction.
 // Optimized for AWK workloads: lock-free reads via sync.Map, no LRU overhead.
 type RegexCache struct {
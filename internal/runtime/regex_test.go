@@ -1,6 +1,7 @@
 package runtime
 
 import (
+	"fmt"
 	"testing"
 )
 
@@ -42,6 +43,45 @@ func TestCompile(t *testing.T) {
 	}
 }
 
+func TestRegexErrorPosition(t *testing.T) {
+	tests := []struct {
+		pattern string
+		posix   bool
+		want    string
+	}{
+		{"[abcd", true, "missing ] at position 5"},
+		{"(abc", true, "missing ) at position 4"},
+		{"ab)c", true, "unexpected ) at position 2"},
+		{"(a)[)]b)", true, "unexpected ) at position 7"},
+		{"abc\\", true, "trailing backslash at position 3"},
+		{"a**", true, "invalid nested repetition operator `**` at position 1"},
+		{"[**]a**", true, "invalid nested repetition operator `**` at position 5"},
+		{"[**]a**", false, "invalid nested repetition operator `**` at position 5"},
+		{"x{2,1}", true, "invalid repeat count `{2,1}` at position 1"},
+		{"[x{2,1}]y{2,1}", true, "invalid repeat count `{2,1}` at position 9"},
+		{"[*]|*", true, "missing argument to repetition operator `*` at position 4"},
+		{"ab\\q", true, "invalid escape sequence `\\q` at position 2"},
+		{"(.)\\2", false, "invalid back reference `\\2` at position 3"},
+		{"a(?=b", false, "missing ) at position 5"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.pattern, func(t *testing.T) {
+			_, err := CompileWithConfig(tt.pattern, RegexConfig{POSIX: tt.posix})
+			re, ok := err.(*RegexError)
+			if !ok {
+				t.Fatalf("expected *RegexError, got %T (%v)", err, err)
+			}
+			if re.Pattern != tt.pattern {
+				t.Errorf("Pattern = %q, want %q", re.Pattern, tt.pattern)
+			}
+			if err.Error() != tt.want {
+				t.Errorf("Error() = %q, want %q", err.Error(), tt.want)
+			}
+		})
+	}
+}
+
 func TestMustCompile(t *testing.T) {
 	defer func() {
 		if r := recover(); r == nil {
@@ -82,6 +122,54 @@ func TestMatchString(t *testing.T) {
 	}
 }
 
+func TestNumericEscapes(t *testing.T) {
+	tests := []struct {
+		pattern string
+		input   string
+		want    bool
+	}{
+		{`\x41`, "A", true},
+		{`\x41`, "B", false},
+		{`\x4`, "\x04", true},
+		{`\101`, "A", true},
+		{`\101`, "101", false},
+		{`\0`, "\x00", true},
+		{`\011`, "a\tb", true},
+		{`\u00e9`, "café", true},
+		{`\u00e9`, "cafe", false},
+		{`\u4e16`, "世界", true},
+		{`^[\x41-\x43]+$`, "ABCA", true},
+		{`^[\x41-\x43]+$`, "ABD", false},
+		{`[\101\102]`, "xB", true},
+		{`\\x41`, `\x41`, true},
+		{`\\101`, "A", false},
+	}
+
+	for _, tt := range tests {
+		for _, config := range []RegexConfig{DefaultConfig(), FastConfig()} {
+			t.Run(fmt.Sprintf("%s_%q_posix=%v", tt.pattern, tt.input, config.POSIX), func(t *testing.T) {
+				re, err := CompileWithConfig(tt.pattern, config)
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if got := re.MatchString(tt.input); got != tt.want {
+					t.Errorf("MatchString(%q) = %v, want %v", tt.input, got, tt.want)
+				}
+			})
+		}
+	}
+}
+
+func TestNumericEscapesWithBackref(t *testing.T) {
+	re, err := CompileWithConfig(`(\x41)\1`, FastConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !re.MatchString("xAAy") || re.MatchString("xABy") {
+		t.Errorf("(\\x41)\\1 should match only a doubled A")
+	}
+}
+
 func TestFindStringIndex(t *testing.T) {
 	tests := []struct {
 		pattern string
@@ -197,6 +285,40 @@ func TestSplit(t *testing.T) {
 	}
 }
 
+func TestSearchResume(t *testing.T) {
+	tests := []struct {
+		pattern string
+		input   string
+		from    int
+		want    int
+	}{
+		{";;", ";bcd;e;", 0, 6},       // Bounded: a match starting earlier would have ended within the text
+		{"\r?\n", "\r\r\r\r", 3, 3},   // Never before from
+		{"\n+", "abcdef", 0, 6},       // No byte can start a match
+		{"x[^y]*y", "abxcdef", 0, 2},  // Unbounded, from the first possible start
+		{"[0-9]+", "ab1cd", 0, 2},     // Classes
+		{"é|ü", "abcd", 0, 4},         // Multi-byte literals
+		{`(?:^|;)x`, "abcdef", 0, 0},  // Assertions looking back stop skipping
+		{`^x`, "abcdef", 1, 1},        // Also at from
+		{`(a)\1`, "bbbbbb", 0, 0},     // Back-references give no guarantee
+		{"(?:abc)?d", "xxxxxx", 0, 6}, // Optional parts
+		{"a{2,}", "bbbbab", 0, 4},     // Unbounded repeats
+		{"[^\n]", "\n\n\n", 0, 3},     // Negated classes
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.pattern, func(t *testing.T) {
+			re, err := CompileWithConfig(tt.pattern, FastConfig())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := re.SearchResume([]byte(tt.input), tt.from); got != tt.want {
+				t.Errorf("SearchResume(%q, %d) = %d, want %d", tt.input, tt.from, got, tt.want)
+			}
+		})
+	}
+}
+
 func TestRegexCache(t *testing.T) {
 	cache := NewRegexCache(3)
 
@@ -255,6 +255,12 @@ func (c *Checker) checkExpr(expr ast.Expr) {
 	case *ast.CallExpr:
 		c.checkCallExpr(e)
 
+	case *ast.IndirectCallExpr:
+		c.checkExpr(e.Func)
+		for _, arg := range e.Args {
+			c.checkExpr(arg)
+		}
+
 	case *ast.BuiltinExpr:
 		c.checkBuiltinExpr(e)
 
@@ -306,7 +312,7 @@ func (c *Checker) checkCallExpr(e *ast.CallExpr) {
 	}
 
 	// Check argument count
-	if len(e.Args) > len(funcInfo.Params) {
+	if len(e.Args) > len(funcInfo.Params) && !c.result.Options.ExtraArgs {
 		c.errors.Add(e.Pos(), errTooManyArgs, e.Name)
 	}
 
@@ -131,4 +131,11 @@ const (
 	warnUnusedVar   = "variable %q is declared but never used"
 	warnUnusedFunc  = "function %q is declared but never called"
 	warnUnusedParam = "parameter %q is never used"
+
+	warnFormatTooFewArgs   = "%s format %q has %d conversions but only %d arguments"
+	warnFormatTooManyArgs  = "%s format %q has %d conversions but %d arguments; extra arguments are ignored"
+	warnFormatStringForNum = "%s %%%c expects a number, got string %q"
+	warnPrintfNoNewline    = "printf format %q has no newline and nothing else prints one, so the output for each record runs together on one line"
+	warnExtraArgs          = "function %q called with %d arguments but declares %d"
+	warnAssignInCond       = "assignment used as a condition; use == to compare, or add parentheses if the assignment is intended"
 )
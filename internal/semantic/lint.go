@@ -0,0 +1,198 @@
+package semantic
+
+import (
+	"strings"
+
+	"github.com/kolkov/uawk/internal/ast"
+	"github.com/kolkov/uawk/internal/token"
+	"github.com/kolkov/uawk/internal/types"
+)
+
+// Lint reports likely mistakes that are valid AWK, such as printf and
+// sprintf calls whose constant format doesn't fit their arguments, a
+// per-record printf whose output never ends a line, an assignment used
+// as a condition, or a call passing a function more arguments than it
+// declares (accepted only with Options.ExtraArgs).
+// Lint warnings never stop a program from compiling or running.
+func Lint(prog *ast.Program) WarningList {
+	var warnings WarningList
+	params := make(map[string]int, len(prog.Functions))
+	for _, fn := range prog.Functions {
+		params[fn.Name] = len(fn.Params)
+	}
+	ast.Inspect(prog, func(n, _ ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.CallExpr:
+			if np, ok := params[n.Name]; ok && len(n.Args) > np {
+				warnings.Add(n.Pos(), warnExtraArgs, n.Name, len(n.Args), np)
+			}
+		case *ast.PrintStmt:
+			if n.Printf && len(n.Args) > 0 {
+				lintFormat(&warnings, "printf", n.Args[0], n.Args[1:])
+			}
+		case *ast.BuiltinExpr:
+			if n.Func == token.F_SPRINTF && len(n.Args) > 0 {
+				lintFormat(&warnings, "sprintf", n.Args[0], n.Args[1:])
+			}
+		case *ast.IfStmt:
+			lintAssignCond(&warnings, n.Cond)
+		case *ast.WhileStmt:
+			lintAssignCond(&warnings, n.Cond)
+		case *ast.DoWhileStmt:
+			lintAssignCond(&warnings, n.Cond)
+		case *ast.ForStmt:
+			lintAssignCond(&warnings, n.Cond)
+		case *ast.TernaryExpr:
+			// The parentheses needed to write (x = 1) ? a : b don't
+			// count as marking the assignment intended
+			if g, ok := n.Cond.(*ast.GroupExpr); ok {
+				lintAssignCond(&warnings, g.Expr)
+			}
+		}
+		return true
+	})
+	lintPrintfNewline(&warnings, prog)
+	return warnings
+}
+
+// lintAssignCond warns when cond is a plain assignment, as in
+// if (x = 5), which is usually a mistyped comparison. Extra parentheses,
+// as in if ((x = 5)), mark the assignment as intended, and so does a
+// getline on the right-hand side, as in while (n = (getline line)).
+func lintAssignCond(warnings *WarningList, cond ast.Expr) {
+	assign, ok := cond.(*ast.AssignExpr)
+	if !ok || assign.Op != token.ASSIGN {
+		return
+	}
+	getline := false
+	ast.Inspect(assign.Right, func(n, _ ast.Node) bool {
+		if _, ok := n.(*ast.GetlineExpr); ok {
+			getline = true
+		}
+		return !getline
+	})
+	if !getline {
+		warnings.Add(assign.Pos(), warnAssignInCond)
+	}
+}
+
+// lintPrintfNewline warns about printf statements in pattern-action rules
+// whose constant format has no newline, as in { printf "%d", $1 }, when
+// nothing in the program may print one: the output of all records then
+// runs together. A print, a dynamic format or a newline argument anywhere
+// (such as END { print "" }) suggests the missing newline is deliberate.
+func lintPrintfNewline(warnings *WarningList, prog *ast.Program) {
+	newline := false
+	ast.Inspect(prog, func(n, _ ast.Node) bool {
+		if s, ok := n.(*ast.PrintStmt); ok && s.Redirect == token.ILLEGAL && printsNewline(s) {
+			newline = true
+		}
+		return !newline
+	})
+	if newline {
+		return
+	}
+
+	for _, rule := range prog.Rules {
+		if rule.Action == nil {
+			continue
+		}
+		ast.Inspect(rule.Action, func(n, _ ast.Node) bool {
+			if s, ok := n.(*ast.PrintStmt); ok && s.Printf && s.Redirect == token.ILLEGAL && len(s.Args) > 0 {
+				if lit, ok := s.Args[0].(*ast.StrLit); ok {
+					warnings.Add(lit.Pos(), warnPrintfNoNewline, lit.Value)
+				}
+			}
+			return true
+		})
+	}
+}
+
+// printsNewline reports whether an unredirected print or printf may
+// output a newline: a print (which ends with ORS), a printf with a dynamic
+// format, or one whose format or a string literal argument has a newline.
+func printsNewline(s *ast.PrintStmt) bool {
+	if !s.Printf || len(s.Args) == 0 {
+		return true
+	}
+	if _, ok := s.Args[0].(*ast.StrLit); !ok {
+		return true
+	}
+	for _, arg := range s.Args {
+		if lit, ok := arg.(*ast.StrLit); ok && strings.Contains(lit.Value, "\n") {
+			return true
+		}
+	}
+	return false
+}
+
+// lintFormat checks a constant printf-style format against its arguments.
+func lintFormat(warnings *WarningList, name string, format ast.Expr, args []ast.Expr) {
+	lit, ok := format.(*ast.StrLit)
+	if !ok {
+		return // Dynamic format: nothing is known until run time
+	}
+
+	verbs := formatVerbs(lit.Value)
+	switch {
+	case len(args) < len(verbs):
+		warnings.Add(format.Pos(), warnFormatTooFewArgs, name, lit.Value, len(verbs), len(args))
+	case len(args) > len(verbs):
+		warnings.Add(args[len(verbs)].Pos(), warnFormatTooManyArgs, name, lit.Value, len(verbs), len(args))
+	}
+
+	for i, verb := range verbs {
+		if i >= len(args) || !isNumericVerb(verb) {
+			continue
+		}
+		if s, ok := args[i].(*ast.StrLit); ok {
+			if _, err := types.ParseNum(s.Value); err != nil {
+				warnings.Add(s.Pos(), warnFormatStringForNum, name, verb, s.Value)
+			}
+		}
+	}
+}
+
+// formatVerbs returns the conversion character of each argument a printf
+// format consumes, in order. A '*' width or precision consumes an argument
+// of its own and is reported as the verb '*'.
+func formatVerbs(format string) []byte {
+	var verbs []byte
+	for i := 0; i < len(format); i++ {
+		if format[i] != '%' {
+			continue
+		}
+		i++
+		if i < len(format) && format[i] == '%' {
+			continue // Literal %
+		}
+		// Flags, width and precision
+		for i < len(format) && isFormatModifier(format[i]) {
+			if format[i] == '*' {
+				verbs = append(verbs, '*')
+			}
+			i++
+		}
+		if i < len(format) {
+			verbs = append(verbs, format[i])
+		}
+	}
+	return verbs
+}
+
+func isFormatModifier(c byte) bool {
+	switch c {
+	case '-', '+', ' ', '#', '0', '\'', '.', '*':
+		return true
+	}
+	return c >= '1' && c <= '9'
+}
+
+// isNumericVerb reports whether a conversion expects a numeric argument.
+func isNumericVerb(verb byte) bool {
+	switch verb {
+	case 'd', 'i', 'o', 'u', 'x', 'X', 'e', 'E', 'f', 'F', 'g', 'G', 'a', 'A', '*':
+		return true
+	}
+	return false
+}
@@ -26,6 +26,17 @@ type ResolveResult struct {
 
 	// Warnings (non-fatal issues)
 	Warnings WarningList
+
+	// Options the program was resolved with
+	Options Options
+}
+
+// Options adjusts semantic analysis.
+type Options struct {
+	// ExtraArgs accepts calls passing more arguments than a user-defined
+	// function declares instead of reporting an error. The compiler
+	// evaluates the extra arguments and discards them.
+	ExtraArgs bool
 }
 
 // Resolver performs semantic analysis on an AST.
@@ -47,15 +58,26 @@ type Resolver struct {
 
 	// Type inference iteration count
 	typeUpdates int
+
+	// Whether the program contains indirect calls (@f()), which may
+	// call any function by name
+	hasIndirectCalls bool
 }
 
 // Resolve performs semantic analysis on the given program.
 // Returns the resolution result containing symbol tables, errors, and warnings.
 func Resolve(prog *ast.Program) (*ResolveResult, error) {
+	return ResolveWithOptions(prog, Options{})
+}
+
+// ResolveWithOptions is like Resolve but with the given options, which
+// Check also honours through the result.
+func ResolveWithOptions(prog *ast.Program, opts Options) (*ResolveResult, error) {
 	r := &Resolver{
 		result: &ResolveResult{
 			Globals:   NewSymbolTable(nil, "global"),
 			Functions: make(map[string]*FuncInfo),
+			Options:   opts,
 		},
 	}
 
@@ -386,6 +408,13 @@ func (r *Resolver) resolveExpr(expr ast.Expr) {
 	case *ast.CallExpr:
 		r.resolveCall(e)
 
+	case *ast.IndirectCallExpr:
+		r.hasIndirectCalls = true
+		r.resolveVarRef(e.Func.Name, TypeScalar, e.Func.Pos())
+		for _, arg := range e.Args {
+			r.resolveExpr(arg)
+		}
+
 	case *ast.BuiltinExpr:
 		r.resolveBuiltin(e)
 
@@ -494,7 +523,7 @@ func (r *Resolver) resolveCall(call *ast.CallExpr) {
 	funcInfo.Called = true
 
 	// Check argument count
-	if len(call.Args) > len(funcInfo.Params) {
+	if len(call.Args) > len(funcInfo.Params) && !r.result.Options.ExtraArgs {
 		r.result.Errors.Add(call.Pos(), errTooManyArgs, call.Name)
 	}
 
@@ -557,8 +586,33 @@ func (r *Resolver) resolveBuiltin(builtin *ast.BuiltinExpr) {
 		return
 	}
 
-	// Special handling for length() - argument may be array or scalar
-	if builtin.Func == token.F_LENGTH && len(builtin.Args) > 0 {
+	// Special handling for copy() and extend() - both args are arrays
+	if builtin.Func == token.F_COPY || builtin.Func == token.F_EXTEND {
+		for _, arg := range builtin.Args {
+			if ident, ok := arg.(*ast.Ident); ok {
+				r.resolveVarRef(ident.Name, TypeArray, ident.Pos())
+			}
+		}
+		return
+	}
+
+	// Special handling for asort() and asorti() - source and destination
+	// are arrays, the sort order a scalar
+	if builtin.Func == token.F_ASORT || builtin.Func == token.F_ASORTI {
+		for i, arg := range builtin.Args {
+			if ident, ok := arg.(*ast.Ident); ok && i < 2 {
+				r.resolveVarRef(ident.Name, TypeArray, ident.Pos())
+			} else {
+				r.resolveExpr(arg)
+			}
+		}
+		return
+	}
+
+	// Special handling for length(), typeof() and isarray() - argument
+	// may be array or scalar
+	if (builtin.Func == token.F_LENGTH || builtin.Func == token.F_TYPEOF ||
+		builtin.Func == token.F_ISARRAY) && len(builtin.Args) > 0 {
 		if ident, ok := builtin.Args[0].(*ast.Ident); ok {
 			// Don't force a type - could be either
 			r.resolveVarRef(ident.Name, TypeUnknown, ident.Pos())
@@ -587,6 +641,7 @@ func (r *Resolver) inferTypes(prog *ast.Program) {
 	r.result.Globals.ForEach(func(name string, sym *Symbol) {
 		if sym.Type == TypeUnknown {
 			sym.Type = TypeScalar
+			sym.Untyped = true
 		}
 	})
 
@@ -594,6 +649,7 @@ func (r *Resolver) inferTypes(prog *ast.Program) {
 		funcInfo.Symbols.ForEach(func(name string, sym *Symbol) {
 			if sym.Type == TypeUnknown {
 				sym.Type = TypeScalar
+				sym.Untyped = true
 			}
 		})
 	}
@@ -660,7 +716,7 @@ func (r *Resolver) finalize() {
 	})
 
 	for _, funcInfo := range r.result.Functions {
-		if !funcInfo.Called {
+		if !funcInfo.Called && !r.hasIndirectCalls {
 			r.result.Warnings.Add(funcInfo.Pos, warnUnusedFunc, funcInfo.Name)
 		}
 
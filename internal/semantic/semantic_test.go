@@ -153,6 +153,7 @@ func TestResolveSpecials(t *testing.T) {
 		{"RSTART", `{ if (match($0, /x/)) print RSTART }`, "RSTART"},
 		{"RLENGTH", `{ if (match($0, /x/)) print RLENGTH }`, "RLENGTH"},
 		{"SUBSEP", `BEGIN { print SUBSEP }`, "SUBSEP"},
+		{"RT", `{ print RT }`, "RT"},
 		{"CONVFMT", `BEGIN { print CONVFMT }`, "CONVFMT"},
 		{"OFMT", `BEGIN { print OFMT }`, "OFMT"},
 		{"ARGC", `BEGIN { print ARGC }`, "ARGC"},
@@ -399,6 +400,54 @@ func TestCheckUndefinedFunction(t *testing.T) {
 	}
 }
 
+func TestCheckExtraArgs(t *testing.T) {
+	code := `function f(a) { return a } BEGIN { f(1, 2) }`
+	expectError(t, code, "too many arguments")
+
+	prog, err := parser.Parse(code)
+	if err != nil {
+		t.Fatalf("parse error: %v", err)
+	}
+	result, err := ResolveWithOptions(prog, Options{ExtraArgs: true})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if errs := Check(prog, result); len(errs) > 0 {
+		t.Errorf("unexpected check errors: %v", errs)
+	}
+}
+
+func TestLintExtraArgs(t *testing.T) {
+	tests := []struct {
+		name string
+		code string
+		want int // Expected number of warnings
+	}{
+		{"extra", `function f(a) { } BEGIN { f(1, 2) }`, 1},
+		{"exact", `function f(a) { } BEGIN { f(1) }`, 0},
+		{"fewer", `function f(a, b) { } BEGIN { f(1) }`, 0},
+		{"nested", `function f(a) { return a } BEGIN { print f(f(1, 2)) }`, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			prog, err := parser.Parse(tt.code)
+			if err != nil {
+				t.Fatalf("parse error: %v", err)
+			}
+			warnings := Lint(prog)
+			if len(warnings) != tt.want {
+				t.Fatalf("got %d warnings %v, want %d", len(warnings), warnings, tt.want)
+			}
+			for _, w := range warnings {
+				if !strings.Contains(w.Message, `"f" called with 2 arguments but declares 1`) {
+					t.Errorf("warning = %q, want an extra arguments warning", w.Message)
+				}
+			}
+		})
+	}
+}
+
 func TestCheckDuplicateFunction(t *testing.T) {
 	expectError(t, `function f() { } function f() { }`, "already defined")
 }
@@ -452,6 +501,24 @@ func TestTypeInference(t *testing.T) {
 			varName:  "arr",
 			expected: TypeArray,
 		},
+		{
+			name:     "array from copy",
+			code:     `BEGIN { x[1] = 1; copy(x, arr) }`,
+			varName:  "arr",
+			expected: TypeArray,
+		},
+		{
+			name:     "array from extend",
+			code:     `BEGIN { x[1] = 1; extend(arr, x) }`,
+			varName:  "arr",
+			expected: TypeArray,
+		},
+		{
+			name:     "array from asort",
+			code:     `BEGIN { x[1] = 1; asort(x, arr) }`,
+			varName:  "arr",
+			expected: TypeArray,
+		},
 	}
 
 	for _, tt := range tests {
@@ -591,6 +658,122 @@ func TestNextInBeginEnd(t *testing.T) {
 	}
 }
 
+func TestLintFormat(t *testing.T) {
+	tests := []struct {
+		name string
+		code string
+		want []string // Expected warning substrings, in order
+	}{
+		{"matching", `{ printf "%s=%d\n", $1, $2 }`, nil},
+		{"too few args", `{ printf "%s %s\n", $1 }`, []string{"2 conversions but only 1 arguments"}},
+		{"too many args", `{ printf "%s\n", $1, $2 }`, []string{"1 conversions but 2 arguments"}},
+		{"sprintf too few", `{ x = sprintf("%d-%d", 1) }`, []string{"sprintf format"}},
+		{"string for %d", `{ printf "%d\n", "abc" }`, []string{`%d expects a number, got string "abc"`}},
+		{"numeric string for %d", `{ printf "%d %f\n", "42", " 1.5" }`, nil},
+		{"literal percent", `{ printf "100%% %s\n", $1 }`, nil},
+		{"star width", `{ printf "%*d\n", 5, $1 }`, nil},
+		{"star width missing", `{ printf "%*d\n", $1 }`, []string{"2 conversions but only 1 arguments"}},
+		{"dynamic format", `{ printf fmt, $1, $2, $3 }`, nil},
+		{"parenthesized", `{ printf("%s %s\n", $1) }`, []string{"only 1 arguments"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			prog, err := parser.Parse(tt.code)
+			if err != nil {
+				t.Fatalf("parse error: %v", err)
+			}
+			warnings := Lint(prog)
+			if len(warnings) != len(tt.want) {
+				t.Fatalf("got %d warnings %v, want %d", len(warnings), warnings, len(tt.want))
+			}
+			for i, w := range warnings {
+				if !strings.Contains(w.Message, tt.want[i]) {
+					t.Errorf("warning %d = %q, want it to contain %q", i, w.Message, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestLintPrintfNewline(t *testing.T) {
+	tests := []struct {
+		name string
+		code string
+		want int // Expected number of warnings
+	}{
+		{"no newline", `{ printf "%d", $1 }`, 1},
+		{"no newline parenthesized", `{ printf("%s: %d", $1, $2) }`, 1},
+		{"newline", `{ printf "%d\n", $1 }`, 0},
+		{"newline argument", `{ printf "%s%s", $1, "\n" }`, 0},
+		{"dynamic format", `{ printf fmt, $1 }`, 0},
+		{"print in same rule", `{ printf "%s ", $1; print "" }`, 0},
+		{"newline in END", `{ printf "%s ", $1 } END { print "" }`, 0},
+		{"newline in function", `function nl() { printf "\n" } { printf "%s ", $1; nl() }`, 0},
+		{"BEGIN only", `BEGIN { printf "%d", 1 }`, 0},
+		{"redirected", `{ printf "%s", $1 > "out" }`, 0},
+		{"two printfs", `$1 { printf "%s", $1 } $2 { printf "%s", $2 }`, 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			prog, err := parser.Parse(tt.code)
+			if err != nil {
+				t.Fatalf("parse error: %v", err)
+			}
+			warnings := Lint(prog)
+			if len(warnings) != tt.want {
+				t.Fatalf("got %d warnings %v, want %d", len(warnings), warnings, tt.want)
+			}
+			for _, w := range warnings {
+				if !strings.Contains(w.Message, "has no newline") {
+					t.Errorf("warning = %q, want a missing newline warning", w.Message)
+				}
+			}
+		})
+	}
+}
+
+func TestLintAssignCond(t *testing.T) {
+	tests := []struct {
+		name string
+		code string
+		want int // Expected number of warnings
+	}{
+		{"if assign", `{ if (x = 5) print }`, 1},
+		{"if compare", `{ if (x == 5) print }`, 0},
+		{"if double parens", `{ if ((x = 5)) print }`, 0},
+		{"if compound assign", `{ if (x += 1) print }`, 0},
+		{"while assign", `{ while (x = $1) x-- }`, 1},
+		{"do while assign", `{ do x-- while (x = 0) }`, 1},
+		{"for assign", `{ for (i = 0; i = 3; i++) break }`, 1},
+		{"for init assign", `{ for (i = 0; i < 3; i++) print i }`, 0},
+		{"ternary assign", `{ y = (x = $1) ? 1 : 2 }`, 1},
+		{"ternary compare", `{ y = (x == $1) ? 1 : 2 }`, 0},
+		{"getline compare", `{ while ((getline l) > 0) n++ }`, 0},
+		{"getline assign", `{ while (n = (getline l < "f")) print l }`, 0},
+		{"pattern", `x = 5 { print }`, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			prog, err := parser.Parse(tt.code)
+			if err != nil {
+				t.Fatalf("parse error: %v", err)
+			}
+			warnings := Lint(prog)
+			if len(warnings) != tt.want {
+				t.Fatalf("got %d warnings %v, want %d", len(warnings), warnings, tt.want)
+			}
+			for _, w := range warnings {
+				if !strings.Contains(w.Message, "assignment used as a condition") {
+					t.Errorf("warning = %q, want an assignment condition warning", w.Message)
+				}
+			}
+		})
+	}
+}
+
 func TestIsSpecialVar(t *testing.T) {
 	specials := []string{
 		"NR", "NF", "FS", "RS", "OFS", "ORS", "FILENAME", "FNR",
@@ -630,7 +813,7 @@ func TestIsBuiltinFunc(t *testing.T) {
 	builtins := []string{
 		"length", "substr", "index", "split", "sub", "gsub", "match", "sprintf",
 		"tolower", "toupper", "sin", "cos", "atan2", "exp", "log", "sqrt", "int",
-		"rand", "srand", "close", "fflush", "system",
+		"rand", "srand", "close", "fflush", "system", "copy", "extend", "asort", "asorti", "now",
 	}
 
 	for _, name := range builtins {
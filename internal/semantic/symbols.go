@@ -68,6 +68,10 @@ type Symbol struct {
 	Index int            // Index for VM access (within its category)
 	Pos   token.Position // Declaration position
 	Used  bool           // Whether the symbol is used (for warnings)
+
+	// Untyped is set for a variable nothing uses as a scalar or an
+	// array, made a scalar by default; typeof() reports it as "untyped"
+	Untyped bool
 }
 
 // IsVariable returns true if the symbol represents a variable.
@@ -214,12 +218,17 @@ var specialVars = map[string]int{
 	"RS":       14,
 	"RSTART":   15,
 	"SUBSEP":   16,
+	"ERRNO":    17,
+	"RT":       18,
+	"FPAT":     19,
+	"PROCINFO": 20, // Array
 }
 
 // specialArrays lists special variables that are arrays.
 var specialArrays = map[string]bool{
-	"ARGV":    true,
-	"ENVIRON": true,
+	"ARGV":     true,
+	"ENVIRON":  true,
+	"PROCINFO": true,
 }
 
 // IsSpecialVar returns true if name is a special AWK variable.
@@ -236,6 +245,17 @@ func SpecialVarIndex(name string) int {
 	return -1
 }
 
+// SpecialVarName returns the name of the special variable with index idx,
+// or "" if there is none.
+func SpecialVarName(idx int) string {
+	for name, i := range specialVars {
+		if i == idx {
+			return name
+		}
+	}
+	return ""
+}
+
 // IsSpecialArray returns true if name is a special array variable.
 func IsSpecialArray(name string) bool {
 	return specialArrays[name]
@@ -245,16 +265,28 @@ func IsSpecialArray(name string) bool {
 // MinArgs is the minimum, MaxArgs is the maximum (-1 for variadic).
 var builtinFuncs = map[string]BuiltinInfo{
 	// String functions
-	"length":  {Name: "length", MinArgs: 0, MaxArgs: 1, Token: token.F_LENGTH},
-	"substr":  {Name: "substr", MinArgs: 2, MaxArgs: 3, Token: token.F_SUBSTR},
-	"index":   {Name: "index", MinArgs: 2, MaxArgs: 2, Token: token.F_INDEX},
-	"split":   {Name: "split", MinArgs: 2, MaxArgs: 3, Token: token.F_SPLIT},
-	"sub":     {Name: "sub", MinArgs: 2, MaxArgs: 3, Token: token.F_SUB},
-	"gsub":    {Name: "gsub", MinArgs: 2, MaxArgs: 3, Token: token.F_GSUB},
-	"match":   {Name: "match", MinArgs: 2, MaxArgs: 2, Token: token.F_MATCH},
-	"sprintf": {Name: "sprintf", MinArgs: 1, MaxArgs: -1, Token: token.F_SPRINTF},
-	"tolower": {Name: "tolower", MinArgs: 1, MaxArgs: 1, Token: token.F_TOLOWER},
-	"toupper": {Name: "toupper", MinArgs: 1, MaxArgs: 1, Token: token.F_TOUPPER},
+	"length":   {Name: "length", MinArgs: 0, MaxArgs: 1, Token: token.F_LENGTH},
+	"substr":   {Name: "substr", MinArgs: 2, MaxArgs: 3, Token: token.F_SUBSTR},
+	"index":    {Name: "index", MinArgs: 2, MaxArgs: 2, Token: token.F_INDEX},
+	"split":    {Name: "split", MinArgs: 2, MaxArgs: 3, Token: token.F_SPLIT},
+	"sub":      {Name: "sub", MinArgs: 2, MaxArgs: 3, Token: token.F_SUB},
+	"gsub":     {Name: "gsub", MinArgs: 2, MaxArgs: 3, Token: token.F_GSUB},
+	"gensub":   {Name: "gensub", MinArgs: 3, MaxArgs: 4, Token: token.F_GENSUB},
+	"match":    {Name: "match", MinArgs: 2, MaxArgs: 2, Token: token.F_MATCH},
+	"sprintf":  {Name: "sprintf", MinArgs: 1, MaxArgs: -1, Token: token.F_SPRINTF},
+	"tolower":  {Name: "tolower", MinArgs: 1, MaxArgs: 1, Token: token.F_TOLOWER},
+	"toupper":  {Name: "toupper", MinArgs: 1, MaxArgs: 1, Token: token.F_TOUPPER},
+	"strtonum": {Name: "strtonum", MinArgs: 1, MaxArgs: 1, Token: token.F_STRTONUM},
+
+	// Array functions
+	"copy":   {Name: "copy", MinArgs: 2, MaxArgs: 2, Token: token.F_COPY},
+	"extend": {Name: "extend", MinArgs: 2, MaxArgs: 2, Token: token.F_EXTEND},
+	"asort":  {Name: "asort", MinArgs: 1, MaxArgs: 3, Token: token.F_ASORT},
+	"asorti": {Name: "asorti", MinArgs: 1, MaxArgs: 3, Token: token.F_ASORTI},
+
+	// Type functions
+	"typeof":  {Name: "typeof", MinArgs: 1, MaxArgs: 1, Token: token.F_TYPEOF},
+	"isarray": {Name: "isarray", MinArgs: 1, MaxArgs: 1, Token: token.F_ISARRAY},
 
 	// Math functions
 	"sin":   {Name: "sin", MinArgs: 1, MaxArgs: 1, Token: token.F_SIN},
@@ -267,10 +299,35 @@ var builtinFuncs = map[string]BuiltinInfo{
 	"rand":  {Name: "rand", MinArgs: 0, MaxArgs: 0, Token: token.F_RAND},
 	"srand": {Name: "srand", MinArgs: 0, MaxArgs: 1, Token: token.F_SRAND},
 
+	// Bitwise functions
+	"and":    {Name: "and", MinArgs: 2, MaxArgs: -1, Token: token.F_AND},
+	"or":     {Name: "or", MinArgs: 2, MaxArgs: -1, Token: token.F_OR},
+	"xor":    {Name: "xor", MinArgs: 2, MaxArgs: -1, Token: token.F_XOR},
+	"compl":  {Name: "compl", MinArgs: 1, MaxArgs: 1, Token: token.F_COMPL},
+	"lshift": {Name: "lshift", MinArgs: 2, MaxArgs: 2, Token: token.F_LSHIFT},
+	"rshift": {Name: "rshift", MinArgs: 2, MaxArgs: 2, Token: token.F_RSHIFT},
+
+	// Time functions
+	"now":      {Name: "now", MinArgs: 0, MaxArgs: 1, Token: token.F_NOW},
+	"timefmt":  {Name: "timefmt", MinArgs: 2, MaxArgs: 3, Token: token.F_TIMEFMT},
+	"systime":  {Name: "systime", MinArgs: 0, MaxArgs: 0, Token: token.F_SYSTIME},
+	"mktime":   {Name: "mktime", MinArgs: 1, MaxArgs: 2, Token: token.F_MKTIME},
+	"strftime": {Name: "strftime", MinArgs: 0, MaxArgs: 3, Token: token.F_STRFTIME},
+
 	// I/O functions
-	"close":  {Name: "close", MinArgs: 1, MaxArgs: 1, Token: token.F_CLOSE},
-	"fflush": {Name: "fflush", MinArgs: 0, MaxArgs: 1, Token: token.F_FFLUSH},
-	"system": {Name: "system", MinArgs: 1, MaxArgs: 1, Token: token.F_SYSTEM},
+	"close":    {Name: "close", MinArgs: 1, MaxArgs: 2, Token: token.F_CLOSE},
+	"fflush":   {Name: "fflush", MinArgs: 0, MaxArgs: 1, Token: token.F_FFLUSH},
+	"system":   {Name: "system", MinArgs: 1, MaxArgs: 1, Token: token.F_SYSTEM},
+	"slurp":    {Name: "slurp", MinArgs: 1, MaxArgs: 1, Token: token.F_SLURP},
+	"spit":     {Name: "spit", MinArgs: 2, MaxArgs: 3, Token: token.F_SPIT},
+	"streamnr": {Name: "streamnr", MinArgs: 1, MaxArgs: 1, Token: token.F_STREAMNR},
+
+	// Encoding functions
+	"hash":   {Name: "hash", MinArgs: 2, MaxArgs: 2, Token: token.F_HASH},
+	"b64enc": {Name: "b64enc", MinArgs: 1, MaxArgs: 1, Token: token.F_B64ENC},
+	"b64dec": {Name: "b64dec", MinArgs: 1, MaxArgs: 1, Token: token.F_B64DEC},
+	"urlenc": {Name: "urlenc", MinArgs: 1, MaxArgs: 1, Token: token.F_URLENC},
+	"urldec": {Name: "urldec", MinArgs: 1, MaxArgs: 1, Token: token.F_URLDEC},
 }
 
 // IsBuiltinFunc returns true if name is a built-in function.
@@ -42,10 +42,11 @@ const (
 	MATCH     // ~
 	NOT_MATCH // !~
 
-	INCR   // ++
-	DECR   // --
-	APPEND // >>
-	PIPE   // |
+	INCR      // ++
+	DECR      // --
+	APPEND    // >>
+	PIPE      // |
+	PIPE_BOTH // |& (coprocess)
 
 	LPAREN    // (
 	RPAREN    // )
@@ -86,28 +87,55 @@ const (
 
 	// Built-in functions
 	builtinStart
-	F_ATAN2   // atan2
-	F_CLOSE   // close
-	F_COS     // cos
-	F_EXP     // exp
-	F_FFLUSH  // fflush
-	F_GSUB    // gsub
-	F_INDEX   // index
-	F_INT     // int
-	F_LENGTH  // length
-	F_LOG     // log
-	F_MATCH   // match
-	F_RAND    // rand
-	F_SIN     // sin
-	F_SPLIT   // split
-	F_SPRINTF // sprintf
-	F_SQRT    // sqrt
-	F_SRAND   // srand
-	F_SUB     // sub
-	F_SUBSTR  // substr
-	F_SYSTEM  // system
-	F_TOLOWER // tolower
-	F_TOUPPER // toupper
+	F_AND      // and
+	F_ASORT    // asort
+	F_ASORTI   // asorti
+	F_ATAN2    // atan2
+	F_B64DEC   // b64dec
+	F_B64ENC   // b64enc
+	F_CLOSE    // close
+	F_COMPL    // compl
+	F_COPY     // copy
+	F_COS      // cos
+	F_EXP      // exp
+	F_EXTEND   // extend
+	F_FFLUSH   // fflush
+	F_GENSUB   // gensub
+	F_GSUB     // gsub
+	F_HASH     // hash
+	F_INDEX    // index
+	F_INT      // int
+	F_ISARRAY  // isarray
+	F_LENGTH   // length
+	F_LOG      // log
+	F_LSHIFT   // lshift
+	F_MATCH    // match
+	F_MKTIME   // mktime
+	F_NOW      // now
+	F_OR       // or
+	F_RAND     // rand
+	F_RSHIFT   // rshift
+	F_SIN      // sin
+	F_SLURP    // slurp
+	F_SPIT     // spit
+	F_SPLIT    // split
+	F_SPRINTF  // sprintf
+	F_SQRT     // sqrt
+	F_SRAND    // srand
+	F_STRFTIME // strftime
+	F_STREAMNR // streamnr
+	F_STRTONUM // strtonum
+	F_SUB      // sub
+	F_SUBSTR   // substr
+	F_SYSTEM   // system
+	F_SYSTIME  // systime
+	F_TIMEFMT  // timefmt
+	F_TOLOWER  // tolower
+	F_TOUPPER  // toupper
+	F_TYPEOF   // typeof
+	F_URLDEC   // urldec
+	F_URLENC   // urlenc
+	F_XOR      // xor
 	builtinEnd
 
 	// Literals
@@ -162,37 +190,105 @@ var keywords = map[string]Token{
 
 // builtins maps built-in function names to their token types.
 var builtins = map[string]Token{
-	"atan2":   F_ATAN2,
-	"close":   F_CLOSE,
-	"cos":     F_COS,
-	"exp":     F_EXP,
-	"fflush":  F_FFLUSH,
-	"gsub":    F_GSUB,
-	"index":   F_INDEX,
-	"int":     F_INT,
-	"length":  F_LENGTH,
-	"log":     F_LOG,
-	"match":   F_MATCH,
-	"rand":    F_RAND,
-	"sin":     F_SIN,
-	"split":   F_SPLIT,
-	"sprintf": F_SPRINTF,
-	"sqrt":    F_SQRT,
-	"srand":   F_SRAND,
-	"sub":     F_SUB,
-	"substr":  F_SUBSTR,
-	"system":  F_SYSTEM,
-	"tolower": F_TOLOWER,
-	"toupper": F_TOUPPER,
+	"and":      F_AND,
+	"asort":    F_ASORT,
+	"asorti":   F_ASORTI,
+	"atan2":    F_ATAN2,
+	"b64dec":   F_B64DEC,
+	"b64enc":   F_B64ENC,
+	"close":    F_CLOSE,
+	"compl":    F_COMPL,
+	"copy":     F_COPY,
+	"cos":      F_COS,
+	"exp":      F_EXP,
+	"extend":   F_EXTEND,
+	"fflush":   F_FFLUSH,
+	"gensub":   F_GENSUB,
+	"gsub":     F_GSUB,
+	"hash":     F_HASH,
+	"index":    F_INDEX,
+	"int":      F_INT,
+	"isarray":  F_ISARRAY,
+	"length":   F_LENGTH,
+	"log":      F_LOG,
+	"lshift":   F_LSHIFT,
+	"match":    F_MATCH,
+	"mktime":   F_MKTIME,
+	"now":      F_NOW,
+	"or":       F_OR,
+	"rand":     F_RAND,
+	"rshift":   F_RSHIFT,
+	"sin":      F_SIN,
+	"slurp":    F_SLURP,
+	"spit":     F_SPIT,
+	"split":    F_SPLIT,
+	"sprintf":  F_SPRINTF,
+	"sqrt":     F_SQRT,
+	"srand":    F_SRAND,
+	"strftime": F_STRFTIME,
+	"streamnr": F_STREAMNR,
+	"strtonum": F_STRTONUM,
+	"sub":      F_SUB,
+	"substr":   F_SUBSTR,
+	"system":   F_SYSTEM,
+	"systime":  F_SYSTIME,
+	"timefmt":  F_TIMEFMT,
+	"tolower":  F_TOLOWER,
+	"toupper":  F_TOUPPER,
+	"typeof":   F_TYPEOF,
+	"urldec":   F_URLDEC,
+	"urlenc":   F_URLENC,
+	"xor":      F_XOR,
+}
+
+// extensions are the built-in functions POSIX AWK lacks. Their names are
+// not keywords: the parser takes a call to one, directly followed by "(",
+// as the builtin unless the program defines a function of that name, so
+// POSIX programs can still use them as function, variable, array and
+// parameter names.
+var extensions = map[Token]bool{
+	F_AND:      true,
+	F_ASORT:    true,
+	F_ASORTI:   true,
+	F_B64DEC:   true,
+	F_B64ENC:   true,
+	F_COMPL:    true,
+	F_COPY:     true,
+	F_EXTEND:   true,
+	F_GENSUB:   true,
+	F_HASH:     true,
+	F_ISARRAY:  true,
+	F_LSHIFT:   true,
+	F_MKTIME:   true,
+	F_NOW:      true,
+	F_OR:       true,
+	F_RSHIFT:   true,
+	F_SLURP:    true,
+	F_SPIT:     true,
+	F_STREAMNR: true,
+	F_STRFTIME: true,
+	F_STRTONUM: true,
+	F_SYSTIME:  true,
+	F_TIMEFMT:  true,
+	F_TYPEOF:   true,
+	F_URLDEC:   true,
+	F_URLENC:   true,
+	F_XOR:      true,
+}
+
+// IsExtension returns true if the token is a built-in function that POSIX
+// AWK lacks, whose name is not a keyword.
+func (t Token) IsExtension() bool {
+	return extensions[t]
 }
 
 // LookupIdent returns the token type for a given identifier.
-// Returns a keyword or builtin token if found, otherwise NAME.
+// Returns a keyword or POSIX builtin token if found, otherwise NAME.
 func LookupIdent(ident string) Token {
 	if tok, ok := keywords[ident]; ok {
 		return tok
 	}
-	if tok, ok := builtins[ident]; ok {
+	if tok, ok := builtins[ident]; ok && !tok.IsExtension() {
 		return tok
 	}
 	return NAME
@@ -235,8 +235,12 @@ func ParseNum(s string) (float64, error) {
 	}
 
 	// Handle hex without exponent (AWK allows "0x1a", Go requires "0x1ap0")
-	if len(s) > 2 && (s[0] == '0' && (s[1] == 'x' || s[1] == 'X')) {
-		if !strings.ContainsAny(s, "pP") {
+	digits := s
+	if digits[0] == '+' || digits[0] == '-' {
+		digits = digits[1:]
+	}
+	if len(digits) > 2 && (digits[0] == '0' && (digits[1] == 'x' || digits[1] == 'X')) {
+		if !strings.ContainsAny(digits, "pP") {
 			s += "p0"
 		}
 	}
@@ -369,7 +373,57 @@ func parseHexPrefix(s string, start, i int) float64 {
 	return n
 }
 
+// ParseNonDecimal parses a number from the beginning of s as strtonum
+// does: a leading "0x" or "0X" gives a hexadecimal integer and a leading
+// "0" an octal one, falling back to decimal if a digit 8 or 9 follows.
+// Anything else is parsed like ParseNumPrefix.
+func ParseNonDecimal(s string) float64 {
+	i := 0
+	for i < len(s) && isSpace(s[i]) {
+		i++
+	}
+	neg := false
+	if i < len(s) && (s[i] == '+' || s[i] == '-') {
+		neg = s[i] == '-'
+		i++
+	}
+	if i+1 >= len(s) || s[i] != '0' {
+		return ParseNumPrefix(s)
+	}
+
+	var n float64
+	if s[i+1] == 'x' || s[i+1] == 'X' {
+		for i += 2; i < len(s) && isHexDigit(s[i]); i++ {
+			n = n*16 + float64(hexValue(s[i]))
+		}
+	} else {
+		for i++; i < len(s) && isDigit(s[i]); i++ {
+			if s[i] > '7' {
+				return ParseNumPrefix(s)
+			}
+			n = n*8 + float64(s[i]-'0')
+		}
+		if i < len(s) && (s[i] == '.' || s[i] == 'e' || s[i] == 'E') {
+			// "0.5" and "01e3" are decimal
+			return ParseNumPrefix(s)
+		}
+	}
+	if neg {
+		return -n
+	}
+	return n
+}
+
+// IsInt reports whether n is a whole number in the range of int64, so
+// int64(n) is exact. Values outside that range convert differently on
+// different platforms and must not be treated as integers.
+func IsInt(n float64) bool {
+	return n == math.Trunc(n) && n >= -(1<<63) && n < 1<<63
+}
+
 // FormatNum formats a number as a string using the given format.
+// Whole numbers in the range of int64 are printed as integers, however
+// large; others use format.
 func FormatNum(n float64, format string) string {
 	switch {
 	case math.IsNaN(n):
@@ -378,7 +432,7 @@ func FormatNum(n float64, format string) string {
 		return "inf"
 	case math.IsInf(n, -1):
 		return "-inf"
-	case n == float64(int64(n)):
+	case IsInt(n):
 		// Integer - format without decimal
 		return strconv.FormatInt(int64(n), 10)
 	case format == "%.6g":
@@ -402,3 +456,14 @@ func isDigit(c byte) bool {
 func isHexDigit(c byte) bool {
 	return isDigit(c) || (c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F')
 }
+
+func hexValue(c byte) byte {
+	switch {
+	case c >= 'a':
+		return c - 'a' + 10
+	case c >= 'A':
+		return c - 'A' + 10
+	default:
+		return c - '0'
+	}
+}
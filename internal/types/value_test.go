@@ -265,6 +265,8 @@ func TestParseNum(t *testing.T) {
 		{"1.5e-3", 1.5e-3, false},
 		{"0x1a", 26, false},
 		{"0X1A", 26, false},
+		{"-0x10", -16, false},
+		{" +0x10 ", 16, false},
 		{"  42  ", 42, false},
 		{"", 0, false},
 		{"abc", 0, true},
@@ -332,6 +334,13 @@ func TestFormatNum(t *testing.T) {
 		{1e10, "%.6g", "10000000000"},      // Integer representation
 		{1e15, "%.6g", "1000000000000000"}, // Still integer representation
 		{1e20, "%.6g", "1e+20"},            // Scientific for very large
+		{123456789012345, "%.6g", "123456789012345"},
+		{1 << 53, "%.6g", "9007199254740992"},
+		{-1e15, "%.6g", "-1000000000000000"},
+		{1 << 62, "%.6g", "4611686018427387904"},
+		{-(1 << 63), "%.6g", "-9223372036854775808"},
+		{1 << 63, "%.6g", "9.22337e+18"}, // Just out of int64 range
+		{1e15 + 0.5, "%.6g", "1e+15"},
 		{math.NaN(), "%.6g", "nan"},
 		{math.Inf(1), "%.6g", "inf"},
 		{math.Inf(-1), "%.6g", "-inf"},
@@ -348,6 +357,55 @@ func TestFormatNum(t *testing.T) {
 	}
 }
 
+func TestParseNonDecimal(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected float64
+	}{
+		{"0x1F", 31},
+		{"0XfFz", 255},
+		{" -0x10", -16},
+		{"0x", 0},
+		{"017", 15},
+		{"+017", 15},
+		{"018", 18},
+		{"0.5", 0.5},
+		{"01e2", 100},
+		{"0", 0},
+		{"42abc", 42},
+		{"abc", 0},
+	}
+
+	for _, tt := range tests {
+		if got := ParseNonDecimal(tt.input); got != tt.expected {
+			t.Errorf("ParseNonDecimal(%q) = %v, want %v", tt.input, got, tt.expected)
+		}
+	}
+}
+
+func TestIsInt(t *testing.T) {
+	tests := []struct {
+		n    float64
+		want bool
+	}{
+		{0, true},
+		{-3, true},
+		{1e15, true},
+		{-(1 << 63), true},
+		{1 << 63, false},
+		{1e19, false},
+		{-1e19, false},
+		{0.5, false},
+		{math.NaN(), false},
+		{math.Inf(1), false},
+	}
+	for _, tt := range tests {
+		if got := IsInt(tt.n); got != tt.want {
+			t.Errorf("IsInt(%v) = %v, want %v", tt.n, got, tt.want)
+		}
+	}
+}
+
 func TestKindString(t *testing.T) {
 	tests := []struct {
 		k        Kind
@@ -3,6 +3,8 @@
 package vm
 
 import (
+	"slices"
+
 	"github.com/kolkov/uawk/internal/compiler"
 )
 
@@ -53,6 +55,10 @@ const (
 	ReasonRangePattern
 	ReasonComplexRS
 	ReasonUserFunction
+	ReasonExit
+	ReasonFileVars
+	ReasonArgs
+	ReasonInputGetline
 )
 
 // String returns a human-readable explanation.
@@ -78,6 +84,14 @@ func (r UnsafeReason) String() string {
 		return "uses complex RS (multi-char record separator)"
 	case ReasonUserFunction:
 		return "uses user-defined functions (may have side effects)"
+	case ReasonExit:
+		return "uses exit (stops input at a specific record)"
+	case ReasonFileVars:
+		return "uses FILENAME or FNR (per-file state)"
+	case ReasonArgs:
+		return "uses ARGV or ARGC (may change the input files)"
+	case ReasonInputGetline:
+		return "uses getline on the main input"
 	default:
 		return "unknown reason"
 	}
@@ -126,6 +140,27 @@ func AnalyzeParallelSafety(prog *compiler.Program, rs string) *ParallelAnalysis
 		}
 	}
 
+	if prog.UsesArgs {
+		analysis.Safety = ParallelUnsafe
+		analysis.UnsafeReasons = append(analysis.UnsafeReasons, ReasonArgs)
+		return analysis
+	}
+
+	// A plain getline in BEGIN takes records before the workers see them
+	beginCode := [][]compiler.Opcode{prog.Begin}
+	if hasUserFunctionCall(prog.Begin) {
+		for _, fn := range prog.Functions {
+			beginCode = append(beginCode, fn.Body)
+		}
+	}
+	for _, code := range beginCode {
+		if slices.Contains(checkUnsafeOps(code), ReasonInputGetline) {
+			analysis.Safety = ParallelUnsafe
+			analysis.UnsafeReasons = append(analysis.UnsafeReasons, ReasonInputGetline)
+			return analysis
+		}
+	}
+
 	// Analyze BEGIN block
 	beginVars := analyzeCodeVars(prog.Begin)
 
@@ -159,6 +194,12 @@ func AnalyzeParallelSafety(prog *compiler.Program, rs string) *ParallelAnalysis
 		}
 	}
 
+	// END sees FILENAME and FNR of the last input, which workers don't track
+	if slices.Contains(checkUnsafeOps(prog.End), ReasonFileVars) {
+		analysis.Safety = ParallelUnsafe
+		analysis.UnsafeReasons = append(analysis.UnsafeReasons, ReasonFileVars)
+	}
+
 	if analysis.Safety == ParallelUnsafe {
 		return analysis
 	}
@@ -320,11 +361,31 @@ func analyzeCodeVars(code []compiler.Opcode) *varSet {
 				vs.writtenArrays[idx] = true
 				i += 2
 			}
+		case compiler.CallCopy, compiler.CallAsort, compiler.CallAsorti:
+			if i+4 < len(code) {
+				if compiler.Scope(code[i+1]) == compiler.ScopeGlobal {
+					vs.readArrays[int(code[i+2])] = true
+				}
+				if compiler.Scope(code[i+3]) == compiler.ScopeGlobal {
+					vs.writtenArrays[int(code[i+4])] = true
+				}
+				i += 4
+			}
+		case compiler.CallExtend:
+			if i+4 < len(code) {
+				if compiler.Scope(code[i+1]) == compiler.ScopeGlobal {
+					vs.writtenArrays[int(code[i+2])] = true
+				}
+				if compiler.Scope(code[i+3]) == compiler.ScopeGlobal {
+					vs.readArrays[int(code[i+4])] = true
+				}
+				i += 4
+			}
 		// Skip operands for other opcodes
 		case compiler.Num, compiler.Str, compiler.Regex,
 			compiler.LoadLocal, compiler.StoreLocal,
 			compiler.LoadSpecial, compiler.StoreSpecial,
-			compiler.FieldInt:
+			compiler.FieldInt, compiler.Line:
 			i++
 		case compiler.Jump, compiler.JumpTrue, compiler.JumpFalse,
 			compiler.JumpEqual, compiler.JumpNotEq,
@@ -341,7 +402,7 @@ func analyzeCodeVars(code []compiler.Opcode) *varSet {
 			i++
 		case compiler.ForIn:
 			i += 5
-		case compiler.CallBuiltin:
+		case compiler.CallBuiltin, compiler.CallIndirect:
 			i++
 		case compiler.CallUser:
 			if i+2 < len(code) {
@@ -350,8 +411,10 @@ func analyzeCodeVars(code []compiler.Opcode) *varSet {
 			}
 		case compiler.CallNative, compiler.CallSplit, compiler.CallSplitSep, compiler.CallLength:
 			i += 2
-		case compiler.CallSprintf, compiler.Print, compiler.Printf:
+		case compiler.CallSprintf, compiler.Printf:
 			i += 2
+		case compiler.Print:
+			i += 3
 		case compiler.Getline, compiler.GetlineField:
 			i++
 		case compiler.GetlineVar, compiler.GetlineArray:
@@ -387,7 +450,11 @@ func checkUnsafeOps(code []compiler.Opcode) []UnsafeReason {
 		op := code[i]
 		switch op {
 		case compiler.Getline, compiler.GetlineVar, compiler.GetlineField, compiler.GetlineArray:
-			reasons = append(reasons, ReasonGetline)
+			if i+1 < len(code) && compiler.Redirect(code[i+1]) == compiler.RedirectNone {
+				reasons = append(reasons, ReasonInputGetline)
+			} else {
+				reasons = append(reasons, ReasonGetline)
+			}
 			// Skip operands
 			if op == compiler.GetlineVar || op == compiler.GetlineArray {
 				i += 3
@@ -396,6 +463,8 @@ func checkUnsafeOps(code []compiler.Opcode) []UnsafeReason {
 			}
 		case compiler.Next:
 			reasons = append(reasons, ReasonNext)
+		case compiler.Exit, compiler.ExitCode:
+			reasons = append(reasons, ReasonExit)
 		case compiler.Nextfile:
 			reasons = append(reasons, ReasonNextFile)
 		case compiler.Print, compiler.Printf:
@@ -404,34 +473,53 @@ func checkUnsafeOps(code []compiler.Opcode) []UnsafeReason {
 				switch redirect {
 				case compiler.RedirectWrite, compiler.RedirectAppend:
 					reasons = append(reasons, ReasonFileOutput)
-				case compiler.RedirectPipe:
+				case compiler.RedirectPipe, compiler.RedirectCoprocess:
 					reasons = append(reasons, ReasonPipeOutput)
 				}
 				i += 2
+				if op == compiler.Print {
+					i++
+				}
 			}
 		case compiler.CallBuiltin:
 			if i+1 < len(code) {
 				builtin := compiler.BuiltinOp(code[i+1])
-				if builtin == compiler.BuiltinSystem {
+				switch builtin {
+				case compiler.BuiltinSystem:
 					reasons = append(reasons, ReasonSystemCall)
+				case compiler.BuiltinSpit, compiler.BuiltinSpitAppend:
+					reasons = append(reasons, ReasonFileOutput)
+				case compiler.BuiltinStreamNR:
+					reasons = append(reasons, ReasonGetline)
 				}
 				i++
 			}
+		case compiler.CallIndirect:
+			i++
+		case compiler.LoadSpecial, compiler.StoreSpecial:
+			if i+1 < len(code) && isFileSpecial(code[i+1]) {
+				reasons = append(reasons, ReasonFileVars)
+			}
+			i++
+		case compiler.IncrSpecial, compiler.AugSpecial:
+			if i+2 < len(code) && isFileSpecial(code[i+2]) {
+				reasons = append(reasons, ReasonFileVars)
+			}
+			i += 2
 		// Skip operands for other opcodes (same as analyzeCodeVars)
 		case compiler.Num, compiler.Str, compiler.Regex,
 			compiler.LoadGlobal, compiler.StoreGlobal,
 			compiler.LoadLocal, compiler.StoreLocal,
-			compiler.LoadSpecial, compiler.StoreSpecial,
-			compiler.FieldInt:
+			compiler.FieldInt, compiler.Line:
 			i++
 		case compiler.Jump, compiler.JumpTrue, compiler.JumpFalse,
 			compiler.JumpEqual, compiler.JumpNotEq,
 			compiler.JumpLess, compiler.JumpLessEq,
 			compiler.JumpGreater, compiler.JumpGrEq:
 			i++
-		case compiler.IncrGlobal, compiler.IncrLocal, compiler.IncrSpecial, compiler.IncrField:
+		case compiler.IncrGlobal, compiler.IncrLocal, compiler.IncrField:
 			i += 2
-		case compiler.AugGlobal, compiler.AugLocal, compiler.AugSpecial, compiler.AugField:
+		case compiler.AugGlobal, compiler.AugLocal, compiler.AugField:
 			i += 2
 		case compiler.ArrayGet, compiler.ArraySet, compiler.ArrayIn, compiler.ArrayDelete, compiler.ArrayClear:
 			i += 2
@@ -450,6 +538,8 @@ func checkUnsafeOps(code []compiler.Opcode) []UnsafeReason {
 			}
 		case compiler.CallNative, compiler.CallSplit, compiler.CallSplitSep, compiler.CallLength:
 			i += 2
+		case compiler.CallCopy, compiler.CallExtend, compiler.CallAsort, compiler.CallAsorti:
+			i += 4
 		case compiler.CallSprintf:
 			i += 2
 		case compiler.IndexMulti, compiler.ConcatMulti, compiler.Nulls:
@@ -472,6 +562,12 @@ func checkUnsafeOps(code []compiler.Opcode) []UnsafeReason {
 	return reasons
 }
 
+// isFileSpecial reports whether a special variable index is FILENAME or
+// FNR, which change per input file.
+func isFileSpecial(idx compiler.Opcode) bool {
+	return idx == 5 || idx == 6
+}
+
 // hasUserFunctionCall checks if code contains user function calls.
 func hasUserFunctionCall(code []compiler.Opcode) bool {
 	if len(code) == 0 {
@@ -480,7 +576,7 @@ func hasUserFunctionCall(code []compiler.Opcode) bool {
 
 	for i := 0; i < len(code); i++ {
 		op := code[i]
-		if op == compiler.CallUser {
+		if op == compiler.CallUser || op == compiler.CallIndirect {
 			return true
 		}
 		// Skip operands (same logic as above)
@@ -489,7 +585,7 @@ func hasUserFunctionCall(code []compiler.Opcode) bool {
 			compiler.LoadGlobal, compiler.StoreGlobal,
 			compiler.LoadLocal, compiler.StoreLocal,
 			compiler.LoadSpecial, compiler.StoreSpecial,
-			compiler.FieldInt:
+			compiler.FieldInt, compiler.Line:
 			i++
 		case compiler.Jump, compiler.JumpTrue, compiler.JumpFalse,
 			compiler.JumpEqual, compiler.JumpNotEq,
@@ -514,8 +610,12 @@ func hasUserFunctionCall(code []compiler.Opcode) bool {
 			i++
 		case compiler.CallNative, compiler.CallSplit, compiler.CallSplitSep, compiler.CallLength:
 			i += 2
-		case compiler.CallSprintf, compiler.Print, compiler.Printf:
+		case compiler.CallCopy, compiler.CallExtend, compiler.CallAsort, compiler.CallAsorti:
+			i += 4
+		case compiler.CallSprintf, compiler.Printf:
 			i += 2
+		case compiler.Print:
+			i += 3
 		case compiler.Getline, compiler.GetlineField:
 			i++
 		case compiler.GetlineVar, compiler.GetlineArray:
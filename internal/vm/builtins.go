@@ -1,13 +1,21 @@
 package vm
 
 import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
 	"fmt"
+	"hash"
 	"math"
 	"math/rand"
-	"os/exec"
+	"net/url"
 	"strconv"
 	"strings"
 	"time"
+	"unicode"
+	"unicode/utf8"
 
 	"github.com/kolkov/uawk/internal/compiler"
 	"github.com/kolkov/uawk/internal/types"
@@ -16,17 +24,49 @@ import (
 // callBuiltin executes a built-in function.
 func (vm *VM) callBuiltin(op compiler.BuiltinOp) error {
 	switch op {
+	case compiler.BuiltinAnd, compiler.BuiltinOr, compiler.BuiltinXor,
+		compiler.BuiltinLshift, compiler.BuiltinRshift:
+		// Two operands, pushed in order - pop in reverse
+		y := toBits(vm.pop().AsNum())
+		x := toBits(vm.pop().AsNum())
+		vm.push(types.Num(float64(bitwise(op, x, y))))
+
+	case compiler.BuiltinCompl:
+		// Only the low 53 bits, as in gawk, so that the result is exact:
+		// and(x, compl(mask)) then clears the bits of mask
+		x := toBits(vm.pop().AsNum())
+		vm.push(types.Num(float64(^x & (1<<53 - 1))))
+
 	case compiler.BuiltinAtan2:
 		// atan2(y, x) - args pushed in order, so pop in reverse
 		x := vm.pop().AsNum()
 		y := vm.pop().AsNum()
 		vm.push(types.Num(math.Atan2(y, x)))
 
+	case compiler.BuiltinB64Dec:
+		str := vm.pop().AsStr(vm.convfmt)
+		decoded, err := base64.StdEncoding.DecodeString(str)
+		if err != nil {
+			decoded = nil
+			vm.specials.ERRNO = "b64dec: " + err.Error()
+		}
+		vm.push(types.Str(string(decoded)))
+
+	case compiler.BuiltinB64Enc:
+		str := vm.pop().AsStr(vm.convfmt)
+		vm.push(types.Str(base64.StdEncoding.EncodeToString([]byte(str))))
+
 	case compiler.BuiltinClose:
 		name := vm.pop().AsStr(vm.convfmt)
 		result := vm.closeFile(name)
 		vm.push(types.Num(float64(result)))
 
+	case compiler.BuiltinCloseHow:
+		how := vm.pop().AsStr(vm.convfmt)
+		name := vm.pop().AsStr(vm.convfmt)
+		result := vm.ioManager.CloseHalf(name, strings.ToLower(how))
+		vm.push(types.Num(float64(result)))
+
 	case compiler.BuiltinCos:
 		x := vm.pop().AsNum()
 		vm.push(types.Num(math.Cos(x)))
@@ -44,6 +84,13 @@ func (vm *VM) callBuiltin(op compiler.BuiltinOp) error {
 		result := vm.flushAll()
 		vm.push(types.Num(float64(result)))
 
+	case compiler.BuiltinGensub:
+		target := vm.pop().AsStr(vm.convfmt)
+		how := vm.pop()
+		replacement := vm.pop().AsStr(vm.convfmt)
+		pattern := vm.pop().AsStr(vm.convfmt)
+		vm.push(types.Str(vm.builtinGensub(pattern, replacement, how, target)))
+
 	case compiler.BuiltinGsub:
 		target := vm.pop().AsStr(vm.convfmt)
 		replacement := vm.pop().AsStr(vm.convfmt)
@@ -53,6 +100,15 @@ func (vm *VM) callBuiltin(op compiler.BuiltinOp) error {
 		vm.push(types.Num(float64(count)))
 		vm.push(types.Str(result))
 
+	case compiler.BuiltinHash:
+		str := vm.pop().AsStr(vm.convfmt)
+		algo := vm.pop().AsStr(vm.convfmt)
+		digest, err := hashString(algo, str)
+		if err != nil {
+			vm.specials.ERRNO = err.Error()
+		}
+		vm.push(types.Str(digest))
+
 	case compiler.BuiltinIndex:
 		substr := vm.pop().AsStr(vm.convfmt)
 		str := vm.pop().AsStr(vm.convfmt)
@@ -61,20 +117,26 @@ func (vm *VM) callBuiltin(op compiler.BuiltinOp) error {
 			vm.push(types.Num(0))
 		} else {
 			// AWK uses 1-based indexing
-			vm.push(types.Num(float64(idx + 1)))
+			vm.push(types.Num(float64(vm.strLen(str[:idx]) + 1)))
 		}
 
 	case compiler.BuiltinInt:
 		x := vm.pop().AsNum()
 		vm.push(types.Num(math.Trunc(x)))
 
+	case compiler.BuiltinIsarray:
+		// Arrays are recognised at compile time
+		vm.pop()
+		vm.push(types.Num(0))
+
 	case compiler.BuiltinLength:
 		// length() with no args - length of $0
-		vm.push(types.Num(float64(len(vm.line))))
+		vm.push(types.Num(float64(vm.strLen(vm.line))))
 
 	case compiler.BuiltinLengthArg:
+		// Numbers are measured by their CONVFMT string: length(12345) is 5
 		s := vm.pop().AsStr(vm.convfmt)
-		vm.push(types.Num(float64(len(s))))
+		vm.push(types.Num(float64(vm.strLen(s))))
 
 	case compiler.BuiltinLog:
 		x := vm.pop().AsNum()
@@ -89,20 +151,61 @@ func (vm *VM) callBuiltin(op compiler.BuiltinOp) error {
 		vm.specials.RLENGTH = rlength
 		vm.push(types.Num(float64(rstart)))
 
+	case compiler.BuiltinMktime, compiler.BuiltinMktimeUTC:
+		utc := false
+		if op == compiler.BuiltinMktimeUTC {
+			utc = vm.pop().AsBool()
+		}
+		spec := vm.pop().AsStr(vm.convfmt)
+		vm.push(types.Num(mktime(spec, utc)))
+
+	case compiler.BuiltinNow:
+		vm.push(types.Str(vm.now().Format(time.RFC3339)))
+
+	case compiler.BuiltinNowFormat:
+		format := vm.pop().AsStr(vm.convfmt)
+		vm.push(types.Str(formatNow(vm.now(), format)))
+
 	case compiler.BuiltinRand:
-		vm.push(types.Num(vm.randSource.Float64()))
+		vm.push(types.Num(vm.rng().Float64()))
 
 	case compiler.BuiltinSin:
 		x := vm.pop().AsNum()
 		vm.push(types.Num(math.Sin(x)))
 
+	case compiler.BuiltinSlurp:
+		name := vm.pop().AsStr(vm.convfmt)
+		content, err := vm.ioManager.Slurp(name)
+		if err != nil {
+			vm.specials.ERRNO = err.Error()
+		}
+		vm.push(types.Str(content))
+
+	case compiler.BuiltinStreamNR:
+		name := vm.pop().AsStr(vm.convfmt)
+		vm.push(types.Num(float64(vm.streamNR(name))))
+
+	case compiler.BuiltinSpit, compiler.BuiltinSpitAppend:
+		appendMode := false
+		if op == compiler.BuiltinSpitAppend {
+			appendMode = vm.pop().AsBool()
+		}
+		content := vm.pop().AsStr(vm.convfmt)
+		name := vm.pop().AsStr(vm.convfmt)
+		n, err := vm.ioManager.Spit(name, content, appendMode)
+		if err != nil {
+			vm.specials.ERRNO = err.Error()
+			n = -1
+		}
+		vm.push(types.Num(float64(n)))
+
 	case compiler.BuiltinSqrt:
 		x := vm.pop().AsNum()
 		vm.push(types.Num(math.Sqrt(x)))
 
 	case compiler.BuiltinSrand:
 		// srand() with no args - use current time
-		seed := time.Now().UnixNano()
+		seed := vm.now().UnixNano()
 		vm.randSource = rand.New(rand.NewSource(seed))
 		vm.push(types.Num(float64(seed)))
 
@@ -111,6 +214,13 @@ func (vm *VM) callBuiltin(op compiler.BuiltinOp) error {
 		vm.randSource = rand.New(rand.NewSource(seed))
 		vm.push(types.Num(float64(seed)))
 
+	case compiler.BuiltinStrtonum:
+		v := vm.pop()
+		if !v.IsNum() {
+			v = types.Num(types.ParseNonDecimal(v.AsStr(vm.convfmt)))
+		}
+		vm.push(v)
+
 	case compiler.BuiltinSub:
 		target := vm.pop().AsStr(vm.convfmt)
 		replacement := vm.pop().AsStr(vm.convfmt)
@@ -144,10 +254,72 @@ func (vm *VM) callBuiltin(op compiler.BuiltinOp) error {
 		s := vm.pop().AsStr(vm.convfmt)
 		vm.push(types.Str(toLowerASCII(s)))
 
+	case compiler.BuiltinStrftime, compiler.BuiltinStrftimeFormat,
+		compiler.BuiltinStrftimeTime, compiler.BuiltinStrftimeUTC:
+		// strftime([format [, timestamp [, utc]]]) - pop in reverse
+		utc := false
+		if op == compiler.BuiltinStrftimeUTC {
+			utc = vm.pop().AsBool()
+		}
+		var ts float64
+		if op == compiler.BuiltinStrftimeTime || op == compiler.BuiltinStrftimeUTC {
+			ts = vm.pop().AsNum()
+		} else {
+			ts = float64(vm.now().Unix())
+		}
+		format := defaultStrftimeFormat
+		if op != compiler.BuiltinStrftime {
+			format = vm.pop().AsStr(vm.convfmt)
+		}
+		// A timestamp that is not finite gives ""
+		result := ""
+		if t, ok := strftimeTime(ts, utc); ok {
+			result = strftime(t, format)
+		}
+		vm.push(types.Str(result))
+
+	case compiler.BuiltinSystime:
+		vm.push(types.Num(float64(vm.now().Unix())))
+
+	case compiler.BuiltinTimefmt, compiler.BuiltinTimefmtUTC:
+		utc := false
+		if op == compiler.BuiltinTimefmtUTC {
+			utc = vm.pop().AsBool()
+		}
+		layout := vm.pop().AsStr(vm.convfmt)
+		ts := vm.pop().AsNum()
+		vm.push(types.Str(timefmt(ts, layout, utc)))
+
 	case compiler.BuiltinToupper:
 		s := vm.pop().AsStr(vm.convfmt)
 		vm.push(types.Str(toUpperASCII(s)))
 
+	case compiler.BuiltinTypeof:
+		vm.push(types.Str(typeName(vm.pop())))
+
+	case compiler.BuiltinTypeofUntyped:
+		// A variable nothing gives a type, unless assigned from outside
+		v := vm.pop()
+		if v.IsNull() {
+			vm.push(types.Str("untyped"))
+		} else {
+			vm.push(types.Str(typeName(v)))
+		}
+
+	case compiler.BuiltinURLDec:
+		s := vm.pop().AsStr(vm.convfmt)
+		decoded, err := url.QueryUnescape(s)
+		if err != nil {
+			// Malformed escapes leave the input as it was
+			decoded = s
+			vm.specials.ERRNO = "urldec: " + err.Error()
+		}
+		vm.push(types.Str(decoded))
+
+	case compiler.BuiltinURLEnc:
+		s := vm.pop().AsStr(vm.convfmt)
+		vm.push(types.Str(url.QueryEscape(s)))
+
 	default:
 		return fmt.Errorf("unknown builtin op: %d", op)
 	}
@@ -155,6 +327,205 @@ func (vm *VM) callBuiltin(op compiler.BuiltinOp) error {
 	return nil
 }
 
+// indirectBuiltins maps builtin names to their BuiltinOp by argument count,
+// for the builtins that can be called indirectly (@f()). Builtins taking
+// arrays or lvalues (split, sub, gsub) are excluded.
+var indirectBuiltins = map[string]map[int]compiler.BuiltinOp{
+	"and":      {2: compiler.BuiltinAnd},
+	"atan2":    {2: compiler.BuiltinAtan2},
+	"b64dec":   {1: compiler.BuiltinB64Dec},
+	"b64enc":   {1: compiler.BuiltinB64Enc},
+	"close":    {1: compiler.BuiltinClose, 2: compiler.BuiltinCloseHow},
+	"compl":    {1: compiler.BuiltinCompl},
+	"cos":      {1: compiler.BuiltinCos},
+	"exp":      {1: compiler.BuiltinExp},
+	"fflush":   {0: compiler.BuiltinFflushAll, 1: compiler.BuiltinFflush},
+	"gensub":   {4: compiler.BuiltinGensub},
+	"hash":     {2: compiler.BuiltinHash},
+	"index":    {2: compiler.BuiltinIndex},
+	"int":      {1: compiler.BuiltinInt},
+	"isarray":  {1: compiler.BuiltinIsarray},
+	"length":   {0: compiler.BuiltinLength, 1: compiler.BuiltinLengthArg},
+	"log":      {1: compiler.BuiltinLog},
+	"lshift":   {2: compiler.BuiltinLshift},
+	"match":    {2: compiler.BuiltinMatch},
+	"mktime":   {1: compiler.BuiltinMktime, 2: compiler.BuiltinMktimeUTC},
+	"now":      {0: compiler.BuiltinNow, 1: compiler.BuiltinNowFormat},
+	"or":       {2: compiler.BuiltinOr},
+	"rand":     {0: compiler.BuiltinRand},
+	"rshift":   {2: compiler.BuiltinRshift},
+	"sin":      {1: compiler.BuiltinSin},
+	"slurp":    {1: compiler.BuiltinSlurp},
+	"spit":     {2: compiler.BuiltinSpit, 3: compiler.BuiltinSpitAppend},
+	"sqrt":     {1: compiler.BuiltinSqrt},
+	"srand":    {0: compiler.BuiltinSrand, 1: compiler.BuiltinSrandSeed},
+	"streamnr": {1: compiler.BuiltinStreamNR},
+	"strftime": {
+		0: compiler.BuiltinStrftime, 1: compiler.BuiltinStrftimeFormat,
+		2: compiler.BuiltinStrftimeTime, 3: compiler.BuiltinStrftimeUTC,
+	},
+	"strtonum": {1: compiler.BuiltinStrtonum},
+	"substr":   {2: compiler.BuiltinSubstr, 3: compiler.BuiltinSubstrLen},
+	"system":   {1: compiler.BuiltinSystem},
+	"systime":  {0: compiler.BuiltinSystime},
+	"timefmt":  {2: compiler.BuiltinTimefmt, 3: compiler.BuiltinTimefmtUTC},
+	"tolower":  {1: compiler.BuiltinTolower},
+	"toupper":  {1: compiler.BuiltinToupper},
+	"typeof":   {1: compiler.BuiltinTypeof},
+	"urldec":   {1: compiler.BuiltinURLDec},
+	"urlenc":   {1: compiler.BuiltinURLEnc},
+	"xor":      {2: compiler.BuiltinXor},
+}
+
+// typeName returns what typeof() reports for the scalar v. Fields are
+// "strnum" whether or not they look numeric.
+func typeName(v types.Value) string {
+	switch v.Kind() {
+	case types.KindNum:
+		return "number"
+	case types.KindStr:
+		return "string"
+	case types.KindNumStr:
+		return "strnum"
+	}
+	return "unassigned"
+}
+
+// toBits converts x to the 64-bit unsigned integer the bitwise builtins
+// operate on: the fraction is dropped and the integer reduced modulo 2^64,
+// so values beyond 2^64 wrap and -1 has all bits set. NaN and infinities
+// give 0. Results are numbers again, rounded like any value above 2^53.
+func toBits(x float64) uint64 {
+	if math.IsNaN(x) || math.IsInf(x, 0) {
+		return 0
+	}
+	x = math.Mod(math.Trunc(x), 1<<64)
+	if x < 0 {
+		return -toBits(-x)
+	}
+	if x >= 1<<63 {
+		return uint64(x-(1<<63)) | 1<<63
+	}
+	return uint64(x)
+}
+
+// bitwise applies the two-operand bitwise builtin op to x and y. Shifts
+// by 64 or more bits give 0.
+func bitwise(op compiler.BuiltinOp, x, y uint64) uint64 {
+	switch op {
+	case compiler.BuiltinAnd:
+		return x & y
+	case compiler.BuiltinOr:
+		return x | y
+	case compiler.BuiltinXor:
+		return x ^ y
+	case compiler.BuiltinLshift:
+		return x << y
+	default: // compiler.BuiltinRshift
+		return x >> y
+	}
+}
+
+// callBuiltinByName calls a built-in function for an indirect call.
+func (vm *VM) callBuiltinByName(name string, args []types.Value) error {
+	if name == "sprintf" && len(args) > 0 {
+		vm.push(types.Str(vm.builtinSprintf(args)))
+		return nil
+	}
+
+	if name == "gensub" && len(args) == 3 {
+		args = append(args, vm.getField(0)) // The target defaults to $0
+	}
+
+	if (name == "and" || name == "or" || name == "xor") && len(args) > 2 {
+		// Variadic: fold all but the last argument first
+		if err := vm.callBuiltinByName(name, args[:len(args)-1]); err != nil {
+			return err
+		}
+		vm.push(args[len(args)-1])
+		return vm.callBuiltin(indirectBuiltins[name][2])
+	}
+
+	ops, ok := indirectBuiltins[name]
+	if !ok {
+		return fmt.Errorf("undefined function %q in indirect call", name)
+	}
+	op, ok := ops[len(args)]
+	if !ok {
+		return fmt.Errorf("wrong number of arguments in indirect call to %q", name)
+	}
+	for _, arg := range args {
+		vm.push(arg)
+	}
+	return vm.callBuiltin(op)
+}
+
+// nowTokens maps the tokens understood by now(format) to time.Format layouts.
+// Longer tokens come first so that YYYY is matched before YY.
+var nowTokens = []struct {
+	token  string
+	layout string
+}{
+	{"YYYY", "2006"},
+	{"YY", "06"},
+	{"MM", "01"},
+	{"DD", "02"},
+	{"hh", "15"},
+	{"mm", "04"},
+	{"ss", "05"},
+}
+
+// formatNow formats t using now()'s friendly tokens (YYYY, YY, MM, DD, hh,
+// mm, ss). All other characters are copied literally.
+func formatNow(t time.Time, format string) string {
+	var sb strings.Builder
+	for i := 0; i < len(format); {
+		matched := false
+		for _, nt := range nowTokens {
+			if strings.HasPrefix(format[i:], nt.token) {
+				sb.WriteString(t.Format(nt.layout))
+				i += len(nt.token)
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			sb.WriteByte(format[i])
+			i++
+		}
+	}
+	return sb.String()
+}
+
+// timefmt formats ts, in seconds since the Unix epoch, with a Go reference
+// layout such as "2006-01-02 15:04:05", in local time or UTC.
+func timefmt(ts float64, layout string, utc bool) string {
+	sec, frac := math.Modf(ts)
+	t := time.Unix(int64(sec), int64(frac*1e9))
+	if utc {
+		t = t.UTC()
+	}
+	return t.Format(layout)
+}
+
+// hashString returns the lowercase hex digest of s under algo ("md5",
+// "sha1" or "sha256", in any case).
+func hashString(algo, s string) (string, error) {
+	var h hash.Hash
+	switch strings.ToLower(algo) {
+	case "md5":
+		h = md5.New()
+	case "sha1":
+		h = sha1.New()
+	case "sha256":
+		h = sha256.New()
+	default:
+		return "", fmt.Errorf("hash: unknown algorithm %q", algo)
+	}
+	h.Write([]byte(s))
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
 // builtinSplit splits a string into an array.
 func (vm *VM) builtinSplit(str string, scope compiler.Scope, arrIdx int, sep string) int {
 	arr := vm.getArray(scope, arrIdx)
@@ -170,7 +541,10 @@ func (vm *VM) builtinSplit(str string, scope compiler.Scope, arrIdx int, sep str
 	}
 
 	var parts []string
-	if sep == " " {
+	if keyParts, ok := splitKey(str, sep); ok && vm.subsepSafe && sep == vm.subsep {
+		// Multi-dimensional key: undo the escaping done by joinKey
+		parts = keyParts
+	} else if sep == " " {
 		// Default separator: split on runs of whitespace
 		parts = strings.Fields(str)
 	} else if len(sep) == 1 {
@@ -178,10 +552,7 @@ func (vm *VM) builtinSplit(str string, scope compiler.Scope, arrIdx int, sep str
 		parts = strings.Split(str, sep)
 	} else if sep == "" {
 		// Empty separator: split into individual characters
-		parts = make([]string, len(str))
-		for i, r := range str {
-			parts[i] = string(r)
-		}
+		parts = splitChars(str, vm.chars, nil)
 	} else {
 		// Regex separator - use coregex via cache
 		re, err := vm.regexCache.Get(sep)
@@ -199,6 +570,45 @@ func (vm *VM) builtinSplit(str string, scope compiler.Scope, arrIdx int, sep str
 	return len(parts)
 }
 
+// builtinCopy replaces the contents of dst with a copy of src.
+// Returns the number of elements copied.
+func (vm *VM) builtinCopy(src, dst map[string]types.Value) int {
+	// copy(a, a) must not clear the source
+	if sameArray(src, dst) {
+		return len(src)
+	}
+	clear(dst)
+	for k, v := range src {
+		dst[k] = v
+	}
+	return len(dst)
+}
+
+// sameArray reports whether a and b are the same array, which they may be
+// through function parameters. Removing a key from a shrinks b only if they
+// share storage; the key is put back before returning.
+func sameArray(a, b map[string]types.Value) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for k, v := range a {
+		delete(a, k)
+		same := len(a) == len(b)
+		a[k] = v
+		return same
+	}
+	return true // Both empty, so copying one to the other changes nothing
+}
+
+// builtinExtend merges src into dst, overwriting values of existing keys.
+// Returns the number of keys added or updated.
+func (vm *VM) builtinExtend(dst, src map[string]types.Value) int {
+	for k, v := range src {
+		dst[k] = v
+	}
+	return len(src)
+}
+
 // builtinSprintf implements sprintf with AWK-compatible formatting.
 func (vm *VM) builtinSprintf(args []types.Value) string {
 	if len(args) == 0 {
@@ -243,10 +653,15 @@ func (vm *VM) builtinSprintf(args []types.Value) string {
 			continue
 		}
 
-		// Parse flags: -+ #0
+		// Parse flags: -+ #0, and ' for digit grouping (not a Go flag)
 		var flags strings.Builder
-		for i < len(format) && strings.ContainsAny(string(format[i]), "-+ #0") {
-			flags.WriteByte(format[i])
+		grouped := false
+		for i < len(format) && strings.ContainsAny(string(format[i]), "-+ #0'") {
+			if format[i] == '\'' {
+				grouped = true
+			} else {
+				flags.WriteByte(format[i])
+			}
 			i++
 		}
 
@@ -305,6 +720,14 @@ func (vm *VM) builtinSprintf(args []types.Value) string {
 		switch specifier {
 		case 'd', 'i':
 			// %i is same as %d in AWK
+			if grouped && vm.thousandsSep != "" {
+				goFmt := "%" + strings.ReplaceAll(flags.String(), "0", "") + precision + "d"
+				s := groupDigits(fmt.Sprintf(goFmt, int64(value.AsNum())), vm.thousandsSep)
+				left := strings.Contains(flags.String(), "-")
+				zero := !left && precision == "" && strings.Contains(flags.String(), "0")
+				result.WriteString(padWidth(s, width, left, zero))
+				break
+			}
 			goFmt := "%" + flags.String() + width + precision + "d"
 			result.WriteString(fmt.Sprintf(goFmt, int64(value.AsNum())))
 		case 'o':
@@ -321,21 +744,13 @@ func (vm *VM) builtinSprintf(args []types.Value) string {
 			goFmt := "%" + flags.String() + width + precision + "d"
 			result.WriteString(fmt.Sprintf(goFmt, uint64(value.AsNum())))
 		case 'c':
-			// %c: if number, use as ASCII code; if string, use first char
-			// AWK convention: number takes precedence for %c
-			if value.IsNum() || value.IsNull() {
-				n := int(value.AsNum())
-				// Any byte value is valid (0-255)
-				if n >= 0 && n <= 255 {
-					result.WriteByte(byte(n))
-				}
-			} else {
-				// String value - use first character
-				s := value.AsStr(vm.convfmt)
-				if len(s) > 0 {
-					result.WriteByte(s[0])
-				}
+			// %c: a number is a character code, a string gives its
+			// first character; number takes precedence, as in AWK
+			c := vm.formatChar(value)
+			if width != "" {
+				c = fmt.Sprintf("%"+flags.String()+width+"s", c)
 			}
+			result.WriteString(c)
 		case 's':
 			s := value.AsStr(vm.convfmt)
 			goFmt := "%" + flags.String() + width + precision + "s"
@@ -364,11 +779,64 @@ func (vm *VM) builtinSprintf(args []types.Value) string {
 	return result.String()
 }
 
+// groupDigits inserts sep between groups of three digits in s, an
+// optionally signed integer such as "-1234567". Other strings, such as
+// "1.5" or "1e+30", are returned unchanged.
+func groupDigits(s, sep string) string {
+	digits := s
+	if digits != "" && (digits[0] == '-' || digits[0] == '+' || digits[0] == ' ') {
+		digits = digits[1:]
+	}
+	if len(digits) <= 3 {
+		return s
+	}
+	for i := 0; i < len(digits); i++ {
+		if digits[i] < '0' || digits[i] > '9' {
+			return s
+		}
+	}
+
+	var b strings.Builder
+	b.Grow(len(s) + len(digits)/3*len(sep))
+	b.WriteString(s[:len(s)-len(digits)])
+	for i := 0; i < len(digits); i++ {
+		if i > 0 && (len(digits)-i)%3 == 0 {
+			b.WriteString(sep)
+		}
+		b.WriteByte(digits[i])
+	}
+	return b.String()
+}
+
+// padWidth pads s with spaces to width, on the right if left is set.
+// If zero is set, s is padded with zeros after its sign instead.
+func padWidth(s, width string, left, zero bool) string {
+	w, _ := strconv.Atoi(width)
+	if pad := w - utf8.RuneCountInString(s); pad > 0 {
+		if left {
+			return s + strings.Repeat(" ", pad)
+		}
+		if zero {
+			sign := 0
+			if s != "" && (s[0] == '-' || s[0] == '+' || s[0] == ' ') {
+				sign = 1
+			}
+			return s[:sign] + strings.Repeat("0", pad) + s[sign:]
+		}
+		return strings.Repeat(" ", pad) + s
+	}
+	return s
+}
+
 // builtinSubstr implements substr.
 // AWK substr(s, start[, length]) uses 1-based indexing.
 // If start < 1, it's treated as 1 (beginning of string).
 // If start+length extends beyond string, returns to end of string.
 func (vm *VM) builtinSubstr(s string, start, length int) string {
+	if vm.chars {
+		return substrChars(s, start, length)
+	}
+
 	// AWK uses 1-based indexing
 	// If start < 1, treat as 1 (POSIX behavior)
 	if start < 1 {
@@ -390,6 +858,42 @@ func (vm *VM) builtinSubstr(s string, start, length int) string {
 	return s[start:end]
 }
 
+// substrChars is builtinSubstr counting positions in characters
+// (UTF-8 runes) rather than bytes.
+func substrChars(s string, start, length int) string {
+	if start < 1 {
+		start = 1
+	}
+	start--
+	if length <= 0 {
+		return ""
+	}
+
+	i, begin := 0, -1
+	for pos := range s {
+		if i == start {
+			begin = pos
+		}
+		if begin >= 0 && i == start+length {
+			return s[begin:pos]
+		}
+		i++
+	}
+	if begin < 0 {
+		return ""
+	}
+	return s[begin:]
+}
+
+// strLen returns the length of s in bytes, or in characters
+// (UTF-8 runes) in chars mode.
+func (vm *VM) strLen(s string) int {
+	if vm.chars {
+		return utf8.RuneCountInString(s)
+	}
+	return len(s)
+}
+
 // builtinMatch implements match.
 func (vm *VM) builtinMatch(str, pattern string) (int, int) {
 	re, err := vm.regexCache.Get(pattern)
@@ -403,7 +907,7 @@ func (vm *VM) builtinMatch(str, pattern string) (int, int) {
 	}
 
 	// AWK uses 1-based indexing
-	return loc[0] + 1, loc[1] - loc[0]
+	return vm.strLen(str[:loc[0]]) + 1, vm.strLen(str[loc[0]:loc[1]])
 }
 
 // builtinSub implements sub (single substitution).
@@ -442,6 +946,75 @@ func (vm *VM) builtinGsub(pattern, replacement, target string) (string, int) {
 	return result, count
 }
 
+// builtinGensub implements gensub, returning target with matches of
+// pattern replaced: all of them if how starts with "g" or "G", otherwise
+// only match number how (the first if how is less than 1).
+func (vm *VM) builtinGensub(pattern, replacement string, how types.Value, target string) string {
+	re, err := vm.regexCache.Get(pattern)
+	if err != nil {
+		return target
+	}
+
+	s := how.AsStr(vm.convfmt)
+	global := s != "" && (s[0] == 'g' || s[0] == 'G')
+	limit := -1
+	if !global {
+		// There are at most len(target)+1 matches
+		limit = int(math.Max(1, math.Min(how.AsNum(), float64(len(target)+1))))
+	}
+	matches := re.FindAllStringSubmatchIndex(target, limit)
+	if !global {
+		if len(matches) < limit {
+			return target
+		}
+		matches = matches[limit-1:]
+	}
+	if len(matches) == 0 {
+		return target
+	}
+
+	var result strings.Builder
+	last := 0
+	for _, m := range matches {
+		result.WriteString(target[last:m[0]])
+		expandGensub(&result, replacement, target, m)
+		last = m[1]
+	}
+	result.WriteString(target[last:])
+	return result.String()
+}
+
+// expandGensub writes gensub's replacement repl for the match m of s:
+// & and \0 stand for the matched text, \1 to \9 for its groups (empty if
+// a group did not take part), \& and \\ for a literal & and backslash.
+// Any other backslash is kept.
+func expandGensub(b *strings.Builder, repl, s string, m []int) {
+	for i := 0; i < len(repl); i++ {
+		c := repl[i]
+		switch {
+		case c == '&':
+			b.WriteString(s[m[0]:m[1]])
+		case c == '\\' && i+1 < len(repl):
+			next := repl[i+1]
+			switch {
+			case next >= '0' && next <= '9':
+				g := int(next-'0') * 2
+				if g+1 < len(m) && m[g] >= 0 {
+					b.WriteString(s[m[g]:m[g+1]])
+				}
+				i++
+			case next == '&' || next == '\\':
+				b.WriteByte(next)
+				i++
+			default:
+				b.WriteByte(c)
+			}
+		default:
+			b.WriteByte(c)
+		}
+	}
+}
+
 // handleAwkReplacement handles AWK replacement string semantics.
 // & is replaced with the matched string, \& is a literal &.
 func handleAwkReplacement(replacement, matched string) string {
@@ -470,27 +1043,62 @@ func handleAwkReplacement(replacement, matched string) string {
 	return result.String()
 }
 
-// builtinSystem executes a shell command.
-func (vm *VM) builtinSystem(cmd string) int {
-	c := exec.Command("sh", "-c", cmd)
-	c.Stdout = vm.output
-	c.Stderr = vm.output
-
-	err := c.Run()
-	if err != nil {
-		if exitErr, ok := err.(*exec.ExitError); ok {
-			return exitErr.ExitCode()
+// formatChar returns what printf's %c writes for value. In byte mode a
+// number gives the low byte of its integer part, as in C and onetrue awk,
+// so 256 gives "\x00" and -1 gives "\xff", and a string gives its first
+// byte. In chars mode a number is a Unicode code point, written as UTF-8
+// (U+FFFD if it is not a valid one), and a string gives its first rune.
+func (vm *VM) formatChar(value types.Value) string {
+	if value.IsNum() || value.IsNull() {
+		n := math.Trunc(value.AsNum())
+		if vm.chars {
+			if n < 0 || n > unicode.MaxRune || math.IsNaN(n) {
+				return string(utf8.RuneError)
+			}
+			return string(rune(n))
+		}
+		if math.IsNaN(n) || math.IsInf(n, 0) {
+			return "\x00"
 		}
-		return 1
+		return string([]byte{byte(int64(math.Mod(n, 256)))})
 	}
-	return 0
+
+	s := value.AsStr(vm.convfmt)
+	if s == "" {
+		return ""
+	}
+	if vm.chars {
+		_, size := utf8.DecodeRuneInString(s)
+		return s[:size]
+	}
+	return s[:1]
+}
+
+// builtinSystem executes a shell command.
+func (vm *VM) builtinSystem(cmd string) int {
+	return vm.ioManager.System(cmd)
 }
 
 // closeFile closes a file or pipe.
 func (vm *VM) closeFile(name string) int {
+	delete(vm.streamRecords, name)
 	return vm.ioManager.Close(name)
 }
 
+// streamNR returns the number of records read so far from the stream
+// called name: by getline from a file, command or coprocess of that name,
+// or FNR if name is the current main input file. Closing a stream resets
+// its count.
+func (vm *VM) streamNR(name string) int {
+	if n, ok := vm.streamRecords[name]; ok {
+		return n
+	}
+	if name == vm.specials.FILENAME && name != "" {
+		return vm.fileNum
+	}
+	return 0
+}
+
 // flushFile flushes a specific file.
 func (vm *VM) flushFile(name string) int {
 	return vm.ioManager.Flush(name)
@@ -498,13 +1106,96 @@ func (vm *VM) flushFile(name string) int {
 
 // flushAll flushes all files and stdout.
 func (vm *VM) flushAll() int {
-	// Flush stdout if it's a flushable writer
-	if f, ok := vm.output.(interface{ Flush() error }); ok {
-		f.Flush()
-	}
+	// The I/O manager's stdout is vm.output (see SetOutput)
 	return vm.ioManager.Flush("")
 }
 
+// keyEscape marks a literal SUBSEP (or keyEscape) inside a part of a
+// multi-dimensional key when VMConfig.SubsepSafe is set. A key holding
+// escapes also starts with keyEscape, so it can be told from other strings.
+const keyEscape = '\035'
+
+// joinKey joins multi-dimensional key parts with subsep. If any part holds
+// subsep or keyEscape, the key starts with keyEscape and those occurrences
+// are escaped, so that distinct part lists always give distinct keys.
+// Otherwise the parts are joined unchanged.
+func joinKey(parts []string, subsep string) string {
+	escape := false
+	for _, part := range parts {
+		if subsep != "" && (strings.Contains(part, subsep) || strings.IndexByte(part, keyEscape) >= 0) {
+			escape = true
+			break
+		}
+	}
+	if !escape {
+		return strings.Join(parts, subsep)
+	}
+
+	var sb strings.Builder
+	sb.WriteByte(keyEscape)
+	for i, part := range parts {
+		if i > 0 {
+			sb.WriteString(subsep)
+		}
+		for j := 0; j < len(part); {
+			switch {
+			case part[j] == keyEscape:
+				sb.WriteByte(keyEscape)
+				sb.WriteByte(keyEscape)
+				j++
+			case strings.HasPrefix(part[j:], subsep):
+				sb.WriteByte(keyEscape)
+				sb.WriteString(subsep)
+				j += len(subsep)
+			default:
+				sb.WriteByte(part[j])
+				j++
+			}
+		}
+	}
+	return sb.String()
+}
+
+// splitKey splits a key built by joinKey from escaped parts back into
+// those parts. It reports false if key isn't such a key: one starting with
+// keyEscape, holding escapes, where every later keyEscape escapes itself
+// or subsep.
+func splitKey(key, subsep string) ([]string, bool) {
+	if subsep == "" || key == "" || key[0] != keyEscape {
+		return nil, false
+	}
+	var parts []string
+	var sb strings.Builder
+	escapes := 0
+	for i := 1; i < len(key); {
+		switch {
+		case key[i] == keyEscape:
+			escapes++
+			switch {
+			case strings.HasPrefix(key[i+1:], subsep):
+				sb.WriteString(subsep)
+				i += 1 + len(subsep)
+			case i+1 < len(key) && key[i+1] == keyEscape:
+				sb.WriteByte(keyEscape)
+				i += 2
+			default:
+				return nil, false
+			}
+		case strings.HasPrefix(key[i:], subsep):
+			parts = append(parts, sb.String())
+			sb.Reset()
+			i += len(subsep)
+		default:
+			sb.WriteByte(key[i])
+			i++
+		}
+	}
+	if escapes == 0 {
+		return nil, false
+	}
+	return append(parts, sb.String()), true
+}
+
 // toLowerASCII converts string to lowercase with ASCII fast path.
 // For pure ASCII strings (90%+ of AWK input), uses byte arithmetic
 // instead of Unicode table lookups - 2-3x faster.
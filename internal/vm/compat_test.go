@@ -13,8 +13,8 @@
 //	go test ./internal/vm/... -run TestCompatibility/Category/test_name -v
 //
 // Skipped features (not yet implemented):
-// - I/O: getline, system(), close(), pipes (|), redirection (>, >>), fflush()
-// - gawk extensions: gensub(), patsplit(), strftime(), mktime(), systime(), nextfile
+// - I/O: getline, pipes (|), redirection (>, >>)
+// - gawk extensions: patsplit()
 //
 // Test Status (as of porting):
 // - PASS: ~330 tests (86%)
@@ -56,12 +56,10 @@ type testCategory struct {
 // Tests containing these patterns are automatically skipped.
 var unsupportedFeatures = []string{
 	// gawk extensions
-	"gensub(", "patsplit(", "strftime(", "mktime(", "systime(",
-	"nextfile",
+	"patsplit(",
 	// I/O operations
-	"getline", "system(", "close(",
+	"getline",
 	" | ", // Pipe (with spaces to avoid matching ||)
-	"fflush(",
 	// Special markers
 	"# !awk",
 	"# !gawk",
@@ -84,6 +82,13 @@ func shouldSkip(src string) (skip bool, reason string) {
 // runCompatTest executes a single compatibility test.
 func runCompatTest(t *testing.T, tt interpTest) {
 	t.Helper()
+	runCompatTestConfig(t, tt, DefaultVMConfig())
+}
+
+// runCompatTestConfig runs a compatibility test on a VM with the given
+// configuration.
+func runCompatTestConfig(t *testing.T, tt interpTest, config VMConfig) {
+	t.Helper()
 
 	// Check for skip conditions
 	if skip, reason := shouldSkip(tt.src); skip {
@@ -125,7 +130,7 @@ func runCompatTest(t *testing.T, tt interpTest) {
 	}
 
 	// Execute
-	vm := New(compiled)
+	vm := NewWithConfig(compiled, config)
 
 	if tt.in != "" {
 		vm.SetInput(strings.NewReader(tt.in))
@@ -207,6 +212,9 @@ var beginEndTests = []interpTest{
 	{name: "BEGIN_END_with_input", src: `BEGIN { print "b"} END { print "e" }`, in: "foo", out: "b\ne\n"},
 	{name: "BEGIN_action_END", src: `BEGIN { print "b"} $0 { print NR } END { print "e" }`, in: "foo", out: "b\n1\ne\n"},
 	{name: "multiple_BEGIN", src: `BEGIN { printf "x" }; BEGIN { printf "y" }`, in: "", out: "xy"},
+	{name: "BEGIN_fields_empty", src: `BEGIN { print "[" $0 "]", NF, $1 }`, in: "a b", out: "[] 0 \n"},
+	{name: "BEGIN_fields_length", src: `BEGIN { print length(), length($0), "[" $NF "]", "[" $(NF+2) "]" }`, in: "a b", out: "0 0 [] []\n"},
+	{name: "BEGIN_fields_then_record", src: `BEGIN { x = $1 NF } { print x "|" $1, NF }`, in: "a b", out: "0|a 2\n"},
 }
 
 func TestCompatBeginEnd(t *testing.T) {
@@ -239,6 +247,11 @@ var patternTests = []interpTest{
 
 	// Range patterns
 	{name: "range_pattern", src: `NR==2, NR==4`, in: "1\n2\n3\n4\n5\n6\n", out: "2\n3\n4\n"},
+	{name: "range_pattern_vars", src: `BEGIN { s = 3; e = 5 } NR==s, NR==e`, in: "1\n2\n3\n4\n5\n6\n", out: "3\n4\n5\n"},
+	{name: "range_pattern_vars_moved", src: `BEGIN { s = 1; e = 2 } NR==s, NR==e { print; if (NR == e) { s = 4; e = 5 } }`, in: "1\n2\n3\n4\n5\n6\n", out: "1\n2\n4\n5\n"},
+	{name: "range_pattern_end_moved", src: `BEGIN { s = 2; e = 3 } NR==s, NR==e { print; e = 5 }`, in: "1\n2\n3\n4\n5\n6\n", out: "2\n3\n4\n5\n"},
+	{name: "range_pattern_same_record", src: `/x/,/x/`, in: "a\nx\nb\nx\nc\n", out: "x\nx\n"},
+	{name: "range_pattern_one_record", src: `/x/,/y/ { print NR }`, in: "a\nxy\nb\ny\nx\nc\ny\n", out: "2\n5\n6\n7\n"},
 }
 
 func TestCompatPatterns(t *testing.T) {
@@ -254,6 +267,14 @@ var printTests = []interpTest{
 	{name: "print_OFS", src: `BEGIN { print OFS; OFS = ","; print "x", "y" }`, out: " \nx,y\n"},
 	{name: "print_ORS", src: `BEGIN { print ORS; ORS = "."; print "x", "y" }`, out: "\n\nx y."},
 	{name: "print_ORS_empty", src: `BEGIN { print ORS; ORS = ""; print "x", "y" }`, out: "\n\nx y"},
+	{name: "default_action_ORS", src: `BEGIN { ORS = "|" } 1`, in: "a\nb\n", out: "a|b|"},
+	{name: "default_action_ORS_OFS", src: `BEGIN { ORS = "|"; OFS = "-" } { $1 = $1 } 1`, in: "a b\nc d\n", out: "a-b|c-d|"},
+	{name: "default_action_ORS_range", src: `BEGIN { ORS = ";" } /b/,/c/`, in: "a\nb\nc\nd\n", out: "b;c;"},
+	{name: "print_noargs_ORS", src: `BEGIN { ORS = "|"; OFS = "-" } { print }`, in: "a  b\nc\n", out: "a  b|c|"},
+	{name: "print_noargs_vs_default", src: `BEGIN { ORS = "|"; OFS = "-" } { print } 1`, in: "a  b\n", out: "a  b|a  b|"},
+	{name: "print_$0_args_OFS", src: `BEGIN { OFS = "-" } { print $0, $0; print $0 $0 }`, in: "a b\n", out: "a b-a b\na ba b\n"},
+	{name: "print_rebuilt_OFS", src: `BEGIN { OFS = "-" } { $1 = $1; print; print $0, NF }`, in: "a  b\n", out: "a-b\na-b-2\n"},
+	{name: "print_$0_assigned", src: `BEGIN { OFS = "-" } { $0 = "x  y"; print; print $1, $2 }`, in: "a\n", out: "x  y\nx-y\n"},
 	{name: "print_twice", src: `{ print; print }`, in: "foo", out: "foo\nfoo\n"},
 	{name: "print_empty", src: `BEGIN { print; print }`, out: "\n\n"},
 
@@ -265,6 +286,11 @@ var printTests = []interpTest{
 	{name: "printf_char_zero", src: `BEGIN { printf "%c", 0 }`, out: "\x00"},
 	{name: "printf_char_127", src: `BEGIN { printf "%c", 127 }`, out: "\x7f"},
 	{name: "printf_char_string", src: `BEGIN { printf "%c", "xyz" }`, out: "x"},
+	{name: "printf_char_256", src: `BEGIN { printf "%c", 256 }`, out: "\x00"},
+	{name: "printf_char_321", src: `BEGIN { printf "%c", 321 }`, out: "A"},
+	{name: "printf_char_negative", src: `BEGIN { printf "%c", -1 }`, out: "\xff"},
+	{name: "printf_char_fraction", src: `BEGIN { printf "%c", 66.9 }`, out: "B"},
+	{name: "printf_char_width", src: `BEGIN { printf "[%3c][%-3c]", "x", 66 }`, out: "[  x][B  ]"},
 	{name: "printf_paren", src: `BEGIN { printf("%%%dd", 4) }`, out: "%4d"},
 	{name: "printf_int_formats", src: `BEGIN { printf "%d %i %o %u %x %X", 42, 42, 42, 42, 42, 42 }`, out: "42 42 52 42 2a 2A"},
 }
@@ -394,6 +420,9 @@ var arrayTests = []interpTest{
 	{name: "array_string_key", src: `BEGIN { a["k"] = "v"; print a["k"] }`, out: "v\n"},
 	{name: "array_in_true", src: `BEGIN { a[1] = "x"; print (1 in a) }`, out: "1\n"},
 	{name: "array_in_false", src: `BEGIN { a[1] = "x"; print (2 in a) }`, out: "0\n"},
+	{name: "array_in_no_create", src: `BEGIN { if ("x" in a) print "yes"; print length(a) }`, out: "0\n"},
+	{name: "array_in_no_create_multi", src: `BEGIN { a[1] = 1; if ((1, 2) in a) print "yes"; n = 0; for (k in a) n++; print n }`, out: "1\n"},
+	{name: "array_in_no_create_param", src: `function has(arr, k) { return k in arr } BEGIN { has(a, "x"); print length(a), has(a, "x") }`, out: "0 0\n"},
 	{name: "array_for_in_sum", src: `BEGIN { a[1]=1; a[2]=2; for (k in a) s+=a[k]; print s }`, out: "3\n"},
 	{name: "array_empty_index_error", src: `BEGIN { a[] }`, err: "expected expression in array index"},
 	{name: "delete_empty_index_error", src: `BEGIN { delete a[] }`, err: "expected expression in delete index"},
@@ -447,6 +476,13 @@ var comparisonTests = []interpTest{
 	{name: "lt_$0_assigned", src: `BEGIN { $0="10"; print($0<2) }`, out: "1\n"},
 	{name: "lt_$1_assigned", src: `BEGIN { $1="10"; print($1<2) }`, out: "1\n"},
 	{name: "lt_$1_assigned_str", src: `BEGIN { $1="10x"; print($1<2) }`, out: "1\n"},
+	{name: "lt_hex_fields", src: `{ print ($1<$2) }`, in: "0x1F 9\n0x10 0x9\n-0x10 -20\n+0xa 11", out: "0\n0\n0\n1\n"},
+	{name: "eq_hex_field", src: `$1 == 31`, in: "0x1F\n0x1G\n31", out: "0x1F\n31\n"},
+	{name: "uninit_vars", src: `BEGIN { print (x==y), (x<y), (x<=y), (x!=y), (x>y), (x>=y) }`, out: "1 0 1 0 0 1\n"},
+	{name: "uninit_vs_zero_empty", src: `BEGIN { print (x==0), (x==""), (x<1), (x<"a"), (x>-1) }`, out: "1 1 1 1 1\n"},
+	{name: "uninit_elements", src: `BEGIN { print (a[1]==a[2]), (a[1]<b[1]), (a[1]==x) }`, out: "1 0 1\n"},
+	{name: "uninit_locals", src: `function f(p, q) { return (p==q) (p<q) (p>=q) } BEGIN { print f() }`, out: "101\n"},
+	{name: "uninit_vs_missing_field", src: `{ print (x==$3), ($3==$4), (x<$3) }`, in: "a b", out: "1 1 0\n"},
 }
 
 func TestCompatComparison(t *testing.T) {
@@ -519,6 +555,17 @@ var regexTests = []interpTest{
 	{name: "regex_notmatch_literal", src: `BEGIN { print "hello" ~ /xyz/ }`, out: "0\n"},
 	{name: "regex_notmatch_op_true", src: `BEGIN { print "hello" !~ /xyz/ }`, out: "1\n"},
 	{name: "regex_notmatch_op_false", src: `BEGIN { print "hello" !~ /ell/ }`, out: "0\n"},
+	{name: "regex_posix_upper", src: `/[[:upper:]]+/ { print match($0, /[[:upper:]]+/), RLENGTH }`, in: "abc\nab CDe\nQ\n", out: "4 2\n1 1\n"},
+	{name: "regex_posix_negated", src: `{ gsub(/[^[:alpha:][:space:]]/, "#"); print }`, in: "a1 b-2 C", out: "a# b## C\n"},
+	{name: "regex_posix_classes", src: `BEGIN {
+		t = "Az5f_\t ~\001"
+		n = split("alpha digit alnum upper lower space blank punct print graph cntrl xdigit", c, " ")
+		for (i = 1; i <= n; i++) {
+			s = ""
+			for (j = 1; j <= length(t); j++) s = s (substr(t, j, 1) ~ ("^[[:" c[i] ":]]$"))
+			print c[i], s
+		}
+	}`, out: "alpha 110100000\ndigit 001000000\nalnum 111100000\nupper 100000000\nlower 010100000\nspace 000001100\nblank 000001100\npunct 000010010\nprint 111110110\ngraph 111110010\ncntrl 000001001\nxdigit 101100000\n"},
 }
 
 func TestCompatRegex(t *testing.T) {
@@ -625,6 +672,10 @@ var stringFuncTests = []interpTest{
 
 	// length
 	{name: "length_field", src: `{ print length, length(), length("buzz"), length("") }`, in: "foo bar", out: "7 7 4 0\n"},
+	{name: "length_bare_pattern", src: `length > 3`, in: "abc\nabcdefg\n", out: "abcdefg\n"},
+	{name: "length_bare_arith", src: `{ x = length; print x, length + 1, length/2, length * 2 - length, -length }`, in: "abcd", out: "4 5 2 4 -4\n"},
+	{name: "length_bare_subscript", src: `{ a[length]++ } END { for (k in a) print k, a[k] }`, in: "ab\ncd\n", out: "2 2\n"},
+	{name: "length_bare_compare", src: `{ print length == 3, length < 5 ? "short" : "long" }`, in: "abc\nabcdefg\n", out: "1 short\n0 long\n"},
 	{name: "length_empty", src: `BEGIN { print length("") }`, out: "0\n"},
 	{name: "length_str", src: `BEGIN { print length("abc") }`, out: "3\n"},
 	{name: "length_long", src: `BEGIN { print length("hello world") }`, out: "11\n"},
@@ -723,6 +774,16 @@ var fieldTests = []interpTest{
 	{name: "field_$1_pow", src: `{ print $1^2 }`, in: "10", out: "100\n"},
 	{name: "field_NF_multiline", src: `{ print NF }`, in: "\na\nc d\ne f g", out: "0\n1\n2\n3\n"},
 	{name: "field_$$0", src: `{ $$0++; print $0 }`, in: "2 3 4", out: "3\n"},
+	{name: "field_fs_posix_punct", src: `BEGIN { FS = "[[:punct:]]" } { print NF, $2, $3 }`, in: "a.b,c d", out: "3 b c d\n"},
+	{name: "fpat_quoted_csv", src: `BEGIN { FPAT = "([^,]+)|(\"[^\"]+\")" } { print NF; for (i = 1; i <= NF; i++) print i ": <" $i ">" }`,
+		in: `1,"a,b",3`, out: "3\n1: <1>\n2: <\"a,b\">\n3: <3>\n"},
+	{name: "fpat_empty_fields", src: `BEGIN { FPAT = "([^,]*)|(\"[^\"]+\")" } { print NF; for (i = 1; i <= NF; i++) print i ": <" $i ">" }`,
+		in: `abc,,"x,y",`, out: "4\n1: <abc>\n2: <>\n3: <\"x,y\">\n4: <>\n"},
+	{name: "fpat_ignores_fs", src: `BEGIN { FS = ","; FPAT = "[0-9]+" } { print NF, $1 + $2 }`, in: "a1,b22 c", out: "2 23\n"},
+	{name: "fpat_field_assign", src: `BEGIN { FPAT = "[^ ]+"; OFS = "-" } { $2 = "x"; print; print NF }`, in: "a  b  c", out: "a-x-c\n3\n"},
+	{name: "fpat_assign_$0", src: `BEGIN { FPAT = "[a-z]+" } { $0 = "1x2yy3"; print NF, $2 }`, in: "ignored", out: "2 yy\n"},
+	{name: "fpat_next_record", src: `{ FPAT = "[0-9]"; print NF }`, in: "a1 b2\nc3d4e5", out: "2\n3\n"},
+	{name: "fpat_cleared", src: `NR == 1 { FPAT = "[0-9]" } NR == 3 { FPAT = "" } { print NF }`, in: "1 2\n34\n5 6", out: "2\n2\n2\n"},
 }
 
 func TestCompatFields(t *testing.T) {
@@ -738,6 +799,11 @@ var nfTests = []interpTest{
 	{name: "NF_assign_2_empty", src: `{ print NF; NF=2; $2="two"; print $0, NF}`, in: "\n", out: "0\n two 2\n"},
 	{name: "NF_assign_3", src: `{ print NF; NF=3; $2="two"; print $0, NF}`, in: "a b c\n", out: "3\na two c 3\n"},
 
+	// NF=0 tests
+	{name: "NF0_clears", src: `{ NF=0; print "[" $0 "]", NF, "[" $1 "]" }`, in: "a b c", out: "[] 0 []\n"},
+	{name: "NF0_$1", src: `{ NF=0; $1="x"; print $0; print NF }`, in: "a b c", out: "x\n1\n"},
+	{name: "NF0_$3", src: `{ NF=0; $3="x"; print $0; print NF }`, in: "a b c", out: "  x\n3\n"},
+
 	// NF=1 tests
 	{name: "NF1_$1_1field", src: `{ NF=1; $1="x"; print $0; print NF }`, in: "a", out: "x\n1\n"},
 	{name: "NF1_$1_2fields", src: `{ NF=1; $1="x"; print $0; print NF }`, in: "a b", out: "x\n1\n"},
@@ -770,6 +836,35 @@ func TestCompatNF(t *testing.T) {
 	runTestCategory(t, nfTests)
 }
 
+// TestCompatEagerFields reruns the field-related categories with records
+// split as they are read, which must not change any output.
+func TestCompatEagerFields(t *testing.T) {
+	config := DefaultVMConfig()
+	config.EagerFields = true
+	categories := []testCategory{
+		{"BeginEnd", beginEndTests},
+		{"Print", printTests},
+		{"StringFuncs", stringFuncTests},
+		{"Fields", fieldTests},
+		{"NF", nfTests},
+		{"SpecialVars", specialVarTests},
+		{"RS", rsTests},
+	}
+	for _, cat := range categories {
+		t.Run(cat.name, func(t *testing.T) {
+			for i, tt := range cat.tests {
+				name := tt.name
+				if name == "" {
+					name = generateTestName(tt.src, i)
+				}
+				t.Run(name, func(t *testing.T) {
+					runCompatTestConfig(t, tt, config)
+				})
+			}
+		})
+	}
+}
+
 // =============================================================================
 // Special Variable Tests
 // =============================================================================
@@ -786,7 +881,13 @@ BEGIN {
 	{name: "FNR_assign", src: `BEGIN { FNR = 123; print FNR }`, out: "123\n"},
 	{name: "FNR_print", src: `{ print FNR, $0 }`, in: "a\nb\nc", out: "1 a\n2 b\n3 c\n"},
 	{name: "NR_FNR_END", src: `{ print NR, FNR } END { print NR, FNR }`, in: "a\nb\nc\n", out: "1 1\n2 2\n3 3\n3 3\n"},
+	{name: "fields_END", src: `END { print $1, NF }`, in: "a b\nc d", out: "c 2\n"},
+	{name: "record_END", src: `{ n++ } END { print $0; print NF }`, in: "a b\nc d e\n", out: "c d e\n3\n"},
+	{name: "assign_record_END", src: `END { $0 = "x y z"; print NF, $2 }`, in: "a b\n", out: "3 y\n"},
+	{name: "assign_field_END", src: `END { $2 = "z"; print; print NF }`, in: "a b c\n", out: "a z c\n3\n"},
 	{name: "FS_assign", src: `BEGIN { print "|" FS "|"; FS="," } { print $1, $2 }`, in: "a b\na,b\nx,,y", out: "| |\na b \na b\nx \n"},
+	{name: "FS_assign_next_record", src: `NR == 1 { FS = ":" } { print $1, NF }`, in: "a:b c\nd:e f", out: "a:b 2\nd 2\n"},
+	{name: "FS_assign_resplit", src: `{ FS = ":"; $0 = $0; print $1 }`, in: "a:b c\nd:e f", out: "a\nd\n"},
 	{name: "NR_assign", src: `BEGIN { NR = 123; print NR }`, out: "123\n"},
 	{name: "NR_print", src: `{ print NR, $0 }`, in: "a\nb\nc", out: "1 a\n2 b\n3 c\n"},
 	{name: "OFMT", src: `
@@ -895,6 +996,41 @@ function f4(d) { f5(d) }
 function f5(i) { i[1]=42 }
 BEGIN { x[1]=3; f5(x); print x[1] }
 `, out: "42\n"},
+	{name: "func_deep_array_ref", src: `
+function f1(a, d) { f2(a, d+1) }
+function f2(a, d) { f3(a, d+1) }
+function f3(a, d) { f4(a, d+1) }
+function f4(a, d) { f5(a, d+1) }
+function f5(a, d) { f6(a, d+1) }
+function f6(a, d) { f7(a, d+1) }
+function f7(a, d) { f8(a, d+1) }
+function f8(a, d) { f9(a, d+1) }
+function f9(a, d) { f10(a, d+1) }
+function f10(a, d) { a["depth"] = d; delete a["gone"] }
+BEGIN { x["gone"]; f1(x, 1); print x["depth"], length(x) }
+`, out: "10 1\n"},
+	{name: "func_deep_array_untyped", src: `
+BEGIN { p(z); print length(z), z["leaf"] }
+function p(a) { q(a) }
+function q(b) { r(b) }
+function r(c) { s(c) }
+function s(d) { d["leaf"] = "set" }
+`, out: "1 set\n"},
+	{name: "func_recursive_array_accum", src: `
+function walk(acc, n) { if (n == 0) return; acc[n] = n * n; acc["sum"] += n; walk(acc, n - 1) }
+BEGIN { walk(r, 200); print length(r), r["sum"], r[1], r[200] }
+`, out: "201 20100 1 40000\n"},
+	{name: "func_recursive_local_array", src: `
+function count(n,   seen) { fill(seen, n); return length(seen) }
+function fill(a, n) { if (n) { a[n]; fill(a, n - 1) } }
+function nest(a, n,   inner) { if (n == 0) { a["leaf"]; return } nest(inner, n - 1); for (k in inner) a[k n] }
+BEGIN { print count(30), count(3); nest(r, 3); for (k in r) print k }
+`, out: "30 3\nleaf123\n"},
+	{name: "func_mutual_recursion_array", src: `
+function even(a, n) { a["even"]++; if (n) odd(a, n - 1) }
+function odd(a, n) { a["odd"]++; if (n) even(a, n - 1) }
+BEGIN { even(c, 99); print c["even"], c["odd"] }
+`, out: "50 50\n"},
 }
 
 func TestCompatFunctions(t *testing.T) {
@@ -937,6 +1073,7 @@ var syntaxErrorTests = []interpTest{
 	{name: "unexpected_char", src: "BEGIN { ` }", err: "expected expression"},
 	{name: "incr_nonlvalue", src: "BEGIN { ++3 }", err: "expected lvalue"},
 	{name: "assign_nonlvalue", src: "BEGIN { rand() = 1 }", err: "left side of assignment"},
+	{name: "assign_ternary", src: "BEGIN { (1 ? a : b) = 2 }", err: "left side of assignment"},
 }
 
 func TestCompatSyntaxErrors(t *testing.T) {
@@ -949,12 +1086,22 @@ func TestCompatSyntaxErrors(t *testing.T) {
 
 var conversionTests = []interpTest{
 	{name: "numbers", src: `BEGIN { print 1, 1., .1, 1e0, -1, 1e }`, out: "1 1 0.1 1 -1 1\n"},
+	{name: "large_integers", src: `BEGIN { print 1e15, 2^53, 123456789012345, -2^62 }`, out: "1000000000000000 9007199254740992 123456789012345 -4611686018427387904\n"},
+	{name: "large_integers_str", src: `BEGIN { x = 2^53; print length(x ""), (x "" == "9007199254740992"), 1e15 "" }`, out: "16 1 1000000000000000\n"},
+	{name: "large_non_integers", src: `BEGIN { print 2^63, 1e30, 1e15 + 0.5 }`, out: "9.22337e+18 1e+30 1e+15\n"},
+	{name: "large_integer_index", src: `BEGIN { a[2^53] = 1; a[2^63] = 2; for (k in a) n++; print n, a["9007199254740992"], a["9.22337e+18"] }`, out: "2 1 2\n"},
+	{name: "large_literal_index", src: `BEGIN { a[9223372036854775808] = 1; a[9007199254740992] = 2; print a[2^63], a[2^53] }`, out: "1 2\n"},
 	{name: "string_to_num", src: `BEGIN { print "-12"+0, "+12"+0, " \t\r\n7foo"+0, ".5"+0, "5."+0, "+."+0 }`, out: "-12 12 7 0.5 5 0\n"},
 	{name: "exp_notation", src: `BEGIN { print "1e3"+0, "1.2e-1"+0, "1e+1"+0, "1e"+0, "1e+"+0 }`, out: "1000 0.12 10 1 1\n"},
 	{name: "unusual_exp", src: `BEGIN { e="x"; E="X"; print 1e, 1E }`, out: "1x 1X\n"},
 	{name: "exp_concat", src: `BEGIN { e="x"; E="X"; print 1e1e, 1E1E }`, out: "10x 10X\n"},
 	{name: "exp_plus_var", src: `BEGIN { a=2; print 1e+a, 1E+a, 1e+1, 1E+1 }`, out: "12 12 10 10\n"},
 	{name: "exp_minus_var", src: `BEGIN { a=2; print 1e-a, 1E-a, 1e-1, 1E-1 }`, out: "1-2 1-2 0.1 0.1\n"},
+	{name: "convfmt_valid", src: `BEGIN { CONVFMT = "<%.2e>"; OFMT = "%.1f%%"; x = 1.5; print x "", x }`, out: "<1.50e+00> 1.5%\n"},
+	{name: "convfmt_bad_verb", src: `BEGIN { CONVFMT = "%q"; x = 3.5; print x "" }`, err: `invalid CONVFMT "%q"`},
+	{name: "convfmt_no_verb", src: `BEGIN { CONVFMT = "abc" }`, err: `invalid CONVFMT "abc"`},
+	{name: "ofmt_int_verb", src: `BEGIN { OFMT = "%d"; print 2.5 }`, err: `invalid OFMT "%d"`},
+	{name: "ofmt_two_verbs", src: `BEGIN { OFMT = "%g%g"; print 2.5 }`, err: `invalid OFMT "%g%g"`},
 }
 
 func TestCompatConversion(t *testing.T) {
@@ -1013,6 +1160,8 @@ var rsTests = []interpTest{
 	{name: "RS_empty_para", src: `BEGIN { RS=""; FS="\n" }  { printf "%d (%d):\n", NR, NF; for (i=1; i<=NF; i++) print $i }`,
 		in: "1\n2\n\na\nb", out: "1 (2):\n1\n2\n2 (2):\na\nb\n"},
 	{name: "RS_newline", src: `BEGIN { RS="\n" }  { print }`, in: "a\n\nb\nc", out: "a\n\nb\nc\n"},
+	{name: "RS_regex", src: `BEGIN { RS="[0-9]+" }  { print NR ": " $0 " [" RT "]" }`, in: "a12b345c", out: "1: a [12]\n2: b [345]\n3: c []\n"},
+	{name: "RS_regex_newlines", src: `BEGIN { RS="\n+" }  { print }`, in: "a\n\n\nb\nc\n\n", out: "a\nb\nc\n"},
 }
 
 func TestCompatRS(t *testing.T) {
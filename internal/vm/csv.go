@@ -0,0 +1,192 @@
+package vm
+
+import "strings"
+
+// Input and output modes for VMConfig.InputMode and OutputMode.
+const (
+	ModeCSV = "csv"
+	ModeTSV = "tsv"
+)
+
+// csvSplit is a split function reading one CSV record, which spans
+// several lines when a quoted field holds newlines. A "\r\n" line ending
+// is dropped like "\n".
+func csvSplit(data []byte, atEOF bool) (advance int, token []byte, err error) {
+	if atEOF && len(data) == 0 {
+		return 0, nil, nil
+	}
+	inQuotes := false
+	fieldStart := true
+	for i := 0; i < len(data); i++ {
+		c := data[i]
+		if inQuotes {
+			if c == '"' {
+				if i+1 == len(data) && !atEOF {
+					// Can't tell a closing quote from the first of ""
+					return 0, nil, nil
+				}
+				if i+1 < len(data) && data[i+1] == '"' {
+					i++ // Escaped quote: the field goes on
+					continue
+				}
+				inQuotes = false
+			}
+			continue
+		}
+		switch c {
+		case '"':
+			// Only a quote opening a field starts a quoted field
+			inQuotes = fieldStart
+		case '\n':
+			return i + 1, trimCR(data[:i]), nil
+		}
+		fieldStart = c == ','
+	}
+	if atEOF {
+		// An unterminated quoted field runs to end of input
+		return len(data), trimCR(data), nil
+	}
+	return 0, nil, nil
+}
+
+// trimCR drops a trailing '\r' from data.
+func trimCR(data []byte) []byte {
+	if len(data) > 0 && data[len(data)-1] == '\r' {
+		return data[:len(data)-1]
+	}
+	return data
+}
+
+// splitCSV appends the fields of the CSV record line to dst. Quoted
+// fields have their quotes removed and each "" turned into ".
+func splitCSV(line string, dst []string) []string {
+	for {
+		var field string
+		if strings.HasPrefix(line, `"`) {
+			field, line = unquoteCSV(line[1:])
+		} else if i := strings.IndexByte(line, ','); i >= 0 {
+			field, line = line[:i], line[i:]
+		} else {
+			field, line = line, ""
+		}
+		dst = append(dst, field)
+		if line == "" {
+			return dst
+		}
+		line = line[1:] // The comma ending the field
+	}
+}
+
+// unquoteCSV returns the value of a quoted CSV field, given s starting
+// just after its opening quote, and the rest of s from the comma ending
+// the field. Any text between the closing quote and that comma is kept.
+func unquoteCSV(s string) (field, rest string) {
+	// Fast path: no escaped quotes, so the value is a substring
+	if i := strings.IndexByte(s, '"'); i >= 0 && (i+1 == len(s) || s[i+1] == ',') {
+		return s[:i], s[i+1:]
+	}
+
+	var b strings.Builder
+	for {
+		i := strings.IndexByte(s, '"')
+		if i < 0 {
+			// Unterminated: the field runs to the end
+			b.WriteString(s)
+			return b.String(), ""
+		}
+		b.WriteString(s[:i])
+		s = s[i+1:]
+		if !strings.HasPrefix(s, `"`) {
+			break
+		}
+		b.WriteByte('"')
+		s = s[1:]
+	}
+	end := strings.IndexByte(s, ',')
+	if end < 0 {
+		end = len(s)
+	}
+	b.WriteString(s[:end])
+	return b.String(), s[end:]
+}
+
+// quoteCSV returns field as a CSV field to be joined with sep, quoted
+// if it holds sep, a comma, a quote or a line break.
+func quoteCSV(field, sep string) string {
+	if !strings.ContainsAny(field, "\",\r\n") && (sep == "" || !strings.Contains(field, sep)) {
+		return field
+	}
+	return `"` + strings.ReplaceAll(field, `"`, `""`) + `"`
+}
+
+// tsvEscaper and tsvUnescaper convert between TSV field text, where tab,
+// newline, carriage return and backslash are written \t, \n, \r and \\,
+// and the values they stand for.
+var (
+	tsvEscaper   = strings.NewReplacer("\\", `\\`, "\t", `\t`, "\n", `\n`, "\r", `\r`)
+	tsvUnescaper = strings.NewReplacer(`\\`, "\\", `\t`, "\t", `\n`, "\n", `\r`, "\r")
+)
+
+// splitTSV appends the fields of the TSV record line to dst, undoing
+// escapes.
+func splitTSV(line string, dst []string) []string {
+	for {
+		i := strings.IndexByte(line, '\t')
+		if i < 0 {
+			return append(dst, unescapeTSV(line))
+		}
+		dst = append(dst, unescapeTSV(line[:i]))
+		line = line[i+1:]
+	}
+}
+
+// unescapeTSV undoes the escapes in a TSV field.
+func unescapeTSV(field string) string {
+	if strings.IndexByte(field, '\\') < 0 {
+		return field
+	}
+	return tsvUnescaper.Replace(field)
+}
+
+// setHeader takes the fields of the header row line as the column names
+// @"name" looks up. A name shared by several columns refers to the first.
+func (vm *VM) setHeader(line string) {
+	var names []string
+	if vm.inputMode == ModeTSV {
+		names = splitTSV(line, nil)
+	} else {
+		names = splitCSV(line, nil)
+	}
+	vm.headerFields = make(map[string]int, len(names))
+	for i, name := range names {
+		if _, ok := vm.headerFields[name]; !ok {
+			vm.headerFields[name] = i + 1
+		}
+	}
+}
+
+// encodeField returns field as written in mode when fields are joined
+// with sep, quoted for CSV or escaped for TSV, so that splitting the
+// result in the same mode gives the field back.
+func encodeField(mode, field, sep string) string {
+	switch mode {
+	case ModeCSV:
+		return quoteCSV(field, sep)
+	case ModeTSV:
+		return tsvEscaper.Replace(field)
+	}
+	return field
+}
+
+// modeSeparator returns the separator between fields in mode: what print
+// writes in an output mode and what a rebuilt $0 is joined with in an
+// input mode. It is "" if there is no mode and OFS applies.
+func modeSeparator(mode string) string {
+	switch mode {
+	case ModeCSV:
+		return ","
+	case ModeTSV:
+		return "\t"
+	}
+	return ""
+}
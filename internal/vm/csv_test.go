@@ -0,0 +1,197 @@
+package vm
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// runAWKMode runs source over input with the given input mode.
+func runAWKMode(t *testing.T, mode, source, input string) string {
+	t.Helper()
+	config := DefaultVMConfig()
+	config.InputMode = mode
+	vm := NewWithConfig(compileAWK(t, source), config)
+	vm.SetInput(strings.NewReader(input))
+	var output bytes.Buffer
+	vm.SetOutput(&output)
+	if err := vm.Run(); err != nil {
+		t.Fatalf("run error: %v", err)
+	}
+	return output.String()
+}
+
+func TestSplitCSV(t *testing.T) {
+	tests := []struct {
+		line string
+		want []string
+	}{
+		{`a,b,c`, []string{"a", "b", "c"}},
+		{`name,"a,b","line1` + "\n" + `line2"`, []string{"name", "a,b", "line1\nline2"}},
+		{`"say ""hi""",x`, []string{`say "hi"`, "x"}},
+		{`a,,c,`, []string{"a", "", "c", ""}},
+		{`""`, []string{""}},
+		{`"a"b,c`, []string{"ab", "c"}},
+		{`a"b,c`, []string{`a"b`, "c"}},
+		{`"unterminated,x`, []string{"unterminated,x"}},
+	}
+	for _, tt := range tests {
+		if got := splitCSV(tt.line, nil); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("splitCSV(%q) = %q, want %q", tt.line, got, tt.want)
+		}
+	}
+}
+
+func TestVMCSVInput(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+		input  string
+		want   string
+	}{
+		{"quoted fields", `{ for (i = 1; i <= NF; i++) print i ": [" $i "]" }`,
+			"name,\"a,b\",\"line1\nline2\"\n", "1: [name]\n2: [a,b]\n3: [line1\nline2]\n"},
+		{"records", `{ print NR, NF, $2 }`, "a,\"x\ny\",c\nd,e\n", "1 3 x\ny\n2 2 e\n"},
+		{"escaped quotes", `{ print $1 }`, "\"say \"\"hi\"\"\",x\n", "say \"hi\"\n"},
+		{"CRLF", `{ print $2 "|" }`, "a,b\r\nc,d\r\n", "b|\nd|\n"},
+		{"quoted CRLF kept", `{ print length($1) }`, "\"a\r\nb\"\r\n", "4\n"},
+		{"empty fields", `{ print NF, "[" $2 "]" }`, "a,,c\n,\n\n", "3 []\n2 []\n0 []\n"},
+		{"ignores FS", `BEGIN { FS = ";" } { print $2 }`, "a;b,c\n", "c\n"},
+		{"no final newline", `{ print $2 }`, "a,\"b\"", "b\n"},
+		{"round trip", `BEGIN { OFS = "," } { $1 = $1; print }`,
+			"name,\"a,b\",\"line1\nline2\",\"q\"\"q\",plain\n", "name,\"a,b\",\"line1\nline2\",\"q\"\"q\",plain\n"},
+		{"resplit rebuilt", `BEGIN { OFS = "," } { $1 = "x,y"; $0 = $0; print NF "|" $1 }`, "a,b\n", "2|x,y\n"},
+		{"rebuild ignores OFS", `{ $3 = "x"; print; $0 = $0; print NF, $1 }`, "a b,\"c,d\",e\n", "a b,\"c,d\",x\n3 a b\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := runAWKMode(t, ModeCSV, tt.source, tt.input); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	t.Run("long quoted field", func(t *testing.T) {
+		long := strings.Repeat("x\n\"\",", 5000)
+		input := "1,\"" + long + "\",3\n2,b,c\n"
+		got := runAWKMode(t, ModeCSV, `{ print NR, NF, length($2) }`, input)
+		if want := "1 3 20000\n2 3 1\n"; got != want {
+			t.Errorf("got %q, want %q", got, want)
+		}
+	})
+}
+
+func TestVMCSVOutput(t *testing.T) {
+	tests := []struct {
+		name   string
+		mode   string
+		source string
+		want   string
+	}{
+		{"quoting", ModeCSV, `BEGIN { print "a,b", "c" }`, "\"a,b\",c\n"},
+		{"quotes and newlines", ModeCSV, `BEGIN { print "say \"hi\"", "x\ny", "" }`, "\"say \"\"hi\"\"\",\"x\ny\",\n"},
+		{"ignores OFS", ModeCSV, `BEGIN { OFS = ";"; print "a;b", 1.5 }`, "a;b,1.5\n"},
+		{"honours ORS", ModeCSV, `BEGIN { ORS = "\r\n"; print "a", "b" }`, "a,b\r\n"},
+		{"tsv", ModeTSV, `BEGIN { print "a\tb", "c\\d", "e\nf" }`, "a\\tb\tc\\\\d\te\\nf\n"},
+		{"printf unchanged", ModeCSV, `BEGIN { printf "%s,%s\n", "a,b", "c" }`, "a,b,c\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := DefaultVMConfig()
+			config.OutputMode = tt.mode
+			vm := NewWithConfig(compileAWK(t, tt.source), config)
+			var output bytes.Buffer
+			vm.SetOutput(&output)
+			if err := vm.Run(); err != nil {
+				t.Fatalf("run error: %v", err)
+			}
+			if got := output.String(); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestVMHeader(t *testing.T) {
+	tests := []struct {
+		name   string
+		mode   string
+		source string
+		input  string
+		want   string
+	}{
+		{"named field", ModeCSV, `{ print @"value" }`, "id,value\n7,42\n", "42\n"},
+		{"not a record", ModeCSV, `{ print NR, FNR, $0 } END { print NR }`, "a,b\n1,2\n3,4\n", "1 1 1,2\n2 2 3,4\n2\n"},
+		{"quoted name", ModeCSV, `{ print @"first name" }`, "\"first name\",x\nAda,1\n", "Ada\n"},
+		{"dynamic name", ModeCSV, `{ for (i = 1; i <= 2; i++) { c = i == 1 ? "a" : "b"; printf "%s ", @(c) } print "" }`, "a,b\n1,2\n", "1 2 \n"},
+		{"assign", ModeCSV, `BEGIN { OFS = "," } { @"b" = "x,y"; @"a"++; print }`, "a,b\n1,2\n", "2,\"x,y\"\n"},
+		{"duplicate names", ModeCSV, `{ print @"a" }`, "a,a\n1,2\n", "1\n"},
+		{"tsv", ModeTSV, `{ print @"b" }`, "a\tb\n1\tx\\ty\n", "x\ty\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := DefaultVMConfig()
+			config.InputMode = tt.mode
+			config.Header = true
+			vm := NewWithConfig(compileAWK(t, tt.source), config)
+			vm.SetInput(strings.NewReader(tt.input))
+			var output bytes.Buffer
+			vm.SetOutput(&output)
+			if err := vm.Run(); err != nil {
+				t.Fatalf("run error: %v", err)
+			}
+			if got := output.String(); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	errTests := []struct {
+		name   string
+		header bool
+		mode   string
+		source string
+		want   string
+	}{
+		{"unknown name", true, ModeCSV, `{ print @"c" }`, `no field named "c"`},
+		{"no header", false, ModeCSV, `{ print @"a" }`, "without a header row"},
+		{"no input mode", true, "", `{ print }`, "header row needs input mode"},
+	}
+	for _, tt := range errTests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := DefaultVMConfig()
+			config.InputMode = tt.mode
+			config.Header = tt.header
+			vm := NewWithConfig(compileAWK(t, tt.source), config)
+			vm.SetInput(strings.NewReader("a,b\n1,2\n"))
+			vm.SetOutput(&bytes.Buffer{})
+			err := vm.Run()
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("got error %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestVMTSVInput(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+		input  string
+		want   string
+	}{
+		{"fields", `{ print NF, $2 }`, "a b\tc d\te\n", "3 c d\n"},
+		{"escapes", `{ print $1 "|" $2 }`, "a\\tb\tc\\nd\\\\\n", "a\tb|c\nd\\\n"},
+		{"empty fields", `{ print NF }`, "\t\n", "2\n"},
+		{"round trip", `BEGIN { OFS = "\t" } { $1 = $1; print }`, "a\\tb\tc\\\\\n", "a\\tb\tc\\\\\n"},
+		{"rebuild ignores OFS", `BEGIN { OFS = ";" } { $2 = "x y"; print; $0 = $0; print NF }`, "a\tb c\n", "a\tx y\n2\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := runAWKMode(t, ModeTSV, tt.source, tt.input); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
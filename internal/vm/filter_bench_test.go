@@ -2,6 +2,7 @@ package vm_test
 
 import (
 	"bytes"
+	"io"
 	"strings"
 	"testing"
 
@@ -106,3 +107,85 @@ func BenchmarkVMWordCount(b *testing.B) {
 		v.Run()
 	}
 }
+
+func BenchmarkVMConcat(b *testing.B) {
+	source := `{ s = $1 "-" $2 "-" $3; print s }`
+	prog, _ := parser.Parse(source)
+	resolved, _ := semantic.Resolve(prog)
+	compiled, _ := compiler.Compile(prog, resolved)
+
+	var input strings.Builder
+	for i := 0; i < 10000; i++ {
+		input.WriteString("305 66.000497 668 208.818703 423\n")
+	}
+	inputStr := input.String()
+
+	b.ResetTimer()
+	b.ReportAllocs()
+
+	for i := 0; i < b.N; i++ {
+		v := vm.New(compiled)
+		v.SetInput(strings.NewReader(inputStr))
+		var buf bytes.Buffer
+		v.SetOutput(&buf)
+		v.Run()
+	}
+}
+
+func BenchmarkVMSumNR(b *testing.B) {
+	source := `{ s += NR; t += FNR } END { print s, t }`
+	prog, _ := parser.Parse(source)
+	resolved, _ := semantic.Resolve(prog)
+	compiled, _ := compiler.Compile(prog, resolved)
+
+	inputStr := strings.Repeat("x\n", 1000000)
+
+	b.ResetTimer()
+	b.ReportAllocs()
+
+	for i := 0; i < b.N; i++ {
+		v := vm.New(compiled)
+		v.SetInput(strings.NewReader(inputStr))
+		var buf bytes.Buffer
+		v.SetOutput(&buf)
+		v.Run()
+	}
+}
+
+// BenchmarkVMRegexRSLongRecord reads 1MB records ended by a regex RS from a
+// reader returning 4KB at a time, as pipes do, so finding the end of each
+// record takes many calls to the split function.
+func BenchmarkVMRegexRSLongRecord(b *testing.B) {
+	for _, rs := range []string{"\\r?\\n", "\\n+", ";;"} {
+		b.Run(rs, func(b *testing.B) {
+			source := `BEGIN { RS = "` + rs + `" } { n += length($0) } END { print n }`
+			prog, _ := parser.Parse(source)
+			resolved, _ := semantic.Resolve(prog)
+			compiled, _ := compiler.Compile(prog, resolved)
+
+			sep := strings.NewReplacer("\\r?", "", "\\n+", "\n", "\\n", "\n").Replace(rs)
+			inputStr := strings.Repeat(strings.Repeat("x", 1<<20)+sep, 4)
+
+			b.ResetTimer()
+			b.ReportAllocs()
+
+			for i := 0; i < b.N; i++ {
+				v := vm.New(compiled)
+				v.SetInput(&chunkReader{r: strings.NewReader(inputStr), n: 4096})
+				var buf bytes.Buffer
+				v.SetOutput(&buf)
+				v.Run()
+			}
+		})
+	}
+}
+
+// chunkReader returns at most n bytes from each Read.
+type chunkReader struct {
+	r io.Reader
+	n int
+}
+
+func (c *chunkReader) Read(p []byte) (int, error) {
+	return c.r.Read(p[:min(len(p), c.n)])
+}
@@ -7,7 +7,10 @@ import (
 	"bytes"
 	"context"
 	"errors"
+	"fmt"
 	"io"
+	"maps"
+	"os"
 	"runtime"
 	"sync"
 
@@ -31,6 +34,81 @@ type ParallelConfig struct {
 	MaxBufferedChunks int
 }
 
+// ParallelArgs reports whether the parallel executor can read the operands
+// in args (ARGV): it can't apply var=value operands between files.
+func ParallelArgs(args []string) bool {
+	for i := 1; i < len(args); i++ {
+		if _, _, ok := parseAssignOperand(args[i]); ok {
+			return false
+		}
+	}
+	return true
+}
+
+// ArgsInputs returns a reader for each file operand in args (ARGV), for
+// the parallel executor which chunks each input separately.
+// Empty entries are skipped and "-" reads stdin. When there are no file
+// operands the named inputs are returned, followed by stdin. Files are
+// opened on first read, so a missing file is an error only once input is
+// needed. The returned function closes any opened files.
+func ArgsInputs(args []string, named []io.Reader, stdin io.Reader) ([]io.Reader, func()) {
+	var readers []io.Reader
+	var files []*argFile
+	fileOperand := false
+	closeAll := func() {
+		for _, f := range files {
+			if f.f != nil {
+				f.f.Close()
+			}
+		}
+	}
+
+	for i := 1; i < len(args); i++ {
+		arg := args[i]
+		if arg == "" {
+			continue
+		}
+		if _, _, ok := parseAssignOperand(arg); ok {
+			continue
+		}
+		fileOperand = true
+		if arg == "-" {
+			if stdin != nil {
+				readers = append(readers, stdin)
+			}
+			continue
+		}
+		f := &argFile{name: arg}
+		files = append(files, f)
+		readers = append(readers, f)
+	}
+
+	if !fileOperand {
+		readers = append(readers, named...)
+		if stdin != nil {
+			readers = append(readers, stdin)
+		}
+	}
+	return readers, closeAll
+}
+
+// argFile is a file operand that is opened on its first read.
+type argFile struct {
+	name string
+	f    *os.File
+}
+
+func (a *argFile) Read(p []byte) (int, error) {
+	if a.f == nil {
+		f, err := os.Open(a.name)
+		if err != nil {
+			return 0, fmt.Errorf("cannot open file %s: %w", a.name, err)
+		}
+		a.f = f
+	}
+	return a.f.Read(p)
+}
+
 // DefaultParallelConfig returns sensible defaults for parallel execution.
 func DefaultParallelConfig() ParallelConfig {
 	numCPU := runtime.NumCPU()
@@ -97,6 +175,19 @@ func NewParallelExecutor(prog *compiler.Program, vmConfig VMConfig, config Paral
 // Run executes the program in parallel mode.
 // BEGIN and END blocks are executed serially; main loop runs in parallel.
 func (pe *ParallelExecutor) Run(ctx context.Context, input io.Reader, output io.Writer) error {
+	var inputs []io.Reader
+	if input != nil {
+		inputs = append(inputs, input)
+	}
+	return pe.RunInputs(ctx, inputs, output)
+}
+
+// RunInputs is like Run but reads several inputs in order. No record
+// spans two inputs, so an input without a final newline ends its last
+// record there.
+func (pe *ParallelExecutor) RunInputs(ctx context.Context, inputs []io.Reader, output io.Writer) (err error) {
+	defer recoverRegexLimit(&err)
+
 	// Phase 1: Execute BEGIN block (single-threaded)
 	beginVM := NewWithConfig(pe.program, pe.vmConfig)
 	beginVM.SetOutput(output)
@@ -114,9 +205,10 @@ func (pe *ParallelExecutor) Run(ctx context.Context, input io.Reader, output io.
 	// Copy BEGIN state to aggregation state (initial values for workers)
 	pe.copyStateFrom(beginVM)
 
-	// Phase 2: Process input in parallel
-	if input != nil && len(pe.program.Actions) > 0 {
-		if err := pe.processInputParallel(ctx, input, output, beginVM); err != nil {
+	// Phase 2: Process input in parallel; with only END the workers
+	// still count records for NR
+	if len(inputs) > 0 && (len(pe.program.Actions) > 0 || len(pe.program.End) > 0) {
+		if err := pe.processInputParallel(ctx, inputs, output, beginVM); err != nil {
 			if exit, ok := err.(*ExitError); ok {
 				return pe.runEnd(beginVM, output, exit)
 			}
@@ -145,8 +237,11 @@ func (pe *ParallelExecutor) runEnd(vm *VM, output io.Writer, prevExit *ExitError
 			vm.arrays[i] = arr
 		}
 	}
-	vm.specials.NR = pe.totalNR
+	vm.lineNum = pe.totalNR
 	pe.mu.Unlock()
+	if prevExit != nil {
+		vm.exitCode = prevExit.Code
+	}
 
 	vm.SetOutput(output)
 	if err := vm.execute(pe.program.End); err != nil {
@@ -165,7 +260,7 @@ func (pe *ParallelExecutor) runEnd(vm *VM, output io.Writer, prevExit *ExitError
 // processInputParallel processes input using parallel workers.
 func (pe *ParallelExecutor) processInputParallel(
 	ctx context.Context,
-	input io.Reader,
+	inputs []io.Reader,
 	output io.Writer,
 	templateVM *VM,
 ) error {
@@ -186,7 +281,7 @@ func (pe *ParallelExecutor) processInputParallel(
 	// Start chunk reader
 	readerDone := make(chan error, 1)
 	go func() {
-		readerDone <- pe.readChunks(ctx, input, chunks, templateVM.rs)
+		readerDone <- pe.readChunks(ctx, inputs, chunks, templateVM.rs)
 		close(chunks)
 	}()
 
@@ -221,14 +316,15 @@ type inputChunk struct {
 	StartNR int    // Starting NR for this chunk
 }
 
-// readChunks reads input and splits it into chunks at record boundaries.
+// readChunks reads each input in turn and splits it into chunks at record
+// boundaries. A chunk never holds data from two inputs.
 func (pe *ParallelExecutor) readChunks(
 	ctx context.Context,
-	input io.Reader,
+	inputs []io.Reader,
 	chunks chan<- inputChunk,
 	rs string,
 ) error {
-	reader := bufio.NewReaderSize(input, pe.config.ChunkSize)
+	var reader *bufio.Reader
 	chunkID := 0
 	currentNR := 1
 
@@ -242,6 +338,29 @@ func (pe *ParallelExecutor) readChunks(
 	buffer := make([]byte, pe.config.ChunkSize)
 	remainder := make([]byte, 0, 4096) // Pre-allocated remainder buffer
 
+	for _, input := range inputs {
+		if reader == nil {
+			reader = bufio.NewReaderSize(input, pe.config.ChunkSize)
+		} else {
+			reader.Reset(input)
+		}
+		if err := pe.readInputChunks(ctx, reader, chunks, rsByte, buffer, remainder, &chunkID, &currentNR); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readInputChunks sends the chunks of one input, numbering them from
+// *chunkID and their records from *currentNR, and advances both.
+func (pe *ParallelExecutor) readInputChunks(
+	ctx context.Context,
+	reader *bufio.Reader,
+	chunks chan<- inputChunk,
+	rsByte byte,
+	buffer, remainder []byte,
+	chunkID, currentNR *int,
+) error {
 	for {
 		select {
 		case <-ctx.Done():
@@ -273,6 +392,14 @@ func (pe *ParallelExecutor) readChunks(
 		// If not EOF, find last record boundary and save remainder
 		if err != io.EOF {
 			lastRS := bytes.LastIndexByte(data, rsByte)
+			if lastRS < 0 && err == nil {
+				// A record longer than the buffer: read on until it ends
+				remainder = append(remainder, data...)
+				if len(remainder) == len(buffer) {
+					buffer = make([]byte, 2*len(buffer))
+				}
+				continue
+			}
 			if lastRS >= 0 && lastRS < len(data)-1 {
 				// Grow remainder if needed
 				needLen := len(data) - lastRS - 1
@@ -286,13 +413,17 @@ func (pe *ParallelExecutor) readChunks(
 			}
 		}
 
-		// Count records in this chunk for NR tracking
+		// Count records in this chunk for NR tracking; an unterminated
+		// last record ends with its input
 		recordCount := bytes.Count(data, []byte{rsByte})
+		if err == io.EOF && data[len(data)-1] != rsByte {
+			recordCount++
+		}
 
 		chunk := inputChunk{
-			ID:      chunkID,
+			ID:      *chunkID,
 			Data:    make([]byte, len(data)),
-			StartNR: currentNR,
+			StartNR: *currentNR,
 		}
 		copy(chunk.Data, data)
 
@@ -302,8 +433,8 @@ func (pe *ParallelExecutor) readChunks(
 			return ctx.Err()
 		}
 
-		chunkID++
-		currentNR += recordCount
+		*chunkID++
+		*currentNR += recordCount
 
 		if err == io.EOF {
 			return nil
@@ -341,12 +472,14 @@ func (pe *ParallelExecutor) worker(
 
 		// Copy configuration from template
 		vm.fs = templateVM.fs
+		vm.fpat = templateVM.fpat
 		vm.rs = templateVM.rs
 		vm.ofs = templateVM.ofs
 		vm.ors = templateVM.ors
 		vm.convfmt = templateVM.convfmt
 		vm.ofmt = templateVM.ofmt
 		vm.subsep = templateVM.subsep
+		vm.specials.PROCINFO = maps.Clone(templateVM.specials.PROCINFO)
 
 		// Copy scalar state from BEGIN, but NOT aggregated variables
 		// Aggregated vars should start at 0 in each worker for proper summing
@@ -367,8 +500,9 @@ func (pe *ParallelExecutor) worker(
 // processChunk processes a single input chunk and returns results.
 //
 //nolint:gocognit,nestif // Complex but necessary - processes AWK program on chunk
-func (pe *ParallelExecutor) processChunk(vm *VM, chunk inputChunk) WorkerResult {
-	result := WorkerResult{
+func (pe *ParallelExecutor) processChunk(vm *VM, chunk inputChunk) (result WorkerResult) {
+	defer recoverRegexLimit(&result.Err)
+	result = WorkerResult{
 		ChunkID: chunk.ID,
 		StartNR: chunk.StartNR,
 	}
@@ -379,15 +513,18 @@ func (pe *ParallelExecutor) processChunk(vm *VM, chunk inputChunk) WorkerResult
 
 	// Set up input from chunk data
 	scanner := bufio.NewScanner(bytes.NewReader(chunk.Data))
+	// No record is longer than its chunk
+	scanner.Buffer(nil, len(chunk.Data)+1)
+	if pe.program.UsesRT {
+		scanner.Split(vm.trackTerminator(bufio.ScanLines))
+	}
 
 	// Process records
 	recordCount := 0
 	for scanner.Scan() {
 		line := scanner.Text()
 		vm.lineNum = chunk.StartNR + recordCount
-		vm.specials.NR = vm.lineNum
 		vm.fileNum++
-		vm.specials.FNR = vm.fileNum
 
 		vm.setLine(line)
 
@@ -410,11 +547,9 @@ func (pe *ParallelExecutor) processChunk(vm *VM, chunk inputChunk) WorkerResult
 						result.Err = err
 						return result
 					}
-					if vm.pop().AsBool() {
-						vm.rangeActive[i] = true
-						matches = true
-					}
-				} else {
+					vm.rangeActive[i] = vm.pop().AsBool()
+				}
+				if vm.rangeActive[i] {
 					matches = true
 					if err := vm.execute(action.Pattern[1]); err != nil {
 						result.Err = err
@@ -428,9 +563,8 @@ func (pe *ParallelExecutor) processChunk(vm *VM, chunk inputChunk) WorkerResult
 
 			if matches {
 				if action.Body == nil {
-					// Default action: print $0
-					outputBuf.WriteString(vm.line)
-					outputBuf.WriteByte('\n')
+					// Default action: print $0, honouring ORS
+					vm.executePrint(0, compiler.RedirectNone, false, true)
 				} else if len(action.Body) > 0 {
 					if err := vm.execute(action.Body); err != nil {
 						if errors.Is(err, ErrNext) {
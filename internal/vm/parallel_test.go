@@ -3,6 +3,7 @@ package vm
 import (
 	"bytes"
 	"context"
+	"io"
 	"strconv"
 	"strings"
 	"testing"
@@ -90,6 +91,60 @@ func TestParallelSafetyAnalysis(t *testing.T) {
 			wantSafety:  ParallelUnsafe,
 			wantReasons: []UnsafeReason{ReasonSystemCall},
 		},
+		{
+			name:        "spit is unsafe",
+			program:     `{ spit("output.txt", $0 "\n", 1) }`,
+			rs:          "\n",
+			wantSafety:  ParallelUnsafe,
+			wantReasons: []UnsafeReason{ReasonFileOutput},
+		},
+		{
+			name:        "exit is unsafe",
+			program:     `NR == 10 { exit 1 } END { print NR }`,
+			rs:          "\n",
+			wantSafety:  ParallelUnsafe,
+			wantReasons: []UnsafeReason{ReasonExit},
+		},
+		{
+			name:        "FNR is unsafe",
+			program:     `FNR == 1 { print FILENAME }`,
+			rs:          "\n",
+			wantSafety:  ParallelUnsafe,
+			wantReasons: []UnsafeReason{ReasonFileVars, ReasonFileVars},
+		},
+		{
+			name:        "FILENAME in END is unsafe",
+			program:     `{ n++ } END { print FILENAME, n }`,
+			rs:          "\n",
+			wantSafety:  ParallelUnsafe,
+			wantReasons: []UnsafeReason{ReasonFileVars},
+		},
+		{
+			name:        "ARGV is unsafe",
+			program:     `BEGIN { ARGV[1] = "" } { print }`,
+			rs:          "\n",
+			wantSafety:  ParallelUnsafe,
+			wantReasons: []UnsafeReason{ReasonArgs},
+		},
+		{
+			name:        "getline in BEGIN is unsafe",
+			program:     `BEGIN { getline header } { print }`,
+			rs:          "\n",
+			wantSafety:  ParallelUnsafe,
+			wantReasons: []UnsafeReason{ReasonInputGetline},
+		},
+		{
+			name:       "getline from a file in BEGIN is safe",
+			program:    `BEGIN { while ((getline line < "file") > 0) n++ } { print }`,
+			rs:         "\n",
+			wantSafety: ParallelStateless,
+		},
+		{
+			name:       "exit in END only is safe",
+			program:    `{ print } END { exit 1 }`,
+			rs:         "\n",
+			wantSafety: ParallelStateless,
+		},
 		{
 			name:        "file output is unsafe",
 			program:     `{ print $0 > "output.txt" }`,
@@ -227,6 +282,54 @@ func TestParallelExecutor_Filter(t *testing.T) {
 	}
 }
 
+func TestParallelExecutor_DefaultActionORS(t *testing.T) {
+	prog := compileAWK(t, `BEGIN { ORS = "|" } $1 % 2`)
+
+	var inputLines []string
+	for i := 1; i <= 100; i++ {
+		inputLines = append(inputLines, strconv.Itoa(i))
+	}
+	input := strings.NewReader(strings.Join(inputLines, "\n") + "\n")
+
+	var output bytes.Buffer
+
+	config := DefaultParallelConfig()
+	config.NumWorkers = 4
+	config.ChunkSize = 100
+
+	exec := NewParallelExecutor(prog, DefaultVMConfig(), config)
+	if err := exec.Run(context.Background(), input, &output); err != nil {
+		t.Fatalf("Run error: %v", err)
+	}
+
+	var want strings.Builder
+	for i := 1; i <= 100; i += 2 {
+		want.WriteString(strconv.Itoa(i) + "|")
+	}
+	if got := output.String(); got != want.String() {
+		t.Errorf("output = %q, want %q", got, want.String())
+	}
+}
+
+func TestParallelExecutor_RT(t *testing.T) {
+	prog := compileAWK(t, `{ print $1 "[" RT "]" }`)
+
+	input := strings.NewReader("a\nb\r\nc")
+	var output bytes.Buffer
+
+	config := DefaultParallelConfig()
+	config.NumWorkers = 2
+
+	exec := NewParallelExecutor(prog, DefaultVMConfig(), config)
+	if err := exec.Run(context.Background(), input, &output); err != nil {
+		t.Fatalf("Run error: %v", err)
+	}
+
+	if got, want := output.String(), "a[\n]\nb[\r\n]\nc[]\n"; got != want {
+		t.Errorf("output = %q, want %q", got, want)
+	}
+}
+
 func TestParallelExecutor_BEGIN(t *testing.T) {
 	prog := compileAWK(t, `BEGIN { x = 10 } { sum += $1 + x } END { print sum }`)
 
@@ -341,6 +444,32 @@ func TestParallelExecutor_SingleRecord(t *testing.T) {
 	}
 }
 
+func TestParallelExecutor_Inputs(t *testing.T) {
+	prog := compileAWK(t, `{ print NR, $0 } END { print NR }`)
+
+	// The first input has no final newline: its last record must not run
+	// into the next input
+	inputs := []io.Reader{
+		strings.NewReader("a\nb"),
+		strings.NewReader(""),
+		strings.NewReader("c\nd\n"),
+	}
+	var output bytes.Buffer
+
+	config := DefaultParallelConfig()
+	config.NumWorkers = 2
+	config.ChunkSize = 2
+
+	exec := NewParallelExecutor(prog, DefaultVMConfig(), config)
+	if err := exec.RunInputs(context.Background(), inputs, &output); err != nil {
+		t.Fatalf("RunInputs error: %v", err)
+	}
+
+	if got, want := output.String(), "1 a\n2 b\n3 c\n4 d\n4\n"; got != want {
+		t.Errorf("output = %q, want %q", got, want)
+	}
+}
+
 func BenchmarkParallelExecutor_Sum_Small(b *testing.B) {
 	prog := compileAWKBench(b, `{ sum += $1 } END { print sum }`)
 
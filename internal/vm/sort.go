@@ -0,0 +1,176 @@
+package vm
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/kolkov/uawk/internal/compiler"
+	"github.com/kolkov/uawk/internal/types"
+)
+
+// sortOrder is an order for array elements, named as in gawk by a string
+// such as "@val_num_desc": compare indices (ind) or values (val), as
+// numbers (num), strings (str) or numbers before strings (type), in
+// ascending or descending order.
+type sortOrder struct {
+	byValue bool
+	kind    string // "num", "str" or "type"
+	desc    bool
+}
+
+// parseSortOrder parses a sort order name such as "@ind_str_asc". ok is
+// false if how is not one.
+func parseSortOrder(how string) (order sortOrder, ok bool) {
+	parts := strings.Split(how, "_")
+	if len(parts) != 3 {
+		return sortOrder{}, false
+	}
+	switch parts[0] {
+	case "@ind":
+	case "@val":
+		order.byValue = true
+	default:
+		return sortOrder{}, false
+	}
+	switch parts[1] {
+	case "num", "str", "type":
+		order.kind = parts[1]
+	default:
+		return sortOrder{}, false
+	}
+	switch parts[2] {
+	case "asc":
+	case "desc":
+		order.desc = true
+	default:
+		return sortOrder{}, false
+	}
+	return order, true
+}
+
+// sortEntry is an array element being sorted.
+type sortEntry struct {
+	key   string
+	value types.Value
+}
+
+// sortEntries returns the elements of arr in order. Elements that compare
+// equal are ordered by index as strings, so the result never depends on
+// map iteration order.
+func (vm *VM) sortEntries(arr map[string]types.Value, order sortOrder) []sortEntry {
+	entries := make([]sortEntry, 0, len(arr))
+	for k, v := range arr {
+		entries = append(entries, sortEntry{k, v})
+	}
+	slices.SortFunc(entries, func(a, b sortEntry) int {
+		c := vm.compareEntries(a, b, order)
+		if c == 0 {
+			c = strings.Compare(a.key, b.key)
+		}
+		if order.desc {
+			return -c
+		}
+		return c
+	})
+	return entries
+}
+
+// compareEntries compares two elements in the given order, ignoring its
+// direction.
+func (vm *VM) compareEntries(a, b sortEntry, order sortOrder) int {
+	x, y := types.Str(a.key), types.Str(b.key)
+	if order.byValue {
+		x, y = a.value, b.value
+	}
+	switch order.kind {
+	case "num":
+		return cmp.Compare(x.AsNum(), y.AsNum())
+	case "str":
+		return strings.Compare(x.AsStr(vm.convfmt), y.AsStr(vm.convfmt))
+	}
+	// Numbers, and strings that look numeric, come first
+	xn, xStr := x.IsTrueStr()
+	yn, yStr := y.IsTrueStr()
+	switch {
+	case !xStr && !yStr:
+		return cmp.Compare(xn, yn)
+	case !xStr:
+		return -1
+	case !yStr:
+		return 1
+	}
+	return strings.Compare(x.AsStr(vm.convfmt), y.AsStr(vm.convfmt))
+}
+
+// sortedIn returns the order PROCINFO["sorted_in"] asks for-in loops to
+// visit elements in. ok is false if it is unset or not an order name such
+// as "@ind_str_asc", and loops visit elements in unspecified order.
+func (vm *VM) sortedIn() (order sortOrder, ok bool) {
+	if len(vm.specials.PROCINFO) == 0 {
+		return sortOrder{}, false
+	}
+	how, ok := vm.specials.PROCINFO["sorted_in"]
+	if !ok {
+		return sortOrder{}, false
+	}
+	return parseSortOrder(how.AsStr(vm.convfmt))
+}
+
+// forInSorted runs the body of a for-in loop over arr for each index in
+// order, assigning it to the loop variable. The order is fixed when the
+// loop starts; elements deleted by the body before they are reached are
+// skipped.
+func (vm *VM) forInSorted(arr map[string]types.Value, order sortOrder, scope compiler.Scope, idx int, body []compiler.Opcode) error {
+	for _, e := range vm.sortEntries(arr, order) {
+		if _, ok := arr[e.key]; !ok {
+			continue
+		}
+		if err := vm.setScalar(scope, idx, types.Str(e.key)); err != nil {
+			return err
+		}
+		if err := vm.execute(body); err != nil {
+			if errors.Is(err, ErrBreak) {
+				return nil
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// builtinAsort implements asort (values) and asorti (indices, when
+// indices is set): it sorts the elements of src in the order how, or the
+// default order if how is empty, and replaces dst, which may be src, with
+// the sorted values or indices at indices 1 to n. Returns n.
+//
+// The default order for asort is "@val_type_asc", numbers before strings,
+// and for asorti "@ind_str_asc".
+func (vm *VM) builtinAsort(src, dst map[string]types.Value, how string, indices bool) (int, error) {
+	name := "asort"
+	order := sortOrder{byValue: true, kind: "type"}
+	if indices {
+		name = "asorti"
+		order = sortOrder{kind: "str"}
+	}
+	if how != "" {
+		var ok bool
+		if order, ok = parseSortOrder(how); !ok {
+			return 0, fmt.Errorf("%s: invalid sort order %q", name, how)
+		}
+	}
+
+	entries := vm.sortEntries(src, order)
+	clear(dst)
+	for i, e := range entries {
+		v := e.value
+		if indices {
+			v = types.Str(e.key)
+		}
+		dst[strconv.Itoa(i+1)] = v
+	}
+	return len(entries), nil
+}
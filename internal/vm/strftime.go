@@ -0,0 +1,167 @@
+package vm
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// defaultStrftimeFormat is the format strftime() uses when called without
+// one, matching date(1) in the C locale.
+const defaultStrftimeFormat = "%a %b %e %H:%M:%S %Z %Y"
+
+// strftime formats t using C strftime directives in the C locale. The E
+// and O modifiers are accepted and ignored; an unknown directive is copied
+// as it is, and so is a trailing lone %.
+func strftime(t time.Time, format string) string {
+	var sb strings.Builder
+	for i := 0; i < len(format); i++ {
+		c := format[i]
+		if c != '%' || i+1 == len(format) {
+			sb.WriteByte(c)
+			continue
+		}
+		i++
+		if (format[i] == 'E' || format[i] == 'O') && i+1 < len(format) {
+			i++
+		}
+		writeDirective(&sb, t, format[i])
+	}
+	return sb.String()
+}
+
+// writeDirective writes the expansion of the strftime directive %d for t.
+func writeDirective(sb *strings.Builder, t time.Time, d byte) {
+	switch d {
+	case 'a':
+		sb.WriteString(t.Format("Mon"))
+	case 'A':
+		sb.WriteString(t.Format("Monday"))
+	case 'b', 'h':
+		sb.WriteString(t.Format("Jan"))
+	case 'B':
+		sb.WriteString(t.Format("January"))
+	case 'c':
+		sb.WriteString(strftime(t, "%a %b %e %H:%M:%S %Y"))
+	case 'C':
+		fmt.Fprintf(sb, "%02d", t.Year()/100)
+	case 'd':
+		fmt.Fprintf(sb, "%02d", t.Day())
+	case 'D', 'x':
+		sb.WriteString(strftime(t, "%m/%d/%y"))
+	case 'e':
+		fmt.Fprintf(sb, "%2d", t.Day())
+	case 'F':
+		sb.WriteString(strftime(t, "%Y-%m-%d"))
+	case 'g':
+		year, _ := t.ISOWeek()
+		fmt.Fprintf(sb, "%02d", year%100)
+	case 'G':
+		year, _ := t.ISOWeek()
+		sb.WriteString(strconv.Itoa(year))
+	case 'H':
+		fmt.Fprintf(sb, "%02d", t.Hour())
+	case 'I':
+		fmt.Fprintf(sb, "%02d", hour12(t))
+	case 'j':
+		fmt.Fprintf(sb, "%03d", t.YearDay())
+	case 'k':
+		fmt.Fprintf(sb, "%2d", t.Hour())
+	case 'l':
+		fmt.Fprintf(sb, "%2d", hour12(t))
+	case 'm':
+		fmt.Fprintf(sb, "%02d", int(t.Month()))
+	case 'M':
+		fmt.Fprintf(sb, "%02d", t.Minute())
+	case 'n':
+		sb.WriteByte('\n')
+	case 'p':
+		sb.WriteString(t.Format("PM"))
+	case 'r':
+		sb.WriteString(strftime(t, "%I:%M:%S %p"))
+	case 'R':
+		sb.WriteString(strftime(t, "%H:%M"))
+	case 's':
+		sb.WriteString(strconv.FormatInt(t.Unix(), 10))
+	case 'S':
+		fmt.Fprintf(sb, "%02d", t.Second())
+	case 't':
+		sb.WriteByte('\t')
+	case 'T', 'X':
+		sb.WriteString(strftime(t, "%H:%M:%S"))
+	case 'u':
+		fmt.Fprintf(sb, "%d", (int(t.Weekday())+6)%7+1)
+	case 'U':
+		// Weeks starting on Sunday; days before the first Sunday are week 0
+		fmt.Fprintf(sb, "%02d", (t.YearDay()+6-int(t.Weekday()))/7)
+	case 'V':
+		_, week := t.ISOWeek()
+		fmt.Fprintf(sb, "%02d", week)
+	case 'w':
+		fmt.Fprintf(sb, "%d", int(t.Weekday()))
+	case 'W':
+		// Weeks starting on Monday; days before the first Monday are week 0
+		fmt.Fprintf(sb, "%02d", (t.YearDay()+6-(int(t.Weekday())+6)%7)/7)
+	case 'y':
+		fmt.Fprintf(sb, "%02d", t.Year()%100)
+	case 'Y':
+		sb.WriteString(strconv.Itoa(t.Year()))
+	case 'z':
+		sb.WriteString(t.Format("-0700"))
+	case 'Z':
+		sb.WriteString(t.Format("MST"))
+	case '%':
+		sb.WriteByte('%')
+	default:
+		sb.WriteByte('%')
+		sb.WriteByte(d)
+	}
+}
+
+// hour12 returns the hour of t on a 12-hour clock, 1 to 12.
+func hour12(t time.Time) int {
+	if h := t.Hour() % 12; h != 0 {
+		return h
+	}
+	return 12
+}
+
+// strftimeTime returns the time of the Unix timestamp ts, with any
+// fraction dropped, in UTC or local time. ok is false if ts is not finite.
+func strftimeTime(ts float64, utc bool) (t time.Time, ok bool) {
+	if math.IsNaN(ts) || math.IsInf(ts, 0) {
+		return time.Time{}, false
+	}
+	t = time.Unix(int64(ts), 0)
+	if utc {
+		return t.UTC(), true
+	}
+	return t.Local(), true
+}
+
+// mktime returns the Unix timestamp of spec, "YYYY MM DD HH MM SS [DST]",
+// in UTC or local time, or -1 if spec is malformed. Out-of-range values
+// are normalized, so month 13 is January of the next year. The DST field
+// is accepted but the zone's own rules decide daylight saving time.
+func mktime(spec string, utc bool) float64 {
+	fields := strings.Fields(spec)
+	if len(fields) != 6 && len(fields) != 7 {
+		return -1
+	}
+	var n [7]int
+	for i, f := range fields {
+		v, err := strconv.Atoi(f)
+		if err != nil {
+			return -1
+		}
+		n[i] = v
+	}
+	loc := time.Local
+	if utc {
+		loc = time.UTC
+	}
+	t := time.Date(n[0], time.Month(n[1]), n[2], n[3], n[4], n[5], 0, loc)
+	return float64(t.Unix())
+}
@@ -2,6 +2,7 @@ package vm
 
 import (
 	"bufio"
+	"context"
 	"errors"
 	"fmt"
 	"io"
@@ -12,8 +13,10 @@ import (
 	"strings"
 	"sync"
 	"time"
+	"unicode/utf8"
 
 	"github.com/kolkov/uawk/internal/compiler"
+	"github.com/kolkov/uawk/internal/lexer"
 	"github.com/kolkov/uawk/internal/runtime"
 	"github.com/kolkov/uawk/internal/types"
 )
@@ -68,6 +71,18 @@ func (e *ExitError) Error() string {
 	return fmt.Sprintf("exit %d", e.Code)
 }
 
+// recoverRegexLimit turns a regex that exceeded its backtracking budget
+// into the error of the enclosing run. Other panics are re-raised.
+func recoverRegexLimit(err *error) {
+	if r := recover(); r != nil {
+		limitErr, ok := r.(*runtime.BacktrackLimitError)
+		if !ok {
+			panic(r)
+		}
+		*err = limitErr
+	}
+}
+
 // VM is the AWK virtual machine.
 type VM struct {
 	program *compiler.Program
@@ -87,10 +102,15 @@ type VM struct {
 	specials *SpecialVars
 
 	// I/O
-	inputReader io.Reader
-	input       *bufio.Scanner
+	inputReader io.Reader      // Standard input: read when ARGV has no file operands, and for "-"
+	input       *bufio.Scanner // Scanner for the current input source
+	inputFile   io.Closer      // Current input file opened from ARGV (nil for inputReader)
+	inputs      []NamedReader  // Named input streams not yet read (SetInputs)
+	argsRead    int            // ARGV operands consumed so far (ARGV[1..argsRead])
+	fileOperand bool           // True once a file operand has been read from ARGV
 	output      io.Writer
 	ioManager   *runtime.IOManager
+	ctx         context.Context // Cancels the run between records and after getline
 
 	// Record state - string-based field storage for zero-copy performance
 	line         string   // Raw line ($0)
@@ -100,8 +120,8 @@ type VM struct {
 	haveFields   bool     // True if fields were parsed (lazy splitting)
 	haveNF       bool     // True if NF was counted (without full split)
 	lineIsStr    bool     // True if $0 was explicitly assigned
-	lineNum      int      // NR
-	fileNum      int      // FNR
+	lineNum      int      // NR, kept here rather than in specials
+	fileNum      int      // FNR, kept here rather than in specials
 
 	// Generation counter for O(1) state invalidation (vs O(n) memset)
 	// Incremented each line - fields from previous lines become "stale"
@@ -121,15 +141,45 @@ type VM struct {
 	ofs     string // Output field separator
 	ors     string // Output record separator
 	fs      string // Input field separator
+	fpat    string // Field pattern; overrides fs when non-empty
 	rs      string // Input record separator
 	subsep  string // Subscript separator
 
-	// Random number generator (for reproducible srand)
+	subsepSafe bool // Escape SUBSEP in multi-dimensional key parts (VMConfig.SubsepSafe)
+	chars      bool // Count characters instead of bytes (VMConfig.Chars)
+
+	thousandsSep string // Digit grouping separator (VMConfig.ThousandsSep)
+	trimFields   bool   // Strip whitespace around fields (VMConfig.TrimFields)
+	squeeze      bool   // Runs of a single-char FS are one separator (VMConfig.SqueezeDelimiters)
+	eagerFields  bool   // Split each record as it is read (VMConfig.EagerFields)
+	inputMode    string // ModeCSV, ModeTSV or "" (VMConfig.InputMode)
+	outputMode   string // ModeCSV, ModeTSV or "" (VMConfig.OutputMode)
+	header       bool   // Read a header row from each input (VMConfig.Header)
+
+	needHeader   bool           // The next main input record is a header row
+	headerFields map[string]int // Field number by header column name
+
+	lineCounts []int // Executions per source line, for profiled programs
+
+	streamRecords map[string]int // Records read by redirected getline, by stream name
+
+	exitCode int // Status of the last exit with an expression, used by a bare exit
+
+	// Delimiter preservation (VMConfig.PreserveDelimiters)
+	preserveDelims bool
+	fieldSeps      []string // Input separators around fields: [0] before $1, [i] after $i
+
+	// Random number generator (for reproducible srand).
+	// Nil until first use unless VMConfig.RandSeed is set; see rng.
 	randSource *rand.Rand
 
+	// Clock for time builtins (VMConfig.Now)
+	now func() time.Time
+
 	// Reusable buffers for performance (reduce allocations)
 	printArgs []types.Value // Reusable args slice for print
 	printBuf  []byte        // Reusable buffer for print output
+	concatBuf []byte        // Reusable buffer for ConcatMulti
 }
 
 // CallFrame represents a function call on the call stack.
@@ -148,6 +198,79 @@ type VMConfig struct {
 	// When true (default), uses AWK/POSIX ERE semantics (slower but compliant).
 	// When false, uses leftmost-first matching (faster, Perl-like).
 	POSIXRegex bool
+
+	// PreserveDelimiters makes rebuilt records reuse the separators found
+	// in the input between unmodified fields instead of OFS, and makes print
+	// of the current record to stdout end with the record's terminator
+	// instead of ORS.
+	PreserveDelimiters bool
+
+	// Now returns the current time. It is the only clock the VM reads:
+	// now(), systime(), strftime() and the default seeds of rand() and
+	// srand() all use it.
+	// If nil, time.Now is used.
+	Now func() time.Time
+
+	// MaxSlurpSize limits the size of a file slurp() reads. 0 uses
+	// runtime.DefaultMaxSlurpSize, negative means no limit.
+	MaxSlurpSize int64
+
+	// MaxOutputFiles limits how many output files are open at once; the
+	// least recently used one is closed (and later reopened for append)
+	// when a program writes to more. 0 uses runtime.DefaultMaxOutputFiles,
+	// a negative value removes the limit.
+	MaxOutputFiles int
+
+	// Environ, if non-nil, is the environment ENVIRON is built from
+	// instead of os.Environ().
+	Environ map[string]string
+
+	// Arrays seeds the global arrays of the same names, as numeric
+	// strings. Names that aren't global arrays in the program are ignored.
+	Arrays map[string]map[string]string
+
+	// RandSeed, if non-nil, is the initial seed of rand(). Otherwise the
+	// generator is seeded from Now when rand() or srand() is first used.
+	RandSeed *int64
+
+	// Chars makes length, index, match and substr count characters
+	// (UTF-8 runes) instead of bytes, and %c write a character.
+	Chars bool
+
+	// SubsepSafe escapes SUBSEP inside the parts of multi-dimensional
+	// keys, so arr[a, b] never collides with another key when the data
+	// itself contains SUBSEP. split(key, parts, SUBSEP) undoes the escaping
+	// for keys built this way.
+	SubsepSafe bool
+
+	// ThousandsSep, if set, separates groups of three digits when print
+	// outputs an integer-valued number, and for printf's ' flag.
+	ThousandsSep string
+
+	// TrimFields strips leading and trailing ASCII whitespace from each
+	// field after splitting.
+	TrimFields bool
+
+	// SqueezeDelimiters treats runs of a single-character FS as one
+	// separator, ignoring them at the start and end of the record.
+	SqueezeDelimiters bool
+
+	// EagerFields splits each record when it is read rather than lazily
+	// on first field access.
+	EagerFields bool
+
+	// InputMode, if ModeCSV or ModeTSV, reads records and fields as CSV
+	// or TSV instead of splitting them with RS and FS.
+	InputMode string
+
+	// Header, with an InputMode, reads the first record of each input as
+	// column names rather than as a record, so that @"name" refers to the
+	// field under the column name.
+	Header bool
+
+	// OutputMode, if ModeCSV or ModeTSV, makes print join its arguments
+	// with commas or tabs instead of OFS, quoting or escaping them.
+	OutputMode string
 }
 
 // DefaultVMConfig returns the default configuration (POSIX compliant).
@@ -168,10 +291,8 @@ type SpecialVars struct {
 	CONVFMT  string
 	ENVIRON  *LazyEnviron // Lazy-loaded for performance
 	FILENAME string
-	FNR      int
 	FS       string
 	NF       int
-	NR       int
 	OFMT     string
 	OFS      string
 	ORS      string
@@ -179,11 +300,19 @@ type SpecialVars struct {
 	RS       string
 	RSTART   int
 	SUBSEP   string
+	ERRNO    string // Message of the last failed slurp or spit
+	RT       string // Terminator that ended the current input record
+	FPAT     string // Regex matching each field, used instead of FS if set
+
+	// PROCINFO starts empty; PROCINFO["sorted_in"] orders for-in loops
+	PROCINFO map[string]types.Value
 }
 
 // LazyEnviron provides lazy loading of environment variables.
 // os.Environ() is only called on first access, reducing VM creation overhead
 // by 40-60% when ENVIRON is not used (common case for most AWK programs).
+// When created from an explicit map, the process environment is never read,
+// so a VM can run where there is no ambient OS access (WASM, sandboxes).
 //
 // Alternative approaches for future consideration:
 //   - Configurable: VMConfig.EagerENVIRON flag for explicit control
@@ -194,6 +323,7 @@ type SpecialVars struct {
 //   - With ENVIRON: ~40μs one-time cost, then 1.5ns per access
 type LazyEnviron struct {
 	once sync.Once
+	env  map[string]string // Explicit source; nil means os.Environ()
 	data map[string]types.Value
 }
 
@@ -202,9 +332,22 @@ func NewLazyEnviron() *LazyEnviron {
 	return &LazyEnviron{}
 }
 
+// NewLazyEnvironFrom creates a LazyEnviron holding env instead of the
+// process environment.
+func NewLazyEnvironFrom(env map[string]string) *LazyEnviron {
+	return &LazyEnviron{env: env}
+}
+
 // Get returns the environment map, loading it on first access.
 func (le *LazyEnviron) Get() map[string]types.Value {
 	le.once.Do(func() {
+		if le.env != nil {
+			le.data = make(map[string]types.Value, len(le.env))
+			for k, v := range le.env {
+				le.data[k] = types.Str(v)
+			}
+			return
+		}
 		le.data = make(map[string]types.Value)
 		for _, e := range os.Environ() {
 			if idx := strings.IndexByte(e, '='); idx >= 0 {
@@ -244,16 +387,48 @@ func NewWithConfig(prog *compiler.Program, config VMConfig) *VM {
 		arrays:     make([]map[string]types.Value, prog.NumArrays),
 		output:     os.Stdout,
 		ioManager:  runtime.NewIOManager(),
+		ctx:        context.Background(),
 		regexes:    make([]*runtime.Regex, len(prog.Regexes)),
 		regexCache: runtime.NewRegexCacheWithConfig(1000, regexConfig),
 		specials:   newSpecialVars(),
-		randSource: rand.New(rand.NewSource(time.Now().UnixNano())),
+
+		preserveDelims: config.PreserveDelimiters,
+		now:            config.Now,
+		subsepSafe:     config.SubsepSafe,
+		chars:          config.Chars,
+		thousandsSep:   config.ThousandsSep,
+		trimFields:     config.TrimFields,
+		squeeze:        config.SqueezeDelimiters,
+		eagerFields:    config.EagerFields,
+		inputMode:      config.InputMode,
+		outputMode:     config.OutputMode,
+		header:         config.Header,
+	}
+	if vm.now == nil {
+		vm.now = time.Now
+	}
+	if config.MaxOutputFiles != 0 {
+		vm.ioManager.SetMaxOutputFiles(config.MaxOutputFiles)
+	}
+	if config.MaxSlurpSize != 0 {
+		vm.ioManager.SetMaxSlurpSize(config.MaxSlurpSize)
+	}
+	if config.Environ != nil {
+		vm.specials.ENVIRON = NewLazyEnvironFrom(config.Environ)
+	}
+	if config.RandSeed != nil {
+		vm.randSource = rand.New(rand.NewSource(*config.RandSeed))
 	}
 
 	// Initialize arrays
 	for i := range vm.arrays {
 		vm.arrays[i] = make(map[string]types.Value)
 	}
+	for i, name := range prog.ArrayNames {
+		for key, value := range config.Arrays[name] {
+			vm.arrays[i][key] = types.NumStr(value)
+		}
+	}
 
 	// Initialize string-based fields with pre-allocated capacity
 	vm.fieldsStr = make([]string, 0, baseFieldCapacity)    // 0-indexed: [0]=$1, [1]=$2, etc.
@@ -402,16 +577,17 @@ func (vm *VM) growStack() {
 // ENVIRON is lazy-loaded on first access to avoid os.Environ() overhead.
 func newSpecialVars() *SpecialVars {
 	return &SpecialVars{
-		ARGC:    0,
-		ARGV:    make(map[string]types.Value),
-		CONVFMT: "%.6g",
-		ENVIRON: NewLazyEnviron(), // Lazy: os.Environ() called only when accessed
-		FS:      " ",
-		OFMT:    "%.6g",
-		OFS:     " ",
-		ORS:     "\n",
-		RS:      "\n",
-		SUBSEP:  "\034",
+		ARGC:     0,
+		ARGV:     make(map[string]types.Value),
+		CONVFMT:  "%.6g",
+		ENVIRON:  NewLazyEnviron(), // Lazy: os.Environ() called only when accessed
+		PROCINFO: make(map[string]types.Value),
+		FS:       " ",
+		OFMT:     "%.6g",
+		OFS:      " ",
+		ORS:      "\n",
+		RS:       "\n",
+		SUBSEP:   "\034",
 	}
 }
 
@@ -422,36 +598,63 @@ func (vm *VM) syncFromSpecials() {
 	vm.ofs = vm.specials.OFS
 	vm.ors = vm.specials.ORS
 	vm.fs = vm.specials.FS
+	vm.fpat = vm.specials.FPAT
 	vm.rs = vm.specials.RS
 	vm.subsep = vm.specials.SUBSEP
 }
 
-// SetInput sets the input reader.
+// rng returns the random number generator, seeding it from the clock
+// on first use so that creating a VM doesn't read the time.
+func (vm *VM) rng() *rand.Rand {
+	if vm.randSource == nil {
+		vm.randSource = rand.New(rand.NewSource(vm.now().UnixNano()))
+	}
+	return vm.randSource
+}
+
+// SetInput sets the input reader. It is also what getline reads
+// from "/dev/stdin" or "-".
 func (vm *VM) SetInput(r io.Reader) {
 	vm.inputReader = r
+	vm.ioManager.SetStdin(r)
 	// Scanner is set up lazily in processInput to allow BEGIN to set RS
 }
 
-// setupScanner creates a scanner with the current RS setting.
-func (vm *VM) setupScanner() {
-	if vm.inputReader == nil {
-		return
-	}
-	vm.input = bufio.NewScanner(vm.inputReader)
+// NamedReader is an input stream together with the FILENAME it is read as.
+type NamedReader struct {
+	Name string
+	R    io.Reader
+}
 
-	// Configure split function based on RS
-	if vm.rs == "\n" {
-		// Default: split on newlines (default scanner behavior)
-		return
-	}
+// SetInputs sets named input streams, read in order before the input reader
+// when ARGV has no file operands. FILENAME is set and FNR reset for each.
+func (vm *VM) SetInputs(inputs []NamedReader) {
+	vm.inputs = inputs
+}
 
-	if vm.rs == "" {
+// setupScanner creates a scanner for r with the current RS setting.
+// It fails only for a multi-character RS that is not a valid regex.
+func (vm *VM) setupScanner(r io.Reader) error {
+	// Configure split function based on RS
+	// Default: split on newlines (default scanner behavior)
+	split := bufio.ScanLines
+	if vm.inputMode == ModeCSV {
+		// Records are CSV rows, which may span lines; RS is ignored
+		split = csvSplit
+	} else if vm.rs == "" {
 		// Paragraph mode: split on blank lines
-		vm.input.Split(vm.paragraphSplit)
-	} else if len(vm.rs) == 1 {
+		split = vm.paragraphSplit
+	} else if len(vm.rs) > 1 {
+		// Multi-character RS is a regular expression, as in gawk
+		re, err := vm.regexCache.Get(vm.rs)
+		if err != nil {
+			return fmt.Errorf("invalid RS %q: %w", vm.rs, err)
+		}
+		split = regexSplit(re)
+	} else if vm.rs != "\n" {
 		// Single character RS
 		sep := vm.rs[0]
-		vm.input.Split(func(data []byte, atEOF bool) (advance int, token []byte, err error) {
+		split = func(data []byte, atEOF bool) (advance int, token []byte, err error) {
 			if atEOF && len(data) == 0 {
 				return 0, nil, nil
 			}
@@ -462,9 +665,75 @@ func (vm *VM) setupScanner() {
 				return len(data), data, nil
 			}
 			return 0, nil, nil
-		})
+		}
+	}
+
+	// Tracking terminators costs a little per record, so only do it
+	// when something needs them
+	if vm.preserveDelims || vm.program.UsesRT {
+		split = vm.trackTerminator(split)
+	}
+	vm.input = runtime.NewScanner(r)
+	vm.input.Split(split)
+	return nil
+}
+
+// trackTerminator wraps split to record the bytes that ended each record
+// (the RS match, or "\r\n" for CRLF lines) in RT. At end of input without
+// a final terminator RT is empty.
+func (vm *VM) trackTerminator(split bufio.SplitFunc) bufio.SplitFunc {
+	return func(data []byte, atEOF bool) (int, []byte, error) {
+		advance, token, err := split(data, atEOF)
+		if token != nil {
+			// token is a subslice of data, so capacities give its end offset
+			end := cap(data) - cap(token) + len(token)
+			// Compare first so the usual unchanged terminator doesn't allocate
+			if term := data[end:advance]; string(term) != vm.specials.RT {
+				vm.specials.RT = string(term)
+			}
+		}
+		return advance, token, err
+	}
+}
+
+// regexSplit returns a split function ending records at each non-empty
+// match of re. A match reaching the end of the data read so far might go
+// on in data not yet read, so it is only accepted at end of input.
+// While a record is incomplete, each call only searches the data from
+// where a match could still start, so long records are read in linear time.
+func regexSplit(re *runtime.Regex) bufio.SplitFunc {
+	from := 0 // Offset in data to search from; no record ends earlier
+	return func(data []byte, atEOF bool) (int, []byte, error) {
+		if atEOF && len(data) == 0 {
+			return 0, nil, nil
+		}
+		from = min(from, len(data))
+		s := string(data[from:])
+		for start := 0; start < len(s); {
+			loc := re.FindStringIndex(s[start:])
+			if loc == nil {
+				break
+			}
+			i, j := start+loc[0], start+loc[1]
+			if i == j {
+				// An empty match can't end a record; look further on
+				start = i + 1
+				continue
+			}
+			if j == len(s) && !atEOF {
+				break
+			}
+			advance, token := from+j, data[:from+i]
+			from = 0
+			return advance, token, nil
+		}
+		if atEOF {
+			from = 0
+			return len(data), data, nil
+		}
+		from = re.SearchResume(data, from)
+		return 0, nil, nil
 	}
-	// For multi-char RS, would need regex matching (not implemented)
 }
 
 // indexOf finds the first occurrence of byte b in data.
@@ -520,9 +789,48 @@ func (vm *VM) paragraphSplit(data []byte, atEOF bool) (advance int, token []byte
 	return 0, nil, nil
 }
 
-// SetOutput sets the output writer.
+// SetOutput sets the output writer. It is also the destination of
+// print > "/dev/stdout" and of what output pipe commands write.
 func (vm *VM) SetOutput(w io.Writer) {
-	vm.output = w
+	vm.ioManager.SetStdout(w)
+	vm.output = vm.ioManager.Stdout()
+}
+
+// SetContext sets the context that cancels the run. Cancellation is
+// checked before each record and after each getline, and kills commands
+// started by pipes, coprocesses and system(); Run then returns ctx.Err().
+func (vm *VM) SetContext(ctx context.Context) {
+	vm.ctx = ctx
+	vm.ioManager.SetContext(ctx)
+}
+
+// LineCounts returns how many times statements and patterns starting on
+// each source line were executed, indexed by line number. It is only
+// populated for programs compiled by compiler.CompileProfiled.
+func (vm *VM) LineCounts() []int {
+	return vm.lineCounts
+}
+
+// Arrays returns a copy of the global arrays by name, with values
+// converted to strings using CONVFMT.
+func (vm *VM) Arrays() map[string]map[string]string {
+	arrays := make(map[string]map[string]string, len(vm.program.ArrayNames))
+	for i, name := range vm.program.ArrayNames {
+		if name == "" {
+			continue
+		}
+		arr := make(map[string]string, len(vm.arrays[i]))
+		for key, value := range vm.arrays[i] {
+			arr[key] = value.AsStr(vm.convfmt)
+		}
+		arrays[name] = arr
+	}
+	return arrays
+}
+
+// SetStderr sets the destination of print > "/dev/stderr".
+func (vm *VM) SetStderr(w io.Writer) {
+	vm.ioManager.SetStderr(w)
 }
 
 // SetArgs sets ARGC and ARGV.
@@ -565,6 +873,10 @@ func (vm *VM) SetVar(name, value string) bool {
 	case "FS":
 		vm.SetFS(value)
 		return true
+	case "FPAT":
+		vm.specials.FPAT = value
+		vm.fpat = value
+		return true
 	case "RS":
 		vm.SetRS(value)
 		return true
@@ -599,10 +911,36 @@ func (vm *VM) SetVar(name, value string) bool {
 	return false
 }
 
-// Run executes the compiled program.
+// Run executes the compiled program. However the program ends, normally,
+// through exit or with an error, all redirected files and pipes are flushed
+// and closed, and command pipes waited for, before Run returns.
 func (vm *VM) Run() error {
+	err := vm.run()
+	vm.closeInput()
+	vm.ioManager.CloseAll()
+	return err
+}
+
+func (vm *VM) run() (err error) {
+	defer recoverRegexLimit(&err)
 	var exitErr *ExitError
 
+	if err := checkNumFormat("CONVFMT", vm.convfmt); err != nil {
+		return err
+	}
+	if err := checkNumFormat("OFMT", vm.ofmt); err != nil {
+		return err
+	}
+	if vm.inputMode != "" && vm.inputMode != ModeCSV && vm.inputMode != ModeTSV {
+		return fmt.Errorf("invalid input mode %q: want %q or %q", vm.inputMode, ModeCSV, ModeTSV)
+	}
+	if vm.outputMode != "" && vm.outputMode != ModeCSV && vm.outputMode != ModeTSV {
+		return fmt.Errorf("invalid output mode %q: want %q or %q", vm.outputMode, ModeCSV, ModeTSV)
+	}
+	if vm.header && vm.inputMode == "" {
+		return fmt.Errorf("header row needs input mode %q or %q", ModeCSV, ModeTSV)
+	}
+
 	// Execute BEGIN blocks
 	if len(vm.program.Begin) > 0 {
 		if err := vm.execute(vm.program.Begin); err != nil {
@@ -614,8 +952,9 @@ func (vm *VM) Run() error {
 		}
 	}
 
-	// Process input (if no exit from BEGIN)
-	if exitErr == nil && vm.inputReader != nil {
+	// Process input (if no exit from BEGIN). Programs consisting only of
+	// BEGIN actions read no input.
+	if exitErr == nil && (len(vm.program.Actions) > 0 || len(vm.program.End) > 0) {
 		if err := vm.processInput(); err != nil {
 			if exit, ok := err.(*ExitError); ok {
 				exitErr = exit
@@ -633,9 +972,6 @@ func (vm *VM) Run() error {
 		return err
 	}
 
-	// Close all files and pipes
-	vm.ioManager.CloseAll()
-
 	// Return the saved exit error if any
 	if exitErr != nil {
 		return exitErr
@@ -658,18 +994,19 @@ func (vm *VM) executeEnd() error {
 
 // processInput reads and processes input records.
 func (vm *VM) processInput() error {
-	// Set up scanner now that BEGIN has run (RS may have been set)
-	vm.setupScanner()
-	if vm.input == nil {
-		return nil
-	}
-
-	for vm.input.Scan() {
-		line := vm.input.Text()
+	for {
+		if err := vm.ctx.Err(); err != nil {
+			return err
+		}
+		line, ok, err := vm.nextRecord()
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return nil
+		}
 		vm.lineNum++
-		vm.specials.NR = vm.lineNum
 		vm.fileNum++
-		vm.specials.FNR = vm.fileNum
 
 		// Use lazy field splitting - fields are only parsed when accessed
 		vm.setLine(line)
@@ -694,12 +1031,11 @@ func (vm *VM) processInput() error {
 					if err := vm.execute(action.Pattern[0]); err != nil {
 						return err
 					}
-					if vm.pop().AsBool() {
-						vm.rangeActive[i] = true
-						matches = true
-					}
-				} else {
-					// Already in range, check end pattern
+					vm.rangeActive[i] = vm.pop().AsBool()
+				}
+				if vm.rangeActive[i] {
+					// In range, check end pattern (also on the starting
+					// record, so a record matching both is a range of one)
 					matches = true
 					if err := vm.execute(action.Pattern[1]); err != nil {
 						return err
@@ -712,16 +1048,17 @@ func (vm *VM) processInput() error {
 
 			if matches {
 				if action.Body == nil {
-					// Default action: print $0
-					fmt.Fprintln(vm.output, vm.line)
+					// Default action: print $0, honouring ORS
+					vm.executePrint(0, compiler.RedirectNone, false, true)
 				} else if len(action.Body) > 0 {
 					if err := vm.execute(action.Body); err != nil {
 						if errors.Is(err, ErrNext) {
 							break // Skip to next record
 						}
 						if errors.Is(err, ErrNextFile) {
-							// Skip remaining records in this file
-							// For single input, this is same as next
+							// Drop the rest of this input, so the next
+							// record comes from the next ARGV entry
+							vm.closeInput()
 							break
 						}
 						return err
@@ -730,8 +1067,133 @@ func (vm *VM) processInput() error {
 			}
 		}
 	}
+}
 
-	return vm.input.Err()
+// nextRecord reads the next main input record. When the current input is
+// exhausted it moves on to the next file operand in ARGV, which is re-read
+// each time so that changes made by the program (delete ARGV[i], ARGC++)
+// are honored. A header row is taken as column names, not returned.
+// Returns false at the end of all input.
+func (vm *VM) nextRecord() (string, bool, error) {
+	for {
+		if vm.input != nil {
+			for vm.input.Scan() {
+				if vm.needHeader {
+					vm.needHeader = false
+					vm.setHeader(vm.input.Text())
+					continue
+				}
+				return vm.input.Text(), true, nil
+			}
+			if err := vm.input.Err(); err != nil {
+				return "", false, err
+			}
+			vm.closeInput()
+		}
+		ok, err := vm.openNextInput()
+		if err != nil || !ok {
+			return "", false, err
+		}
+	}
+}
+
+// openNextInput opens the next input source: the next file operand in
+// ARGV[1..ARGC-1], or the input reader if ARGV contains no file operands.
+// Empty (or deleted) entries are skipped and var=value operands are assigned.
+func (vm *VM) openNextInput() (bool, error) {
+	for vm.argsRead+1 < vm.specials.ARGC {
+		vm.argsRead++
+		arg := vm.specials.ARGV[strconv.Itoa(vm.argsRead)].AsStr(vm.convfmt)
+		if arg == "" {
+			continue
+		}
+		if name, value, ok := parseAssignOperand(arg); ok {
+			vm.SetVar(name, value)
+			continue
+		}
+
+		vm.fileOperand = true
+		if arg == "-" {
+			if vm.inputReader == nil {
+				continue
+			}
+			if err := vm.startInput(vm.inputReader, nil, arg); err != nil {
+				return false, err
+			}
+			return true, nil
+		}
+		f, err := os.Open(arg)
+		if err != nil {
+			return false, fmt.Errorf("cannot open file %s: %w", arg, err)
+		}
+		if err := vm.startInput(f, f, arg); err != nil {
+			return false, err
+		}
+		return true, nil
+	}
+
+	// No file operands: read the named inputs in order, or the input reader once
+	if !vm.fileOperand {
+		if len(vm.inputs) > 0 {
+			in := vm.inputs[0]
+			vm.inputs = vm.inputs[1:]
+			if err := vm.startInput(in.R, nil, in.Name); err != nil {
+				return false, err
+			}
+			return true, nil
+		}
+		vm.fileOperand = true
+		if vm.inputReader != nil {
+			if err := vm.startInput(vm.inputReader, nil, vm.specials.FILENAME); err != nil {
+				return false, err
+			}
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// startInput makes r the current input source, setting FILENAME and
+// resetting FNR. The scanner is created now rather than before BEGIN, so it
+// sees the current RS. On error closer, if any, is closed. With a header
+// row, the first record of each input gives the column names.
+func (vm *VM) startInput(r io.Reader, closer io.Closer, filename string) error {
+	if err := vm.setupScanner(r); err != nil {
+		if closer != nil {
+			closer.Close()
+		}
+		return err
+	}
+	vm.inputFile = closer
+	vm.specials.FILENAME = filename
+	vm.fileNum = 0
+	vm.needHeader = vm.header
+	return nil
+}
+
+// closeInput closes the current input file, if any.
+func (vm *VM) closeInput() {
+	if vm.inputFile != nil {
+		vm.inputFile.Close()
+		vm.inputFile = nil
+	}
+	vm.input = nil
+}
+
+// parseAssignOperand reports whether arg is a command-line assignment
+// operand of the form var=value, returning the name and unescaped value.
+func parseAssignOperand(arg string) (string, string, bool) {
+	name, value, ok := strings.Cut(arg, "=")
+	if !ok || name == "" {
+		return "", "", false
+	}
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		if c != '_' && (c < 'a' || c > 'z') && (c < 'A' || c > 'Z') && (i == 0 || c < '0' || c > '9') {
+			return "", "", false
+		}
+	}
+	return name, lexer.Unescape(value), true
 }
 
 // setLine sets the current line ($0) without parsing fields.
@@ -755,6 +1217,9 @@ func (vm *VM) setLine(line string) {
 		clear(vm.fieldsStrGen)
 	}
 	// NF will be set when ensureFields or countNF is called
+	if vm.eagerFields {
+		vm.ensureFields()
+	}
 }
 
 // ensureFields ensures that fields are parsed from the current line.
@@ -777,19 +1242,38 @@ func (vm *VM) ensureFields() {
 	}
 	// Note: fieldsStrGen is NOT reset - generation tracking handles staleness O(1)
 
-	if vm.line == "" {
+	if vm.inputMode != "" && vm.line != "" {
+		if vm.inputMode == ModeCSV {
+			vm.fieldsStr = splitCSV(vm.line, vm.fieldsStr)
+		} else {
+			vm.fieldsStr = splitTSV(vm.line, vm.fieldsStr)
+		}
+	} else if vm.preserveDelims {
+		vm.splitPreserving()
+	} else if vm.line == "" {
 		vm.numFields = 0
 		vm.specials.NF = 0
 		return
-	}
-
-	if vm.fs == " " {
+	} else if vm.fpat != "" {
+		// FPAT: each match is a field, whatever lies between is not.
+		// As in gawk, an empty match right after a field is skipped.
+		if re, err := vm.regexCache.Get(vm.fpat); err == nil {
+			for _, m := range re.FindAllStringIndex(vm.line, -1) {
+				vm.fieldsStr = append(vm.fieldsStr, vm.line[m[0]:m[1]])
+			}
+		}
+	} else if vm.fs == " " {
 		// Default FS: split on runs of whitespace (zero-copy, reuses slice)
 		vm.splitWhitespace()
+	} else if len(vm.fs) == 1 && vm.squeeze {
+		vm.splitSqueezed(vm.fs[0])
 	} else if len(vm.fs) == 1 {
 		// Single character FS (zero-copy, reuses slice)
 		vm.splitSingleChar(vm.fs[0])
-	} else if vm.fs != "" {
+	} else if vm.fs == "" {
+		// Empty FS: each character is a field (zero-copy)
+		vm.fieldsStr = splitChars(vm.line, vm.chars, vm.fieldsStr)
+	} else {
 		// Regex FS - use coregex via cache
 		re, err := vm.regexCache.Get(vm.fs)
 		if err == nil {
@@ -800,6 +1284,12 @@ func (vm *VM) ensureFields() {
 		}
 	}
 
+	if vm.trimFields {
+		for i, f := range vm.fieldsStr {
+			vm.fieldsStr[i] = strings.Trim(f, " \t\n\r\v\f")
+		}
+	}
+
 	// Ensure fieldsStrGen has capacity for all fields
 	// O(1) amortized - only extends when needed, not every line
 	for len(vm.fieldsStrGen) < len(vm.fieldsStr) {
@@ -810,6 +1300,101 @@ func (vm *VM) ensureFields() {
 	vm.specials.NF = vm.numFields
 }
 
+// splitPreserving splits vm.line like the regular split paths, also
+// recording the separators around each field in vm.fieldSeps so that
+// rebuildLine can reuse them.
+func (vm *VM) splitPreserving() {
+	line := vm.line
+	vm.fieldSeps = vm.fieldSeps[:0]
+	prevEnd := 0
+	add := func(start, end int) {
+		vm.fieldSeps = append(vm.fieldSeps, line[prevEnd:start])
+		vm.fieldsStr = append(vm.fieldsStr, line[start:end])
+		prevEnd = end
+	}
+
+	switch {
+	case line == "":
+		// No fields
+	case vm.fpat != "":
+		re, err := vm.regexCache.Get(vm.fpat)
+		if err != nil {
+			break
+		}
+		for _, m := range re.FindAllStringIndex(line, -1) {
+			add(m[0], m[1])
+		}
+	case vm.fs == " ":
+		i, n := 0, len(line)
+		for {
+			for i < n && asciiSpace[line[i]] {
+				i++
+			}
+			if i >= n {
+				break
+			}
+			start := i
+			for i < n && !asciiSpace[line[i]] {
+				i++
+			}
+			add(start, i)
+		}
+	case len(vm.fs) == 1 && vm.squeeze:
+		sep := vm.fs[0]
+		i, n := 0, len(line)
+		for {
+			for i < n && line[i] == sep {
+				i++
+			}
+			if i >= n {
+				break
+			}
+			start := i
+			for i < n && line[i] != sep {
+				i++
+			}
+			add(start, i)
+		}
+	case len(vm.fs) == 1:
+		start := 0
+		for {
+			j := strings.IndexByte(line[start:], vm.fs[0])
+			if j < 0 {
+				add(start, len(line))
+				break
+			}
+			add(start, start+j)
+			start += j + 1
+		}
+	case vm.fs == "":
+		size := 1
+		for i := 0; i < len(line); i += size {
+			if vm.chars {
+				_, size = utf8.DecodeRuneInString(line[i:])
+			}
+			add(i, i+size)
+		}
+	default:
+		re, err := vm.regexCache.Get(vm.fs)
+		if err != nil {
+			break
+		}
+		// Same field boundaries as Regex.Split
+		beg, end := 0, 0
+		for _, m := range re.FindAllStringIndex(line, -1) {
+			end = m[0]
+			if m[1] != 0 {
+				add(beg, end)
+			}
+			beg = m[1]
+		}
+		if end != len(line) {
+			add(beg, len(line))
+		}
+	}
+	vm.fieldSeps = append(vm.fieldSeps, line[prevEnd:])
+}
+
 // countNF counts the number of fields without creating substrings.
 // This is much faster than ensureFields when only NF is needed.
 // Only works for default FS (whitespace) and single-char FS.
@@ -825,12 +1410,23 @@ func (vm *VM) countNF() {
 		return
 	}
 
+	if vm.inputMode != "" || vm.fpat != "" {
+		// Quoting, escapes and field patterns need a full split
+		vm.ensureFields()
+		return
+	}
 	if vm.fs == " " {
 		// Count whitespace-separated fields
 		vm.numFields = vm.countFieldsWhitespace()
-	} else if len(vm.fs) == 1 {
+	} else if len(vm.fs) == 1 && !vm.squeeze {
 		// Count single-char separated fields
 		vm.numFields = vm.countFieldsSingleChar(vm.fs[0])
+	} else if vm.fs == "" {
+		// One field per character
+		vm.numFields = len(vm.line)
+		if vm.chars {
+			vm.numFields = utf8.RuneCountInString(vm.line)
+		}
 	} else {
 		// Regex FS - need full split
 		vm.ensureFields()
@@ -919,6 +1515,45 @@ func (vm *VM) splitSingleChar(sep byte) {
 	vm.fieldsStr = append(vm.fieldsStr, line)
 }
 
+// splitSqueezed splits vm.line on runs of a single character into
+// vm.fieldsStr, ignoring runs at either end, as for SqueezeDelimiters.
+func (vm *VM) splitSqueezed(sep byte) {
+	line := vm.line
+	for {
+		for len(line) > 0 && line[0] == sep {
+			line = line[1:]
+		}
+		if line == "" {
+			return
+		}
+		idx := strings.IndexByte(line, sep)
+		if idx < 0 {
+			vm.fieldsStr = append(vm.fieldsStr, line)
+			return
+		}
+		vm.fieldsStr = append(vm.fieldsStr, line[:idx])
+		line = line[idx+1:]
+	}
+}
+
+// splitChars appends each character of s to dst as a separate string,
+// for an empty field separator. Characters are bytes, or UTF-8 encoded
+// runes when chars is set. The strings share memory with s.
+func splitChars(s string, chars bool, dst []string) []string {
+	if !chars {
+		for i := 0; i < len(s); i++ {
+			dst = append(dst, s[i:i+1])
+		}
+		return dst
+	}
+	for len(s) > 0 {
+		_, size := utf8.DecodeRuneInString(s)
+		dst = append(dst, s[:size])
+		s = s[size:]
+	}
+	return dst
+}
+
 // splitRecord splits a line into fields immediately.
 // Uses setLine + ensureFields internally.
 func (vm *VM) splitRecord(line string) {
@@ -937,6 +1572,14 @@ func (vm *VM) execute(code []compiler.Opcode) error {
 		case compiler.Nop:
 			// Do nothing
 
+		case compiler.Line:
+			line := int(code[ip])
+			ip++
+			if line >= len(vm.lineCounts) {
+				vm.lineCounts = append(vm.lineCounts, make([]int, line+1-len(vm.lineCounts))...)
+			}
+			vm.lineCounts[line]++
+
 		case compiler.Num:
 			idx := int(code[ip])
 			ip++
@@ -973,7 +1616,15 @@ func (vm *VM) execute(code []compiler.Opcode) error {
 		case compiler.LoadSpecial:
 			idx := int(code[ip])
 			ip++
-			vm.push(vm.getSpecial(idx))
+			// Counting programs read NR or FNR for every record
+			switch idx {
+			case 9: // NR
+				vm.push(types.Num(float64(vm.lineNum)))
+			case 6: // FNR
+				vm.push(types.Num(float64(vm.fileNum)))
+			default:
+				vm.push(vm.getSpecial(idx))
+			}
 
 		case compiler.StoreGlobal:
 			idx := int(code[ip])
@@ -989,7 +1640,9 @@ func (vm *VM) execute(code []compiler.Opcode) error {
 		case compiler.StoreSpecial:
 			idx := int(code[ip])
 			ip++
-			vm.setSpecial(idx, vm.pop())
+			if err := vm.setSpecial(idx, vm.pop()); err != nil {
+				return err
+			}
 
 		case compiler.Field:
 			index := int(vm.peek().AsNum())
@@ -1000,6 +1653,17 @@ func (vm *VM) execute(code []compiler.Opcode) error {
 			ip++
 			vm.push(vm.getField(index))
 
+		case compiler.FieldIndex:
+			name := vm.peek().AsStr(vm.convfmt)
+			index, ok := vm.headerFields[name]
+			if !ok {
+				if vm.headerFields == nil {
+					return fmt.Errorf("field name %q used without a header row", name)
+				}
+				return fmt.Errorf("no field named %q in the header row", name)
+			}
+			vm.replaceTop(types.Num(float64(index)))
+
 		case compiler.StoreField:
 			index := int(vm.pop().AsNum())
 			value := vm.pop()
@@ -1015,9 +1679,9 @@ func (vm *VM) execute(code []compiler.Opcode) error {
 			if v, ok := arr[key]; ok {
 				vm.push(v)
 			} else {
-				// AWK creates the element on access (with empty string value)
-				arr[key] = types.Str("")
-				vm.push(types.Str(""))
+				// AWK creates the element on access, uninitialized
+				arr[key] = types.Null()
+				vm.push(types.Null())
 			}
 
 		case compiler.ArraySet:
@@ -1068,8 +1732,8 @@ func (vm *VM) execute(code []compiler.Opcode) error {
 			if v, ok := arr[key]; ok {
 				vm.push(v)
 			} else {
-				arr[key] = types.Str("")
-				vm.push(types.Str(""))
+				arr[key] = types.Null()
+				vm.push(types.Null())
 			}
 
 		case compiler.ArraySetGlobal:
@@ -1113,7 +1777,9 @@ func (vm *VM) execute(code []compiler.Opcode) error {
 			idx := int(code[ip])
 			ip++
 			v := vm.getSpecial(idx)
-			vm.setSpecial(idx, types.Num(v.AsNum()+amount))
+			if err := vm.setSpecial(idx, types.Num(v.AsNum()+amount)); err != nil {
+				return err
+			}
 
 		case compiler.IncrField:
 			amount := float64(code[ip])
@@ -1170,7 +1836,9 @@ func (vm *VM) execute(code []compiler.Opcode) error {
 			ip++
 			rhs := vm.pop().AsNum()
 			lhs := vm.getSpecial(idx).AsNum()
-			vm.setSpecial(idx, types.Num(vm.applyAugOp(augOp, lhs, rhs)))
+			if err := vm.setSpecial(idx, types.Num(vm.applyAugOp(augOp, lhs, rhs))); err != nil {
+				return err
+			}
 
 		case compiler.AugField:
 			augOp := compiler.AugOp(code[ip])
@@ -1218,17 +1886,30 @@ func (vm *VM) execute(code []compiler.Opcode) error {
 			for i := count - 1; i >= 0; i-- {
 				parts[i] = vm.pop().AsStr(vm.convfmt)
 			}
-			key := strings.Join(parts, vm.subsep)
+			var key string
+			if vm.subsepSafe {
+				key = joinKey(parts, vm.subsep)
+			} else {
+				key = strings.Join(parts, vm.subsep)
+			}
 			vm.push(types.Str(key))
 
 		case compiler.ConcatMulti:
+			// Append the parts straight from the stack into a reused
+			// buffer, so the result string is the only allocation
 			count := int(code[ip])
 			ip++
-			parts := make([]string, count)
-			for i := count - 1; i >= 0; i-- {
-				parts[i] = vm.pop().AsStr(vm.convfmt)
+			buf := vm.concatBuf
+			if cap(buf) > maxPrintBuf {
+				buf = nil
+			}
+			buf = buf[:0]
+			for _, v := range vm.stackData[vm.sp-count : vm.sp] {
+				buf = append(buf, v.AsStr(vm.convfmt)...)
 			}
-			vm.push(types.Str(strings.Join(parts, "")))
+			vm.sp -= count
+			vm.push(types.Str(string(buf)))
+			vm.concatBuf = buf
 
 		case compiler.Add:
 			// Optimized: use typed stack ops to avoid boxing/unboxing overhead
@@ -1499,11 +2180,13 @@ func (vm *VM) execute(code []compiler.Opcode) error {
 			return ErrNextFile
 
 		case compiler.Exit:
-			return &ExitError{Code: 0}
+			// A bare exit keeps the status of an earlier exit, so that
+			// END { exit } after exit 3 in a rule still exits 3
+			return &ExitError{Code: vm.exitCode}
 
 		case compiler.ExitCode:
-			code := int(vm.pop().AsNum())
-			return &ExitError{Code: code}
+			vm.exitCode = int(vm.pop().AsNum())
+			return &ExitError{Code: vm.exitCode}
 
 		case compiler.ForIn:
 			varScope := compiler.Scope(code[ip])
@@ -1518,16 +2201,24 @@ func (vm *VM) execute(code []compiler.Opcode) error {
 			ip++
 
 			arr := vm.getArray(arrScope, arrIdx)
-			for key := range arr {
-				vm.setScalar(varScope, varIdx, types.Str(key))
-				// Execute loop body (code after ForIn until offset)
-				bodyEnd := ip + offset
-				if err := vm.execute(code[ip:bodyEnd]); err != nil {
-					if errors.Is(err, ErrBreak) {
-						break
-					}
+			if order, ok := vm.sortedIn(); ok {
+				if err := vm.forInSorted(arr, order, varScope, varIdx, code[ip:ip+offset]); err != nil {
 					return err
 				}
+			} else {
+				for key := range arr {
+					if err := vm.setScalar(varScope, varIdx, types.Str(key)); err != nil {
+						return err
+					}
+					// Execute loop body (code after ForIn until offset)
+					bodyEnd := ip + offset
+					if err := vm.execute(code[ip:bodyEnd]); err != nil {
+						if errors.Is(err, ErrBreak) {
+							break
+						}
+						return err
+					}
+				}
 			}
 			ip += offset
 
@@ -1578,22 +2269,16 @@ func (vm *VM) execute(code []compiler.Opcode) error {
 				frame.localArrs[i] = make(map[string]types.Value)
 			}
 
-			vm.frames = append(vm.frames, frame)
-
-			// Execute function body
-			if err := vm.execute(fn.Body); err != nil {
-				if errors.Is(err, ErrReturn) {
-					// Return value is on stack
-				} else {
-					vm.frames = vm.frames[:len(vm.frames)-1]
-					return err
-				}
-			} else {
-				// No explicit return - push null
-				vm.push(types.Null())
+			if err := vm.callFunction(frame); err != nil {
+				return err
 			}
 
-			vm.frames = vm.frames[:len(vm.frames)-1]
+		case compiler.CallIndirect:
+			numArgs := int(code[ip])
+			ip++
+			if err := vm.callIndirect(numArgs, code, ip); err != nil {
+				return err
+			}
 
 		case compiler.Return:
 			return ErrReturn
@@ -1646,24 +2331,51 @@ func (vm *VM) execute(code []compiler.Opcode) error {
 			arr := vm.getArray(scope, arrIdx)
 			vm.push(types.Num(float64(len(arr))))
 
+		case compiler.CallCopy:
+			src := vm.getArray(compiler.Scope(code[ip]), int(code[ip+1]))
+			dst := vm.getArray(compiler.Scope(code[ip+2]), int(code[ip+3]))
+			ip += 4
+			vm.push(types.Num(float64(vm.builtinCopy(src, dst))))
+
+		case compiler.CallExtend:
+			dst := vm.getArray(compiler.Scope(code[ip]), int(code[ip+1]))
+			src := vm.getArray(compiler.Scope(code[ip+2]), int(code[ip+3]))
+			ip += 4
+			vm.push(types.Num(float64(vm.builtinExtend(dst, src))))
+
+		case compiler.CallAsort, compiler.CallAsorti:
+			src := vm.getArray(compiler.Scope(code[ip]), int(code[ip+1]))
+			dst := vm.getArray(compiler.Scope(code[ip+2]), int(code[ip+3]))
+			ip += 4
+			n, err := vm.builtinAsort(src, dst, vm.pop().AsStr(vm.convfmt), op == compiler.CallAsorti)
+			if err != nil {
+				return err
+			}
+			vm.push(types.Num(float64(n)))
+
 		case compiler.Print:
 			numArgs := int(code[ip])
 			ip++
 			redirect := compiler.Redirect(code[ip])
 			ip++
-			vm.executePrint(numArgs, redirect, false)
+			record := code[ip] != 0
+			ip++
+			vm.executePrint(numArgs, redirect, false, record)
 
 		case compiler.Printf:
 			numArgs := int(code[ip])
 			ip++
 			redirect := compiler.Redirect(code[ip])
 			ip++
-			vm.executePrint(numArgs, redirect, true)
+			vm.executePrint(numArgs, redirect, true, false)
 
 		case compiler.Getline:
 			redirect := compiler.Redirect(code[ip])
 			ip++
 			result := vm.executeGetline(redirect, nil)
+			if err := vm.ctx.Err(); err != nil {
+				return err
+			}
 			vm.push(types.Num(float64(result)))
 
 		case compiler.GetlineVar:
@@ -1673,7 +2385,13 @@ func (vm *VM) execute(code []compiler.Opcode) error {
 			ip++
 			idx := int(code[ip])
 			ip++
-			result := vm.executeGetlineVar(redirect, scope, idx)
+			result, err := vm.executeGetlineVar(redirect, scope, idx)
+			if err != nil {
+				return err
+			}
+			if err := vm.ctx.Err(); err != nil {
+				return err
+			}
 			vm.push(types.Num(float64(result)))
 
 		case compiler.GetlineField:
@@ -1681,6 +2399,9 @@ func (vm *VM) execute(code []compiler.Opcode) error {
 			ip++
 			fieldIdx := int(vm.pop().AsNum())
 			result := vm.executeGetlineField(redirect, fieldIdx)
+			if err := vm.ctx.Err(); err != nil {
+				return err
+			}
 			vm.push(types.Num(float64(result)))
 
 		case compiler.Halt:
@@ -1922,6 +2643,74 @@ func (vm *VM) execute(code []compiler.Opcode) error {
 	return nil
 }
 
+// callFunction executes a user function in the given frame.
+// The return value is left on the stack.
+func (vm *VM) callFunction(frame CallFrame) error {
+	vm.frames = append(vm.frames, frame)
+
+	// Execute function body
+	err := vm.execute(frame.fn.Body)
+	vm.frames = vm.frames[:len(vm.frames)-1]
+	if err == nil {
+		// No explicit return - push null
+		vm.push(types.Null())
+		return nil
+	}
+	if errors.Is(err, ErrReturn) {
+		// Return value is on stack
+		return nil
+	}
+	return err
+}
+
+// callIndirect implements @f(args): it calls the user-defined or built-in
+// function named by the value pushed before the arguments.
+// Only scalar arguments can be passed; array parameters start empty.
+func (vm *VM) callIndirect(numArgs int, code []compiler.Opcode, ip int) error {
+	args := make([]types.Value, numArgs)
+	for i := numArgs - 1; i >= 0; i-- {
+		args[i] = vm.pop()
+	}
+	name := vm.pop().AsStr(vm.convfmt)
+
+	for i := range vm.program.Functions {
+		fn := &vm.program.Functions[i]
+		if fn.Name != name {
+			continue
+		}
+		if numArgs > len(fn.Params) {
+			return fmt.Errorf("too many arguments in indirect call to %q", name)
+		}
+
+		frame := CallFrame{
+			fn:        fn,
+			ip:        ip,
+			bp:        vm.stackPosition(),
+			locals:    make([]types.Value, fn.NumScalars),
+			localArrs: make([]map[string]types.Value, fn.NumArrays),
+			code:      code,
+		}
+		scalarIdx, arrayIdx := 0, 0
+		for j, isArray := range fn.Arrays {
+			if isArray {
+				if j < numArgs {
+					return fmt.Errorf("indirect call to %q cannot pass array parameter %q", name, fn.Params[j])
+				}
+				frame.localArrs[arrayIdx] = make(map[string]types.Value)
+				arrayIdx++
+				continue
+			}
+			if j < numArgs {
+				frame.locals[scalarIdx] = args[j]
+			}
+			scalarIdx++
+		}
+		return vm.callFunction(frame)
+	}
+
+	return vm.callBuiltinByName(name, args)
+}
+
 // applyAugOp applies an augmented assignment operation.
 func (vm *VM) applyAugOp(op compiler.AugOp, lhs, rhs float64) float64 {
 	switch op {
@@ -2065,11 +2854,40 @@ func (vm *VM) rebuildLine() {
 	// Build line using OFS
 	var buf strings.Builder
 	buf.Grow(len(vm.line)) // Pre-allocate roughly same size
+	if vm.preserveDelims && len(vm.fieldSeps) > 0 {
+		// Reuse input separators between original fields, OFS for new ones
+		orig := len(vm.fieldSeps) - 1
+		buf.WriteString(vm.fieldSeps[0])
+		for i := 0; i < vm.numFields; i++ {
+			if i > 0 {
+				if i < orig {
+					buf.WriteString(vm.fieldSeps[i])
+				} else {
+					buf.WriteString(vm.ofs)
+				}
+			}
+			buf.WriteString(vm.fieldsStr[i])
+		}
+		if vm.numFields == orig {
+			buf.WriteString(vm.fieldSeps[orig])
+		}
+		vm.line = buf.String()
+		return
+	}
+	sep := vm.ofs
+	if vm.inputMode != "" {
+		// Join as the input was split, so $0 splits back into the fields
+		sep = modeSeparator(vm.inputMode)
+	}
 	for i := 0; i < vm.numFields; i++ {
 		if i > 0 {
-			buf.WriteString(vm.ofs)
+			buf.WriteString(sep)
+		}
+		if vm.inputMode != "" {
+			buf.WriteString(encodeField(vm.inputMode, vm.fieldsStr[i], sep))
+		} else {
+			buf.WriteString(vm.fieldsStr[i])
 		}
-		buf.WriteString(vm.fieldsStr[i])
 	}
 	vm.line = buf.String()
 }
@@ -2083,9 +2901,12 @@ func (vm *VM) getArray(scope compiler.Scope, idx int) map[string]types.Value {
 		frame := &vm.frames[len(vm.frames)-1]
 		return frame.localArrs[idx]
 	case compiler.ScopeSpecial:
-		// ARGV or ENVIRON
-		if idx == 2 {
+		// ARGV, ENVIRON or PROCINFO
+		switch idx {
+		case 2:
 			return vm.specials.ARGV
+		case 20:
+			return vm.specials.PROCINFO
 		}
 		return vm.specials.ENVIRON.Get() // Lazy load on first access
 	default:
@@ -2102,7 +2923,7 @@ func (vm *VM) clearArray(scope compiler.Scope, idx int) {
 }
 
 // setScalar sets a scalar variable.
-func (vm *VM) setScalar(scope compiler.Scope, idx int, value types.Value) {
+func (vm *VM) setScalar(scope compiler.Scope, idx int, value types.Value) error {
 	switch scope {
 	case compiler.ScopeGlobal:
 		vm.scalars[idx] = value
@@ -2110,8 +2931,9 @@ func (vm *VM) setScalar(scope compiler.Scope, idx int, value types.Value) {
 		frame := &vm.frames[len(vm.frames)-1]
 		frame.locals[idx] = value
 	case compiler.ScopeSpecial:
-		vm.setSpecial(idx, value)
+		return vm.setSpecial(idx, value)
 	}
+	return nil
 }
 
 // getSpecial returns a special variable value.
@@ -2124,7 +2946,7 @@ func (vm *VM) getSpecial(idx int) types.Value {
 	case 5: // FILENAME
 		return types.Str(vm.specials.FILENAME)
 	case 6: // FNR
-		return types.Num(float64(vm.specials.FNR))
+		return types.Num(float64(vm.fileNum))
 	case 7: // FS
 		return types.Str(vm.specials.FS)
 	case 8: // NF
@@ -2132,7 +2954,7 @@ func (vm *VM) getSpecial(idx int) types.Value {
 		vm.countNF()
 		return types.Num(float64(vm.specials.NF))
 	case 9: // NR
-		return types.Num(float64(vm.specials.NR))
+		return types.Num(float64(vm.lineNum))
 	case 10: // OFMT
 		return types.Str(vm.specials.OFMT)
 	case 11: // OFS
@@ -2147,25 +2969,38 @@ func (vm *VM) getSpecial(idx int) types.Value {
 		return types.Num(float64(vm.specials.RSTART))
 	case 16: // SUBSEP
 		return types.Str(vm.specials.SUBSEP)
+	case 17: // ERRNO
+		return types.Str(vm.specials.ERRNO)
+	case 18: // RT
+		return types.Str(vm.specials.RT)
+	case 19: // FPAT
+		return types.Str(vm.specials.FPAT)
 	default:
 		return types.Null()
 	}
 }
 
-// setSpecial sets a special variable value.
-func (vm *VM) setSpecial(idx int, value types.Value) {
+// setSpecial sets a special variable value. It fails only when CONVFMT or
+// OFMT is given a format that cannot convert a number.
+func (vm *VM) setSpecial(idx int, value types.Value) error {
 	switch idx {
 	case 1: // ARGC
 		vm.specials.ARGC = int(value.AsNum())
 	case 3: // CONVFMT
-		vm.specials.CONVFMT = value.AsStr(vm.convfmt)
-		vm.convfmt = vm.specials.CONVFMT
+		format := value.AsStr(vm.convfmt)
+		if err := checkNumFormat("CONVFMT", format); err != nil {
+			return err
+		}
+		vm.specials.CONVFMT = format
+		vm.convfmt = format
 	case 5: // FILENAME
 		vm.specials.FILENAME = value.AsStr(vm.convfmt)
 	case 6: // FNR
-		vm.specials.FNR = int(value.AsNum())
-		vm.fileNum = vm.specials.FNR
+		vm.fileNum = int(value.AsNum())
 	case 7: // FS
+		// A new FS applies from the next record: split the current one
+		// with the old separator before lazy splitting can pick it up.
+		vm.ensureFields()
 		vm.specials.FS = value.AsStr(vm.convfmt)
 		vm.fs = vm.specials.FS
 	case 8: // NF
@@ -2187,11 +3022,14 @@ func (vm *VM) setSpecial(idx int, value types.Value) {
 		// Rebuild $0 from fieldsStr
 		vm.rebuildLine()
 	case 9: // NR
-		vm.specials.NR = int(value.AsNum())
-		vm.lineNum = vm.specials.NR
+		vm.lineNum = int(value.AsNum())
 	case 10: // OFMT
-		vm.specials.OFMT = value.AsStr(vm.convfmt)
-		vm.ofmt = vm.specials.OFMT
+		format := value.AsStr(vm.convfmt)
+		if err := checkNumFormat("OFMT", format); err != nil {
+			return err
+		}
+		vm.specials.OFMT = format
+		vm.ofmt = format
 	case 11: // OFS
 		vm.specials.OFS = value.AsStr(vm.convfmt)
 		vm.ofs = vm.specials.OFS
@@ -2208,14 +3046,62 @@ func (vm *VM) setSpecial(idx int, value types.Value) {
 	case 16: // SUBSEP
 		vm.specials.SUBSEP = value.AsStr(vm.convfmt)
 		vm.subsep = vm.specials.SUBSEP
+	case 17: // ERRNO
+		vm.specials.ERRNO = value.AsStr(vm.convfmt)
+	case 18: // RT
+		vm.specials.RT = value.AsStr(vm.convfmt)
+	case 19: // FPAT
+		// Like FS, a new FPAT applies from the next record
+		vm.ensureFields()
+		vm.specials.FPAT = value.AsStr(vm.convfmt)
+		vm.fpat = vm.specials.FPAT
 	}
+	return nil
+}
+
+// checkNumFormat reports whether format, the value of the CONVFMT or OFMT
+// variable called name, holds exactly one floating-point conversion
+// (%e, %f or %g with optional flags, width and precision). Anything else
+// would make number-to-string conversions produce garbage.
+func checkNumFormat(name, format string) error {
+	convs := 0
+	for i := 0; i < len(format); i++ {
+		if format[i] != '%' {
+			continue
+		}
+		i++
+		if i < len(format) && format[i] == '%' {
+			continue
+		}
+		for i < len(format) && strings.IndexByte("-+ #0", format[i]) >= 0 {
+			i++
+		}
+		for i < len(format) && format[i] >= '0' && format[i] <= '9' {
+			i++
+		}
+		if i < len(format) && format[i] == '.' {
+			i++
+			for i < len(format) && format[i] >= '0' && format[i] <= '9' {
+				i++
+			}
+		}
+		if i >= len(format) || strings.IndexByte("eEfFgG", format[i]) < 0 {
+			return fmt.Errorf("invalid %s %q: want a single %%e, %%f or %%g conversion", name, format)
+		}
+		convs++
+	}
+	if convs != 1 {
+		return fmt.Errorf("invalid %s %q: want a single %%e, %%f or %%g conversion", name, format)
+	}
+	return nil
 }
 
 // getRegex returns a compiled regex, compiling it lazily.
+// Uses the same regex configuration as dynamic regexes.
 func (vm *VM) getRegex(idx int) *runtime.Regex {
 	if vm.regexes[idx] == nil {
 		pattern := vm.program.Regexes[idx]
-		re, err := runtime.Compile(pattern)
+		re, err := runtime.CompileWithConfig(pattern, vm.regexCache.Config())
 		if err != nil {
 			// Return a regex that never matches
 			re = runtime.MustCompile(`\A\z`)
@@ -2225,9 +3111,10 @@ func (vm *VM) getRegex(idx int) *runtime.Regex {
 	return vm.regexes[idx]
 }
 
-// executePrint executes a print/printf statement.
+// executePrint executes a print/printf statement. record is set when
+// print prints the current record, as print or print $0.
 // Optimized: uses reusable buffers to minimize allocations.
-func (vm *VM) executePrint(numArgs int, redirect compiler.Redirect, isPrintf bool) {
+func (vm *VM) executePrint(numArgs int, redirect compiler.Redirect, isPrintf, record bool) {
 	// Get output destination
 	var out io.Writer = vm.output
 
@@ -2244,6 +3131,8 @@ func (vm *VM) executePrint(numArgs int, redirect compiler.Redirect, isPrintf boo
 			out, err = vm.ioManager.GetOutputFile(dest, true)
 		case compiler.RedirectPipe:
 			out, err = vm.ioManager.GetOutputPipe(dest)
+		case compiler.RedirectCoprocess:
+			out, err = vm.ioManager.GetCoprocessWriter(dest)
 		}
 		if err != nil {
 			// On error, silently use stdout
@@ -2289,122 +3178,126 @@ func (vm *VM) executePrint(numArgs int, redirect compiler.Redirect, isPrintf boo
 		if len(args) == 0 {
 			// print with no args prints $0
 			buf = append(buf, vm.line...)
+		} else if vm.outputMode != "" {
+			// CSV or TSV output: fixed separator, quoted or escaped fields
+			sep := modeSeparator(vm.outputMode)
+			for i, arg := range args {
+				if i > 0 {
+					buf = append(buf, sep...)
+				}
+				s := arg.AsStr(vm.ofmt)
+				if vm.thousandsSep != "" && arg.IsNum() {
+					s = groupDigits(s, vm.thousandsSep)
+				}
+				buf = append(buf, encodeField(vm.outputMode, s, sep)...)
+			}
 		} else {
 			for i, arg := range args {
 				if i > 0 {
 					buf = append(buf, vm.ofs...)
 				}
-				buf = append(buf, arg.AsStr(vm.ofmt)...)
+				if vm.thousandsSep != "" && arg.IsNum() {
+					buf = append(buf, groupDigits(arg.AsStr(vm.ofmt), vm.thousandsSep)...)
+				} else {
+					buf = append(buf, arg.AsStr(vm.ofmt)...)
+				}
 			}
 		}
-		buf = append(buf, vm.ors...)
+		// Only the current record printed to stdout keeps its terminator
+		if vm.preserveDelims && vm.specials.RT != "" && redirect == compiler.RedirectNone && record {
+			buf = append(buf, vm.specials.RT...)
+		} else {
+			buf = append(buf, vm.ors...)
+		}
 
 		out.Write(buf)
 		vm.printBuf = buf[:0] // Save for next call
 	}
 }
 
-// executeGetline executes getline without a target.
-func (vm *VM) executeGetline(redirect compiler.Redirect, _ interface{}) int {
+// readGetline reads the next line for a getline with the given redirect.
+// Returns the line and the getline result: 1 on success, 0 at end of input,
+// -1 on error. Plain getline reads the next main input record.
+func (vm *VM) readGetline(redirect compiler.Redirect) (string, int) {
 	var scanner *bufio.Scanner
+	var source string
 	var err error
 
 	switch redirect {
 	case compiler.RedirectInput:
 		// getline < file
-		source := vm.pop().AsStr(vm.convfmt)
+		source = vm.pop().AsStr(vm.convfmt)
 		scanner, err = vm.ioManager.GetInputFile(source)
 		if err != nil {
-			return -1
+			return "", -1
 		}
 	case compiler.RedirectPipe:
 		// cmd | getline
-		source := vm.pop().AsStr(vm.convfmt)
+		source = vm.pop().AsStr(vm.convfmt)
 		scanner, err = vm.ioManager.GetInputPipe(source)
 		if err != nil {
-			return -1
+			return "", -1
+		}
+	case compiler.RedirectCoprocess:
+		// cmd |& getline
+		source = vm.pop().AsStr(vm.convfmt)
+		scanner, err = vm.ioManager.GetCoprocessReader(source)
+		if err != nil {
+			return "", -1
 		}
 	default:
-		// Regular getline from stdin
-		scanner = vm.input
+		// Regular getline from the main input (ARGV files or stdin)
+		line, ok, err := vm.nextRecord()
+		if err != nil {
+			return "", -1
+		}
+		if !ok {
+			return "", 0
+		}
+		return line, 1
 	}
 
 	if scanner != nil && scanner.Scan() {
-		line := scanner.Text()
+		if vm.streamRecords == nil {
+			vm.streamRecords = make(map[string]int)
+		}
+		vm.streamRecords[source]++
+		return scanner.Text(), 1
+	}
+	return "", 0
+}
+
+// executeGetline executes getline without a target.
+func (vm *VM) executeGetline(redirect compiler.Redirect, _ interface{}) int {
+	line, result := vm.readGetline(redirect)
+	if result == 1 {
 		vm.splitRecord(line)
 		vm.lineNum++
-		vm.specials.NR = vm.lineNum
 		vm.fileNum++
-		vm.specials.FNR = vm.fileNum
-		return 1
 	}
-	return 0
+	return result
 }
 
 // executeGetlineVar executes getline into a variable.
-func (vm *VM) executeGetlineVar(redirect compiler.Redirect, scope compiler.Scope, idx int) int {
-	var scanner *bufio.Scanner
-	var err error
-
-	switch redirect {
-	case compiler.RedirectInput:
-		source := vm.pop().AsStr(vm.convfmt)
-		scanner, err = vm.ioManager.GetInputFile(source)
-		if err != nil {
-			return -1
-		}
-	case compiler.RedirectPipe:
-		source := vm.pop().AsStr(vm.convfmt)
-		scanner, err = vm.ioManager.GetInputPipe(source)
-		if err != nil {
-			return -1
+func (vm *VM) executeGetlineVar(redirect compiler.Redirect, scope compiler.Scope, idx int) (int, error) {
+	line, result := vm.readGetline(redirect)
+	if result == 1 {
+		if err := vm.setScalar(scope, idx, types.Str(line)); err != nil {
+			return result, err
 		}
-	default:
-		scanner = vm.input
-	}
-
-	if scanner != nil && scanner.Scan() {
-		line := scanner.Text()
-		vm.setScalar(scope, idx, types.Str(line))
 		vm.lineNum++
-		vm.specials.NR = vm.lineNum
 		vm.fileNum++
-		vm.specials.FNR = vm.fileNum
-		return 1
 	}
-	return 0
+	return result, nil
 }
 
 // executeGetlineField executes getline into a field.
 func (vm *VM) executeGetlineField(redirect compiler.Redirect, fieldIdx int) int {
-	var scanner *bufio.Scanner
-	var err error
-
-	switch redirect {
-	case compiler.RedirectInput:
-		source := vm.pop().AsStr(vm.convfmt)
-		scanner, err = vm.ioManager.GetInputFile(source)
-		if err != nil {
-			return -1
-		}
-	case compiler.RedirectPipe:
-		source := vm.pop().AsStr(vm.convfmt)
-		scanner, err = vm.ioManager.GetInputPipe(source)
-		if err != nil {
-			return -1
-		}
-	default:
-		scanner = vm.input
-	}
-
-	if scanner != nil && scanner.Scan() {
-		line := scanner.Text()
+	line, result := vm.readGetline(redirect)
+	if result == 1 {
 		vm.setField(fieldIdx, types.Str(line))
 		vm.lineNum++
-		vm.specials.NR = vm.lineNum
 		vm.fileNum++
-		vm.specials.FNR = vm.fileNum
-		return 1
 	}
-	return 0
+	return result
 }
@@ -2,8 +2,18 @@ package vm
 
 import (
 	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"reflect"
 	"strings"
 	"testing"
+	"testing/iotest"
+	"time"
 
 	"github.com/kolkov/uawk/internal/compiler"
 	"github.com/kolkov/uawk/internal/parser"
@@ -213,6 +223,10 @@ func TestVMStrings(t *testing.T) {
 	}{
 		{"literal", `BEGIN { print "hello" }`, "hello\n"},
 		{"concat", `BEGIN { print "hello" " " "world" }`, "hello world\n"},
+		{"concat numbers", `BEGIN { CONVFMT = "%.2f"; x = 0.5; print x "|" 1/3 "|" 7 }`, "0.50|0.33|7\n"},
+		{"concat nested", `BEGIN { a = "a"; print a (a "-" a "-" a) a, length(a a a a a) }`, "aa-a-aa 5\n"},
+		{"concat reused", `BEGIN { for (i = 1; i <= 3; i++) { s = s i "," i } print s; x = "p" "q" "r"; print x }`, "1,12,23,3\npqr\n"},
+		{"concat in call", `function f(s, t) { return s t } BEGIN { print f("a" "b" "c", "d" "e" "f") }`, "abcdef\n"},
 		{"variable", `BEGIN { x = "test"; print x }`, "test\n"},
 	}
 
@@ -416,8 +430,835 @@ func TestVMFields(t *testing.T) {
 			input:  "a b c\n",
 			want:   "c\n",
 		},
+		{
+			name:   "empty FS",
+			source: `BEGIN { FS = "" } { print NF, $1, $3 }`,
+			input:  "abc\n",
+			want:   "3 a c\n",
+		},
+		{
+			name:   "empty FS NF only",
+			source: `BEGIN { FS = "" } { print NF }`,
+			input:  "a b\n\nxy\n",
+			want:   "3\n0\n2\n",
+		},
+		{
+			name:   "empty FS rebuild",
+			source: `BEGIN { FS = ""; OFS = "-" } { $2 = "B"; print }`,
+			input:  "abc\n",
+			want:   "a-B-c\n",
+		},
+		{
+			name:   "FS change with $0 = $0",
+			source: `{ FS = ","; $0 = $0; print NF }`,
+			input:  "a,b,c\n",
+			want:   "3\n",
+		},
+		{
+			name:   "FS change after NF",
+			source: `{ FS = ","; print NF; $0 = $0; print NF, $2 }`,
+			input:  "a,b,c\n",
+			want:   "1\n3 b\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := runAWK(t, tt.source, tt.input)
+			if got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestVMPatterns(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+		input  string
+		want   string
+	}{
+		{
+			name:   "no pattern",
+			source: "{ print $1 }",
+			input:  "a\nb\nc\n",
+			want:   "a\nb\nc\n",
+		},
+		{
+			name:   "NR pattern",
+			source: "NR == 2 { print $0 }",
+			input:  "a\nb\nc\n",
+			want:   "b\n",
+		},
+		{
+			name:   "regex pattern",
+			source: "/b/ { print $0 }",
+			input:  "a\nb\nc\n",
+			want:   "b\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := runAWK(t, tt.source, tt.input)
+			if got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestVMFunctions(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+		want   string
+	}{
+		{
+			name:   "simple function",
+			source: `function add(a, b) { return a + b } BEGIN { print add(1, 2) }`,
+			want:   "3\n",
+		},
+		{
+			name:   "recursive function",
+			source: `function fac(n) { if (n <= 1) return 1; return n * fac(n-1) } BEGIN { print fac(5) }`,
+			want:   "120\n",
+		},
+		{
+			name:   "local variables",
+			source: `function f(a,    local) { local = a * 2; return local } BEGIN { print f(5) }`,
+			want:   "10\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := runAWK(t, tt.source, "")
+			if got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestVMBuiltins(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+		want   string
+	}{
+		{"length string", `BEGIN { print length("hello") }`, "5\n"},
+		{"length empty", `BEGIN { print length("") }`, "0\n"},
+		{"substr 2 arg", `BEGIN { print substr("hello", 2) }`, "ello\n"},
+		{"substr 3 arg", `BEGIN { print substr("hello", 2, 3) }`, "ell\n"},
+		{"index found", `BEGIN { print index("hello", "ll") }`, "3\n"},
+		{"index not found", `BEGIN { print index("hello", "x") }`, "0\n"},
+		{"tolower", `BEGIN { print tolower("HELLO") }`, "hello\n"},
+		{"toupper", `BEGIN { print toupper("hello") }`, "HELLO\n"},
+		{"int", `BEGIN { print int(3.7) }`, "3\n"},
+		{"int negative", `BEGIN { print int(-3.7) }`, "-3\n"},
+		{"sqrt", `BEGIN { print sqrt(4) }`, "2\n"},
+		{"sin 0", `BEGIN { print sin(0) }`, "0\n"},
+		{"cos 0", `BEGIN { print cos(0) }`, "1\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := runAWK(t, tt.source, "")
+			if got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestVMRegexFSClasses(t *testing.T) {
+	const input = "a1 b2\t\tc3,d;E\n"
+	tests := []struct {
+		fs   string
+		want string
+	}{
+		{`[[:space:]]+`, "3|a1|b2|c3,d;E"},
+		{`[[:blank:]]+`, "3|a1|b2|c3,d;E"},
+		{`[[:digit:]]`, "4|a| b|\t\tc|,d;E"},
+		{`[[:alpha:]]`, "6||1 |2\t\t|3,|;|"},
+		{`[[:alnum:]]+`, "6|| |\t\t|,|;|"},
+		{`[[:punct:]]`, "3|a1 b2\t\tc3|d|E"},
+		{`[[:upper:]]`, "2|a1 b2\t\tc3,d;|"},
+		{`[[:lower:]]`, "5||1 |2\t\t|3,|;E"},
+		{`[[:xdigit:]]+`, "6|| |\t\t|,|;|"},
+		{`[[:cntrl:]]+`, "2|a1 b2|c3,d;E"},
+		{`[[:graph:]]+`, "4|| |\t\t|"},
+		{`\t+`, "2|a1 b2|c3,d;E"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.fs, func(t *testing.T) {
+			src := `BEGIN { FS = "` + strings.ReplaceAll(tt.fs, `\`, `\\`) + `" }
+{ s = NF; for (i = 1; i <= NF; i++) s = s "|" $i; print s }`
+			got := runAWK(t, src, input)
+			if got != tt.want+"\n" {
+				t.Errorf("FS %q: got %q, want %q", tt.fs, got, tt.want+"\n")
+			}
+		})
+	}
+}
+
+func TestVMSplit(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+		want   string
+	}{
+		{
+			name:   "default separator",
+			source: `BEGIN { n = split("a b c", arr); print n, arr[1], arr[2], arr[3] }`,
+			want:   "3 a b c\n",
+		},
+		{
+			name:   "custom separator",
+			source: `BEGIN { n = split("a:b:c", arr, ":"); print n, arr[1], arr[2], arr[3] }`,
+			want:   "3 a b c\n",
+		},
+		{
+			name:   "empty separator",
+			source: `BEGIN { n = split("abc", arr, ""); print n, arr[1], arr[2], arr[3] }`,
+			want:   "3 a b c\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := runAWK(t, tt.source, "")
+			if got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestVMCopy(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+		want   string
+	}{
+		{
+			name:   "copies elements",
+			source: `BEGIN { a["x"] = 1; a["y"] = 2; n = copy(a, b); print n, b["x"], b["y"] }`,
+			want:   "2 1 2\n",
+		},
+		{
+			name:   "independent of source",
+			source: `BEGIN { a[1] = "old"; copy(a, b); b[1] = "new"; print a[1], b[1] }`,
+			want:   "old new\n",
+		},
+		{
+			name:   "clears destination",
+			source: `BEGIN { a[1] = 1; b[2] = 2; b[3] = 3; copy(a, b); print length(b), (2 in b) }`,
+			want:   "1 0\n",
+		},
+		{
+			name:   "empty source",
+			source: `BEGIN { b[1] = 1; print copy(a, b), length(b) }`,
+			want:   "0 0\n",
+		},
+		{
+			name:   "self copy",
+			source: `BEGIN { a[1] = 1; a[2] = 2; print copy(a, a), length(a) }`,
+			want:   "2 2\n",
+		},
+		{
+			name:   "self copy through parameters",
+			source: `function f(x, y) { return copy(x, y) } BEGIN { a[1] = 1; a[2] = 2; print f(a, a), length(a), a[2] }`,
+			want:   "2 2 2\n",
+		},
+		{
+			name:   "same size arrays",
+			source: `BEGIN { a[1] = "a"; b[2] = "b"; print copy(a, b), length(a), b[1], (2 in b) }`,
+			want:   "1 1 a 0\n",
+		},
+		{
+			name:   "local array",
+			source: `function f(src,    dst) { copy(src, dst); return dst["k"] } BEGIN { a["k"] = "v"; print f(a) }`,
+			want:   "v\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := runAWK(t, tt.source, "")
+			if got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestVMExtend(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+		want   string
+	}{
+		{
+			name:   "disjoint arrays",
+			source: `BEGIN { a[1] = "x"; b[2] = "y"; b[3] = "z"; n = extend(a, b); print n, length(a), a[1], a[2], a[3] }`,
+			want:   "2 3 x y z\n",
+		},
+		{
+			name:   "overlapping arrays",
+			source: `BEGIN { a["k"] = "old"; a["m"] = 1; b["k"] = "new"; n = extend(a, b); print n, length(a), a["k"], a["m"] }`,
+			want:   "1 2 new 1\n",
+		},
+		{
+			name:   "source unchanged",
+			source: `BEGIN { a[1] = 1; b[2] = 2; extend(a, b); print length(b), (1 in b) }`,
+			want:   "1 0\n",
+		},
+		{
+			name:   "empty source",
+			source: `BEGIN { a[1] = 1; print extend(a, b), length(a) }`,
+			want:   "0 1\n",
+		},
+		{
+			name:   "accumulate",
+			source: `{ part[$1] = $2; extend(all, part); delete part } END { print length(all), all["a"], all["b"] }`,
+			want:   "2 3 2\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := runAWK(t, tt.source, "a 1\nb 2\na 3\n")
+			if got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestVMIndirectCall(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+		want   string
+	}{
+		{"builtin", `BEGIN { f = "sqrt"; print @f(4) }`, "2\n"},
+		{"builtin by arg count", `BEGIN { f = "substr"; print @f("hello", 2), @f("hello", 2, 3) }`, "ello ell\n"},
+		{"sprintf", `BEGIN { f = "sprintf"; print @f("%03d", 7) }`, "007\n"},
+		{"user function", `function add(a, b) { return a + b } BEGIN { f = "add"; print @f(2, 3) }`, "5\n"},
+		{"missing args", `function g(a, b) { return a "-" b } BEGIN { f = "g"; print @f("x") }`, "x-\n"},
+		{"local array", `function h(x,    arr) { arr[1] = x; return arr[1] } BEGIN { f = "h"; print @f("ok") }`, "ok\n"},
+		{"dispatch table", `function inc(x) { return x + 1 } function dbl(x) { return x * 2 } BEGIN { split("inc dbl inc", ops); v = 1; for (i = 1; i <= 3; i++) { f = ops[i]; v = @f(v) }; print v }`, "5\n"},
+		{"nested", `BEGIN { f = "toupper"; g = "substr"; print @f(@g("hello", 2, 2)) }`, "EL\n"},
+		{"recursive", `function fact(n) { return n <= 1 ? 1 : n * @self(n - 1) } BEGIN { self = "fact"; print fact(5) }`, "120\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := runAWK(t, tt.source, "")
+			if got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestVMCoprocess(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+		want   string
+	}{
+		{
+			name:   "round trip through tr",
+			source: `BEGIN { cmd = "tr a-z A-Z"; print "hello" |& cmd; print "world" |& cmd; close(cmd, "to"); while ((cmd |& getline line) > 0) print line; print close(cmd) }`,
+			want:   "HELLO\nWORLD\n0\n",
+		},
+		{
+			name:   "getline into $0",
+			source: `BEGIN { print "a b c" |& "cat"; close("cat", "to"); "cat" |& getline; print NF, $2 }`,
+			want:   "3 b\n",
+		},
+		{
+			name:   "line at a time",
+			source: `BEGIN { cmd = "cat"; for (i = 1; i <= 3; i++) { print i * 10 |& cmd; cmd |& getline r; print r } }`,
+			want:   "10\n20\n30\n",
+		},
+		{
+			name:   "close how on plain pipe",
+			source: `BEGIN { "echo x" | getline; print close("echo x", "to") }`,
+			want:   "-1\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := runAWK(t, tt.source, "")
+			if got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestVMCoprocessNoDeadlock(t *testing.T) {
+	// Writes run ahead of reads by thousands of lines, far more than a
+	// pipe buffer holds, so cat would block on output if it were not drained.
+	source := `BEGIN {
+		cmd = "cat"
+		for (i = 1; i <= 20000; i++) {
+			print "request " i " padded to make the line a good deal longer" |& cmd
+			if (i % 2 == 0) { cmd |& getline line; n++ }
+		}
+		close(cmd, "to")
+		while ((cmd |& getline line) > 0) n++
+		print n, line
+	}`
+
+	done := make(chan string, 1)
+	go func() { done <- runAWK(t, source, "") }()
+
+	select {
+	case got := <-done:
+		want := "20000 request 20000 padded to make the line a good deal longer\n"
+		if got != want {
+			t.Errorf("got %q, want %q", got, want)
+		}
+	case <-time.After(30 * time.Second):
+		t.Fatal("coprocess deadlocked")
+	}
+}
+
+func TestVMContextCancel(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+	}{
+		// The shell runs sleep as a child, which keeps the pipe open even
+		// after the shell itself is killed. Its stderr is redirected so the
+		// orphaned sleep doesn't hold the test binary's stderr open, making
+		// go test wait for it.
+		{"pipe getline", `BEGIN { "sleep 30 2>/dev/null; echo late" | getline x; print "not reached" }`},
+		{"pipe getline loop", `BEGIN { while (("sleep 30 2>/dev/null; echo late" | getline x) > 0) n++ }`},
+		{"coprocess getline", `BEGIN { "sleep 30 2>/dev/null; echo late" |& getline x }`},
+		{"system", `BEGIN { system("sleep 30 2>/dev/null") } { print }`},
+		{"records", `{ print; fflush() }`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			vm := New(compileAWK(t, tt.source))
+			vm.SetInput(&slowReader{})
+			vm.SetOutput(io.Discard)
+			ctx, cancel := context.WithCancel(context.Background())
+			vm.SetContext(ctx)
+			time.AfterFunc(100*time.Millisecond, cancel)
+
+			done := make(chan error, 1)
+			go func() { done <- vm.Run() }()
+			select {
+			case err := <-done:
+				if !errors.Is(err, context.Canceled) {
+					t.Errorf("Run() error = %v, want context.Canceled", err)
+				}
+			case <-time.After(10 * time.Second):
+				t.Fatal("Run() did not return after cancellation")
+			}
+		})
+	}
+}
+
+// slowReader yields one line every 10ms, forever.
+type slowReader struct{}
+
+func (slowReader) Read(p []byte) (int, error) {
+	time.Sleep(10 * time.Millisecond)
+	return copy(p, "line\n"), nil
+}
+
+func TestVMSystem(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+		want   string
+	}{
+		{"ordering", `BEGIN { print "a"; system("echo b"); print "c" }`, "a\nb\nc\n"},
+		{"success", `BEGIN { print system("true") }`, "0\n"},
+		{"exit status", `BEGIN { print system("exit 3") }`, "3\n"},
+		{"not found", `BEGIN { print system("uawk-no-such-command 2>/dev/null") }`, "127\n"},
+		{"per record", `{ system("echo " $1) }`, "x\ny\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := runAWK(t, tt.source, "x\ny\n")
+			if got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	t.Run("stderr", func(t *testing.T) {
+		vm := New(compileAWK(t, `BEGIN { system("echo out; echo err >&2") }`))
+		var stdout, stderr bytes.Buffer
+		vm.SetOutput(&stdout)
+		vm.SetStderr(&stderr)
+		if err := vm.Run(); err != nil {
+			t.Fatal(err)
+		}
+		if stdout.String() != "out\n" || stderr.String() != "err\n" {
+			t.Errorf("stdout = %q, stderr = %q, want \"out\\n\", \"err\\n\"", stdout.String(), stderr.String())
+		}
+	})
+
+	t.Run("sh whatever SHELL is", func(t *testing.T) {
+		t.Setenv("SHELL", "/bin/false")
+		if got := runAWK(t, `BEGIN { r = system("echo hi"); print "rc", r }`, ""); got != "hi\nrc 0\n" {
+			t.Errorf("got %q, want %q", got, "hi\nrc 0\n")
+		}
+		// Pipes use the same shell as system()
+		if got := runAWK(t, `BEGIN { "echo in" | getline x; print x | "cat"; close("cat") }`, ""); got != "in\n" {
+			t.Errorf("pipes: got %q, want %q", got, "in\n")
+		}
+	})
+
+	t.Run("no shell", func(t *testing.T) {
+		t.Setenv("PATH", t.TempDir())
+		if got := runAWK(t, `BEGIN { print system("true") }`, ""); got != "127\n" {
+			t.Errorf("got %q, want %q", got, "127\n")
+		}
+	})
+}
+
+func TestVMClose(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "out.txt")
+	tests := []struct {
+		name   string
+		source string
+		want   string
+	}{
+		{"output pipe status", `BEGIN { print "x" | "cat >/dev/null; exit 2"; print close("cat >/dev/null; exit 2") }`, "2\n"},
+		{"input pipe status", `BEGIN { "echo a; exit 4" | getline x; print x, close("echo a; exit 4") }`, "a 4\n"},
+		{"not open", `BEGIN { print close("never-opened") }`, "-1\n"},
+		{"reopen truncates", `BEGIN { f = "` + name + `"; print "one" > f; print close(f); print "two" > f; close(f); while ((getline l < f) > 0) print l }`, "0\ntwo\n"},
+		{"reopen pipe", `BEGIN { c = "echo hi"; c | getline a; close(c); c | getline b; print a, b }`, "hi hi\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := runAWK(t, tt.source, "")
+			if got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestVMOutputPipe(t *testing.T) {
+	var input, records strings.Builder
+	for i := 1; i <= 500; i++ {
+		fmt.Fprintf(&input, "line %d\n", i)
+	}
+	records.WriteString("start\n")
+	records.WriteString(input.String())
+
+	tests := []struct {
+		name   string
+		source string
+		input  string
+		want   string
+	}{
+		// A command opened per record would print "start" for each one
+		{"one command", `{ print $0 | ("echo start; " "cat") }`, input.String(), records.String()},
+		{"printf", `{ printf "%s;", $1 | "cat" } END { close("cat"); print "" }`, "a\nb\nc\n", "a;b;c;\n"},
+		{"close reopens", `{ print | "echo start; cat" } NR == 2 { close("echo start; cat") }`, "a\nb\nc\n", "start\na\nb\nstart\nc\n"},
+		{"ordered with print", `BEGIN { print "before"; print "x" | "cat"; close("cat"); print "after" }`, "", "before\nx\nafter\n"},
+		{"closed at end", `{ print | "sort -r" } END { print "end" }`, "a\nb\n", "end\nb\na\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := runAWK(t, tt.source, tt.input); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestVMRegexRS(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+		input  string
+		want   string
+	}{
+		{"digits", `BEGIN { RS = "[0-9]+" } { print $0, "[" RT "]" }`, "a12b345c", "a [12]\nb [345]\nc []\n"},
+		{"trailing match", `BEGIN { RS = "[0-9]+" } { print $0 } END { print NR, RT }`, "a1b22", "a\nb\n2 22\n"},
+		{"blank lines", `BEGIN { RS = "\n\n+" } { print NR ":" $0 "|" length(RT) }`, "a\n\n\nb\nc\n\n", "1:a|3\n2:b\nc|2\n"},
+		{"literal string", `BEGIN { RS = "--" } { print }`, "a--b-c--", "a\nb-c\n"},
+		{"alternation", `BEGIN { RS = ";|, " } { printf "%s(%s)", $0, RT } END { print "" }`, "x;y, z", "x(;)y(, )z()\n"},
+		{"empty match skipped", `BEGIN { RS = "x*" } { print }`, "axxb", "a\nb\n"},
+		{"fields", `BEGIN { RS = "[;:]" } { print NF, $2 }`, "a b;c d e:f", "2 b\n3 d\n1 \n"},
+		{"getline var", `BEGIN { RS = "[0-9]" } NR == 1 { getline x; print $0, x, RT }`, "a1b2c", "a b 2\n"},
+		{"newline RT", `{ print "[" RT "]" }`, "a\nb", "[\n]\n[]\n"},
+		{"single char RT", `BEGIN { RS = ";" } { printf "%s%s", $0, RT } END { print "" }`, "a;b;c", "a;b;c\n"},
+		{"assign RT", `BEGIN { RT = "x"; print RT } { print RT }`, "a\n", "x\n\n\n"},
+		{"unbounded match", `BEGIN { RS = "x[^y]*y" } { print $0, RT }`, "axaaybxcyc", "a xaay\nb xcy\nc \n"},
+		{"classes", `BEGIN { RS = "E[Nn]D|E[Nn]d" } { print }`, "aENDbEnd", "a\nb\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := runAWK(t, tt.source, tt.input)
+			if got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+
+			// Records split the same when input arrives a byte at a time
+			vm := New(compileAWK(t, tt.source))
+			vm.SetInput(iotest.OneByteReader(strings.NewReader(tt.input)))
+			var output bytes.Buffer
+			vm.SetOutput(&output)
+			if err := vm.Run(); err != nil {
+				t.Fatal(err)
+			}
+			if output.String() != tt.want {
+				t.Errorf("byte at a time: got %q, want %q", output.String(), tt.want)
+			}
+		})
+	}
+
+	t.Run("across buffer refills", func(t *testing.T) {
+		var in strings.Builder
+		for i := range 20000 {
+			fmt.Fprintf(&in, "record%d%s", i, strings.Repeat("-", i%5+1))
+		}
+		got := runAWK(t, `BEGIN { RS = "-+" } { n++; t += length(RT) } $0 != "record" NR-1 { bad++ } END { print n, t, bad + 0 }`, in.String())
+		if want := "20000 60000 0\n"; got != want {
+			t.Errorf("got %q, want %q", got, want)
+		}
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		vm := New(compileAWK(t, `BEGIN { RS = "([" } { print }`))
+		vm.SetInput(strings.NewReader("a\n"))
+		vm.SetOutput(io.Discard)
+		err := vm.Run()
+		if err == nil || !strings.Contains(err.Error(), `invalid RS "(["`) {
+			t.Errorf("Run() error = %v, want invalid RS", err)
+		}
+	})
+}
+
+func TestVMSlurp(t *testing.T) {
+	dir := t.TempDir()
+	name := filepath.Join(dir, "template.txt")
+	if err := os.WriteFile(name, []byte("Hello, NAME!\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		source string
+		want   string
+	}{
+		{"read", `BEGIN { s = slurp(f); gsub(/NAME/, "world", s); printf "%s", s }`, "Hello, world!\n"},
+		{"missing", `BEGIN { s = slurp(f "x"); print length(s), (ERRNO != "") }`, "0 1\n"},
+		{"no error", `BEGIN { s = slurp(f); print "[" ERRNO "]" }`, "[]\n"},
+		{"indirect", `BEGIN { fn = "slurp"; printf "%s", @fn(f) }`, "Hello, NAME!\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := runAWK(t, "BEGIN { f = \""+name+"\" }\n"+tt.source, "")
+			if got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestVMGetlineLoop(t *testing.T) {
+	f := filepath.Join(t.TempDir(), "lines.txt")
+	if err := os.WriteFile(f, []byte("l1\nl2\nl3\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	missing := filepath.Join(t.TempDir(), "missing.txt")
+
+	tests := []struct {
+		name   string
+		source string
+		want   string
+	}{
+		{"reads to EOF", `BEGIN { while ((getline l < f) > 0) { s = s l ","; n++ }; print n, s }`, "3 l1,l2,l3,\n"},
+		{"result at EOF", `BEGIN { while ((getline l < f) > 0) {}; print (getline l < f) }`, "0\n"},
+		{"missing file", `BEGIN { n = 0; while ((getline l < m) > 0) n++; print n, (getline l < m) }`, "0 -1\n"},
+		{"in arithmetic", `BEGIN { print (getline l < f) + (getline l < f) * 10, l }`, "11 l2\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			src := "BEGIN { f = \"" + f + "\"; m = \"" + missing + "\" }\n" + tt.source
+			got := runAWK(t, src, "")
+			if got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestVMGetlineFields checks that getline into $0 discards fields assigned
+// for the previous record, and that getline into a variable keeps them.
+func TestVMGetlineFields(t *testing.T) {
+	f := filepath.Join(t.TempDir(), "lines.txt")
+	if err := os.WriteFile(f, []byte("p q r\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		source string
+		want   string
+	}{
+		{"plain getline", `{ $1 = "X"; getline; print ($1 == "X"), $1, $0 }`, "0 c c d\n"},
+		{"plain getline NF", `{ $2 = "X"; $5 = "Y"; getline; print NF, $0, $2 }`, "2 c d d\n"},
+		{"plain getline unsplit", `{ getline; $1 = "X"; print }`, "X d\n"},
+		{"getline from file", `NR == 1 { $1 = "X"; getline < f; print ($1 == "X"), NF, $0 }`, "0 3 p q r\n"},
+		{"getline var keeps fields", `NR == 1 { $1 = "X"; getline x; print $0, x }`, "X b c d\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			src := "BEGIN { f = \"" + f + "\" }\n" + tt.source
+			got := runAWK(t, src, "a b\nc d\n")
+			if got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestVMStreamNR(t *testing.T) {
+	dir := t.TempDir()
+	a := filepath.Join(dir, "a")
+	b := filepath.Join(dir, "b")
+	if err := os.WriteFile(a, []byte("a1\na2\na3\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(b, []byte("b1\nb2\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		source string
+		want   string
+	}{
+		{"interleaved", `BEGIN {
+			getline x < a; getline x < b; getline x < a
+			print streamnr(a), streamnr(b)
+			while ((getline x < b) > 0) {}
+			print streamnr(a), streamnr(b)
+		}`, "2 1\n2 2\n"},
+		{"unread", `BEGIN { print streamnr(a), streamnr("nosuch") }`, "0 0\n"},
+		{"close resets", `BEGIN { getline x < a; close(a); print streamnr(a); getline x < a; print x, streamnr(a) }`, "0\na1 1\n"},
+		{"command", `BEGIN { cmd = "printf \"1\\n2\\n\""; while ((cmd | getline) > 0) {}; print streamnr(cmd) }`, "2\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			src := "BEGIN { a = \"" + a + "\"; b = \"" + b + "\" }\n" + tt.source
+			got := runAWK(t, src, "x\ny\n")
+			if got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestVMHash(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+		want   string
+	}{
+		{"sha256", `BEGIN { print hash("sha256", "abc") }`, "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad\n"},
+		{"sha1", `BEGIN { print hash("sha1", "abc") }`, "a9993e364706816aba3e25717850c26c9cd0d89d\n"},
+		{"md5 empty", `BEGIN { print hash("md5", "") }`, "d41d8cd98f00b204e9800998ecf8427e\n"},
+		{"case insensitive", `BEGIN { print hash("MD5", "a") }`, "0cc175b9c0f1b6a831c399e269772661\n"},
+		{"number", `BEGIN { print hash("md5", 1) == hash("md5", "1") }`, "1\n"},
+		{"unknown", `BEGIN { print "[" hash("crc32", "x") "]", (ERRNO != "") }`, "[] 1\n"},
+		{"indirect", `BEGIN { f = "hash"; print @f("sha1", "abc") }`, "a9993e364706816aba3e25717850c26c9cd0d89d\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := runAWK(t, tt.source, "")
+			if got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestVMBase64(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+		want   string
+	}{
+		{"encode", `BEGIN { print b64enc("hello, world"), b64enc("") }`, "aGVsbG8sIHdvcmxk \n"},
+		{"decode", `BEGIN { print b64dec("aGVsbG8sIHdvcmxk") }`, "hello, world\n"},
+		{"round trip", `BEGIN { s = "a\tb\n\001"; print b64dec(b64enc(s)) == s }`, "1\n"},
+		{"bad input", `BEGIN { print "[" b64dec("aGVsbG8=x") "]", (ERRNO != "") }`, "[] 1\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := runAWK(t, tt.source, "")
+			if got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestVMURLEncoding(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+		want   string
+	}{
+		{"encode", `BEGIN { print urlenc("a b&c=d/\303\251") }`, "a+b%26c%3Dd%2F%C3%A9\n"},
+		{"decode", `BEGIN { print urldec("a%20b+c%3D") }`, "a b c=\n"},
+		{"round trip", `BEGIN { s = "q=1 & r=?#"; print urldec(urlenc(s)) == s }`, "1\n"},
+		{"malformed", `BEGIN { print urldec("50%zz+off"), (ERRNO != "") }`, "50%zz+off 1\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := runAWK(t, tt.source, "")
+			if got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
 	}
+}
 
+func TestVMGensub(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+		input  string
+		want   string
+	}{
+		{"groups", `BEGIN { print gensub(/(a)(b)/, "\\2\\1", "g", "abab") }`, "", "baba\n"},
+		{"nth match", `BEGIN { s = "hello world"; print gensub(/o/, "0", 2, s), s }`, "", "hello w0rld hello world\n"},
+		{"no nth match", `BEGIN { print gensub(/o/, "0", 3, "foo") }`, "", "foo\n"},
+		{"how below 1", `BEGIN { print gensub(/o/, "0", 0, "foo"), gensub(/o/, "0", "x", "foo") }`, "", "f0o f0o\n"},
+		{"G", `BEGIN { print gensub(/o/, "0", "G", "foo") }`, "", "f00\n"},
+		{"ampersand and escapes", `BEGIN { print gensub(/l+/, "[&|\\0|\\&|\\\\|\\q]", 1, "hello") }`, "", "he[ll|ll|&|\\|\\q]o\n"},
+		{"unmatched group", `BEGIN { print gensub(/(x)?b/, "<\\1>", 1, "abc") }`, "", "a<>c\n"},
+		{"empty matches", `BEGIN { print gensub(/x*/, "-", "g", "abc") }`, "", "-a-b-c-\n"},
+		{"longest match groups", `BEGIN { print gensub(/(a|ab)(c|bcd)/, "[\\1,\\2]", 1, "abcd") }`, "", "[a,bcd]\n"},
+		{"default target", `{ print gensub(/ /, "-", "g"); print }`, "a b c\n", "a-b-c\na b c\n"},
+		{"indirect", `BEGIN { f = "gensub"; $0 = "aa"; print @f("a", "b", 1), @f("a", "b", "g", "xa") }`, "", "ba xb\n"},
+	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			got := runAWK(t, tt.source, tt.input)
@@ -428,33 +1269,19 @@ func TestVMFields(t *testing.T) {
 	}
 }
 
-func TestVMPatterns(t *testing.T) {
+func TestVMStrtonum(t *testing.T) {
 	tests := []struct {
 		name   string
 		source string
 		input  string
 		want   string
 	}{
-		{
-			name:   "no pattern",
-			source: "{ print $1 }",
-			input:  "a\nb\nc\n",
-			want:   "a\nb\nc\n",
-		},
-		{
-			name:   "NR pattern",
-			source: "NR == 2 { print $0 }",
-			input:  "a\nb\nc\n",
-			want:   "b\n",
-		},
-		{
-			name:   "regex pattern",
-			source: "/b/ { print $0 }",
-			input:  "a\nb\nc\n",
-			want:   "b\n",
-		},
+		{"hex", `BEGIN { print strtonum("0x1F"), strtonum("0XfF"), strtonum("-0x10") }`, "", "31 255 -16\n"},
+		{"octal", `BEGIN { print strtonum("017"), strtonum("018"), strtonum("0") }`, "", "15 18 0\n"},
+		{"decimal", `BEGIN { print strtonum("12abc"), strtonum(" 1.5e1"), strtonum("0.5"), strtonum("x") }`, "", "12 15 0.5 0\n"},
+		{"number", `BEGIN { print strtonum(017), strtonum(2.5) }`, "", "17 2.5\n"},
+		{"field", `{ sum += strtonum($1) } END { print sum }`, "0x10\n010\n10\n", "34\n"},
 	}
-
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			got := runAWK(t, tt.source, tt.input)
@@ -465,29 +1292,45 @@ func TestVMPatterns(t *testing.T) {
 	}
 }
 
-func TestVMFunctions(t *testing.T) {
+func TestVMTimefmt(t *testing.T) {
 	tests := []struct {
 		name   string
 		source string
 		want   string
 	}{
-		{
-			name:   "simple function",
-			source: `function add(a, b) { return a + b } BEGIN { print add(1, 2) }`,
-			want:   "3\n",
-		},
-		{
-			name:   "recursive function",
-			source: `function fac(n) { if (n <= 1) return 1; return n * fac(n-1) } BEGIN { print fac(5) }`,
-			want:   "120\n",
-		},
-		{
-			name:   "local variables",
-			source: `function f(a,    local) { local = a * 2; return local } BEGIN { print f(5) }`,
-			want:   "10\n",
-		},
+		{"epoch", `BEGIN { print timefmt(0, "2006-01-02 15:04:05 MST", 1) }`, "1970-01-01 00:00:00 UTC\n"},
+		{"date", `BEGIN { print timefmt(1700000000, "Mon Jan 2 2006", 1) }`, "Tue Nov 14 2023\n"},
+		{"fraction", `BEGIN { print timefmt(1700000000.25, "15:04:05.000", 1) }`, "22:13:20.250\n"},
+		{"string ts", `BEGIN { print timefmt("86400", "2006-01-02", "utc") }`, "1970-01-02\n"},
+		{"local", `BEGIN { print timefmt(0, "2006") == "1970" || timefmt(0, "2006") == "1969" }`, "1\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := runAWK(t, tt.source, "")
+			if got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
 	}
+}
 
+func TestVMBitwise(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+		want   string
+	}{
+		{"and or xor", `BEGIN { print and(12, 10), or(12, 10), xor(12, 10) }`, "8 14 6\n"},
+		{"variadic", `BEGIN { print and(15, 7, 3), or(1, 2, 4, 8), xor(1, 3, 7) }`, "3 15 5\n"},
+		{"shifts", `BEGIN { print lshift(1, 4), rshift(256, 4), lshift(1, 64), rshift(1, 100) }`, "16 16 0 0\n"},
+		{"compl", `BEGIN { print compl(0), and(255, compl(15)), compl(compl(5)) }`, "9007199254740991 240 5\n"},
+		{"fractions", `BEGIN { print and(5.9, 7), lshift("3", 1.5), or("12abc", 1) }`, "5 6 13\n"},
+		{"negative", `BEGIN { print and(-1, 255), rshift(-1, 60), and(-2, 3) }`, "255 15 2\n"},
+		{"beyond 2^64", `BEGIN { print and(2^64 + 2^12, 2^12), and(2^70, 1) }`, "4096 0\n"},
+		{"beyond 2^53", `BEGIN { print rshift(2^60 + 2^40, 40), lshift(1, 62) == 2^62 }`, "1048577 1\n"},
+		{"not finite", `BEGIN { print or(log(-1), 1), and(-log(0), 3) }`, "1 0\n"},
+		{"indirect", `BEGIN { f = "xor"; print @f(1, 2, 4); f = "compl"; print @f(1) }`, "7\n9007199254740990\n"},
+	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			got := runAWK(t, tt.source, "")
@@ -498,27 +1341,109 @@ func TestVMFunctions(t *testing.T) {
 	}
 }
 
-func TestVMBuiltins(t *testing.T) {
+func TestVMTypeof(t *testing.T) {
 	tests := []struct {
 		name   string
 		source string
+		input  string
 		want   string
 	}{
-		{"length string", `BEGIN { print length("hello") }`, "5\n"},
-		{"length empty", `BEGIN { print length("") }`, "0\n"},
-		{"substr 2 arg", `BEGIN { print substr("hello", 2) }`, "ello\n"},
-		{"substr 3 arg", `BEGIN { print substr("hello", 2, 3) }`, "ell\n"},
-		{"index found", `BEGIN { print index("hello", "ll") }`, "3\n"},
-		{"index not found", `BEGIN { print index("hello", "x") }`, "0\n"},
-		{"tolower", `BEGIN { print tolower("HELLO") }`, "hello\n"},
-		{"toupper", `BEGIN { print toupper("hello") }`, "HELLO\n"},
-		{"int", `BEGIN { print int(3.7) }`, "3\n"},
-		{"int negative", `BEGIN { print int(-3.7) }`, "-3\n"},
-		{"sqrt", `BEGIN { print sqrt(4) }`, "2\n"},
-		{"sin 0", `BEGIN { print sin(0) }`, "0\n"},
-		{"cos 0", `BEGIN { print cos(0) }`, "1\n"},
+		{"scalars", `BEGIN { x = 1; y = "s"; z; print typeof(x), typeof(y), typeof(z), typeof(1 + 1), typeof("a" "b") }`, "",
+			"number string unassigned number string\n"},
+		{"untyped", `BEGIN { print typeof(never) }`, "", "untyped\n"},
+		{"fields", `{ print typeof($1), typeof($2), typeof($0), typeof(NR) }`, "abc 12\n", "strnum strnum strnum number\n"},
+		{"array", `BEGIN { a[1]; print typeof(a), isarray(a), typeof(a[1]), isarray(a[1]) }`, "", "array 1 unassigned 0\n"},
+		{"new element", `BEGIN { print (a["x"] == 0), (a["x"] == ""), typeof(a["x"]) }`, "", "1 1 unassigned\n"},
+		{"isarray scalars", `BEGIN { x = 1; print isarray(x), isarray("a"), isarray(u) }`, "", "0 0 0\n"},
+		{"parameters", `function t(p) { return typeof(p) "," isarray(p) } BEGIN { a["k"]; print t(a); x = 5; print t2(x) } function t2(q) { return typeof(q) }`, "",
+			"array,1\nnumber\n"},
+		{"assigned later", `BEGIN { print typeof(x); x = "a"; print typeof(x); x = 2; print typeof(x) }`, "", "unassigned\nstring\nnumber\n"},
+		{"indirect", `BEGIN { f = "typeof"; print @f(1); f = "isarray"; print @f("a") }`, "", "number\n0\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := runAWK(t, tt.source, tt.input); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestVMExtensionNames checks that POSIX programs can use the names of
+// extension builtins for their own variables.
+func TestVMExtensionNames(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+		want   string
+	}{
+		{"copy", `BEGIN { copy["a"] = 1; for (k in copy) print k, copy[k]; n = copy(copy, b); print n, b["a"] }`, "a 1\n1 1\n"},
+		{"extend", `BEGIN { extend = 2; a[1]; n = extend(b, a); print extend, n }`, "2 1\n"},
+		{"now", `BEGIN { now = 1; print now, (now() > 0) }`, "1 1\n"},
+		{"slurp", `BEGIN { slurp = "x"; print slurp }`, "x\n"},
+		{"spit", `BEGIN { spit[1]; print length(spit) }`, "1\n"},
+		{"streamnr", `BEGIN { streamnr = 3; print streamnr * 2 }`, "6\n"},
+		{"hash", `BEGIN { hash = 1; print hash, length(hash("md5", "")) }`, "1 32\n"},
+		{"b64enc", `BEGIN { b64enc = "a"; b64dec = b64enc(b64enc); print b64dec }`, "YQ==\n"},
+		{"urlenc", `BEGIN { urlenc = "a&b"; urldec = urlenc(urlenc); print urldec }`, "a%26b\n"},
+		{"timefmt", `BEGIN { timefmt = "t"; print timefmt, timefmt(0, "2006", 1) }`, "t 1970\n"},
+		{"strtonum", `BEGIN { strtonum = "0x10"; print strtonum(strtonum) }`, "16\n"},
+		{"gensub", `function f(gensub) { return gensub(/a/, "b", "g", gensub) } BEGIN { print f("aa") }`, "bb\n"},
+		{"strftime", `BEGIN { systime = 1; mktime = 2; strftime = 3; print systime + mktime + strftime, strftime("%Y", mktime("1970 01 02 00 00 00", 1), 1) }`, "6 1970\n"},
+		{"bitwise", `BEGIN { and = 1; or = 2; xor = 3; compl = 4; lshift = 5; rshift = 6; print and + or + xor + compl + lshift + rshift, or(and, or) }`, "21 3\n"},
+		{"typeof", `BEGIN { typeof = "t"; isarray[1]; print typeof, typeof(isarray), isarray(typeof) }`, "t array 0\n"},
+		{"asort", `BEGIN { asort[1] = "b"; asort[2] = "a"; asorti = asort(asort); print asorti, asort[1] }`, "2 a\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := runAWK(t, tt.source, ""); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestVMExtensionNameFunctions(t *testing.T) {
+	// A function the program defines takes priority over the extension
+	// builtin of the same name, whether it is called before or after the
+	// definition
+	names := []string{
+		"and", "asort", "asorti", "b64dec", "b64enc", "compl", "copy",
+		"extend", "gensub", "hash", "isarray", "lshift", "mktime", "now",
+		"or", "rshift", "slurp", "spit", "streamnr", "strftime", "strtonum",
+		"systime", "timefmt", "typeof", "urldec", "urlenc", "xor",
+	}
+	for _, name := range names {
+		t.Run(name, func(t *testing.T) {
+			source := fmt.Sprintf(`BEGIN { print %[1]s("a") }
+function %[1]s(s) { return "user " s }
+END { print %[1]s($0) }`, name)
+			if got, want := runAWK(t, source, "b\n"), "user a\nuser b\n"; got != want {
+				t.Errorf("got %q, want %q", got, want)
+			}
+		})
 	}
+}
 
+func TestVMStrftime(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+		want   string
+	}{
+		{"date and time", `BEGIN { print strftime("%Y-%m-%d %H:%M:%S", 1700000000, 1) }`, "2023-11-14 22:13:20\n"},
+		{"names", `BEGIN { print strftime("%a %A %b %B %h", 1700000000, 1) }`, "Tue Tuesday Nov November Nov\n"},
+		{"composites", `BEGIN { print strftime("%c|%D|%F|%T|%R|%r", 1700000000, 1) }`,
+			"Tue Nov 14 22:13:20 2023|11/14/23|2023-11-14|22:13:20|22:13|10:13:20 PM\n"},
+		{"padding", `BEGIN { print strftime("[%e] [%k] [%l] %I %p %j", 86400 * 4 + 3600, 1) }`, "[ 5] [ 1] [ 1] 01 AM 005\n"},
+		{"weeks", `BEGIN { print strftime("%u %w %U %W %V %G %g", 1700000000, 1) }`, "2 2 46 46 46 2023 23\n"},
+		{"iso year", `BEGIN { print strftime("%G-W%V-%u", 1704067199, 1) }`, "2023-W52-7\n"},
+		{"epoch and zone", `BEGIN { print strftime("%s %z %Z %C %y", 1700000000.9, 1) }`, "1700000000 +0000 UTC 20 23\n"},
+		{"literals", `BEGIN { print strftime("%%%t%n%Q%Ey%", 0, 1) }`, "%\t\n%Q70%\n"},
+		{"string utc flag", `BEGIN { print strftime("%F", 0, "utc") }`, "1970-01-01\n"},
+		{"not finite", `BEGIN { print "[" strftime("%Y", log(-1), 1) "]" }`, "[]\n"},
+		{"local", `BEGIN { print strftime("%Y", 0) == "1970" || strftime("%Y", 0) == "1969" }`, "1\n"},
+	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			got := runAWK(t, tt.source, "")
@@ -529,21 +1454,79 @@ func TestVMBuiltins(t *testing.T) {
 	}
 }
 
-func TestVMSplit(t *testing.T) {
+func TestVMMktime(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+		want   string
+	}{
+		{"utc", `BEGIN { print mktime("2023 11 14 22 13 20", 1) }`, "1700000000\n"},
+		{"dst field", `BEGIN { print mktime("1970 01 02 00 00 00 -1", 1) }`, "86400\n"},
+		{"normalized", `BEGIN { print mktime("2022 14 01 00 00 -1", 1) == mktime("2023 01 31 23 59 59", 1) }`, "1\n"},
+		{"round trip", `BEGIN { t = mktime("2024 02 29 12 30 00"); print strftime("%Y %m %d %H %M %S", t) }`, "2024 02 29 12 30 00\n"},
+		{"too few fields", `BEGIN { print mktime("2023 11 14") }`, "-1\n"},
+		{"not a number", `BEGIN { print mktime("2023 11 14 22 13 xx") }`, "-1\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := runAWK(t, tt.source, "")
+			if got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestVMSpit(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+		want   string
+	}{
+		{"truncate", `BEGIN { spit(f, "old\n"); print spit(f, "new\n"); printf "%s", slurp(f) }`, "4\nnew\n"},
+		{"append", `BEGIN { spit(f, "a\n"); print spit(f, "b\n", 1); printf "%s", slurp(f) }`, "2\na\nb\n"},
+		{"after print", `BEGIN { print "p" > f; spit(f, "s\n", 1); printf "%s", slurp(f) }`, "p\ns\n"},
+		{"error", `BEGIN { print spit(f "/x", "s"), (ERRNO != "") }`, "-1 1\n"},
+		{"stdout", `BEGIN { spit("/dev/stdout", "out\n") }`, "out\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := filepath.Join(t.TempDir(), "out.txt")
+			got := runAWK(t, "BEGIN { f = \""+f+"\" }\n"+tt.source, "")
+			if got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestVMForInEnviron(t *testing.T) {
+	t.Setenv("UAWK_FORIN_TEST", "forin-value")
+
 	tests := []struct {
 		name   string
 		source string
 		want   string
 	}{
 		{
-			name:   "default separator",
-			source: `BEGIN { n = split("a b c", arr); print n, arr[1], arr[2], arr[3] }`,
-			want:   "3 a b c\n",
+			name:   "known variable",
+			source: `BEGIN { for (k in ENVIRON) if (k == "UAWK_FORIN_TEST") print k, ENVIRON[k] }`,
+			want:   "UAWK_FORIN_TEST forin-value\n",
 		},
 		{
-			name:   "custom separator",
-			source: `BEGIN { n = split("a:b:c", arr, ":"); print n, arr[1], arr[2], arr[3] }`,
-			want:   "3 a b c\n",
+			name:   "PATH present",
+			source: `BEGIN { for (k in ENVIRON) if (k == "PATH") found = 1; print found + 0 }`,
+			want:   "1\n",
+		},
+		{
+			name:   "count matches length",
+			source: `BEGIN { for (k in ENVIRON) n++; print (n == length(ENVIRON)) }`,
+			want:   "1\n",
+		},
+		{
+			name:   "inside function",
+			source: `function get(name,    k) { for (k in ENVIRON) if (k == name) return ENVIRON[k] } BEGIN { print get("UAWK_FORIN_TEST") }`,
+			want:   "forin-value\n",
 		},
 	}
 
@@ -557,6 +1540,192 @@ func TestVMSplit(t *testing.T) {
 	}
 }
 
+func TestVMNoAmbientAccess(t *testing.T) {
+	prog, err := parser.Parse(`BEGIN { for (k in ENVIRON) n++; print n, ENVIRON["HOME"]; print rand() }`)
+	if err != nil {
+		t.Fatalf("parse error: %v", err)
+	}
+	resolved, err := semantic.Resolve(prog)
+	if err != nil {
+		t.Fatalf("resolve error: %v", err)
+	}
+	compiled, err := compiler.Compile(prog, resolved)
+	if err != nil {
+		t.Fatalf("compile error: %v", err)
+	}
+
+	seed := int64(42)
+	config := DefaultVMConfig()
+	config.Environ = map[string]string{"HOME": "/sandbox"}
+	config.RandSeed = &seed
+	config.Now = func() time.Time {
+		t.Error("clock read with RandSeed set")
+		return time.Time{}
+	}
+	vm := NewWithConfig(compiled, config)
+
+	var output bytes.Buffer
+	vm.SetOutput(&output)
+	if err := vm.Run(); err != nil {
+		t.Fatalf("run error: %v", err)
+	}
+
+	want := fmt.Sprintf("1 /sandbox\n%s\n", types.FormatNum(rand.New(rand.NewSource(seed)).Float64(), "%.6g"))
+	if got := output.String(); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestJoinSplitKey(t *testing.T) {
+	tests := []struct {
+		parts []string
+		want  string
+	}{
+		{[]string{"a\034", "b"}, "\035a\035\034\034b"},
+		{[]string{"a", "\034b"}, "\035a\034\035\034b"},
+		{[]string{"x\035y", ""}, "\035x\035\035y\034"},
+		{[]string{"\035", "\034"}, "\035\035\035\034\035\034"},
+	}
+	seen := make(map[string]bool)
+	for _, tt := range tests {
+		key := joinKey(tt.parts, "\034")
+		if key != tt.want {
+			t.Errorf("joinKey(%q) = %q, want %q", tt.parts, key, tt.want)
+		}
+		if seen[key] {
+			t.Errorf("joinKey(%q) = %q collides", tt.parts, key)
+		}
+		seen[key] = true
+		if got, ok := splitKey(key, "\034"); !ok || !reflect.DeepEqual(got, tt.parts) {
+			t.Errorf("splitKey(%q) = %q, %v, want %q", key, got, ok, tt.parts)
+		}
+	}
+	if got, _ := splitKey(joinKey([]string{"a::b", "c"}, "::"), "::"); !reflect.DeepEqual(got, []string{"a::b", "c"}) {
+		t.Errorf("multi-char SUBSEP round trip = %q", got)
+	}
+
+	// Keys without escapes are joined as they are and not taken apart
+	for _, parts := range [][]string{{"a", "b"}, {"", "", ""}} {
+		key := joinKey(parts, "\034")
+		if want := strings.Join(parts, "\034"); key != want {
+			t.Errorf("joinKey(%q) = %q, want %q", parts, key, want)
+		}
+		if _, ok := splitKey(key, "\034"); ok {
+			t.Errorf("splitKey(%q) reports an escaped key", key)
+		}
+	}
+	for _, s := range []string{"a\035b\034c", "\035x\034y", "\035a\035"} {
+		if _, ok := splitKey(s, "\034"); ok {
+			t.Errorf("splitKey(%q) reports an escaped key", s)
+		}
+	}
+}
+
+func TestFormatNow(t *testing.T) {
+	ts := time.Date(2024, time.March, 5, 7, 8, 9, 0, time.UTC)
+	tests := []struct {
+		format string
+		want   string
+	}{
+		{"YYYY-MM-DD hh:mm:ss", "2024-03-05 07:08:09"},
+		{"YY/MM/DD", "24/03/05"},
+		{"hhmm", "0708"},
+		{"Day 1 at hh", "Day 1 at 07"},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := formatNow(ts, tt.format); got != tt.want {
+			t.Errorf("formatNow(%q) = %q, want %q", tt.format, got, tt.want)
+		}
+	}
+}
+
+func TestVMAsort(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+		want   string
+	}{
+		{"reindexes", `BEGIN { a["x"] = 3; a["y"] = 1; n = asort(a); print n, length(a), a[1], a[2], ("x" in a) }`, "2 2 1 3 0\n"},
+		{"numbers before strings", `BEGIN { a[1] = "b"; a[2] = 10; a[3] = "a"; a[4] = 9; asort(a); print a[1], a[2], a[3], a[4] }`, "9 10 a b\n"},
+		{"fields compare as numbers", `{ a[NR] = $1 } END { asort(a); print a[1], a[2], a[3] }`, "2 10 x\n"},
+		{"destination", `BEGIN { a["x"] = 2; a["y"] = 1; d["old"]; n = asort(a, d); print n, d[1], d[2], ("old" in d), a["x"] }`, "2 1 2 0 2\n"},
+		{"asorti", `BEGIN { a["b"]; a["10"]; a["9"]; a["a"]; n = asorti(a, k); print n, k[1], k[2], k[3], k[4], length(a) }`, "4 10 9 a b 4\n"},
+		{"asorti in place", `BEGIN { a["y"] = 1; a["x"] = 2; asorti(a); print a[1], a[2], length(a) }`, "x y 2\n"},
+		{"descending", `BEGIN { a[1] = 5; a[2] = 30; a[3] = 7; asort(a, d, "@val_num_desc"); print d[1], d[2], d[3] }`, "30 7 5\n"},
+		{"string order", `BEGIN { a[1] = 5; a[2] = 30; a[3] = 7; asort(a, d, "@val_str_asc"); print d[1], d[2], d[3] }`, "30 5 7\n"},
+		{"by index", `BEGIN { a[10] = "x"; a[9] = "y"; a[2] = "z"; asort(a, d, "@ind_num_asc"); asorti(a, k, "@ind_num_desc"); print d[1], d[2], d[3], k[1], k[2], k[3] }`, "z y x 10 9 2\n"},
+		{"empty", `BEGIN { d[1]; print asort(a, d), length(d) }`, "0 0\n"},
+		{"local array", `function f(arr, d) { arr["q"] = 2; arr["p"] = 1; asorti(arr, d); return d[1] d[2] } BEGIN { print f() }`, "pq\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := runAWK(t, tt.source, "10\nx\n2\n")
+			if got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	t.Run("invalid order", func(t *testing.T) {
+		vm := NewWithConfig(compileAWK(t, `BEGIN { a[1]; asort(a, b, "@val_bogus") }`), DefaultVMConfig())
+		vm.SetOutput(&bytes.Buffer{})
+		err := vm.Run()
+		if err == nil || !strings.Contains(err.Error(), `asort: invalid sort order "@val_bogus"`) {
+			t.Errorf("got error %v", err)
+		}
+	})
+}
+
+func TestVMSortedIn(t *testing.T) {
+	const fill = `a["b"] = 3; a["10"] = 1; a["9"] = 20; `
+	const loop = `for (k in a) printf "%s ", k; print ""`
+	tests := []struct {
+		order string
+		want  string
+	}{
+		{"@ind_str_asc", "10 9 b \n"},
+		{"@ind_str_desc", "b 9 10 \n"},
+		{"@ind_num_asc", "b 9 10 \n"},
+		{"@ind_num_desc", "10 9 b \n"},
+		{"@val_num_asc", "10 b 9 \n"},
+		{"@val_num_desc", "9 b 10 \n"},
+		{"@val_str_asc", "10 9 b \n"},
+		{"@val_type_desc", "9 b 10 \n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.order, func(t *testing.T) {
+			source := `BEGIN { ` + fill + `PROCINFO["sorted_in"] = "` + tt.order + `"; ` + loop + ` }`
+			for i := 0; i < 5; i++ {
+				if got := runAWK(t, source, ""); got != tt.want {
+					t.Fatalf("got %q, want %q", got, tt.want)
+				}
+			}
+		})
+	}
+
+	others := []struct {
+		name   string
+		source string
+		want   string
+	}{
+		{"break", `BEGIN { ` + fill + `PROCINFO["sorted_in"] = "@ind_str_asc"; for (k in a) { if (k == "b") break; printf "%s ", k } print "" }`, "10 9 \n"},
+		{"delete ahead", `BEGIN { ` + fill + `PROCINFO["sorted_in"] = "@ind_str_asc"; for (k in a) { delete a["b"]; printf "%s ", k } print "" }`, "10 9 \n"},
+		{"nested", `BEGIN { ` + fill + `PROCINFO["sorted_in"] = "@ind_str_desc"; for (k in a) for (j in a) if (j == k) printf "%s ", k; print "" }`, "b 9 10 \n"},
+		{"local array", `function f(arr, k, s) { arr[2]; arr[1]; arr[3]; for (k in arr) s = s k; return s } BEGIN { PROCINFO["sorted_in"] = "@ind_num_desc"; print f() }`, "321\n"},
+		{"set in BEGIN", `BEGIN { PROCINFO["sorted_in"] = "@ind_num_asc" } { a[$1] } END { for (k in a) printf "%s ", k; print "" }`, "1 2 3 \n"},
+		{"unsorted", `BEGIN { a[1]; PROCINFO["sorted_in"] = "@unsorted"; for (k in a) print k }`, "1\n"},
+	}
+	for _, tt := range others {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := runAWK(t, tt.source, "3\n1\n2\n"); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
 func TestVMSprintf(t *testing.T) {
 	tests := []struct {
 		name   string
@@ -694,6 +1863,24 @@ func TestVMSpecialVars(t *testing.T) {
 			input:  "a\nb\n",
 			want:   "a;b;",
 		},
+		{
+			name:   "ORS with regex pattern only",
+			source: `BEGIN { ORS = ";" } /a/`,
+			input:  "a\nb\nca\n",
+			want:   "a;ca;",
+		},
+		{
+			name:   "ORS with expression pattern only",
+			source: `BEGIN { ORS = ";" } $2 > 100`,
+			input:  "x 50\ny 150\nz 200\n",
+			want:   "y 150;z 200;",
+		},
+		{
+			name:   "NUL RS and ORS",
+			source: `BEGIN { RS = "\0"; ORS = "\0" } { print NR ":" $0 }`,
+			input:  "a b\x00c\nd\x00e",
+			want:   "1:a b\x002:c\nd\x003:e\x00",
+		},
 	}
 
 	for _, tt := range tests {
@@ -716,6 +1903,11 @@ func TestVMRegexMatch(t *testing.T) {
 		{"match false", `BEGIN { print ("hello" ~ /xyz/) }`, "0\n"},
 		{"not match true", `BEGIN { print ("hello" !~ /xyz/) }`, "1\n"},
 		{"not match false", `BEGIN { print ("hello" !~ /ell/) }`, "0\n"},
+		{"hex escape", `BEGIN { print ("A" ~ /^\x41$/) }`, "1\n"},
+		{"octal escape", `BEGIN { print ("A" ~ /^\101$/) }`, "1\n"},
+		{"unicode escape", `BEGIN { print ("café" ~ /\u00e9/) }`, "1\n"},
+		{"escape in class", `BEGIN { print ("B" ~ /^[\x41-\x43]$/, "D" ~ /^[\101-\103]$/) }`, "1 0\n"},
+		{"dynamic hex escape", `BEGIN { print ("A" ~ "^\\x41$") }`, "1\n"},
 	}
 
 	for _, tt := range tests {
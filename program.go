@@ -3,7 +3,11 @@ package uawk
 import (
 	"bytes"
 	"context"
+	"errors"
+	"fmt"
 	"io"
+	"os"
+	"strings"
 
 	"github.com/kolkov/uawk/internal/compiler"
 	"github.com/kolkov/uawk/internal/vm"
@@ -14,7 +18,8 @@ import (
 // independent execution context.
 type Program struct {
 	compiled *compiler.Program
-	source   string // Original source for debugging
+	source   string         // Original source for debugging
+	opts     compileOptions // Config settings it was compiled with
 }
 
 // Run executes the compiled program with the given input and configuration.
@@ -26,33 +31,149 @@ type Program struct {
 // If config.Parallel > 1 and the program is parallelizable, it will
 // be executed using multiple worker goroutines.
 func (p *Program) Run(input io.Reader, config *Config) (string, error) {
+	return p.RunContext(context.Background(), input, config)
+}
+
+// RunContext is like Run but stops when ctx is cancelled, returning
+// ctx.Err(). Cancellation is noticed between input records and after each
+// getline; commands started by pipes, coprocesses and system() are killed,
+// so a getline or print blocked on one returns promptly.
+func (p *Program) RunContext(ctx context.Context, input io.Reader, config *Config) (string, error) {
+	return p.run(ctx, input, config, nil)
+}
+
+// Result is the outcome of RunResult.
+type Result struct {
+	// Output is the program output, as returned by Run.
+	Output string
+
+	arrays map[string]map[string]string
+}
+
+// Array returns the contents of the program's global array name when the
+// program ended, with values converted to strings using CONVFMT, or nil
+// if the program has no global array of that name. The map belongs to
+// the caller.
+func (r *Result) Array(name string) map[string]string {
+	return r.arrays[name]
+}
+
+// RunResult is like Run but also returns the final contents of the
+// program's global arrays, such as counts it aggregated, through
+// Result.Array. It always runs sequentially, ignoring config.Parallel.
+// If the program exits with a non-zero status, the Result is returned
+// along with the *ExitError.
+//
+// Example:
+//
+//	res, err := prog.RunResult(input, nil) // prog: { count[$1]++ }
+//	counts := res.Array("count")
+func (p *Program) RunResult(input io.Reader, config *Config) (*Result, error) {
+	result := &Result{}
+	output, err := p.run(context.Background(), input, config, result)
+	if _, isExit := err.(*ExitError); err != nil && !isExit {
+		return nil, err
+	}
+	result.Output = output
+	return result, err
+}
+
+// BoundProgram is a Program with a Config bound to it by WithConfig, for
+// running many inputs with the same settings. Like Program, it is safe
+// for concurrent use, unless the bound Config has an Output or Stderr
+// writer that is not, since every run writes to it.
+type BoundProgram struct {
+	program *Program
+	config  Config
+}
+
+// WithConfig returns p bound to a copy of config, so later changes to
+// config, including to its maps and slices, do not affect it. A nil config
+// binds the default configuration. p itself is unchanged and can still be
+// run with other configurations.
+//
+// The copy shares config's Output and Stderr writers and the readers in
+// its Inputs, which the first run reads to the end; pass inputs to Run
+// instead.
+//
+// Example:
+//
+//	csv := prog.WithConfig(&uawk.Config{FS: ","})
+//	for _, file := range files {
+//		output, err := csv.Run(file)
+//		...
+//	}
+func (p *Program) WithConfig(config *Config) *BoundProgram {
+	b := &BoundProgram{program: p}
+	if config != nil {
+		b.config = config.clone()
+	}
+	return b
+}
+
+// Run is like Program.Run with the bound configuration.
+func (b *BoundProgram) Run(input io.Reader) (string, error) {
+	return b.RunContext(context.Background(), input)
+}
+
+// RunContext is like Program.RunContext with the bound configuration.
+func (b *BoundProgram) RunContext(ctx context.Context, input io.Reader) (string, error) {
+	// Each run gets its own copy, since running fills in defaults
+	config := b.config
+	return b.program.run(ctx, input, &config, nil)
+}
+
+// run executes the program for RunContext and RunResult. If result is
+// non-nil, it runs sequentially and fills in result's arrays.
+func (p *Program) run(ctx context.Context, input io.Reader, config *Config, result *Result) (string, error) {
 	if config == nil {
 		config = &Config{}
 	}
 	config.applyDefaults()
 
-	// Check if parallel execution is requested and safe
-	if config.Parallel > 1 {
+	if config.ProfileFile != "" {
+		compiled, err := compileSource(p.source, true, p.opts)
+		if err != nil {
+			return "", err
+		}
+		profiled := &Program{compiled: compiled, source: p.source, opts: p.opts}
+		return profiled.runSequential(ctx, input, config, result)
+	}
+
+	// Check if parallel execution is requested and safe; CSV records
+	// may span lines, so chunking input at newlines would split them,
+	// and every worker would start from its own copy of seeded arrays
+	if config.Parallel > 1 && config.InputMode == "" && len(config.Arrays) == 0 && result == nil &&
+		vm.ParallelArgs(config.Args) {
 		if analysis := p.CanParallelize(config.RS); analysis.CanParallelize {
-			return p.runParallel(input, config)
+			return p.runParallel(ctx, input, config)
 		}
 		// Fall through to sequential if not parallelizable
 	}
 
-	return p.runSequential(input, config)
+	return p.runSequential(ctx, input, config, result)
 }
 
-// runSequential executes the program using a single VM.
-func (p *Program) runSequential(input io.Reader, config *Config) (string, error) {
+// runSequential executes the program using a single VM, saving its
+// global arrays in result if it is non-nil.
+func (p *Program) runSequential(ctx context.Context, input io.Reader, config *Config, result *Result) (string, error) {
 	// Create VM with regex configuration
 	v := p.createVM(config)
 	defer p.putVM(v)
 
 	// Configure VM
 	configureVM(v, config)
+	v.SetContext(ctx)
 
 	// Set input
 	v.SetInput(input)
+	if len(config.Inputs) > 0 {
+		inputs := make([]vm.NamedReader, len(config.Inputs))
+		for i, in := range config.Inputs {
+			inputs[i] = vm.NamedReader{Name: in.Name, R: in.R}
+		}
+		v.SetInputs(inputs)
+	}
 
 	// Set output capture if not provided
 	var outputBuf *bytes.Buffer
@@ -62,15 +183,32 @@ func (p *Program) runSequential(input io.Reader, config *Config) (string, error)
 	} else {
 		v.SetOutput(config.Output)
 	}
+	if config.Stderr != nil {
+		v.SetStderr(config.Stderr)
+	} else {
+		v.SetStderr(io.Discard)
+	}
 
 	// Execute
 	err := v.Run()
+	if result != nil {
+		result.arrays = v.Arrays()
+	}
+	if p.compiled.Profile {
+		if perr := writeProfile(config.ProfileFile, p.source, v.LineCounts()); perr != nil && err == nil {
+			err = perr
+		}
+	}
 
 	// Handle exit error (normal program termination)
 	if err != nil {
 		if exitErr, ok := err.(*vm.ExitError); ok {
 			if exitErr.Code != 0 {
-				return outputBuf.String(), &ExitError{Code: exitErr.Code}
+				var output string
+				if outputBuf != nil {
+					output = outputBuf.String()
+				}
+				return output, &ExitError{Code: exitErr.Code}
 			}
 			// exit 0 is success, not an error
 			err = nil
@@ -78,6 +216,9 @@ func (p *Program) runSequential(input io.Reader, config *Config) (string, error)
 	}
 
 	if err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil && errors.Is(err, ctxErr) {
+			return "", err
+		}
 		return "", &RuntimeError{Message: err.Error()}
 	}
 
@@ -88,13 +229,8 @@ func (p *Program) runSequential(input io.Reader, config *Config) (string, error)
 }
 
 // runParallel executes the program using multiple worker goroutines.
-func (p *Program) runParallel(input io.Reader, config *Config) (string, error) {
-	// Determine POSIX regex mode
-	posixRegex := true
-	if config.POSIXRegex != nil {
-		posixRegex = *config.POSIXRegex
-	}
-	vmConfig := vm.VMConfig{POSIXRegex: posixRegex}
+func (p *Program) runParallel(ctx context.Context, input io.Reader, config *Config) (string, error) {
+	vmConfig := newVMConfig(config)
 
 	// Configure parallel execution
 	parallelConfig := vm.DefaultParallelConfig()
@@ -105,6 +241,15 @@ func (p *Program) runParallel(input io.Reader, config *Config) (string, error) {
 
 	exec := vm.NewParallelExecutor(p.compiled, vmConfig, parallelConfig)
 
+	// The parallel executor chunks each ARGV file operand, or else each
+	// named input, separately
+	named := make([]io.Reader, len(config.Inputs))
+	for i, in := range config.Inputs {
+		named[i] = in.R
+	}
+	inputs, closeInputs := vm.ArgsInputs(config.Args, named, input)
+	defer closeInputs()
+
 	// Set up output
 	var outputBuf *bytes.Buffer
 	var output io.Writer
@@ -116,19 +261,26 @@ func (p *Program) runParallel(input io.Reader, config *Config) (string, error) {
 	}
 
 	// Execute
-	err := exec.Run(context.Background(), input, output)
+	err := exec.RunInputs(ctx, inputs, output)
 
 	// Handle exit error
 	if err != nil {
 		if exitErr, ok := err.(*vm.ExitError); ok {
 			if exitErr.Code != 0 {
-				return outputBuf.String(), &ExitError{Code: exitErr.Code}
+				var output string
+				if outputBuf != nil {
+					output = outputBuf.String()
+				}
+				return output, &ExitError{Code: exitErr.Code}
 			}
 			err = nil
 		}
 	}
 
 	if err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil && errors.Is(err, ctxErr) {
+			return "", err
+		}
 		return "", &RuntimeError{Message: err.Error()}
 	}
 
@@ -184,16 +336,52 @@ func (p *Program) Source() string {
 	return p.source
 }
 
+// writeProfile writes source to name, prefixing each line with the
+// number of times statements and patterns starting on it were executed.
+func writeProfile(name, source string, counts []int) error {
+	var buf bytes.Buffer
+	for i, text := range strings.Split(strings.TrimSuffix(source, "\n"), "\n") {
+		if line := i + 1; line < len(counts) && counts[line] > 0 {
+			fmt.Fprintf(&buf, "%10d  %s\n", counts[line], text)
+		} else {
+			fmt.Fprintf(&buf, "%10s  %s\n", "", text)
+		}
+	}
+	return os.WriteFile(name, buf.Bytes(), 0o644)
+}
+
 // createVM creates a new VM with the specified configuration.
 func (p *Program) createVM(config *Config) *vm.VM {
+	return vm.NewWithConfig(p.compiled, newVMConfig(config))
+}
+
+// newVMConfig derives the VM configuration from config.
+func newVMConfig(config *Config) vm.VMConfig {
 	// Determine POSIX regex mode (default: true for AWK compatibility)
 	posixRegex := true
 	if config.POSIXRegex != nil {
 		posixRegex = *config.POSIXRegex
 	}
 
-	vmConfig := vm.VMConfig{POSIXRegex: posixRegex}
-	return vm.NewWithConfig(p.compiled, vmConfig)
+	return vm.VMConfig{
+		POSIXRegex:         posixRegex,
+		PreserveDelimiters: config.PreserveDelimiters,
+		Now:                config.Now,
+		MaxOutputFiles:     config.MaxOutputFiles,
+		MaxSlurpSize:       config.MaxSlurpSize,
+		RandSeed:           config.RandSeed,
+		Environ:            config.Environ,
+		Arrays:             config.Arrays,
+		SubsepSafe:         config.SubsepSafe,
+		Chars:              config.Chars,
+		ThousandsSep:       config.ThousandsSep,
+		TrimFields:         config.TrimFields,
+		SqueezeDelimiters:  config.SqueezeDelimiters,
+		EagerFields:        config.EagerFields,
+		InputMode:          config.InputMode,
+		Header:             config.Header,
+		OutputMode:         config.OutputMode,
+	}
 }
 
 // putVM returns a VM to the pool for reuse.
@@ -0,0 +1,64 @@
+package uawk
+
+import (
+	"errors"
+
+	"github.com/kolkov/uawk/internal/runtime"
+)
+
+// Regex is a compiled regular expression using the same engine and
+// semantics as AWK patterns (dot matches newline).
+// It is safe for concurrent use.
+type Regex struct {
+	re *runtime.Regex
+}
+
+// CompileRegex compiles pattern the way uawk compiles AWK regexes.
+// If posix is true, uses POSIX leftmost-longest matching; otherwise uses
+// leftmost-first matching, which also allows back-references and lookahead.
+// Patterns using those are matched by backtracking with a work budget;
+// a search that exceeds it panics, where a program run reports an error.
+//
+// Invalid patterns return a [RegexError] describing the problem and its
+// position, which makes it useful for validating dynamic patterns before
+// running a program.
+//
+// Example:
+//
+//	_, err := uawk.CompileRegex("[abcd", true)
+//	// err: missing ] at position 5
+func CompileRegex(pattern string, posix bool) (*Regex, error) {
+	re, err := runtime.CompileWithConfig(pattern, runtime.RegexConfig{POSIX: posix})
+	if err != nil {
+		var rerr *runtime.RegexError
+		if errors.As(err, &rerr) {
+			return nil, &RegexError{
+				Pattern:  rerr.Pattern,
+				Position: rerr.Pos,
+				Message:  rerr.Msg,
+			}
+		}
+		return nil, &RegexError{Pattern: pattern, Message: err.Error()}
+	}
+	return &Regex{re: re}, nil
+}
+
+// String returns the source pattern.
+func (r *Regex) String() string {
+	return r.re.Pattern()
+}
+
+// IsPOSIX reports whether r uses POSIX leftmost-longest matching.
+func (r *Regex) IsPOSIX() bool {
+	return r.re.IsPOSIX()
+}
+
+// MatchString reports whether s contains any match of r.
+func (r *Regex) MatchString(s string) bool {
+	return r.re.MatchString(s)
+}
+
+// FindStringIndex returns the start and end of the first match in s, or nil.
+func (r *Regex) FindStringIndex(s string) []int {
+	return r.re.FindStringIndex(s)
+}
@@ -1,15 +1,32 @@
 package uawk
 
 import (
+	"context"
 	"io"
 
+	"github.com/kolkov/uawk/internal/build"
 	"github.com/kolkov/uawk/internal/compiler"
 	"github.com/kolkov/uawk/internal/parser"
 	"github.com/kolkov/uawk/internal/semantic"
 )
 
-// Version is the uawk version string.
-const Version = "0.1.0"
+// Version is the uawk version string, e.g. "0.3.0". Release builds set it
+// at link time; otherwise it is the uawk module version from the binary's
+// build information, or "dev" if there is none.
+var Version = build.Version
+
+// BuildInfo returns the uawk version, commit and build date. Release builds
+// have them set at link time; commit and date are "none" and "unknown"
+// otherwise.
+func BuildInfo() (version, commit, date string) {
+	return build.Version, build.Commit, build.Date
+}
+
+// RegexEngine returns the name of the regex engine, with its module version
+// when the binary carries build information (e.g. "coregex v0.10.6").
+func RegexEngine() string {
+	return build.RegexEngine()
+}
 
 // Run executes an AWK program with the given input.
 // This is a convenience function for one-off execution.
@@ -28,13 +45,23 @@ const Version = "0.1.0"
 //	output, err := uawk.Run(`{ print $1 }`, strings.NewReader("hello world"), nil)
 //	// output: "hello\n"
 func Run(program string, input io.Reader, config *Config) (string, error) {
-	prog, err := Compile(program)
+	prog, err := compileProgram(program, config)
 	if err != nil {
 		return "", err
 	}
 	return prog.Run(input, config)
 }
 
+// RunContext is like Run but stops when ctx is cancelled; see
+// Program.RunContext.
+func RunContext(ctx context.Context, program string, input io.Reader, config *Config) (string, error) {
+	prog, err := compileProgram(program, config)
+	if err != nil {
+		return "", err
+	}
+	return prog.RunContext(ctx, input, config)
+}
+
 // Compile parses and compiles an AWK program for execution.
 // The returned Program can be executed multiple times with different inputs.
 //
@@ -47,8 +74,35 @@ func Run(program string, input io.Reader, config *Config) (string, error) {
 //	output1, _ := prog.Run(file1, nil)
 //	output2, _ := prog.Run(file2, nil)
 func Compile(program string) (*Program, error) {
+	return compileProgram(program, nil)
+}
+
+// CompileWithConfig is like Compile but applies the compile-time settings
+// of config, which may be nil: Config.StrictArity and Config.POSIX.
+func CompileWithConfig(program string, config *Config) (*Program, error) {
+	return compileProgram(program, config)
+}
+
+// compileProgram compiles program with the compile-time settings of
+// config, which may be nil.
+func compileProgram(program string, config *Config) (*Program, error) {
+	opts := config.compileOptions()
+	compiled, err := compileSource(program, false, opts)
+	if err != nil {
+		return nil, err
+	}
+	return &Program{
+		compiled: compiled,
+		source:   program,
+		opts:     opts,
+	}, nil
+}
+
+// compileSource parses and compiles program to bytecode, with Line
+// opcodes for Config.ProfileFile if profile is set.
+func compileSource(program string, profile bool, opts compileOptions) (*compiler.Program, error) {
 	// Parse
-	astProg, err := parser.Parse(program)
+	astProg, err := parser.ParseWithOptions([]byte(program), parser.Options{POSIX: opts.posix})
 	if err != nil {
 		// Convert parser error to public type
 		if pe, ok := err.(*parser.ParseError); ok {
@@ -70,7 +124,7 @@ func Compile(program string) (*Program, error) {
 	}
 
 	// Resolve symbols
-	resolved, err := semantic.Resolve(astProg)
+	resolved, err := semantic.ResolveWithOptions(astProg, semantic.Options{ExtraArgs: !opts.strictArity})
 	if err != nil {
 		return nil, &CompileError{Message: err.Error()}
 	}
@@ -81,7 +135,11 @@ func Compile(program string) (*Program, error) {
 	}
 
 	// Compile to bytecode
-	compiled, err := compiler.Compile(astProg, resolved)
+	compile := compiler.Compile
+	if profile {
+		compile = compiler.CompileProfiled
+	}
+	compiled, err := compile(astProg, resolved)
 	if err != nil {
 		return nil, &CompileError{Message: err.Error()}
 	}
@@ -89,10 +147,37 @@ func Compile(program string) (*Program, error) {
 	// Apply peephole optimizations (fuse common instruction patterns)
 	compiler.OptimizeProgram(compiled)
 
-	return &Program{
-		compiled: compiled,
-		source:   program,
-	}, nil
+	return compiled, nil
+}
+
+// Lint compiles an AWK program and reports likely mistakes in it, such as
+// printf or sprintf calls whose constant format doesn't match the number
+// or type of their arguments. It returns an error only if the program
+// doesn't compile; a call passing a function extra arguments is reported
+// as a warning, since Config.StrictArity may allow it.
+//
+// Example:
+//
+//	warnings, err := uawk.Lint(`{ printf "%s %s\n", $1 }`)
+//	// warnings[0]: warning at 1:10: printf format "%s %s\n" has 2 conversions but only 1 arguments
+func Lint(program string) ([]*Warning, error) {
+	if _, err := compileSource(program, false, compileOptions{}); err != nil {
+		return nil, err
+	}
+	astProg, err := parser.Parse(program)
+	if err != nil {
+		return nil, &ParseError{Message: err.Error()}
+	}
+
+	var warnings []*Warning
+	for _, w := range semantic.Lint(astProg) {
+		warnings = append(warnings, &Warning{
+			Line:    w.Pos.Line,
+			Column:  w.Pos.Column,
+			Message: w.Message,
+		})
+	}
+	return warnings, nil
 }
 
 // Exec is a simplified interface for running an AWK program.
@@ -105,7 +190,7 @@ func Compile(program string) (*Program, error) {
 //
 //	err := uawk.Exec(`{ print toupper($0) }`, os.Stdin, os.Stdout, nil)
 func Exec(program string, input io.Reader, output io.Writer, config *Config) error {
-	prog, err := Compile(program)
+	prog, err := compileProgram(program, config)
 	if err != nil {
 		return err
 	}
@@ -1,9 +1,17 @@
 package uawk_test
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/kolkov/uawk"
 )
@@ -271,6 +279,1538 @@ func TestConfigVariables(t *testing.T) {
 	}
 }
 
+func TestConfigArrays(t *testing.T) {
+	prog := uawk.MustCompile(`
+	BEGIN { print length(limit), ("carol" in limit) }
+	$2 > limit[$1] { print $1, "over by", $2 - limit[$1] }
+	END { limit["alice"] = 0 }`)
+	limits := map[string]string{"alice": "10", "bob": "3"}
+	input := "alice 12\nbob 2\nalice 9\nbob 5\n"
+
+	for _, parallel := range []int{0, 2} {
+		config := &uawk.Config{
+			Arrays: map[string]map[string]string{
+				"limit":  limits,
+				"unused": {"x": "1"},
+			},
+			Parallel: parallel,
+		}
+		got, err := prog.Run(strings.NewReader(input), config)
+		if err != nil {
+			t.Fatalf("Run() error = %v", err)
+		}
+		// Values compare as numbers: "9" > "10" as strings
+		if want := "2 0\nalice over by 2\nbob over by 2\n"; got != want {
+			t.Errorf("Run() with Parallel %d = %q, want %q", parallel, got, want)
+		}
+	}
+
+	// The program's changes don't reach the caller's maps
+	if limits["alice"] != "10" || len(limits) != 2 {
+		t.Errorf("limits = %v, want it unchanged", limits)
+	}
+
+	// Seeded values are counted once, not once per parallel worker
+	counter := uawk.MustCompile(`{ count[$1]++ } END { print count["a"] }`)
+	config := &uawk.Config{
+		Arrays:    map[string]map[string]string{"count": {"a": "10"}},
+		Parallel:  4,
+		ChunkSize: 64,
+	}
+	got, err := counter.Run(strings.NewReader(strings.Repeat("a\n", 1000)), config)
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if want := "1010\n"; got != want {
+		t.Errorf("Run() with Parallel 4 = %q, want %q", got, want)
+	}
+}
+
+func TestProgramRunResult(t *testing.T) {
+	prog := uawk.MustCompile(`{ count[$1]++; total[$1] += $2 } END { print NR }`)
+	input := "a 1.5\nb 2\na 0.25\n"
+
+	res, err := prog.RunResult(strings.NewReader(input), &uawk.Config{Parallel: 4})
+	if err != nil {
+		t.Fatalf("RunResult() error = %v", err)
+	}
+	if res.Output != "3\n" {
+		t.Errorf("Output = %q, want %q", res.Output, "3\n")
+	}
+	if got, want := res.Array("count"), map[string]string{"a": "2", "b": "1"}; !reflect.DeepEqual(got, want) {
+		t.Errorf(`Array("count") = %v, want %v`, got, want)
+	}
+	if got, want := res.Array("total"), map[string]string{"a": "1.75", "b": "2"}; !reflect.DeepEqual(got, want) {
+		t.Errorf(`Array("total") = %v, want %v`, got, want)
+	}
+	if got := res.Array("missing"); got != nil {
+		t.Errorf(`Array("missing") = %v, want nil`, got)
+	}
+
+	// Seeded arrays come back with the program's changes
+	seeded := uawk.MustCompile(`{ stock[$1] -= $2 } $2 > 5 { exit 3 }`)
+	config := &uawk.Config{Arrays: map[string]map[string]string{"stock": {"x": "10", "y": "4"}}}
+	res, err = seeded.RunResult(strings.NewReader("x 3\ny 1\nx 9\ny 1\n"), config)
+	var exitErr *uawk.ExitError
+	if !errors.As(err, &exitErr) || exitErr.Code != 3 {
+		t.Fatalf("RunResult() error = %v, want exit status 3", err)
+	}
+	if got, want := res.Array("stock"), map[string]string{"x": "-2", "y": "3"}; !reflect.DeepEqual(got, want) {
+		t.Errorf(`Array("stock") = %v, want %v`, got, want)
+	}
+
+	if _, err := prog.RunResult(nil, &uawk.Config{Args: []string{"uawk", "/nonexistent/file"}}); err == nil {
+		t.Error("RunResult() with a missing file: expected error")
+	}
+}
+
+func TestProgramWithConfig(t *testing.T) {
+	prog := uawk.MustCompile(`{ sum += $2 } END { print prefix sum unit["w"] }`)
+	config := &uawk.Config{
+		FS:        ",",
+		Variables: map[string]string{"prefix": "total="},
+		Arrays:    map[string]map[string]string{"unit": {"w": "kg"}},
+	}
+	bound := prog.WithConfig(config)
+
+	// Changing the caller's config afterwards, even the contents of its
+	// maps, does not affect the binding
+	config.FS = ";"
+	config.Variables["prefix"] = "changed="
+	config.Arrays["unit"]["w"] = "lb"
+
+	for _, tt := range []struct{ in, want string }{
+		{"a,1\nb,2\n", "total=3kg\n"},
+		{"x,10\n", "total=10kg\n"},
+		{"", "total=kg\n"},
+	} {
+		got, err := bound.Run(strings.NewReader(tt.in))
+		if err != nil {
+			t.Fatalf("Run(%q) error = %v", tt.in, err)
+		}
+		if got != tt.want {
+			t.Errorf("Run(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+
+	// The program itself keeps running with whatever config it is given
+	if got, _ := prog.Run(strings.NewReader("a 4\n"), nil); got != "4\n" {
+		t.Errorf("unbound Run() = %q, want %q", got, "4\n")
+	}
+	if got, _ := prog.WithConfig(nil).Run(strings.NewReader("a 5\n")); got != "5\n" {
+		t.Errorf("WithConfig(nil).Run() = %q, want %q", got, "5\n")
+	}
+
+	// Concurrent runs share the binding safely
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if got, err := bound.Run(strings.NewReader("a,1\nb,1\n")); err != nil || got != "total=2kg\n" {
+				t.Errorf("concurrent Run() = %q, %v", got, err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := bound.RunContext(ctx, strings.NewReader("a,1\n")); !errors.Is(err, context.Canceled) {
+		t.Errorf("RunContext() with cancelled context error = %v, want context.Canceled", err)
+	}
+}
+
+func TestConfigArgsForIn(t *testing.T) {
+	prog := `BEGIN { for (i in ARGV) n++; for (i = 0; i < ARGC; i++) s = s " " ARGV[i]; print n, ARGC s }`
+	config := &uawk.Config{Args: []string{"uawk", "x=1", "y=2"}}
+	got, err := uawk.Run(prog, nil, config)
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if want := "3 3 uawk x=1 y=2\n"; got != want {
+		t.Errorf("Run() = %q, want %q", got, want)
+	}
+}
+
+// writeInputFiles writes each content to a file in a temporary directory
+// and returns the file paths.
+func writeInputFiles(t *testing.T, contents ...string) []string {
+	t.Helper()
+	dir := t.TempDir()
+	paths := make([]string, len(contents))
+	for i, content := range contents {
+		paths[i] = filepath.Join(dir, fmt.Sprintf("in%d", i+1))
+		if err := os.WriteFile(paths[i], []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return paths
+}
+
+func TestConfigArgsFiles(t *testing.T) {
+	files := writeInputFiles(t, "a\nb\n", "c\n", "d\n", "x\ny")
+
+	tests := []struct {
+		name string
+		prog string
+		args []string
+		want string
+	}{
+		{
+			name: "files in order",
+			prog: `{ print $0 }`,
+			args: []string{files[0], files[1]},
+			want: "a\nb\nc\n",
+		},
+		{
+			name: "FILENAME and FNR per file",
+			prog: `{ n = split(FILENAME, p, "/"); print p[n], FNR, NR }`,
+			args: []string{files[0], files[1], files[2]},
+			want: "in1 1 1\nin1 2 2\nin2 1 3\nin3 1 4\n",
+		},
+		{
+			name: "stdin FILENAME",
+			prog: `{ print FILENAME, FNR, NR }`,
+			args: []string{files[1], "-"},
+			want: files[1] + " 1 1\n- 1 2\n",
+		},
+		{
+			name: "file without final newline",
+			prog: `{ print NR, $0 } END { print NR }`,
+			args: []string{files[3], files[1]},
+			want: "1 x\n2 y\n3 c\n3\n",
+		},
+		{
+			name: "END only counts records",
+			prog: `END { print NR }`,
+			args: []string{files[0], files[3]},
+			want: "4\n",
+		},
+		{
+			name: "nextfile skips rest of file",
+			prog: `{ print FNR, NR, $0; nextfile } END { print NR }`,
+			args: []string{files[0], files[0], files[1]},
+			want: "1 1 a\n1 2 a\n1 3 c\n3\n",
+		},
+		{
+			name: "nextfile in function",
+			prog: `function skip() { nextfile } { print $0; skip() } END { print NR }`,
+			args: []string{files[0], files[1]},
+			want: "a\nc\n2\n",
+		},
+		{
+			name: "delete ARGV skips file",
+			prog: `BEGIN { delete ARGV[1] } { print $0 }`,
+			args: []string{files[0], files[1]},
+			want: "c\n",
+		},
+		{
+			name: "empty ARGV entry skips file",
+			prog: `BEGIN { ARGV[2] = "" } { print $0 }`,
+			args: []string{files[0], files[1]},
+			want: "a\nb\n",
+		},
+		{
+			name: "append to ARGV",
+			prog: `BEGIN { ARGV[ARGC++] = "` + files[2] + `" } { print $0 }`,
+			args: []string{files[1]},
+			want: "c\nd\n",
+		},
+		{
+			name: "lower ARGC",
+			prog: `BEGIN { ARGC = 2 } { print $0 }`,
+			args: []string{files[1], files[2]},
+			want: "c\n",
+		},
+		{
+			name: "assignment operands",
+			prog: `{ print x, $0 }`,
+			args: []string{"x=1", files[1], "x=2", files[2]},
+			want: "1 c\n2 d\n",
+		},
+		{
+			name: "stdin operand",
+			prog: `{ print $0 }`,
+			args: []string{files[1], "-", files[2]},
+			want: "c\nstdin\nd\n",
+		},
+		{
+			name: "only assignments reads stdin",
+			prog: `{ print x, $0 }`,
+			args: []string{"x=v"},
+			want: "v stdin\n",
+		},
+		{
+			name: "getline crosses files",
+			prog: `BEGIN { while ((getline line) > 0) print line }`,
+			args: []string{files[1], files[2]},
+			want: "c\nd\n",
+		},
+		{
+			name: "BEGIN only reads no input",
+			prog: `BEGIN { print "begin" }`,
+			args: []string{"/nonexistent/file"},
+			want: "begin\n",
+		},
+	}
+
+	for _, tt := range tests {
+		for _, parallel := range []int{0, 4} {
+			t.Run(fmt.Sprintf("%s/parallel=%d", tt.name, parallel), func(t *testing.T) {
+				config := &uawk.Config{Args: append([]string{"uawk"}, tt.args...), Parallel: parallel}
+				got, err := uawk.Run(tt.prog, strings.NewReader("stdin\n"), config)
+				if err != nil {
+					t.Fatalf("Run() error = %v", err)
+				}
+				if got != tt.want {
+					t.Errorf("Run() = %q, want %q", got, tt.want)
+				}
+			})
+		}
+	}
+}
+
+func TestConfigInputs(t *testing.T) {
+	config := &uawk.Config{
+		Inputs: []uawk.NamedReader{
+			{Name: "first", R: strings.NewReader("a\nb\n")},
+			{Name: "second", R: strings.NewReader("c\n")},
+		},
+	}
+	got, err := uawk.Run(`{ print FILENAME, FNR, NR, $0 } END { print FILENAME, NR }`, nil, config)
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	want := "first 1 1 a\nfirst 2 2 b\nsecond 1 3 c\nsecond 3\n"
+	if got != want {
+		t.Errorf("Run() = %q, want %q", got, want)
+	}
+
+	// An input without a final newline ends its last record, in parallel too
+	for _, parallel := range []int{0, 4} {
+		config := &uawk.Config{
+			Inputs: []uawk.NamedReader{
+				{Name: "first", R: strings.NewReader("a\nb")},
+				{Name: "second", R: strings.NewReader("c\n")},
+			},
+			Parallel:  parallel,
+			ChunkSize: 2,
+		}
+		got, err := uawk.Run(`{ print NR, $0 } END { print NR }`, strings.NewReader("d\n"), config)
+		if err != nil {
+			t.Fatalf("Run() error = %v", err)
+		}
+		if want := "1 a\n2 b\n3 c\n4 d\n4\n"; got != want {
+			t.Errorf("Run() with Parallel %d = %q, want %q", parallel, got, want)
+		}
+	}
+}
+
+func TestConfigInputsWithFileOperands(t *testing.T) {
+	files := writeInputFiles(t, "from file\n")
+	config := &uawk.Config{
+		Args:   []string{"uawk", files[0]},
+		Inputs: []uawk.NamedReader{{Name: "ignored", R: strings.NewReader("from reader\n")}},
+	}
+	got, err := uawk.Run(`{ print }`, nil, config)
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if got != "from file\n" {
+		t.Errorf("Run() = %q, want only the file operand to be read", got)
+	}
+}
+
+func TestConfigMaxOutputFiles(t *testing.T) {
+	dir := t.TempDir()
+	config := &uawk.Config{
+		Variables:      map[string]string{"dir": dir},
+		MaxOutputFiles: 2,
+	}
+	var input strings.Builder
+	for i := 1; i <= 20; i++ {
+		fmt.Fprintln(&input, i)
+	}
+	_, err := uawk.Run(`{ print > (dir "/mod" ($1 % 5)) }`, strings.NewReader(input.String()), config)
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+
+	for m := 0; m < 5; m++ {
+		content, err := os.ReadFile(filepath.Join(dir, fmt.Sprintf("mod%d", m)))
+		if err != nil {
+			t.Fatalf("ReadFile() error = %v", err)
+		}
+		var want strings.Builder
+		for i := 1; i <= 20; i++ {
+			if i%5 == m {
+				fmt.Fprintln(&want, i)
+			}
+		}
+		if string(content) != want.String() {
+			t.Errorf("mod%d = %q, want %q", m, content, want.String())
+		}
+	}
+}
+
+func TestRedirectPerRecord(t *testing.T) {
+	t.Chdir(t.TempDir())
+	input := "a 1\nb 2\na 3\nc 4\n"
+	_, err := uawk.Run(`
+		{ print > $1 }
+		{ print $2 > ("out-" NR) }
+		{ printf "%s\n", $2 > ($1 ".txt") }
+	`, strings.NewReader(input), nil)
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+
+	want := map[string]string{
+		"a":     "a 1\na 3\n",
+		"b":     "b 2\n",
+		"c":     "c 4\n",
+		"out-1": "1\n",
+		"out-2": "2\n",
+		"out-3": "3\n",
+		"out-4": "4\n",
+		"a.txt": "1\n3\n",
+		"b.txt": "2\n",
+		"c.txt": "4\n",
+	}
+	for name, content := range want {
+		got, err := os.ReadFile(name)
+		if err != nil {
+			t.Fatalf("ReadFile() error = %v", err)
+		}
+		if string(got) != content {
+			t.Errorf("%s = %q, want %q", name, got, content)
+		}
+	}
+}
+
+func TestRedirectFlushOnExit(t *testing.T) {
+	var input strings.Builder
+	for i := 1; i <= 1000; i++ {
+		fmt.Fprintln(&input, i)
+	}
+
+	tests := []struct {
+		name    string
+		src     string
+		lines   int // Lines expected in each output
+		wantErr bool
+	}{
+		{"end of input", `{ print > out; print | ("cat > " pipe) }`, 1000, false},
+		{"exit mid-stream", `{ print > out; print | ("cat > " pipe) } $1 == 500 { exit }`, 500, false},
+		{"exit code mid-stream", `{ print > out; print | ("cat > " pipe) } $1 == 500 { exit 2 }`, 500, true},
+		{"exit in BEGIN", `BEGIN { for (i = 1; i <= 500; i++) { print i > out; print i | ("cat > " pipe) }; exit }`, 500, false},
+		{"exit in END", `END { for (i = 1; i <= 500; i++) { print i > out; print i | ("cat > " pipe) }; exit 1 }`, 500, true},
+		{"runtime error", `{ print > out; print | ("cat > " pipe) } $1 == 500 { print 1 / 0 }`, 500, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			out, pipe := filepath.Join(dir, "out"), filepath.Join(dir, "pipe")
+			config := &uawk.Config{
+				Variables: map[string]string{"out": out, "pipe": pipe},
+				Output:    io.Discard,
+			}
+			_, err := uawk.Run(tt.src, strings.NewReader(input.String()), config)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Run() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			var want strings.Builder
+			for i := 1; i <= tt.lines; i++ {
+				fmt.Fprintln(&want, i)
+			}
+			for _, name := range []string{out, pipe} {
+				content, err := os.ReadFile(name)
+				if err != nil {
+					t.Fatalf("ReadFile() error = %v", err)
+				}
+				if string(content) != want.String() {
+					t.Errorf("%s has %d bytes, want %d", filepath.Base(name), len(content), want.Len())
+				}
+			}
+		})
+	}
+}
+
+func TestExitCodeWithOutput(t *testing.T) {
+	var buf strings.Builder
+	got, err := uawk.Run(`BEGIN { print "x"; exit 3 }`, nil, &uawk.Config{Output: &buf})
+	if code, ok := uawk.IsExitError(err); !ok || code != 3 {
+		t.Fatalf("Run() error = %v, want exit code 3", err)
+	}
+	if got != "" || buf.String() != "x\n" {
+		t.Errorf("Run() = %q, output %q, want \"\" and %q", got, buf.String(), "x\n")
+	}
+}
+
+func TestExitStatusMatrix(t *testing.T) {
+	tests := []struct {
+		name string
+		prog string
+		out  string
+		code int // 0 means a nil error
+	}{
+		{"rule exit, no END", `NR == 1 { exit 1 }`, "", 1},
+		{"rule exit, empty END", `NR == 1 { exit 1 } END { }`, "", 1},
+		{"rule exit, END runs", `NR == 1 { exit 1 } END { print "end" }`, "end\n", 1},
+		{"END exit overrides", `NR == 1 { exit 1 } END { exit 2 }`, "", 2},
+		{"END exit 0 overrides", `NR == 1 { exit 1 } END { exit 0 }`, "", 0},
+		{"bare END exit keeps status", `NR == 1 { exit 1 } END { exit }`, "", 1},
+		{"bare exit in function keeps status", `function done() { exit } NR == 1 { exit 4 } END { done() }`, "", 4},
+		{"BEGIN exit, bare END exit", `BEGIN { exit 5 } END { print NR; exit }`, "0\n", 5},
+		{"bare exit only", `NR == 1 { exit } END { print NR }`, "1\n", 0},
+		{"END exit only", `END { exit 6 }`, "", 6},
+		{"rule exit 0", `NR == 2 { exit 0 } END { exit }`, "", 0},
+	}
+	for _, tt := range tests {
+		for _, parallel := range []int{1, 4} {
+			t.Run(fmt.Sprintf("%s/parallel=%d", tt.name, parallel), func(t *testing.T) {
+				config := &uawk.Config{Parallel: parallel}
+				got, err := uawk.Run(tt.prog, strings.NewReader("a\nb\nc\n"), config)
+				if tt.code == 0 {
+					if err != nil {
+						t.Fatalf("Run() error = %v, want nil", err)
+					}
+				} else if code, ok := uawk.IsExitError(err); !ok || code != tt.code {
+					t.Fatalf("Run() error = %v, want exit code %d", err, tt.code)
+				}
+				if got != tt.out {
+					t.Errorf("Run() = %q, want %q", got, tt.out)
+				}
+			})
+		}
+	}
+}
+
+func TestRunContextCancel(t *testing.T) {
+	prog := uawk.MustCompile(`BEGIN { while (("sleep 30; echo late" | getline line) > 0) print line }`)
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err := prog.RunContext(ctx, nil, nil)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("RunContext() error = %v, want context.DeadlineExceeded", err)
+	}
+	if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Errorf("RunContext() took %v after cancellation", elapsed)
+	}
+}
+
+func TestConfigMaxSlurpSize(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "data")
+	if err := os.WriteFile(name, []byte("0123456789"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	src := `BEGIN { s = slurp(f); print length(s), (ERRNO != "") }`
+
+	tests := []struct {
+		limit int64
+		want  string
+	}{
+		{0, "10 0\n"},
+		{10, "10 0\n"},
+		{9, "0 1\n"},
+		{-1, "10 0\n"},
+	}
+	for _, tt := range tests {
+		config := &uawk.Config{
+			Variables:    map[string]string{"f": name},
+			MaxSlurpSize: tt.limit,
+		}
+		got, err := uawk.Run(src, nil, config)
+		if err != nil {
+			t.Fatalf("Run() error = %v", err)
+		}
+		if got != tt.want {
+			t.Errorf("MaxSlurpSize %d: got %q, want %q", tt.limit, got, tt.want)
+		}
+	}
+}
+
+func TestConfigInvalidNumFormat(t *testing.T) {
+	for _, name := range []string{"CONVFMT", "OFMT"} {
+		config := &uawk.Config{Variables: map[string]string{name: "%d"}}
+		_, err := uawk.Run(`BEGIN { print 2.5 }`, nil, config)
+		var rtErr *uawk.RuntimeError
+		if !errors.As(err, &rtErr) || !strings.Contains(err.Error(), "invalid "+name) {
+			t.Errorf("%s=%%d: Run() error = %v, want invalid %s runtime error", name, err, name)
+		}
+	}
+}
+
+func TestConfigTrimFields(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		fs   string
+		in   string
+		want string
+	}{
+		{"comma", `{ print "[" $1 "]", "[" $2 "]", NF }`, ",", " a ,\tb  \n", "[a] [b] 2\n"},
+		{"pipe", `{ print $2 + $3, length($1) }`, "|", "  x  | 1 |2\n", "3 1\n"},
+		{"record untouched", `{ x = $1; print "[" $0 "]" }`, ",", " a , b \n", "[ a , b ]\n"},
+		{"record rebuilt", `{ $2 = "z"; print "[" $0 "]" }`, ",", " a , b , c \n", "[a z c]\n"},
+		{"empty field", `{ print NF, "[" $2 "]" }`, ",", "a,   ,b\n", "3 []\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := &uawk.Config{FS: tt.fs, TrimFields: true}
+			got, err := uawk.Run(tt.src, strings.NewReader(tt.in), config)
+			if err != nil {
+				t.Fatalf("Run() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestConfigSqueezeDelimiters(t *testing.T) {
+	tests := []struct {
+		name    string
+		src     string
+		fs      string
+		in      string
+		want    string
+		squeeze string
+	}{
+		{"adjacent", `{ print NF, $2 }`, ":", "a::b\n", "3 \n", "2 b\n"},
+		{"long run", `{ print NF, $3 }`, ",", "a,,,,b,c\n", "6 \n", "3 c\n"},
+		{"ends", `{ print NF, $1 }`, ":", "::a:b::\n", "6 \n", "2 a\n"},
+		{"only separators", `{ print NF }`, ":", ":::\n", "4\n", "0\n"},
+		{"NF alone", `{ print NF }`, "\t", "a\t\tb\n", "3\n", "2\n"},
+		{"rebuilt", `BEGIN { OFS = "-" } { $1 = $1; print }`, ":", "a::b\n", "a--b\n", "a-b\n"},
+		{"split unaffected", `{ print split($0, p) }`, ":", "a::b\n", "3\n", "3\n"},
+		{"regex FS unaffected", `{ print NF }`, ":+|;", "a::b;;c\n", "4\n", "4\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, squeeze := range []bool{false, true} {
+				config := &uawk.Config{FS: tt.fs, SqueezeDelimiters: squeeze}
+				got, err := uawk.Run(tt.src, strings.NewReader(tt.in), config)
+				if err != nil {
+					t.Fatalf("Run() error = %v", err)
+				}
+				want := tt.want
+				if squeeze {
+					want = tt.squeeze
+				}
+				if got != want {
+					t.Errorf("squeeze %v: got %q, want %q", squeeze, got, want)
+				}
+			}
+		})
+	}
+
+	t.Run("preserve delimiters", func(t *testing.T) {
+		config := &uawk.Config{FS: ":", SqueezeDelimiters: true, PreserveDelimiters: true}
+		got, err := uawk.Run(`{ $2 = "X"; print NF, $0 }`, strings.NewReader(":a::b:\n"), config)
+		if err != nil {
+			t.Fatalf("Run() error = %v", err)
+		}
+		if want := "2 :a::X:\n"; got != want {
+			t.Errorf("got %q, want %q", got, want)
+		}
+	})
+}
+
+func TestConfigInputMode(t *testing.T) {
+	tests := []struct {
+		name string
+		mode string
+		in   string
+		want string
+	}{
+		{"csv", "csv", "name,\"a,b\",\"line1\nline2\"\n", "3|name|a,b|line1\nline2\n"},
+		{"tsv", "tsv", "name\ta,b\tline1\\nline2\n", "3|name|a,b|line1\nline2\n"},
+		{"default", "", "name,\"a,b\"\n", "1|name,\"a,b\"||\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := &uawk.Config{InputMode: tt.mode}
+			got, err := uawk.Run(`{ print NF "|" $1 "|" $2 "|" $3 }`, strings.NewReader(tt.in), config)
+			if err != nil {
+				t.Fatalf("Run() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	t.Run("parallel", func(t *testing.T) {
+		config := &uawk.Config{InputMode: "csv", Parallel: 4}
+		got, err := uawk.Run(`{ n += NF } END { print NR, n }`, strings.NewReader("a,\"b\nc\"\nd,e\n"), config)
+		if err != nil {
+			t.Fatalf("Run() error = %v", err)
+		}
+		if want := "2 4\n"; got != want {
+			t.Errorf("got %q, want %q", got, want)
+		}
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		_, err := uawk.Run(`{ print }`, strings.NewReader("a\n"), &uawk.Config{InputMode: "json"})
+		var rtErr *uawk.RuntimeError
+		if !errors.As(err, &rtErr) {
+			t.Errorf("Run() error = %v, want *uawk.RuntimeError", err)
+		}
+	})
+}
+
+func TestConfigOutputMode(t *testing.T) {
+	in := "name,\"a,b\",\"say \"\"hi\"\"\"\n"
+	config := &uawk.Config{InputMode: "csv", OutputMode: "csv"}
+	got, err := uawk.Run(`{ print $3, $2, $1; print }`, strings.NewReader(in), config)
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if want := "\"say \"\"hi\"\"\",\"a,b\",name\n" + in; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	_, err = uawk.Run(`BEGIN { print 1 }`, nil, &uawk.Config{OutputMode: "xml"})
+	var rtErr *uawk.RuntimeError
+	if !errors.As(err, &rtErr) {
+		t.Errorf("Run() with invalid OutputMode error = %v, want *uawk.RuntimeError", err)
+	}
+}
+
+func TestConfigHeader(t *testing.T) {
+	config := &uawk.Config{InputMode: "csv", Header: true}
+	got, err := uawk.Run(`{ print @"value" }`, strings.NewReader("id,value\n7,42\n"), config)
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if want := "42\n"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	_, err = uawk.Run(`{ print @"missing" }`, strings.NewReader("id,value\n7,42\n"), config)
+	var rtErr *uawk.RuntimeError
+	if !errors.As(err, &rtErr) {
+		t.Errorf("Run() with unknown field name error = %v, want *uawk.RuntimeError", err)
+	}
+}
+
+func TestConfigEagerFields(t *testing.T) {
+	progs := []string{
+		`{ print NF, $1, $NF }`,
+		`{ FS = ","; print $1 }`,
+		`{ $3 = "x"; print; print NF }`,
+		`{ NF = 1; print }`,
+		`{ getline; print $2 }`,
+	}
+	in := "a b c\nd,e f\ng\nh i,j\n"
+	for _, src := range progs {
+		t.Run(src, func(t *testing.T) {
+			lazy, err := uawk.Run(src, strings.NewReader(in), nil)
+			if err != nil {
+				t.Fatalf("Run() error = %v", err)
+			}
+			eager, err := uawk.Run(src, strings.NewReader(in), &uawk.Config{EagerFields: true})
+			if err != nil {
+				t.Fatalf("Run(EagerFields) error = %v", err)
+			}
+			if eager != lazy {
+				t.Errorf("eager output %q, lazy output %q", eager, lazy)
+			}
+		})
+	}
+}
+
+func TestWholeInputRecord(t *testing.T) {
+	big := strings.Repeat("0123456789abcdef\n", 8192) // 136 KiB
+	tests := []struct {
+		name  string
+		rs    string
+		input string
+	}{
+		{"NUL", "\x00", "a b\nc d\n\n"},
+		{"single char", "@", "a b\nc d"},
+		{"paragraph", "", "a b\nc d"},
+		{"large", "\x00", big},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := uawk.Run(`END { printf "%d %d", NR, length($0) }`, strings.NewReader(tt.input),
+				&uawk.Config{Variables: map[string]string{"RS": tt.rs}})
+			if err != nil {
+				t.Fatalf("Run() error = %v", err)
+			}
+			want := fmt.Sprintf("1 %d", len(tt.input))
+			if tt.rs == "" {
+				want = fmt.Sprintf("1 %d", len(strings.TrimRight(tt.input, "\n")))
+			}
+			if got != want {
+				t.Errorf("got %q, want %q", got, want)
+			}
+		})
+	}
+
+	// Lines longer than bufio.Scanner's 64 KiB default are read whole
+	line := strings.Repeat("x", 100000)
+	got, err := uawk.Run(`{ print length($0) }`, strings.NewReader(line+"\n"+line+"\n"), nil)
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if got != "100000\n100000\n" {
+		t.Errorf("long lines: got %q", got)
+	}
+}
+
+func TestConfigThousandsSep(t *testing.T) {
+	tests := []struct {
+		name    string
+		src     string
+		grouped string
+		plain   string
+	}{
+		{"integer", `BEGIN { print 1234567 }`, "1,234,567\n", "1234567\n"},
+		{"negative", `BEGIN { print -1234567 }`, "-1,234,567\n", "-1234567\n"},
+		{"short", `BEGIN { print 123, -999 }`, "123 -999\n", "123 -999\n"},
+		{"fraction", `BEGIN { print 1234.5 }`, "1234.5\n", "1234.5\n"},
+		{"string", `BEGIN { print "1234567" }`, "1234567\n", "1234567\n"},
+		{"computed", `BEGIN { x = 1000; print x * x }`, "1,000,000\n", "1000000\n"},
+		{"field", `{ print $1, $1 + 0 }`, "9876543 9,876,543\n", "9876543 9876543\n"},
+		{"printf flag", `BEGIN { printf "%'d|%'10d|%-'10d|%d\n", -1234567, 12345, 12345, 12345 }`,
+			"-1,234,567|    12,345|12,345    |12345\n", "-1234567|     12345|12345     |12345\n"},
+		{"printf zero pad", `BEGIN { printf "%'010d|%'010d|%-'010d\n", 1234567, -12345, 12345 }`,
+			"01,234,567|-00012,345|12,345    \n", "0001234567|-000012345|12345     \n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for sep, want := range map[string]string{",": tt.grouped, "": tt.plain} {
+				config := &uawk.Config{ThousandsSep: sep}
+				got, err := uawk.Run(tt.src, strings.NewReader("9876543\n"), config)
+				if err != nil {
+					t.Fatalf("Run() error = %v", err)
+				}
+				if got != want {
+					t.Errorf("ThousandsSep %q: got %q, want %q", sep, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestConfigProfileFile(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "profile")
+	src := `function sq(x) {
+	return x * x
+}
+$1 > 1 {
+	for (i = 0; i < 100; i++)
+		sum += sq(i)
+	n++
+}
+END { print sum, n }
+`
+	config := &uawk.Config{ProfileFile: name, Parallel: 4}
+	got, err := uawk.Run(src, strings.NewReader("1\n2\n3\n"), config)
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if got != "656700 2\n" {
+		t.Errorf("Run() = %q, want %q", got, "656700 2\n")
+	}
+
+	data, err := os.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+	srcLines := strings.Split(strings.TrimSuffix(src, "\n"), "\n")
+	if len(lines) != len(srcLines) {
+		t.Fatalf("profile has %d lines, want %d:\n%s", len(lines), len(srcLines), data)
+	}
+	counts := make([]int, len(lines))
+	for i, line := range lines {
+		// Each line is a 10-column count (blank if zero), 2 spaces, source
+		if len(line) < 12 {
+			t.Fatalf("line %d: too short: %q", i+1, line)
+		}
+		if count := strings.TrimSpace(line[:10]); count != "" {
+			if _, err := fmt.Sscan(count, &counts[i]); err != nil {
+				t.Fatalf("line %d: bad count in %q", i+1, line)
+			}
+		}
+		if text := line[12:]; text != srcLines[i] {
+			t.Errorf("line %d: source %q, want %q", i+1, text, srcLines[i])
+		}
+	}
+
+	want := []int{0, 200, 0, 3, 204, 200, 2, 0, 1}
+	for i := range want {
+		if counts[i] != want[i] {
+			t.Errorf("line %d: count %d, want %d\n%s", i+1, counts[i], want[i], data)
+		}
+	}
+}
+
+func TestConfigStdStreams(t *testing.T) {
+	var stderr strings.Builder
+	config := &uawk.Config{Stderr: &stderr}
+	got, err := uawk.Run(`BEGIN {
+		print "a"
+		print "b" > "/dev/stdout"
+		print "x" > "/dev/stderr"
+		printf "%s\n", "y" > "/dev/stderr"
+		print "c"
+	}`, nil, config)
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if got != "a\nb\nc\n" {
+		t.Errorf("output = %q, want %q", got, "a\nb\nc\n")
+	}
+	if stderr.String() != "x\ny\n" {
+		t.Errorf("stderr = %q, want %q", stderr.String(), "x\ny\n")
+	}
+}
+
+func TestGetlineStdin(t *testing.T) {
+	files := writeInputFiles(t, "one\ntwo\n")
+	config := &uawk.Config{Args: []string{"uawk", files[0]}}
+	got, err := uawk.Run(`{ getline line < "/dev/stdin"; print $0, line } END { getline line < "-"; print line }`,
+		strings.NewReader("s1\ns2\ns3\n"), config)
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	want := "one s1\ntwo s2\ns3\n"
+	if got != want {
+		t.Errorf("Run() = %q, want %q", got, want)
+	}
+}
+
+func TestGetlinePlain(t *testing.T) {
+	tests := []struct {
+		name string
+		prog string
+		want string
+	}{
+		{"updates record", `{ r = getline; print NR, FNR, NF, $0, r }`, "2 2 2 b c 1\n3 3 3 d e f 0\n"},
+		{"default action", `{ getline } 1`, "b c\nd e f\n"},
+		{"fields", `NR == 1 { getline; print $1, $2, $NF }`, "b c c\n"},
+		{"eof keeps state", `NR == 1 { while ((r = getline) > 0) n++; print n, r, NR, FNR, NF, $0 }`, "2 0 3 3 3 d e f\n"},
+		{"end", `END { print getline, NR, $0 }`, "0 3 d e f\n"},
+	}
+	files := writeInputFiles(t, "a\nb c\nd e f\n")
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := &uawk.Config{Args: []string{"uawk", files[0]}}
+			got, err := uawk.Run(tt.prog, nil, config)
+			if err != nil {
+				t.Fatalf("Run() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Run() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStreamNRInputFiles(t *testing.T) {
+	files := writeInputFiles(t, "a\nb\n", "c\n")
+	config := &uawk.Config{Args: []string{"uawk", files[0], files[1]}}
+	got, err := uawk.Run(`{ print $0, streamnr(FILENAME), streamnr(ARGV[1]) }`, nil, config)
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	want := "a 1 1\nb 2 2\nc 1 0\n"
+	if got != want {
+		t.Errorf("Run() = %q, want %q", got, want)
+	}
+}
+
+func TestConfigEnviron(t *testing.T) {
+	t.Setenv("UAWK_REAL_VAR", "real")
+	config := &uawk.Config{
+		Environ: map[string]string{"CUSTOM": "injected", "EMPTY": ""},
+	}
+	got, err := uawk.Run(`BEGIN {
+		print ENVIRON["CUSTOM"]
+		print ("PATH" in ENVIRON), ("UAWK_REAL_VAR" in ENVIRON), ("EMPTY" in ENVIRON)
+		for (k in ENVIRON) n++
+		print n
+	}`, nil, config)
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	want := "injected\n0 0 1\n2\n"
+	if got != want {
+		t.Errorf("Run() = %q, want %q", got, want)
+	}
+}
+
+func TestLint(t *testing.T) {
+	warnings, err := uawk.Lint("{\n\tprintf \"%s %s\\n\", $1\n\tprintf \"%d\\n\", $1, $2\n}")
+	if err != nil {
+		t.Fatalf("Lint() error = %v", err)
+	}
+	if len(warnings) != 2 {
+		t.Fatalf("Lint() = %v, want 2 warnings", warnings)
+	}
+	if warnings[0].Line != 2 || !strings.Contains(warnings[0].Message, "only 1 arguments") {
+		t.Errorf("warnings[0] = %v, want too few arguments on line 2", warnings[0])
+	}
+	if warnings[1].Line != 3 || !strings.Contains(warnings[1].Message, "extra arguments are ignored") {
+		t.Errorf("warnings[1] = %v, want too many arguments on line 3", warnings[1])
+	}
+
+	if _, err := uawk.Lint(`{ printf "%d" `); err == nil {
+		t.Error("Lint() of invalid program: expected error")
+	}
+}
+
+func TestConfigChars(t *testing.T) {
+	tests := []struct {
+		name  string
+		prog  string
+		bytes string
+		chars string
+	}{
+		{"number", `BEGIN { print length(12345), length(0.1 + 0.2), length(-7) }`, "5 3 2\n", "5 3 2\n"},
+		{"ascii", `BEGIN { print length("hello"), length() }`, "5 0\n", "5 0\n"},
+		{"multibyte", `BEGIN { print length("héllo"), length("日本") }`, "6 6\n", "5 2\n"},
+		{"record", `{ print length(), length($0), length }`, "6 6 6\n", "5 5 5\n"},
+		{"index", `BEGIN { print index("héllo", "l") }`, "4\n", "3\n"},
+		{"substr", `BEGIN { print substr("日本語", 2), substr("héllo", 2, 2) }`, "\x97\xa5\xe6\x9c\xac\xe8\xaa\x9e \xc3\xa9\n", "本語 él\n"},
+		{"match", `BEGIN { print match("wörld", /r/), RSTART, RLENGTH; match("aöb", /ö/); print RSTART, RLENGTH }`, "4 4 1\n2 2\n", "3 3 1\n2 1\n"},
+		{"empty FS", `BEGIN { FS = "" } { print NF, $2 $3, $5 }`, "6 \xc3\xa9 l\n", "5 él o\n"},
+		{"split chars", `BEGIN { print split("日本", a, ""), a[1] a[2] a[3] }`, "6 \xe6\x97\xa5\n", "2 日本\n"},
+		{"printf %c", `BEGIN { printf "%c|%c|%c|%c\n", 65, 233, 256, "éa" }`, "A|\xe9|\x00|\xc3\n", "A|é|Ā|é\n"},
+		{"printf %c invalid", `BEGIN { printf "%c|%c\n", -1, 1114112 }`, "\xff|\x00\n", "\ufffd|\ufffd\n"},
+	}
+
+	for _, tt := range tests {
+		for _, chars := range []bool{false, true} {
+			want := tt.bytes
+			name := tt.name + "/bytes"
+			if chars {
+				want, name = tt.chars, tt.name+"/chars"
+			}
+			t.Run(name, func(t *testing.T) {
+				got, err := uawk.Run(tt.prog, strings.NewReader("héllo\n"), &uawk.Config{Chars: chars})
+				if err != nil {
+					t.Fatalf("Run() error = %v", err)
+				}
+				if got != want {
+					t.Errorf("Run() = %q, want %q", got, want)
+				}
+			})
+		}
+	}
+}
+
+func TestConfigSubsepSafe(t *testing.T) {
+	// ("a\034", "b") and ("a", "\034b") give the same key unless escaped
+	input := "a\034\tb\na\t\034b\n"
+	prog := `{ arr[$1, $2] = NR }
+	END {
+		for (k in arr) n++
+		print n
+		for (k in arr) { split(k, p, SUBSEP); out[arr[k]] = length(p[1]) "," length(p[2]) }
+		for (i = 1; i <= 2; i++) if (i in out) print i, out[i]
+	}`
+
+	tests := []struct {
+		name string
+		safe bool
+		want string
+	}{
+		{"default", false, "1\n2 1,0\n"},
+		{"safe", true, "2\n1 2,1\n2 1,2\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := &uawk.Config{FS: "\t", SubsepSafe: tt.safe}
+			got, err := uawk.Run(prog, strings.NewReader(input), config)
+			if err != nil {
+				t.Fatalf("Run() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Run() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	// Only keys that were escaped are unescaped by split
+	t.Run("split string", func(t *testing.T) {
+		config := &uawk.Config{SubsepSafe: true}
+		got, err := uawk.Run(`BEGIN { print split("a\035b" SUBSEP "c\035" SUBSEP "d", p, SUBSEP), length(p[1]), length(p[2]) }`, nil, config)
+		if err != nil {
+			t.Fatalf("Run() error = %v", err)
+		}
+		if want := "3 3 2\n"; got != want {
+			t.Errorf("Run() = %q, want %q", got, want)
+		}
+	})
+
+	// Keys escaped by parallel workers still split in END
+	t.Run("parallel", func(t *testing.T) {
+		prog := uawk.MustCompile(`{ arr[$1, $2]++ }
+		END { for (k in arr) { split(k, p, SUBSEP); s += length(p[1]) * 10 + length(p[2]) } print s }`)
+		if !prog.CanParallelize("\n").CanParallelize {
+			t.Fatal("program does not run in parallel")
+		}
+		config := &uawk.Config{FS: "\t", SubsepSafe: true, Parallel: 4}
+		got, err := prog.Run(strings.NewReader(input), config)
+		if err != nil {
+			t.Fatalf("Run() error = %v", err)
+		}
+		if want := "33\n"; got != want {
+			t.Errorf("Run() = %q, want %q", got, want)
+		}
+	})
+}
+
+func TestConfigRandSeed(t *testing.T) {
+	seed := int64(7)
+	prog := `BEGIN { print rand(), rand() }`
+	first, err := uawk.Run(prog, nil, &uawk.Config{RandSeed: &seed})
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	second, err := uawk.Run(prog, nil, &uawk.Config{RandSeed: &seed})
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if first != second {
+		t.Errorf("same seed gave %q and %q", first, second)
+	}
+	seeded, err := uawk.Run(`BEGIN { srand(7); print rand(), rand() }`, nil, nil)
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if first != seeded {
+		t.Errorf("RandSeed 7 gave %q, srand(7) gave %q", first, seeded)
+	}
+}
+
+func TestConfigArgsMissingFile(t *testing.T) {
+	config := &uawk.Config{Args: []string{"uawk", "/nonexistent/file"}}
+	_, err := uawk.Run(`{ print }`, nil, config)
+	if err == nil || !strings.Contains(err.Error(), "/nonexistent/file") {
+		t.Errorf("expected error naming the missing file, got %v", err)
+	}
+}
+
+func TestConfigNow(t *testing.T) {
+	fixed := time.Date(2024, time.December, 31, 23, 59, 58, 0, time.UTC)
+	config := &uawk.Config{Now: func() time.Time { return fixed }}
+
+	got, err := uawk.Run(`BEGIN {
+		print now(); print now("YYYY-MM-DD hh:mm:ss")
+		print systime(), strftime("%F %T", systime(), 1)
+		print strftime() == strftime("%a %b %e %H:%M:%S %Z %Y", systime())
+	}`, nil, config)
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	want := "2024-12-31T23:59:58Z\n2024-12-31 23:59:58\n1735689598 2024-12-31 23:59:58\n1\n"
+	if got != want {
+		t.Errorf("Run() = %q, want %q", got, want)
+	}
+}
+
+func TestConfigStrictArity(t *testing.T) {
+	prog := `function f(a) { return a * 2 }
+	BEGIN { n = f(3, x++, arr); arr[1]; print n, x }`
+
+	// Strict by default, as in gawk
+	_, err := uawk.Run(prog, nil, nil)
+	var compileErr *uawk.CompileError
+	if !errors.As(err, &compileErr) || !strings.Contains(err.Error(), `too many arguments in call to "f"`) {
+		t.Errorf("Run() error = %v, want a too many arguments CompileError", err)
+	}
+	strict := true
+	if _, err := uawk.Run(prog, nil, &uawk.Config{StrictArity: &strict}); err == nil {
+		t.Error("Run() with StrictArity true: expected error")
+	}
+
+	// Extra arguments are evaluated, then ignored
+	lenient := false
+	got, err := uawk.Run(prog, nil, &uawk.Config{StrictArity: &lenient})
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if want := "6 1\n"; got != want {
+		t.Errorf("Run() = %q, want %q", got, want)
+	}
+
+	var out strings.Builder
+	if err := uawk.Exec(prog, nil, &out, &uawk.Config{StrictArity: &lenient}); err != nil || out.String() != "6 1\n" {
+		t.Errorf("Exec() = %q, %v, want %q", out.String(), err, "6 1\n")
+	}
+
+	compiled, err := uawk.CompileWithConfig(prog, &uawk.Config{StrictArity: &lenient})
+	if err != nil {
+		t.Fatalf("CompileWithConfig() error = %v", err)
+	}
+	if got, err := compiled.Run(nil, nil); err != nil || got != "6 1\n" {
+		t.Errorf("Program.Run() = %q, %v, want %q", got, err, "6 1\n")
+	}
+	profile := filepath.Join(t.TempDir(), "profile")
+	if got, err := compiled.Run(nil, &uawk.Config{ProfileFile: profile}); err != nil || got != "6 1\n" {
+		t.Errorf("Program.Run() with ProfileFile = %q, %v, want %q", got, err, "6 1\n")
+	}
+	if _, err := uawk.CompileWithConfig(prog, nil); err == nil {
+		t.Error("CompileWithConfig() with nil config: expected error")
+	}
+
+	// Compile has no Config and stays strict
+	if _, err := uawk.Compile(prog); err == nil {
+		t.Error("Compile(): expected error")
+	}
+
+	warnings, err := uawk.Lint(prog)
+	if err != nil {
+		t.Fatalf("Lint() error = %v", err)
+	}
+	if len(warnings) != 1 || !strings.Contains(warnings[0].Message, `"f" called with 3 arguments but declares 1`) {
+		t.Errorf("Lint() = %v, want an extra arguments warning", warnings)
+	}
+}
+
+func TestConfigPOSIX(t *testing.T) {
+	tests := []struct {
+		name string
+		prog string
+		want string // "" means an undefined function error in POSIX mode
+	}{
+		{"hash call", `BEGIN { print hash("md5", "") }`, ""},
+		{"hash variable", `BEGIN { hash = 1; print hash }`, "1\n"},
+		{"hash function", `BEGIN { print hash("md5", "") } function hash(a, s) { return a "-" s }`, "md5-\n"},
+		{"b64enc call", `BEGIN { print b64enc("a") }`, ""},
+		{"b64dec call", `BEGIN { print b64dec("YQ==") }`, ""},
+		{"b64 variables", `BEGIN { b64enc = "a"; b64dec[1]; print b64enc, length(b64dec) }`, "a 1\n"},
+		{"urlenc call", `BEGIN { print urlenc("a b") }`, ""},
+		{"urldec call", `BEGIN { print urldec("a+b") }`, ""},
+		{"urldec function", `function urldec(s) { return "user " s } BEGIN { urlenc = "x"; print urldec(urlenc) }`, "user x\n"},
+		{"now call", `BEGIN { print now("YYYY") }`, ""},
+		{"now variable", `BEGIN { now = 5; print now + 1 }`, "6\n"},
+	}
+	posix := &uawk.Config{POSIX: true}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := uawk.Run(tt.prog, nil, posix)
+			if tt.want == "" {
+				var compileErr *uawk.CompileError
+				if !errors.As(err, &compileErr) || !strings.Contains(err.Error(), "undefined function") {
+					t.Errorf("Run() = %q, %v, want an undefined function CompileError", got, err)
+				}
+				// Without POSIX the extension builtin is called
+				if _, err := uawk.Run(tt.prog, nil, nil); err != nil {
+					t.Errorf("Run() without POSIX error = %v", err)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Errorf("Run() = %q, %v, want %q", got, err, tt.want)
+			}
+		})
+	}
+
+	// Recompiling for a profile keeps the setting
+	prog, err := uawk.CompileWithConfig(`function hash(s) { return "user " s } BEGIN { print hash("x") }`, posix)
+	if err != nil {
+		t.Fatalf("CompileWithConfig() error = %v", err)
+	}
+	profile := filepath.Join(t.TempDir(), "profile")
+	if got, err := prog.Run(nil, &uawk.Config{ProfileFile: profile}); err != nil || got != "user x\n" {
+		t.Errorf("Program.Run() with ProfileFile = %q, %v, want %q", got, err, "user x\n")
+	}
+}
+
+func TestConfigNowSeedsRand(t *testing.T) {
+	fixed := time.Unix(0, 42)
+	config := &uawk.Config{Now: func() time.Time { return fixed }}
+	prog := `BEGIN { a = rand(); print srand(); b = rand(); srand(); print (b == rand()), a }`
+
+	first, err := uawk.Run(prog, nil, config)
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if !strings.HasPrefix(first, "42\n1 ") {
+		t.Errorf("Run() = %q, want srand() to return the injected time and reseed identically", first)
+	}
+
+	// The default rand() seed comes from the clock too
+	second, err := uawk.Run(prog, nil, config)
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if first != second {
+		t.Errorf("runs with a fixed clock differ: %q vs %q", first, second)
+	}
+}
+
+func TestConfigBackrefNonPOSIX(t *testing.T) {
+	noPOSIX := false
+	prog := `/(.)\1/ { print "static", $0 } $0 ~ "([a-z])\\1" { print "dynamic", $0 }`
+	got, err := uawk.Run(prog, strings.NewReader("aabb\nabcd\n"), &uawk.Config{POSIXRegex: &noPOSIX})
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if want := "static aabb\ndynamic aabb\n"; got != want {
+		t.Errorf("Run() = %q, want %q", got, want)
+	}
+
+	// POSIX mode has no back-references: the pattern never matches
+	got, err = uawk.Run(`/(.)\1/ { print }`, strings.NewReader("aabb\n"), nil)
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if got != "" {
+		t.Errorf("Run() = %q, want no output in POSIX mode", got)
+	}
+}
+
+func TestConfigLookaheadNonPOSIX(t *testing.T) {
+	noPOSIX := false
+	prog := `{ print match($0, /[0-9]+(?=px)/), RSTART, RLENGTH, match($0, /[a-z]+(?![a-z:])/), RSTART, RLENGTH }`
+	got, err := uawk.Run(prog, strings.NewReader("width: 10em 25px\n"), &uawk.Config{POSIXRegex: &noPOSIX})
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if want := "13 13 2 10 10 2\n"; got != want {
+		t.Errorf("Run() = %q, want %q", got, want)
+	}
+}
+
+func TestConfigBacktrackLimit(t *testing.T) {
+	noPOSIX := false
+	input := strings.Repeat(strings.Repeat("a", 20000)+"\n", 4)
+	for _, parallel := range []int{0, 4} {
+		_, err := uawk.Run(`/(a)\1.*z/ { n++ } END { print n }`, strings.NewReader(input),
+			&uawk.Config{POSIXRegex: &noPOSIX, Parallel: parallel})
+		if err == nil || !strings.Contains(err.Error(), "backtracking limit exceeded") {
+			t.Errorf("parallel %d: Run() error = %v, want backtracking limit error", parallel, err)
+		}
+	}
+}
+
+func TestCompileRegex(t *testing.T) {
+	re, err := uawk.CompileRegex(`^[a-z]+[0-9]$`, true)
+	if err != nil {
+		t.Fatalf("CompileRegex() error = %v", err)
+	}
+	if !re.MatchString("abc1") || re.MatchString("abc") {
+		t.Error("MatchString() gave wrong result")
+	}
+	if !re.IsPOSIX() || re.String() != `^[a-z]+[0-9]$` {
+		t.Errorf("IsPOSIX() = %v, String() = %q", re.IsPOSIX(), re.String())
+	}
+}
+
+// TestRegexEscapeLevels compares regex literals with dynamic regexes written
+// as strings. A string is unescaped by the lexer before it reaches the regex
+// engine, so the string form needs its backslashes doubled.
+func TestRegexEscapeLevels(t *testing.T) {
+	tests := []struct {
+		name    string
+		literal string // Regex literal, as written between slashes
+		dynamic string // The same regex as an AWK string literal
+		input   string
+		want    string
+	}{
+		{"literal dot", `\.`, `"\\."`, "a.b", "1 1"},
+		{"literal dot no match", `\.`, `"\\."`, "ab", "0 0"},
+		{"plus", `a\+b`, `"a\\+b"`, "a+b", "1 1"},
+		{"plus no repeat", `a\+b`, `"a\\+b"`, "aab", "0 0"},
+		{"dollar", `\$`, `"\\$"`, "x$", "1 1"},
+		{"backslash", `\\`, `"\\\\"`, `a\b`, "1 1"},
+		{"slash", `a\/b`, `"a/b"`, "a/b", "1 1"},
+		{"bracket dot", `[.]`, `"[.]"`, "ab", "0 0"},
+		{"tab string escape", `\t`, `"\t"`, "a\tb", "1 1"},
+		{"tab regex escape", `\t`, `"\\t"`, "a\tb", "1 1"},
+		{"hex string escape", `\x41`, `"\x41"`, "A", "1 1"},
+		{"hex regex escape", `\x41`, `"\\x41"`, "A", "1 1"},
+		{"octal string escape", `\101`, `"\101"`, "A", "1 1"},
+		{"octal regex escape", `\101`, `"\\101"`, "A", "1 1"},
+		{"word boundary", `\bcat\b`, `"\\bcat\\b"`, "a cat", "1 1"},
+		// An unknown string escape loses its backslash: "\." is ".", which
+		// matches any character, unlike the regex literal /\./.
+		{"unknown string escape", `\.`, `"\."`, "ab", "0 1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			src := fmt.Sprintf(`{ print ($0 ~ /%s/), ($0 ~ %s) }`, tt.literal, tt.dynamic)
+			got, err := uawk.Run(src, strings.NewReader(tt.input+"\n"), nil)
+			if err != nil {
+				t.Fatalf("Run(%s) error = %v", src, err)
+			}
+			if got != tt.want+"\n" {
+				t.Errorf("Run(%s) = %q, want %q", src, got, tt.want+"\n")
+			}
+		})
+	}
+}
+
+func TestCompileRegexError(t *testing.T) {
+	tests := []struct {
+		pattern  string
+		posix    bool
+		position int
+		want     string
+	}{
+		{"[abcd", true, 5, "missing ] at position 5"},
+		{"(ab|cd", true, 6, "missing ) at position 6"},
+		{"abc)", true, 3, "unexpected ) at position 3"},
+		{"ab+*", true, 2, "invalid nested repetition operator `+*` at position 2"},
+		{"(.)\\1", true, 3, "invalid escape sequence `\\1` at position 3"},
+		{"(.)\\3", false, 3, "invalid back reference `\\3` at position 3"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.pattern, func(t *testing.T) {
+			_, err := uawk.CompileRegex(tt.pattern, tt.posix)
+			re, ok := err.(*uawk.RegexError)
+			if !ok {
+				t.Fatalf("expected *RegexError, got %T (%v)", err, err)
+			}
+			if re.Position != tt.position {
+				t.Errorf("Position = %d, want %d", re.Position, tt.position)
+			}
+			if err.Error() != tt.want {
+				t.Errorf("Error() = %q, want %q", err.Error(), tt.want)
+			}
+		})
+	}
+}
+
+func TestConfigPreserveDelimiters(t *testing.T) {
+	tests := []struct {
+		name    string
+		program string
+		input   string
+		fs      string
+		want    string
+	}{
+		{
+			name:    "tabs and spaces",
+			program: `{ $2 = "X"; print }`,
+			input:   "a\tb  c\nd  e\tf\n",
+			want:    "a\tX  c\nd  X\tf\n",
+		},
+		{
+			name:    "leading and trailing whitespace",
+			program: `{ $1 = toupper($1); print }`,
+			input:   "  one \t two  \n",
+			want:    "  ONE \t two  \n",
+		},
+		{
+			name:    "new fields use OFS",
+			program: `BEGIN { OFS = "-" } { $4 = "d"; print }`,
+			input:   "a\tb  c\n",
+			want:    "a\tb  c-d\n",
+		},
+		{
+			name:    "NF decrease",
+			program: `{ NF = 2; print }`,
+			input:   "a\tb  c\n",
+			want:    "a\tb\n",
+		},
+		{
+			name:    "CRLF terminator",
+			program: `{ $1 = "x"; print; print "extra" }`,
+			input:   "a b\r\nc d\n",
+			want:    "x b\r\nextra\nx d\nextra\n",
+		},
+		{
+			name:    "print $0 keeps terminator",
+			program: `{ print $0; print $1 }`,
+			input:   "a b\r\n",
+			want:    "a b\r\na\n",
+		},
+		{
+			name:    "values equal to the record use ORS",
+			program: `{ x = $0; print x; print "a b"; print $(0) }`,
+			input:   "a b\r\n",
+			want:    "a b\na b\na b\r\n",
+		},
+		{
+			name:    "regex FS",
+			program: `{ $2 = "X"; print }`,
+			input:   "a, b,c\n",
+			fs:      ", *",
+			want:    "a, X,c\n",
+		},
+		{
+			name:    "FPAT",
+			program: `BEGIN { FPAT = "[^ ,]+" } { $2 = "X"; print }`,
+			input:   "a,  b ,c\n",
+			want:    "a,  X ,c\n",
+		},
+		{
+			name:    "missing final newline uses ORS",
+			program: `{ $1 = "x"; print }`,
+			input:   "a\tb",
+			want:    "x\tb\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := &uawk.Config{FS: tt.fs, PreserveDelimiters: true}
+			got, err := uawk.Run(tt.program, strings.NewReader(tt.input), config)
+			if err != nil {
+				t.Fatalf("Run() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Run() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	// Redirected output ends with ORS
+	out := filepath.Join(t.TempDir(), "out")
+	config := &uawk.Config{PreserveDelimiters: true, Variables: map[string]string{"out": out}}
+	if _, err := uawk.Run(`{ print > out; print "x" > out }`, strings.NewReader("a b\r\n"), config); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if data, err := os.ReadFile(out); err != nil {
+		t.Fatal(err)
+	} else if want := "a b\nx\n"; string(data) != want {
+		t.Errorf("redirected output = %q, want %q", data, want)
+	}
+
+	// Without the option, OFS and ORS are used
+	got, err := uawk.Run(`{ $2 = "X"; print }`, strings.NewReader("a\tb  c\r\n"), nil)
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if want := "a X c\n"; got != want {
+		t.Errorf("Run() = %q, want %q", got, want)
+	}
+}
+
+func TestIndirectCallError(t *testing.T) {
+	programs := []string{
+		`BEGIN { f = "nosuch"; @f(1) }`,
+		`BEGIN { f = "split"; @f("a b") }`,
+		`BEGIN { f = "sqrt"; @f(1, 2) }`,
+		`function g(a) { return a } BEGIN { f = "g"; @f(1, 2) }`,
+		`function g(arr) { arr[1] = 1 } BEGIN { f = "g"; @f(1) }`,
+	}
+	for _, src := range programs {
+		if _, err := uawk.Run(src, nil, nil); err == nil {
+			t.Errorf("expected runtime error for %q", src)
+		}
+	}
+}
+
 func TestExitError(t *testing.T) {
 	_, err := uawk.Run(`BEGIN { exit 42 }`, nil, nil)
 	if err == nil {
@@ -330,6 +1870,24 @@ func BenchmarkRun(b *testing.B) {
 	}
 }
 
+func TestVersion(t *testing.T) {
+	version, commit, date := uawk.BuildInfo()
+	if version == "" || commit == "" || date == "" {
+		t.Fatalf("BuildInfo() = %q, %q, %q, want non-empty values", version, commit, date)
+	}
+	// Test binaries are not built with the release -ldflags, and their
+	// build information has no module version
+	if version != "dev" {
+		t.Errorf("BuildInfo() version = %q, want %q", version, "dev")
+	}
+	if uawk.Version != version {
+		t.Errorf("Version = %q, want %q", uawk.Version, version)
+	}
+	if engine := uawk.RegexEngine(); !strings.HasPrefix(engine, "coregex") {
+		t.Errorf("RegexEngine() = %q, want coregex", engine)
+	}
+}
+
 func BenchmarkCompileAndRun(b *testing.B) {
 	for i := 0; i < b.N; i++ {
 		_, _ = uawk.Run(`{ sum += $1 } END { print sum }`, strings.NewReader("1\n2\n3\n"), nil)